@@ -9,13 +9,31 @@ import (
 
 	"github.com/lucas-remigio/wallet-tracker/cmd/api/middlewares"
 	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/access_token"
 	"github.com/lucas-remigio/wallet-tracker/service/account"
+	"github.com/lucas-remigio/wallet-tracker/service/anomaly"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
 	"github.com/lucas-remigio/wallet-tracker/service/category"
+	"github.com/lucas-remigio/wallet-tracker/service/chat"
+	"github.com/lucas-remigio/wallet-tracker/service/goal"
 	"github.com/lucas-remigio/wallet-tracker/service/investment_calculator"
+	"github.com/lucas-remigio/wallet-tracker/service/login_guard"
+	"github.com/lucas-remigio/wallet-tracker/service/mailer"
+	"github.com/lucas-remigio/wallet-tracker/service/membership"
+	"github.com/lucas-remigio/wallet-tracker/service/oidc"
 	"github.com/lucas-remigio/wallet-tracker/service/openai"
+	"github.com/lucas-remigio/wallet-tracker/service/passkey"
+	"github.com/lucas-remigio/wallet-tracker/service/quick_entry"
+	"github.com/lucas-remigio/wallet-tracker/service/session"
+	"github.com/lucas-remigio/wallet-tracker/service/settings"
 	"github.com/lucas-remigio/wallet-tracker/service/transaction"
 	"github.com/lucas-remigio/wallet-tracker/service/transaction_types"
+	"github.com/lucas-remigio/wallet-tracker/service/trash"
+	"github.com/lucas-remigio/wallet-tracker/service/two_factor"
 	"github.com/lucas-remigio/wallet-tracker/service/user"
+	"github.com/lucas-remigio/wallet-tracker/service/user_token"
 )
 
 type APIServer struct {
@@ -37,16 +55,43 @@ func (s *APIServer) Run() error {
 
 	// Initialize all stores first
 	userStore := user.NewStore(s.db)
+	sessionStore := session.NewStore(s.db)
+	userTokenStore := user_token.NewStore(s.db)
+	twoFactorStore := two_factor.NewStore(s.db)
+	loginGuard := login_guard.NewGuard(login_guard.NewStore(s.db))
+	accessTokenStore := access_token.NewStore(s.db)
+	oidcIdentityStore := oidc.NewStore(s.db)
+	passkeyStore := passkey.NewStore(s.db)
+	mailSender := mailer.NewFromConfig()
 	transactionTypesStore := transaction_types.NewStore(s.db)
 	categoryStore := category.NewStore(s.db)
 	openAiStore := openai.NewClient()
-	accountStore := account.NewStore(s.db, categoryStore, openAiStore)
-	transactionStore := transaction.NewStore(s.db, accountStore)
+	policy := authz.NewPolicy(authz.NewStore(s.db))
+	settingsStore := settings.NewStore(s.db, policy)
+	auditStore := audit.NewStore(s.db)
+	accountStore := account.NewStore(s.db, categoryStore, openAiStore, settingsStore, policy)
+	transactionStore := transaction.NewStore(s.db, accountStore, policy)
 
 	// Now initialize handlers with the stores they need
-	userHandler := user.NewHandler(userStore, accountStore, categoryStore, transactionStore) // Updated this line
+	// every authenticated request checks its session has not been revoked
+	middleware.SetSessionStore(sessionStore)
+	middleware.SetAccessTokenStore(accessTokenStore)
+
+	userHandler := user.NewHandler(userStore, sessionStore, twoFactorStore, loginGuard, passkeyStore, userTokenStore, mailSender, accountStore, categoryStore, transactionStore, auditStore)
 	userHandler.RegisterRoutes(apiV1Router)
 
+	sessionHandler := session.NewHandler(sessionStore)
+	sessionHandler.RegisterRoutes(apiV1Router)
+
+	accessTokenHandler := access_token.NewHandler(accessTokenStore)
+	accessTokenHandler.RegisterRoutes(apiV1Router)
+
+	oidcHandler := oidc.NewHandler(oidc.NewProviders(config.Envs.OIDCProviders), oidcIdentityStore, userStore, sessionStore, twoFactorStore)
+	oidcHandler.RegisterRoutes(apiV1Router)
+
+	twoFactorHandler := two_factor.NewHandler(twoFactorStore, userStore, sessionStore, loginGuard)
+	twoFactorHandler.RegisterRoutes(apiV1Router)
+
 	transactionTypesHandler := transaction_types.NewHandler(transactionTypesStore)
 	transactionTypesHandler.RegisterRoutes(apiV1Router)
 
@@ -59,10 +104,39 @@ func (s *APIServer) Run() error {
 	transactionHandler := transaction.NewHandler(transactionStore)
 	transactionHandler.RegisterRoutes(apiV1Router)
 
+	membershipHandler := membership.NewHandler(membership.NewStore(s.db, policy), userStore, mailSender)
+	membershipHandler.RegisterRoutes(apiV1Router)
+
 	accountStore.SetTransactionStore(transactionStore)
 
+	anomalyStore := anomaly.NewStore(transactionStore)
+	accountStore.SetAnomalyStore(anomalyStore)
+	anomalyHandler := anomaly.NewHandler(anomalyStore)
+	anomalyHandler.RegisterRoutes(apiV1Router)
+
+	settingsHandler := settings.NewHandler(settingsStore)
+	settingsHandler.RegisterRoutes(apiV1Router)
+
+	auditHandler := audit.NewHandler(auditStore)
+	auditHandler.RegisterRoutes(apiV1Router)
+
+	trashHandler := trash.NewHandler(accountStore, transactionStore, categoryStore, int(config.Envs.TrashRetentionDays))
+	trashHandler.RegisterRoutes(apiV1Router)
+	trash.StartPurge(trash.NewStore(s.db), time.Duration(config.Envs.TrashRetentionDays)*24*time.Hour)
+
+	quickEntryStore := quick_entry.NewStore(accountStore, categoryStore, openAiStore, settingsStore)
+	quickEntryHandler := quick_entry.NewHandler(quickEntryStore)
+	quickEntryHandler.RegisterRoutes(apiV1Router)
+
+	chatStore := chat.NewStore(s.db, accountStore, categoryStore, transactionStore, openAiStore, settingsStore)
+	chatHandler := chat.NewHandler(chatStore)
+	chatHandler.RegisterRoutes(apiV1Router)
+
+	goalHandler := goal.NewHandler(goal.NewStore(s.db, policy))
+	goalHandler.RegisterRoutes(apiV1Router)
+
 	investmentCalculatorStore := investment_calculator.NewStore()
-	investmentCalculatorHandler := investment_calculator.NewHandler(investmentCalculatorStore)
+	investmentCalculatorHandler := investment_calculator.NewHandler(investmentCalculatorStore, transactionStore)
 	investmentCalculatorHandler.RegisterRoutes(apiV1Router)
 
 	// Set up rate limiting middleware
@@ -3,10 +3,10 @@ package middlewares
 import (
 	"fmt"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/lucas-remigio/wallet-tracker/middleware"
 	"golang.org/x/time/rate"
 )
 
@@ -79,7 +79,7 @@ func RateLimitMiddleware(limiter *ClientRateLimiter) func(next http.Handler) htt
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get real client IP (handles proxies, load balancers)
-			ip := getClientIP(r)
+			ip := middleware.GetClientIP(r)
 
 			// Get rate limiter for this client
 			clientLimiter := limiter.GetLimiter(ip)
@@ -107,31 +107,3 @@ func RateLimitMiddleware(limiter *ClientRateLimiter) func(next http.Handler) htt
 		})
 	}
 }
-
-// getClientIP extracts the real client IP from request headers
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header (most common)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Take the first IP in the chain
-		if idx := strings.Index(xff, ","); idx != -1 {
-			return strings.TrimSpace(xff[:idx])
-		}
-		return strings.TrimSpace(xff)
-	}
-
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
-	}
-
-	// Check CF-Connecting-IP (Cloudflare)
-	if cfip := r.Header.Get("CF-Connecting-IP"); cfip != "" {
-		return strings.TrimSpace(cfip)
-	}
-
-	// Fallback to RemoteAddr
-	if idx := strings.LastIndex(r.RemoteAddr, ":"); idx != -1 {
-		return r.RemoteAddr[:idx]
-	}
-	return r.RemoteAddr
-}
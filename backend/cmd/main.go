@@ -3,6 +3,9 @@ package main
 import (
 	"database/sql"
 	"log"
+	"strings"
+	// the runtime image has no zoneinfo, user timezones need the embedded copy
+	_ "time/tzdata"
 
 	_ "github.com/lib/pq"
 	"github.com/lucas-remigio/wallet-tracker/cmd/api"
@@ -13,6 +16,9 @@ func main() {
 	var dbURL string
 
 	if config.Envs.IsProduction {
+		if missing := config.MissingProductionEnvs(); len(missing) > 0 {
+			log.Fatalf("Missing required production settings: %s", strings.Join(missing, ", "))
+		}
 		dbURL = config.Envs.RemoteDBUrl + "?sslmode=verify-ca&sslrootcert=db/prod-ca-2021.crt"
 		log.Println("Using remote database connection")
 	} else {
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS chat_tool_calls;
+DROP TABLE IF EXISTS chat_messages;
+DROP TABLE IF EXISTS chat_conversations;
@@ -0,0 +1,2 @@
+-- Template version of the system prompt used to generate each assistant message
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS prompt_version VARCHAR(100) DEFAULT NULL;
@@ -0,0 +1,19 @@
+-- failed logins per key, "id:<email>" or "ip:<address>"
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ DEFAULT NULL
+);
+
+-- one row per lockout, kept after the attempts are reset
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    id SERIAL PRIMARY KEY,
+    key VARCHAR(320) NOT NULL,
+    failures INTEGER NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_lockouts_key ON login_lockouts (key);
@@ -0,0 +1,27 @@
+-- WebAuthn credentials, a user can have one per device
+CREATE TABLE IF NOT EXISTS passkeys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    -- base64url credential id, as sent by the browser
+    credential_id VARCHAR(1400) NOT NULL UNIQUE,
+    -- COSE encoded public key
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMPTZ DEFAULT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_passkeys_user ON passkeys (user_id);
+
+-- single-use challenges, user_id is NULL for login ceremonies
+CREATE TABLE IF NOT EXISTS passkey_challenges (
+    challenge VARCHAR(128) PRIMARY KEY,
+    ceremony VARCHAR(32) NOT NULL,
+    user_id INTEGER DEFAULT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
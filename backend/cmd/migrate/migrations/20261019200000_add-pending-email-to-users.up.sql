@@ -0,0 +1,2 @@
+-- A changed email only replaces the current one after the new address is verified
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255) DEFAULT NULL;
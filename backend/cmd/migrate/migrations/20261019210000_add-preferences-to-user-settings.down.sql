@@ -0,0 +1,8 @@
+ALTER TABLE user_settings
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS locale,
+    DROP COLUMN IF EXISTS base_currency,
+    DROP COLUMN IF EXISTS week_start,
+    DROP COLUMN IF EXISTS number_format,
+    DROP COLUMN IF EXISTS default_account_token,
+    DROP COLUMN IF EXISTS ai_language;
@@ -0,0 +1,9 @@
+-- Month and day grouping happens in the timezone, an empty ai_language follows the locale
+ALTER TABLE user_settings
+    ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    ADD COLUMN IF NOT EXISTS locale VARCHAR(20) NOT NULL DEFAULT 'en',
+    ADD COLUMN IF NOT EXISTS base_currency CHAR(3) NOT NULL DEFAULT 'EUR',
+    ADD COLUMN IF NOT EXISTS week_start SMALLINT NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS number_format VARCHAR(20) NOT NULL DEFAULT 'comma_dot',
+    ADD COLUMN IF NOT EXISTS default_account_token VARCHAR(255) DEFAULT NULL REFERENCES accounts(token) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS ai_language VARCHAR(20) NOT NULL DEFAULT '';
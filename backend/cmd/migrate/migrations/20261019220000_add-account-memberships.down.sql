@@ -0,0 +1,4 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS created_by;
+
+DROP TABLE IF EXISTS account_invitations;
+DROP TABLE IF EXISTS account_members;
@@ -0,0 +1,45 @@
+-- Users that can see an account, order and favorite are per member so each
+-- person arranges shared accounts their own way
+CREATE TABLE IF NOT EXISTS account_members (
+    account_token VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    order_index INTEGER NOT NULL DEFAULT 0,
+    is_favorite BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (account_token, user_id),
+    FOREIGN KEY (account_token) REFERENCES accounts(token) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_members_user ON account_members (user_id);
+
+-- Every existing account is owned by the user that created it
+INSERT INTO account_members (account_token, user_id, role, order_index, is_favorite)
+SELECT token, user_id, 'owner', order_index, is_favorite FROM accounts
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS account_invitations (
+    id SERIAL PRIMARY KEY,
+    account_token VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('editor', 'viewer')),
+    invited_by INTEGER NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'revoked')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMPTZ DEFAULT NULL,
+
+    FOREIGN KEY (account_token) REFERENCES accounts(token) ON DELETE CASCADE,
+    FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_invitations_email ON account_invitations (LOWER(email)) WHERE status = 'pending';
+
+-- The member that recorded each transaction, existing ones were added by the account owner
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS created_by INTEGER DEFAULT NULL REFERENCES users(id) ON DELETE SET NULL;
+
+UPDATE transactions t SET created_by = a.user_id
+FROM accounts a
+WHERE a.token = t.account_token AND t.created_by IS NULL;
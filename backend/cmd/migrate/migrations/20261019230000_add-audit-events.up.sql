@@ -0,0 +1,36 @@
+-- Append-only trail of every change to financial data: who, what, when and from where.
+-- Account events keep the token without a foreign key so they outlive the account.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    account_token VARCHAR(255) DEFAULT NULL,
+    entity_type VARCHAR(20) NOT NULL CHECK (entity_type IN ('account', 'transaction', 'category', 'settings')),
+    entity_id VARCHAR(255) NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    before JSONB DEFAULT NULL,
+    after JSONB DEFAULT NULL,
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user ON audit_events (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_account ON audit_events (account_token, id DESC) WHERE account_token IS NOT NULL;
+
+-- Events are never changed. They are only removed together with their user, when the
+-- account is deleted and the user row is already gone.
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND NOT EXISTS (SELECT 1 FROM users WHERE id = OLD.user_id) THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,11 @@
+-- restore events can't be removed from the append-only trail, only new rows are checked
+ALTER TABLE audit_events DROP CONSTRAINT IF EXISTS audit_events_action_check;
+ALTER TABLE audit_events ADD CONSTRAINT audit_events_action_check
+    CHECK (action IN ('create', 'update', 'delete')) NOT VALID;
+
+DROP INDEX IF EXISTS idx_categories_deleted_at;
+DROP INDEX IF EXISTS idx_transactions_deleted_at;
+DROP INDEX IF EXISTS idx_accounts_deleted_at;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE accounts DROP COLUMN IF EXISTS deleted_at;
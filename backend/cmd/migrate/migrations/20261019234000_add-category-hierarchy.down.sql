@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_categories_parent;
+
+ALTER TABLE categories
+    DROP COLUMN IF EXISTS icon,
+    DROP COLUMN IF EXISTS order_index,
+    DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,16 @@
+-- Categories can be grouped one level deep under a parent of the same type, ordered by the
+-- user and shown with an icon
+ALTER TABLE categories
+    ADD COLUMN IF NOT EXISTS parent_id INTEGER DEFAULT NULL REFERENCES categories(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS order_index INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS icon VARCHAR(50) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories (parent_id) WHERE parent_id IS NOT NULL;
+
+-- Existing categories keep the order they were listed in, newest first
+UPDATE categories c SET order_index = ordered.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at DESC, id DESC) AS position
+    FROM categories
+) ordered
+WHERE ordered.id = c.id;
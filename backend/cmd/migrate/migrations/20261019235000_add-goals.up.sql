@@ -0,0 +1,31 @@
+-- Savings goals, linked to an account whose balance is the progress or tracked with
+-- contributions the user records by hand
+CREATE TABLE IF NOT EXISTS goals (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    account_token VARCHAR(255) DEFAULT NULL,
+    name VARCHAR(100) NOT NULL,
+    target_amount NUMERIC(15, 2) NOT NULL CHECK (target_amount > 0),
+    target_date DATE NOT NULL,
+    annual_return_rate NUMERIC(6, 4) NOT NULL DEFAULT 0 CHECK (annual_return_rate >= 0 AND annual_return_rate <= 1),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (account_token) REFERENCES accounts(token) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_goals_user ON goals (user_id);
+
+CREATE TABLE IF NOT EXISTS goal_contributions (
+    id SERIAL PRIMARY KEY,
+    goal_id INTEGER NOT NULL,
+    amount NUMERIC(15, 2) NOT NULL,
+    date DATE NOT NULL,
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (goal_id) REFERENCES goals(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_goal_contributions_goal ON goal_contributions (goal_id, date);
@@ -0,0 +1,13 @@
+-- one row per intermediate login token, by its jti, so a token can't be guessed against forever
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+    token_id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    -- set once the token earned a session, it can't be used again
+    completed_at TIMESTAMPTZ DEFAULT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_two_factor_challenges_expires_at ON two_factor_challenges (expires_at);
@@ -0,0 +1,5 @@
+DELETE FROM chat_tool_calls WHERE conversation_id IS NULL;
+ALTER TABLE chat_tool_calls DROP CONSTRAINT IF EXISTS chat_tool_calls_conversation_id_fkey;
+ALTER TABLE chat_tool_calls ADD CONSTRAINT chat_tool_calls_conversation_id_fkey
+    FOREIGN KEY (conversation_id) REFERENCES chat_conversations(id) ON DELETE CASCADE;
+ALTER TABLE chat_tool_calls ALTER COLUMN conversation_id SET NOT NULL;
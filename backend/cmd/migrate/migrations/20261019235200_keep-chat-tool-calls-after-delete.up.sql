@@ -0,0 +1,5 @@
+-- the tool call audit outlives the conversation, deleting one only unlinks its calls
+ALTER TABLE chat_tool_calls ALTER COLUMN conversation_id DROP NOT NULL;
+ALTER TABLE chat_tool_calls DROP CONSTRAINT IF EXISTS chat_tool_calls_conversation_id_fkey;
+ALTER TABLE chat_tool_calls ADD CONSTRAINT chat_tool_calls_conversation_id_fkey
+    FOREIGN KEY (conversation_id) REFERENCES chat_conversations(id) ON DELETE SET NULL;
@@ -3,20 +3,48 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	PublicHost             string
-	Port                   string
-	JWTExpirationInSeconds int64
-	JWTSecret              string
-	OpenAIKey              string
-	DatabaseUrl            string
-	RemoteDBUrl            string
-	FrontendUrl            string
-	IsProduction           bool
+	PublicHost                      string
+	Port                            string
+	JWTExpirationInSeconds          int64
+	JWTSecret                       string
+	RefreshTokenExpirationInSeconds int64
+	OpenAIKey                       string
+	DatabaseUrl                     string
+	RemoteDBUrl                     string
+	FrontendUrl                     string
+	IsProduction                    bool
+	LogAIPrompts                    bool
+	MailDriver                      string
+	MailFrom                        string
+	MailDir                         string
+	SMTPHost                        string
+	SMTPPort                        string
+	SMTPUsername                    string
+	SMTPPassword                    string
+	RequireEmailVerification        bool
+	TwoFactorEncryptionKey          string
+	OIDCRedirectBaseUrl             string
+	WebAuthnRPID                    string
+	WebAuthnRPName                  string
+	WebAuthnOrigin                  string
+	OIDCProviders                   []OIDCProviderConfig
+	TrashRetentionDays              int64
+	// TrustedProxies are the addresses (IPs or CIDRs) allowed to set the client IP headers
+	TrustedProxies []string
+}
+
+// OIDCProviderConfig is an external identity provider users can sign in with
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
 }
 
 var Envs = initConfig()
@@ -25,16 +53,80 @@ func initConfig() Config {
 	godotenv.Load()
 
 	return Config{
-		PublicHost:             getEnv("PUBLIC_HOST", "http://localhost"),
-		Port:                   getEnv("PORT", "8080"),
-		JWTExpirationInSeconds: getEnvAsInt("JWT_EXPIRATION_IN_SECONDS", 3600*24*7),
-		JWTSecret:              getEnv("JWT_SECRET", "not-so-secret"),
-		OpenAIKey:              getEnv("OPENAI_API_KEY", "not-so-secret"),
-		DatabaseUrl:            getEnv("DATABASE_URL", "mysql"),
-		RemoteDBUrl:            getEnv("REMOTE_DB_URL", ""),
-		FrontendUrl:            getEnv("FRONTEND_URL", "http://localhost:3000"),
-		IsProduction:           getEnvAsBool("IS_PRODUCTION", false),
+		PublicHost:                      getEnv("PUBLIC_HOST", "http://localhost"),
+		Port:                            getEnv("PORT", "8080"),
+		JWTExpirationInSeconds:          getEnvAsInt("JWT_EXPIRATION_IN_SECONDS", 60*15),
+		JWTSecret:                       getEnv("JWT_SECRET", "not-so-secret"),
+		RefreshTokenExpirationInSeconds: getEnvAsInt("REFRESH_TOKEN_EXPIRATION_IN_SECONDS", 3600*24*30),
+		OpenAIKey:                       getEnv("OPENAI_API_KEY", "not-so-secret"),
+		DatabaseUrl:                     getEnv("DATABASE_URL", "mysql"),
+		RemoteDBUrl:                     getEnv("REMOTE_DB_URL", ""),
+		FrontendUrl:                     getEnv("FRONTEND_URL", "http://localhost:3000"),
+		IsProduction:                    getEnvAsBool("IS_PRODUCTION", false),
+		LogAIPrompts:                    getEnvAsBool("LOG_AI_PROMPTS", false),
+		MailDriver:                      getEnv("MAIL_DRIVER", "file"),
+		MailFrom:                        getEnv("MAIL_FROM", "no-reply@graocerto.pt"),
+		MailDir:                         getEnv("MAIL_DIR", ""),
+		SMTPHost:                        getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:                        getEnv("SMTP_PORT", "25"),
+		SMTPUsername:                    getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:                    getEnv("SMTP_PASSWORD", ""),
+		RequireEmailVerification:        getEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false),
+		TwoFactorEncryptionKey:          getEnv("TWO_FACTOR_ENCRYPTION_KEY", "not-so-secret"),
+		OIDCRedirectBaseUrl:             getEnv("OIDC_REDIRECT_BASE_URL", "http://localhost:8080/api/v1"),
+		WebAuthnRPID:                    getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:                  getEnv("WEBAUTHN_RP_NAME", "Grao Certo"),
+		WebAuthnOrigin:                  getEnv("WEBAUTHN_ORIGIN", "http://localhost:3000"),
+		OIDCProviders:                   getOIDCProviders(),
+		TrashRetentionDays:              getEnvAsInt("TRASH_RETENTION_DAYS", 30),
+		TrustedProxies:                  getEnvAsList("TRUSTED_PROXIES"),
+	}
+}
+
+// productionEnvs have fallbacks only meant for development, production refuses to start without them
+var productionEnvs = []string{
+	"TWO_FACTOR_ENCRYPTION_KEY",
+	// passkeys are bound to the site's domain, the localhost defaults would reject every one
+	"WEBAUTHN_RP_ID",
+	"WEBAUTHN_ORIGIN",
+}
+
+// MissingProductionEnvs lists the variables production needs that aren't set
+func MissingProductionEnvs() []string {
+	missing := []string{}
+	for _, key := range productionEnvs {
+		if getEnv(key, "") == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	return missing
+}
+
+// getOIDCProviders reads OIDC_PROVIDERS=google,keycloak and then OIDC_GOOGLE_ISSUER,
+// OIDC_GOOGLE_CLIENT_ID and OIDC_GOOGLE_CLIENT_SECRET for each provider
+func getOIDCProviders() []OIDCProviderConfig {
+	providers := []OIDCProviderConfig{}
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			continue
+		}
+		providers = append(providers, provider)
 	}
+
+	return providers
 }
 
 func getEnv(key, fallback string) string {
@@ -45,6 +137,18 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvAsList reads a comma separated list, empty when the variable isn't set
+func getEnvAsList(key string) []string {
+	values := []string{}
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
 func getEnvAsInt(key string, fallback int64) int64 {
 	if value, ok := os.LookupEnv(key); ok {
 		i, err := strconv.ParseInt(value, 10, 64)
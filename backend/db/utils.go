@@ -10,8 +10,15 @@ type Scannable interface {
 	Scan(rows *sql.Rows) error
 }
 
+// Querier is what *sql.DB and *sql.Tx have in common, so the same queries can run inside a transaction
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // QueryList executes a query and scans results into a slice using the provided scanner function
-func QueryList[T any](db *sql.DB, query string, scanner func(*sql.Rows) (*T, error), args ...interface{}) ([]*T, error) {
+func QueryList[T any](db Querier, query string, scanner func(*sql.Rows) (*T, error), args ...interface{}) ([]*T, error) {
 	// Always return an array, even if empty
 	results := []*T{}
 
@@ -37,13 +44,13 @@ func QueryList[T any](db *sql.DB, query string, scanner func(*sql.Rows) (*T, err
 }
 
 // QuerySingle executes a query and scans a single result
-func QuerySingle[T any](db *sql.DB, query string, scanner func(*sql.Row) (*T, error), args ...interface{}) (*T, error) {
+func QuerySingle[T any](db Querier, query string, scanner func(*sql.Row) (*T, error), args ...interface{}) (*T, error) {
 	row := db.QueryRow(query, args...)
 	return scanner(row)
 }
 
 // QueryFirstFromRows executes a query and returns the first result using the rows scanner
-func QueryFirstFromRows[T any](db *sql.DB, query string, scanner func(*sql.Rows) (*T, error), args ...interface{}) (*T, error) {
+func QueryFirstFromRows[T any](db Querier, query string, scanner func(*sql.Rows) (*T, error), args ...interface{}) (*T, error) {
 	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
@@ -66,13 +73,13 @@ func ValidateOwnership(currentUserID, resourceUserID int, resourceType string) e
 }
 
 // ExecWithValidation executes a query with validation
-func ExecWithValidation(db *sql.DB, query string, args ...interface{}) (sql.Result, error) {
+func ExecWithValidation(db Querier, query string, args ...interface{}) (sql.Result, error) {
 	res, err := db.Exec(query, args...)
 	return res, err
 }
 
 // CheckResourceExists checks if a resource exists and returns an error if used by other entities
-func CheckResourceExists(db *sql.DB, checkQuery string, resourceType string, args ...interface{}) error {
+func CheckResourceExists(db Querier, checkQuery string, resourceType string, args ...interface{}) error {
 	rows, err := db.Query(checkQuery, args...)
 	if err != nil {
 		return err
@@ -9,20 +9,44 @@ import (
 	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/lucas-remigio/wallet-tracker/config"
 	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/types"
 	"github.com/lucas-remigio/wallet-tracker/utils"
 )
 
 // ContextKey is a custom type for context keys to avoid collisions
 type ContextKey string
 
-const UserIDKey ContextKey = "user_id"
+const (
+	UserIDKey    ContextKey = "user_id"
+	SessionIDKey ContextKey = "session_id"
+	// only set for requests authenticated with a personal access token
+	ScopesKey ContextKey = "scopes"
+)
+
+// sessionStore is used to reject access tokens of revoked sessions, it is set once at startup
+var sessionStore types.SessionStore
+
+func SetSessionStore(store types.SessionStore) {
+	sessionStore = store
+}
+
+// accessTokenStore resolves personal access tokens, it is set once at startup
+var accessTokenStore types.AccessTokenStore
+
+func SetAccessTokenStore(store types.AccessTokenStore) {
+	accessTokenStore = store
+}
 
 // Common error messages
 const (
 	ErrUserNotAuthenticated = "user not authenticated"
 	ErrMissingAuthHeader    = "missing authorization header"
 	ErrInvalidPathParam     = "invalid path parameter"
+	ErrSessionRevoked       = "session expired or revoked"
+	ErrInsufficientScope    = "access token does not have the required scope"
+	ErrSessionRequired      = "this action requires logging in, access tokens are not allowed"
 )
 
 // Standard response helpers
@@ -40,12 +64,47 @@ func WriteDataResponse(w http.ResponseWriter, data interface{}) {
 
 // RequireAuth is a helper that checks authentication and returns user ID
 // Returns (userID, true) if authenticated, (0, false) if not (and handles response)
+// Access tokens may only read through it and need the read scope, handlers that write use
+// RequireScope.
 func RequireAuth(w http.ResponseWriter, r *http.Request) (int, bool) {
 	userId, ok := GetUserIDFromContext(r)
 	if !ok {
 		utils.WriteError(w, http.StatusUnauthorized, errors.New(ErrUserNotAuthenticated))
 		return 0, false
 	}
+	if _, isAccessToken := GetScopesFromContext(r); isAccessToken && (!isReadMethod(r.Method) || !HasScope(r, types.ScopeRead)) {
+		utils.WriteError(w, http.StatusForbidden, errors.New(ErrInsufficientScope))
+		return 0, false
+	}
+	return userId, true
+}
+
+// RequireScope authenticates a handler that access tokens can use when granted the scope.
+// Login sessions have full access.
+func RequireScope(w http.ResponseWriter, r *http.Request, scope string) (int, bool) {
+	userId, ok := GetUserIDFromContext(r)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New(ErrUserNotAuthenticated))
+		return 0, false
+	}
+	if !HasScope(r, scope) {
+		utils.WriteError(w, http.StatusForbidden, errors.New(ErrInsufficientScope))
+		return 0, false
+	}
+	return userId, true
+}
+
+// RequireSession rejects access tokens, for actions like managing the tokens themselves
+func RequireSession(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userId, ok := GetUserIDFromContext(r)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New(ErrUserNotAuthenticated))
+		return 0, false
+	}
+	if _, isAccessToken := GetScopesFromContext(r); isAccessToken {
+		utils.WriteError(w, http.StatusForbidden, errors.New(ErrSessionRequired))
+		return 0, false
+	}
 	return userId, true
 }
 
@@ -59,26 +118,101 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		userId, err := auth.GetUserIdFromToken(authToken)
+		if strings.HasPrefix(strings.TrimPrefix(authToken, "Bearer "), types.AccessTokenPrefix) {
+			authenticateAccessToken(w, r, next, strings.TrimPrefix(authToken, "Bearer "))
+			return
+		}
+
+		claims, err := auth.ParseJWT([]byte(config.Envs.JWTSecret), authToken)
+		if err != nil {
+			utils.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		userId, err := claims.GetUserId()
 		if err != nil {
 			utils.WriteError(w, http.StatusUnauthorized, err)
 			return
 		}
 
-		// Add user ID to request context
+		// Fail closed: without a session store revoked tokens could not be detected
+		if sessionStore == nil {
+			utils.WriteError(w, http.StatusUnauthorized, errors.New(ErrSessionRevoked))
+			return
+		}
+		active, err := sessionStore.IsSessionActive(claims.SessionID, userId)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !active {
+			utils.WriteError(w, http.StatusUnauthorized, errors.New(ErrSessionRevoked))
+			return
+		}
+
+		// Add user and session IDs to request context
 		ctx := context.WithValue(r.Context(), UserIDKey, userId)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
 		r = r.WithContext(ctx)
 
 		next(w, r)
 	}
 }
 
+func authenticateAccessToken(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, token string) {
+	if accessTokenStore == nil {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("access tokens are not supported"))
+		return
+	}
+
+	accessToken, err := accessTokenStore.Authenticate(token)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// Add user ID and the granted scopes to request context
+	ctx := context.WithValue(r.Context(), UserIDKey, accessToken.UserID)
+	ctx = context.WithValue(ctx, ScopesKey, accessToken.Scopes)
+	next(w, r.WithContext(ctx))
+}
+
 // GetUserIDFromContext extracts the user ID from the request context
 func GetUserIDFromContext(r *http.Request) (int, bool) {
 	userId, ok := r.Context().Value(UserIDKey).(int)
 	return userId, ok
 }
 
+// GetSessionIDFromContext extracts the session ID of the access token from the request context
+func GetSessionIDFromContext(r *http.Request) (string, bool) {
+	sessionId, ok := r.Context().Value(SessionIDKey).(string)
+	return sessionId, ok
+}
+
+// GetScopesFromContext returns the scopes of the access token, ok is false for login sessions
+func GetScopesFromContext(r *http.Request) ([]string, bool) {
+	scopes, ok := r.Context().Value(ScopesKey).([]string)
+	return scopes, ok
+}
+
+// HasScope is always true for login sessions
+func HasScope(r *http.Request, scope string) bool {
+	scopes, isAccessToken := GetScopesFromContext(r)
+	if !isAccessToken {
+		return true
+	}
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
 // PayloadValidator is a generic function that parses and validates request payloads
 func ParseAndValidatePayload[T any](r *http.Request, payload *T) error {
 	// Parse JSON payload
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+type mockAccessTokenStore struct {
+	tokens map[string]*types.AccessToken
+}
+
+func (m *mockAccessTokenStore) CreateToken(userId int, payload *types.CreateAccessTokenPayload) (*types.AccessToken, string, error) {
+	return nil, "", nil
+}
+func (m *mockAccessTokenStore) GetTokensByUserId(userId int) ([]*types.AccessToken, error) {
+	return nil, nil
+}
+func (m *mockAccessTokenStore) RevokeToken(tokenId int, userId int) error { return nil }
+
+func (m *mockAccessTokenStore) Authenticate(token string) (*types.AccessToken, error) {
+	accessToken, ok := m.tokens[token]
+	if !ok {
+		return nil, fmt.Errorf("invalid access token")
+	}
+	return accessToken, nil
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	SetAccessTokenStore(&mockAccessTokenStore{tokens: map[string]*types.AccessToken{
+		"wt_readonly": {UserID: 7, Scopes: []string{types.ScopeRead}},
+		"wt_importer": {UserID: 7, Scopes: []string{types.ScopeTransactionsWrite}},
+	}})
+	t.Cleanup(func() { SetAccessTokenStore(nil) })
+
+	readHandler := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := RequireAuth(w, r); ok {
+			WriteSuccessResponse(w)
+		}
+	}
+	writeTransactionHandler := func(w http.ResponseWriter, r *http.Request) {
+		if userId, ok := RequireScope(w, r, types.ScopeTransactionsWrite); ok {
+			if userId != 7 {
+				t.Errorf("expected user 7 in the context, got %d", userId)
+			}
+			WriteSuccessResponse(w)
+		}
+	}
+	sessionOnlyHandler := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := RequireSession(w, r); ok {
+			WriteSuccessResponse(w)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		handler    http.HandlerFunc
+		wantStatus int
+	}{
+		{"read-only token can read", "wt_readonly", http.MethodGet, readHandler, http.StatusOK},
+		{"read-only token can't write through a read handler", "wt_readonly", http.MethodPost, readHandler, http.StatusForbidden},
+		{"read-only token can't create transactions", "wt_readonly", http.MethodPost, writeTransactionHandler, http.StatusForbidden},
+		{"write scope can create transactions", "wt_importer", http.MethodPost, writeTransactionHandler, http.StatusOK},
+		{"write scope alone can't read", "wt_importer", http.MethodGet, readHandler, http.StatusForbidden},
+		{"write scope can't delete through an unscoped handler", "wt_importer", http.MethodDelete, readHandler, http.StatusForbidden},
+		{"tokens can't manage tokens", "wt_importer", http.MethodGet, sessionOnlyHandler, http.StatusForbidden},
+		{"unknown token", "wt_unknown", http.MethodGet, readHandler, http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/resource", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rr := httptest.NewRecorder()
+
+			AuthMiddleware(tc.handler)(rr, req)
+			if rr.Code != tc.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestSessionsHaveEveryScope(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/transactions", nil)
+	if !HasScope(req, types.ScopeAccountsWrite) {
+		t.Error("expected a request without access token scopes to have full access")
+	}
+}
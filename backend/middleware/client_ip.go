@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+)
+
+// trustedProxies are the only peers whose forwarding headers are believed, anyone else
+// could put any address in them
+var trustedProxies = parseTrustedProxies(config.Envs.TrustedProxies)
+
+func parseTrustedProxies(addresses []string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, address := range addresses {
+		if !strings.Contains(address, "/") {
+			if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+				address += "/32"
+			} else {
+				address += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			log.Printf("ignoring invalid trusted proxy %q: %v", address, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetClientIP extracts the real client IP. The forwarding headers are only read when the
+// request comes from a trusted proxy, otherwise the connection's address is the client.
+func GetClientIP(r *http.Request) string {
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+	if !isTrustedProxy(remoteIP) {
+		return remoteIP
+	}
+
+	// Check X-Forwarded-For header (most common). Every proxy appends the address it got
+	// the request from, so the client is the last address that isn't one of our proxies.
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop != "" && (i == 0 || !isTrustedProxy(hop)) {
+				return hop
+			}
+		}
+	}
+
+	// Check X-Real-IP header
+	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		return strings.TrimSpace(xri)
+	}
+
+	// Check CF-Connecting-IP (Cloudflare)
+	if cfip := r.Header.Get("CF-Connecting-IP"); cfip != "" {
+		return strings.TrimSpace(cfip)
+	}
+
+	return remoteIP
+}
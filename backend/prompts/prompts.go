@@ -0,0 +1,193 @@
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Templates are embedded so the binary no longer depends on the working directory.
+// File names follow <id>.v<version>.<language>.tmpl, e.g. monthly_feedback.v1.pt-PT.tmpl
+//
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// Template IDs
+const (
+	MonthlyFeedback = "monthly_feedback"
+	ChatSystem      = "chat_system"
+	QuickEntry      = "quick_entry"
+)
+
+// Supported languages, every template version must provide all of them
+const (
+	LanguageEnglish    = "en"
+	LanguagePortuguese = "pt-PT"
+	DefaultLanguage    = LanguageEnglish
+)
+
+var SupportedLanguages = []string{LanguageEnglish, LanguagePortuguese}
+
+var fileNamePattern = regexp.MustCompile(`^([a-z_]+)\.v(\d+)\.([A-Za-z-]+)\.tmpl$`)
+
+type MonthlyFeedbackData struct {
+	Transactions string
+	Anomalies    string
+}
+
+type ChatSystemData struct {
+	Today string
+}
+
+type QuickEntryCategory struct {
+	ID   int
+	Name string
+	Type string
+}
+
+type QuickEntryData struct {
+	Today      string
+	Accounts   []string
+	Categories []QuickEntryCategory
+	Text       string
+}
+
+// Rendered is a prompt ready to send, with the exact template version that produced it
+type Rendered struct {
+	Text    string
+	Version string
+}
+
+type variant struct {
+	id       string
+	version  int
+	language string
+	tmpl     *template.Template
+}
+
+// versionTag identifies a template variant, it is stored next to every generated result
+func (v *variant) versionTag() string {
+	return fmt.Sprintf("%s.v%d.%s", v.id, v.version, v.language)
+}
+
+type Registry struct {
+	// id -> version -> language -> template
+	variants map[string]map[int]map[string]*variant
+}
+
+var registry = mustLoad(templateFiles)
+
+func mustLoad(files fs.FS) *Registry {
+	r, err := load(files)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load prompt templates: %v", err))
+	}
+	return r
+}
+
+func load(files fs.FS) (*Registry, error) {
+	entries, err := fs.ReadDir(files, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registry{variants: make(map[string]map[int]map[string]*variant)}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid template file name %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[2])
+
+		content, err := fs.ReadFile(files, path.Join("templates", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(entry.Name()).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", entry.Name(), err)
+		}
+
+		id := match[1]
+		if r.variants[id] == nil {
+			r.variants[id] = make(map[int]map[string]*variant)
+		}
+		if r.variants[id][version] == nil {
+			r.variants[id][version] = make(map[string]*variant)
+		}
+		r.variants[id][version][match[3]] = &variant{id: id, version: version, language: match[3], tmpl: tmpl}
+	}
+
+	// the default language is the fallback, it must exist for every version
+	for id, versions := range r.variants {
+		for version, languages := range versions {
+			if _, exists := languages[DefaultLanguage]; !exists {
+				return nil, fmt.Errorf("template %s.v%d has no %s variant", id, version, DefaultLanguage)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// Render renders the latest version of a template in the requested language
+func Render(id, language string, data any) (*Rendered, error) {
+	return registry.Render(id, language, data)
+}
+
+func (r *Registry) Render(id, language string, data any) (*Rendered, error) {
+	versions, exists := r.variants[id]
+	if !exists {
+		return nil, fmt.Errorf("unknown prompt template %q", id)
+	}
+
+	latest := 0
+	for version := range versions {
+		if version > latest {
+			latest = version
+		}
+	}
+
+	return r.RenderVersion(id, latest, language, data)
+}
+
+// RenderVersion renders a specific template version, falling back to the default language
+func (r *Registry) RenderVersion(id string, version int, language string, data any) (*Rendered, error) {
+	languages, exists := r.variants[id][version]
+	if !exists {
+		return nil, fmt.Errorf("unknown prompt template %s.v%d", id, version)
+	}
+
+	v, exists := languages[NormalizeLanguage(language)]
+	if !exists {
+		v = languages[DefaultLanguage]
+	}
+
+	var buf bytes.Buffer
+	if err := v.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", v.versionTag(), err)
+	}
+
+	return &Rendered{Text: buf.String(), Version: v.versionTag()}, nil
+}
+
+// NormalizeLanguage maps the language hints sent by clients ("pt", "pt_PT", "Portuguese"...)
+// to one of the supported languages
+func NormalizeLanguage(language string) string {
+	normalized := strings.ToLower(strings.TrimSpace(language))
+	normalized = strings.ReplaceAll(normalized, "_", "-")
+
+	switch {
+	case normalized == "pt" || strings.HasPrefix(normalized, "pt-"),
+		strings.HasPrefix(normalized, "portugu"):
+		return LanguagePortuguese
+	default:
+		return DefaultLanguage
+	}
+}
@@ -0,0 +1,103 @@
+package prompts
+
+import (
+	"strings"
+	"testing"
+)
+
+// fixtures holds sample data for every template ID, new templates must add one
+var fixtures = map[string]any{
+	MonthlyFeedback: MonthlyFeedbackData{
+		Transactions: "- Date: 2025-06-03 | Description: Continente | Amount: 54.20 | Type: DEBIT | Category: Groceries\n",
+		Anomalies:    `[{"type":"large_transaction","severity":"high","category":"Groceries","amount":400,"expected":50,"explanation":"8x the usual amount"}]`,
+	},
+	ChatSystem: ChatSystemData{Today: "2025-06-30"},
+	QuickEntry: QuickEntryData{
+		Today:      "2025-06-30",
+		Accounts:   []string{"Main", "Savings"},
+		Categories: []QuickEntryCategory{{ID: 3, Name: "Groceries", Type: "DEBIT"}, {ID: 7, Name: "Salary", Type: "CREDIT"}},
+		Text:       "paguei 12,50 no continente ontem",
+	},
+}
+
+func TestRenderEveryTemplate(t *testing.T) {
+	for id, versions := range registry.variants {
+		data, exists := fixtures[id]
+		if !exists {
+			t.Errorf("template %s has no fixture", id)
+			continue
+		}
+
+		for version, languages := range versions {
+			for _, language := range SupportedLanguages {
+				v, exists := languages[language]
+				if !exists {
+					t.Errorf("template %s.v%d is missing the %s variant", id, version, language)
+					continue
+				}
+
+				rendered, err := registry.RenderVersion(id, version, language, data)
+				if err != nil {
+					t.Errorf("failed to render %s: %v", v.versionTag(), err)
+					continue
+				}
+				if rendered.Version != v.versionTag() {
+					t.Errorf("expected version %s, got %s", v.versionTag(), rendered.Version)
+				}
+				if strings.Contains(rendered.Text, "<no value>") {
+					t.Errorf("%s rendered a missing value", v.versionTag())
+				}
+			}
+		}
+	}
+}
+
+func TestRenderFixturesAreUsed(t *testing.T) {
+	rendered, err := Render(QuickEntry, "pt", fixtures[QuickEntry])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{"- 1: Savings", "- 7: Salary (CREDIT)", "TEXT: paguei 12,50 no continente ontem"} {
+		if !strings.Contains(rendered.Text, expected) {
+			t.Errorf("expected the prompt to contain %q, got:\n%s", expected, rendered.Text)
+		}
+	}
+}
+
+func TestRenderRejectsWrongData(t *testing.T) {
+	if _, err := Render(MonthlyFeedback, "en", ChatSystemData{Today: "2025-06-30"}); err == nil {
+		t.Error("expected an error when the data does not match the template")
+	}
+	if _, err := Render("unknown", "en", nil); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+}
+
+func TestRenderLanguageFallback(t *testing.T) {
+	rendered, err := Render(ChatSystem, "fr", fixtures[ChatSystem])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(rendered.Version, "."+DefaultLanguage) {
+		t.Errorf("expected the default language variant, got %s", rendered.Version)
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := map[string]string{
+		"pt":         LanguagePortuguese,
+		"pt_PT":      LanguagePortuguese,
+		"PT-pt":      LanguagePortuguese,
+		"Portuguese": LanguagePortuguese,
+		"português":  LanguagePortuguese,
+		"en":         LanguageEnglish,
+		"English":    LanguageEnglish,
+		"":           DefaultLanguage,
+	}
+
+	for input, expected := range tests {
+		if got := NormalizeLanguage(input); got != expected {
+			t.Errorf("NormalizeLanguage(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package access_token
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+type Handler struct {
+	store types.AccessTokenStore
+}
+
+func NewHandler(store types.AccessTokenStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/auth/access-tokens", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet:  h.GetAccessTokens,
+			http.MethodPost: h.CreateAccessToken,
+		}),
+	))
+	router.HandleFunc("/auth/access-tokens/{id}", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodDelete: h.RevokeAccessToken,
+		}),
+	))
+}
+
+// CreateAccessToken returns the plain token, it is never shown again
+func (h *Handler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	// tokens can only be managed from a login session
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.CreateAccessTokenPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	accessToken, token, err := h.store.CreateToken(userId, &payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, types.CreatedAccessToken{AccessToken: *accessToken, Token: token})
+}
+
+func (h *Handler) GetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	// tokens can only be managed from a login session
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.store.GetTokensByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"access_tokens": tokens,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func (h *Handler) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	// tokens can only be managed from a login session
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// extract token ID from URL path (/auth/access-tokens/{id})
+	tokenId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	if err := h.store.RevokeToken(tokenId, userId); err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
@@ -0,0 +1,167 @@
+package access_token
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const (
+	tokenBytes    = 32
+	displayLength = 10
+)
+
+var (
+	ErrInvalidAccessToken = fmt.Errorf("invalid, expired or revoked access token")
+	ErrTokenNotFound      = fmt.Errorf("access token not found")
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+const accessTokenColumns = `
+    id, user_id, name, prefix, scopes, created_at, last_used_at, expires_at
+`
+
+// CreateToken returns the new token with its plain value, which can't be recovered later
+func (s *Store) CreateToken(userId int, payload *types.CreateAccessTokenPayload) (*types.AccessToken, string, error) {
+	random, err := utils.GenerateToken(tokenBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	token := types.AccessTokenPrefix + random
+
+	var expiresAt *time.Time
+	if payload.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, payload.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	var tokenId int
+	err = s.db.QueryRow(
+		`INSERT INTO access_tokens (user_id, name, token_hash, prefix, scopes, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		userId, payload.Name, hashToken(token), token[:displayLength], pq.Array(uniqueScopes(payload.Scopes)), expiresAt,
+	).Scan(&tokenId)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create access token: %w", err)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM access_tokens WHERE id = $1", accessTokenColumns)
+	accessToken, err := db.QuerySingle(s.db, query, scanRowIntoAccessToken, tokenId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return accessToken, token, nil
+}
+
+func (s *Store) GetTokensByUserId(userId int) ([]*types.AccessToken, error) {
+	query := fmt.Sprintf(`SELECT %s FROM access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`, accessTokenColumns)
+	return db.QueryList(s.db, query, scanRowsIntoAccessToken, userId)
+}
+
+func (s *Store) RevokeToken(tokenId int, userId int) error {
+	result, err := db.ExecWithValidation(s.db,
+		"UPDATE access_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		tokenId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// Authenticate resolves a token presented in the Authorization header and marks it as used
+func (s *Store) Authenticate(token string) (*types.AccessToken, error) {
+	query := fmt.Sprintf(`UPDATE access_tokens SET last_used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		RETURNING %s`, accessTokenColumns)
+	accessToken, err := db.QuerySingle(s.db, query, scanRowIntoAccessToken, hashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, err
+	}
+
+	return accessToken, nil
+}
+
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func scanRowIntoAccessToken(row *sql.Row) (*types.AccessToken, error) {
+	accessToken := new(types.AccessToken)
+	err := row.Scan(
+		&accessToken.ID,
+		&accessToken.UserID,
+		&accessToken.Name,
+		&accessToken.Prefix,
+		pq.Array(&accessToken.Scopes),
+		&accessToken.CreatedAt,
+		&accessToken.LastUsedAt,
+		&accessToken.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return accessToken, nil
+}
+
+func scanRowsIntoAccessToken(rows *sql.Rows) (*types.AccessToken, error) {
+	accessToken := new(types.AccessToken)
+	err := rows.Scan(
+		&accessToken.ID,
+		&accessToken.UserID,
+		&accessToken.Name,
+		&accessToken.Prefix,
+		pq.Array(&accessToken.Scopes),
+		&accessToken.CreatedAt,
+		&accessToken.LastUsedAt,
+		&accessToken.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return accessToken, nil
+}
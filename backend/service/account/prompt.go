@@ -0,0 +1,147 @@
+package account
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lucas-remigio/wallet-tracker/service/privacy"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+type categoryAggregate struct {
+	name   string
+	txType string
+	count  int
+	total  float64
+}
+
+// buildTransactionsPromptData formats the transactions sent to the LLM.
+// Descriptions go through the user's privacy mode, and users that opted into
+// aggregates only get per-category totals instead of individual line items.
+func buildTransactionsPromptData(transactions []*types.TransactionDTO, settings *types.UserSettings) string {
+	if settings.AIAggregatesOnly {
+		return buildAggregatesPromptData(transactions)
+	}
+
+	redactor := privacy.NewRedactor(settings.AIPrivacyMode)
+
+	var transactionsData strings.Builder
+	for _, tx := range transactions {
+		txType, categoryName := describeCategory(tx.Category)
+
+		// Format the transaction line
+		transactionsData.WriteString(fmt.Sprintf("- Date: %s | Description: %s | Amount: %.2f | Type: %s | Category: %s\n",
+			tx.Date.Format("2006-01-02"),
+			redactor.Sanitize(tx.Description),
+			tx.Amount,
+			txType,
+			categoryName))
+	}
+
+	return transactionsData.String()
+}
+
+func buildAggregatesPromptData(transactions []*types.TransactionDTO) string {
+	aggregates := make(map[string]*categoryAggregate)
+	totals := make(map[string]float64)
+
+	for _, tx := range transactions {
+		txType, categoryName := describeCategory(tx.Category)
+		key := txType + ":" + categoryName
+
+		if _, exists := aggregates[key]; !exists {
+			aggregates[key] = &categoryAggregate{name: categoryName, txType: txType}
+		}
+		aggregates[key].count++
+		aggregates[key].total += tx.Amount
+		totals[txType] += tx.Amount
+	}
+
+	sorted := make([]*categoryAggregate, 0, len(aggregates))
+	for _, agg := range aggregates {
+		sorted = append(sorted, agg)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].total > sorted[j].total
+	})
+
+	var data strings.Builder
+	data.WriteString("(Only category aggregates are available, individual transactions are private)\n")
+	for _, agg := range sorted {
+		data.WriteString(fmt.Sprintf("- Category: %s | Type: %s | Transactions: %d | Total: %.2f\n",
+			agg.name, agg.txType, agg.count, agg.total))
+	}
+	data.WriteString(fmt.Sprintf("- Total CREDIT: %.2f | Total DEBIT: %.2f\n", totals["CREDIT"], totals["DEBIT"]))
+
+	return data.String()
+}
+
+// describeCategory resolves the transaction type label and category name from the category the
+// transaction was joined with, whoever on the account created it
+func describeCategory(category *types.CategoryDTO) (txType, categoryName string) {
+	txType = "DEBIT"
+	categoryName = "Uncategorized"
+
+	if category == nil {
+		return txType, categoryName
+	}
+
+	categoryName = category.CategoryName
+	if category.TransactionType == nil {
+		return txType, categoryName
+	}
+
+	// Determine transaction type based on category's transaction type ID
+	switch category.TransactionType.ID {
+	case int(types.CreditTransactionType):
+		txType = "CREDIT"
+	case int(types.DebitTransactionType):
+		txType = "DEBIT"
+	case int(types.TransferTransactionType):
+		txType = "TRANSFER"
+	}
+
+	return txType, categoryName
+}
+
+type promptAnomaly struct {
+	Type        string  `json:"type"`
+	Severity    string  `json:"severity"`
+	Category    string  `json:"category"`
+	Description string  `json:"description,omitempty"`
+	Amount      float64 `json:"amount"`
+	Expected    float64 `json:"expected"`
+	Date        string  `json:"date,omitempty"`
+	Explanation string  `json:"explanation"`
+}
+
+// buildAnomaliesPromptData encodes the detector output as JSON for the prompt.
+// Descriptions follow the same privacy rules as the transaction lines.
+func buildAnomaliesPromptData(anomalies []*types.Anomaly, settings *types.UserSettings) (string, error) {
+	redactor := privacy.NewRedactor(settings.AIPrivacyMode)
+
+	items := make([]promptAnomaly, 0, len(anomalies))
+	for _, a := range anomalies {
+		item := promptAnomaly{
+			Type:        a.Type,
+			Severity:    a.Severity,
+			Category:    a.Category,
+			Amount:      a.Amount,
+			Expected:    a.Expected,
+			Date:        a.Date,
+			Explanation: a.Explanation,
+		}
+		if !settings.AIAggregatesOnly {
+			item.Description = redactor.Sanitize(a.Description)
+		}
+		items = append(items, item)
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
 	"github.com/lucas-remigio/wallet-tracker/types"
 	"github.com/lucas-remigio/wallet-tracker/utils"
 )
@@ -50,7 +52,7 @@ func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// require authentication
-	userId, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireScope(w, r, types.ScopeAccountsWrite)
 	if !ok {
 		return
 	}
@@ -60,10 +62,10 @@ func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		UserID:      userId,
 		AccountName: payload.AccountName,
 		Balance:     *payload.Balance,
-	})
+	}, audit.Origin(r))
 
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -84,7 +86,7 @@ func (h *Handler) GetAccountsByUserId(w http.ResponseWriter, r *http.Request) {
 	// get accounts by user id
 	accounts, err := h.store.GetAccountsByUserId(userId)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -97,7 +99,7 @@ func (h *Handler) GetAccountsByUserId(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) UpdateAccount(w http.ResponseWriter, r *http.Request) {
 	// require authentication
-	userId, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireScope(w, r, types.ScopeAccountsWrite)
 	if !ok {
 		return
 	}
@@ -120,10 +122,10 @@ func (h *Handler) UpdateAccount(w http.ResponseWriter, r *http.Request) {
 		UserID:      userId,
 		AccountName: payload.AccountName,
 		Balance:     *payload.Balance,
-	}, userId)
+	}, userId, audit.Origin(r))
 
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -135,7 +137,7 @@ func (h *Handler) UpdateAccount(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
 	// require authentication
-	userId, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireScope(w, r, types.ScopeAccountsWrite)
 	if !ok {
 		return
 	}
@@ -147,9 +149,9 @@ func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// delete the account
-	err := h.store.DeleteAccount(accountToken, userId)
+	err := h.store.DeleteAccount(accountToken, userId, audit.Origin(r))
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -180,16 +182,13 @@ func (h *Handler) GetAccountFeedbackMonthly(w http.ResponseWriter, r *http.Reque
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
-	language, err := utils.GetStringFromQuery(r, "language")
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
-		return
-	}
+	// without a language the feedback follows the user's settings
+	language := r.URL.Query().Get("language")
 
 	// get the account feedback monthly
 	feedback, err := h.store.GetAccountFeedbackMonthly(userId, accountToken, language, month, year)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -198,7 +197,7 @@ func (h *Handler) GetAccountFeedbackMonthly(w http.ResponseWriter, r *http.Reque
 
 func (h *Handler) ReorderAccounts(w http.ResponseWriter, r *http.Request) {
 	// require authentication
-	userId, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireScope(w, r, types.ScopeAccountsWrite)
 	if !ok {
 		return
 	}
@@ -210,9 +209,9 @@ func (h *Handler) ReorderAccounts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// call store to update order indexes
-	err := h.store.ReorderAccounts(userId, payload.Accounts)
+	err := h.store.ReorderAccounts(userId, payload.Accounts, audit.Origin(r))
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -221,7 +220,7 @@ func (h *Handler) ReorderAccounts(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) FavoriteAccount(w http.ResponseWriter, r *http.Request) {
 	// require authentication
-	userId, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireScope(w, r, types.ScopeAccountsWrite)
 	if !ok {
 		return
 	}
@@ -239,9 +238,9 @@ func (h *Handler) FavoriteAccount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// call store to update favorite status
-	err := h.store.FavoriteAccount(accountToken, userId, payload.IsFavorite)
+	err := h.store.FavoriteAccount(accountToken, userId, payload.IsFavorite, audit.Origin(r))
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
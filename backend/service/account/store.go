@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
-	"strings"
 
+	"github.com/lucas-remigio/wallet-tracker/config"
 	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/prompts"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
 	"github.com/lucas-remigio/wallet-tracker/types"
 	"github.com/lucas-remigio/wallet-tracker/utils"
 )
@@ -18,13 +20,18 @@ type Store struct {
 	categoryStore     types.CategoryStore
 	openAiStore       types.OpenAIStore
 	transactionsStore types.TransactionStore
+	settingsStore     types.SettingsStore
+	anomalyStore      types.AnomalyStore
+	policy            *authz.Policy
 }
 
-func NewStore(db *sql.DB, categoryStore types.CategoryStore, openAiStore types.OpenAIStore) *Store {
+func NewStore(db *sql.DB, categoryStore types.CategoryStore, openAiStore types.OpenAIStore, settingsStore types.SettingsStore, policy *authz.Policy) *Store {
 	return &Store{
 		db:            db,
 		categoryStore: categoryStore,
 		openAiStore:   openAiStore,
+		settingsStore: settingsStore,
+		policy:        policy,
 	}
 }
 
@@ -32,14 +39,24 @@ func (s *Store) SetTransactionStore(transactionsStore types.TransactionStore) {
 	s.transactionsStore = transactionsStore
 }
 
+func (s *Store) SetAnomalyStore(anomalyStore types.AnomalyStore) {
+	s.anomalyStore = anomalyStore
+}
+
+// accounts are always read through the membership of the requesting user
 const accountColumns = `
-    id, token, user_id, account_name, balance, created_at, order_index, is_favorite
+    a.id, a.token, a.user_id, a.account_name, a.balance, a.created_at, m.order_index, m.is_favorite, m.role, a.deleted_at
+`
+
+const accountFrom = `
+    accounts a JOIN account_members m ON m.account_token = a.token
 `
 
+// GetAccountsByUserId returns the accounts the user is a member of, shared ones included
 func (s *Store) GetAccountsByUserId(userId int) ([]*types.Account, error) {
 	query := fmt.Sprintf(
-		`SELECT %s FROM accounts WHERE user_id = $1 ORDER BY order_index`,
-		accountColumns,
+		`SELECT %s FROM %s WHERE m.user_id = $1 AND a.deleted_at IS NULL ORDER BY m.order_index`,
+		accountColumns, accountFrom,
 	)
 	return db.QueryList(
 		s.db,
@@ -49,138 +66,242 @@ func (s *Store) GetAccountsByUserId(userId int) ([]*types.Account, error) {
 	)
 }
 
+// GetAccountByToken returns the account if the user is a member, with their role
 func (s *Store) GetAccountByToken(token string, userId int) (*types.Account, error) {
+	if err := s.policy.CanReadAccount(userId, token); err != nil {
+		return nil, err
+	}
+
+	return getAccount(s.db, token, userId)
+}
+
+// getAccount reads the account through the membership of the user, callers go through the policy first
+func getAccount(q db.Querier, token string, userId int) (*types.Account, error) {
 	query := fmt.Sprintf(
-		`SELECT %s FROM accounts WHERE token = $1 AND user_id = $2`,
-		accountColumns,
+		`SELECT %s FROM %s WHERE a.token = $1 AND m.user_id = $2 AND a.deleted_at IS NULL`,
+		accountColumns, accountFrom,
 	)
 	return db.QuerySingle(
-		s.db,
+		q,
 		query,
 		scanRowIntoAccount,
 		token, userId,
 	)
 }
 
-func (s *Store) GetAccountById(id int, userId int) (*types.Account, error) {
+// lockAccount holds the account until tx ends, so what is read as its previous state stays true
+func lockAccount(tx *sql.Tx, token string) error {
+	var id int
+	err := tx.QueryRow("SELECT id FROM accounts WHERE token = $1 AND deleted_at IS NULL FOR UPDATE", token).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("account %w", authz.ErrNotFound)
+	}
+	return err
+}
+
+// GetTrashedAccountsByUserId returns the accounts in the trash the user can restore, the ones they own
+func (s *Store) GetTrashedAccountsByUserId(userId int) ([]*types.Account, error) {
 	query := fmt.Sprintf(
-		`SELECT %s FROM accounts WHERE id = $1 AND user_id = $2`,
-		accountColumns,
+		`SELECT %s FROM %s WHERE m.user_id = $1 AND m.role = $2 AND a.deleted_at IS NOT NULL ORDER BY a.deleted_at DESC`,
+		accountColumns, accountFrom,
 	)
-	return db.QuerySingle(
+	return db.QueryList(
 		s.db,
 		query,
-		scanRowIntoAccount,
-		id, userId,
+		scanRowsIntoAccount,
+		userId, types.AccountRoleOwner,
 	)
 }
 
-func (s *Store) CreateAccount(account *types.Account) (*types.Account, error) {
+func (s *Store) CreateAccount(account *types.Account, origin *types.AuditOrigin) (*types.Account, error) {
 	token, err := utils.GenerateToken(16)
 	if err != nil {
 		return nil, err
 	}
 	account.Token = token
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	var maxOrderIndex int
-	err = s.db.QueryRow("SELECT COALESCE(MAX(order_index), 0) FROM accounts WHERE user_id = $1", account.UserID).Scan(&maxOrderIndex)
+	err = tx.QueryRow("SELECT COALESCE(MAX(order_index), 0) FROM account_members WHERE user_id = $1", account.UserID).Scan(&maxOrderIndex)
 	if err != nil {
 		return nil, err
 	}
 	account.OrderIndex = maxOrderIndex + 1
 
-	_, err = db.ExecWithValidation(s.db,
+	_, err = tx.Exec(
 		"INSERT INTO accounts (token, user_id, account_name, balance, order_index) VALUES ($1, $2, $3, $4, $5)",
 		account.Token, account.UserID, account.AccountName, account.Balance, account.OrderIndex,
 	)
+	if err != nil {
+		return nil, err
+	}
 
+	// the creator owns the account
+	_, err = tx.Exec(
+		"INSERT INTO account_members (account_token, user_id, role, order_index) VALUES ($1, $2, $3, $4)",
+		account.Token, account.UserID, types.AccountRoleOwner, account.OrderIndex,
+	)
 	if err != nil {
 		return nil, err
 	}
 
 	// Fetch the newly created account to return it
-	newAccount, err := s.GetAccountByToken(account.Token, account.UserID)
+	newAccount, err := getAccount(tx, account.Token, account.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching newly created account: %w", err)
 	}
 
+	if err := audit.Record(tx, origin, accountChange(account.UserID, types.AuditActionCreate, nil, newAccount)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return newAccount, nil
 }
 
-func (s *Store) UpdateAccount(account *types.Account, userId int) (*types.Account, error) {
-	// first get the current account so that we can check if the user is the owner of the account
-	currentAccount, err := s.GetAccountById(account.ID, userId)
+func (s *Store) UpdateAccount(account *types.Account, userId int, origin *types.AuditOrigin) (*types.Account, error) {
+	// only owners can rename the account or correct its balance
+	token, err := s.policy.CanManageAccountById(userId, account.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.ValidateOwnership(account.UserID, currentAccount.UserID, "account"); err != nil {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockAccount(tx, token); err != nil {
 		return nil, err
 	}
 
-	_, err = db.ExecWithValidation(s.db,
+	previous, err := getAccount(tx, token, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching account: %w", err)
+	}
+
+	_, err = tx.Exec(
 		"UPDATE accounts SET account_name = $1, balance = $2 WHERE id = $3",
 		account.AccountName, account.Balance, account.ID)
-
 	if err != nil {
 		return nil, err
 	}
 
 	// Fetch the updated account to return it
-	updatedAccount, err := s.GetAccountById(account.ID, userId)
+	updated, err := getAccount(tx, token, userId)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching updated account: %w", err)
 	}
 
-	return updatedAccount, nil
+	if err := audit.Record(tx, origin, accountChange(userId, types.AuditActionUpdate, previous, updated)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
 }
 
-func (s *Store) DeleteAccount(token string, userId int) error {
-	// first get the account so that we can check if the user is the owner of the account
-	account, err := s.GetAccountByToken(token, userId)
+// DeleteAccount moves the account to the trash. Its transactions stay untouched and come
+// back with it.
+func (s *Store) DeleteAccount(token string, userId int, origin *types.AuditOrigin) error {
+	// only owners can delete the account, for everyone it is shared with
+	if err := s.policy.CanManageAccount(userId, token); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	if err := lockAccount(tx, token); err != nil {
+		return err
+	}
 
-	if account.UserID != userId {
-		return fmt.Errorf("user does not have permission to delete this account")
+	deleted, err := getAccount(tx, token, userId)
+	if err != nil {
+		return fmt.Errorf("error fetching account: %w", err)
 	}
 
-	// delete all transactions associated with the account
-	_, err = db.ExecWithValidation(s.db, "DELETE FROM transactions WHERE account_token = $1", token)
+	_, err = tx.Exec("UPDATE accounts SET deleted_at = CURRENT_TIMESTAMP WHERE token = $1 AND deleted_at IS NULL", token)
 	if err != nil {
 		return err
 	}
 
-	// delete the account
-	_, err = db.ExecWithValidation(s.db, "DELETE FROM accounts WHERE token = $1 AND user_id = $2", token, userId)
+	// an account in the trash can't stay preselected for new transactions
+	_, err = tx.Exec("UPDATE user_settings SET default_account_token = NULL WHERE default_account_token = $1", token)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := audit.Record(tx, origin, accountChange(userId, types.AuditActionDelete, deleted, nil)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (s *Store) ReorderAccounts(userId int, accounts []types.ReorderAccount) error {
-	// Check: all tokens belong to the user
-	tokens := make([]any, len(accounts))
-	placeholders := make([]string, len(accounts))
-	for i, account := range accounts {
-		tokens[i] = account.Token
-		placeholders[i] = fmt.Sprintf("$%d", i+2) // Start from $2 since $1 is userId
+// RestoreAccount takes the account out of the trash with the transactions it had. Its balance
+// was kept, so there is nothing to recompute.
+func (s *Store) RestoreAccount(token string, userId int, origin *types.AuditOrigin) (*types.Account, error) {
+	if err := s.policy.CanRestoreAccount(userId, token); err != nil {
+		return nil, err
 	}
-	query := fmt.Sprintf(
-		"SELECT COUNT(*) FROM accounts WHERE user_id = $1 AND token IN (%s)",
-		strings.Join(placeholders, ","),
-	)
-	args := append([]any{userId}, tokens...)
-	var count int
-	err := s.db.QueryRow(query, args...).Scan(&count)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE accounts SET deleted_at = NULL WHERE token = $1 AND deleted_at IS NOT NULL", token)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	// someone else restored it in the meantime
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("account %w", authz.ErrNotFound)
+	}
+
+	account, err := getAccount(tx, token, userId)
 	if err != nil {
-		return fmt.Errorf("failed to verify account ownership: %w", err)
+		return nil, err
+	}
+
+	if err := audit.Record(tx, origin, accountChange(userId, types.AuditActionRestore, nil, account)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
-	if count != len(accounts) {
-		return fmt.Errorf("one or more accounts do not belong to the user")
+
+	return account, nil
+}
+
+func (s *Store) ReorderAccounts(userId int, accounts []types.ReorderAccount, origin *types.AuditOrigin) error {
+	// Check: the user is a member of every account, the order is theirs alone
+	for _, account := range accounts {
+		if err := s.policy.CanReadAccount(userId, account.Token); err != nil {
+			return err
+		}
 	}
 
 	// Check: all order indexes are unique
@@ -192,33 +313,87 @@ func (s *Store) ReorderAccounts(userId int, accounts []types.ReorderAccount) err
 		orderIndexes[account.OrderIndex] = true
 	}
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// Proceed with update
 	for _, account := range accounts {
-		_, err := db.ExecWithValidation(s.db, "UPDATE accounts SET order_index = $1 WHERE token = $2 AND user_id = $3", account.OrderIndex, account.Token, userId)
+		err := s.updateMembership(tx, account.Token, userId, origin,
+			"UPDATE account_members SET order_index = $1 WHERE account_token = $2 AND user_id = $3", account.OrderIndex)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (s *Store) FavoriteAccount(token string, userId int, isFavorite bool) error {
-	// first get the account so that we can check if the user is the owner of the account
-	account, err := s.GetAccountByToken(token, userId)
+func (s *Store) FavoriteAccount(token string, userId int, isFavorite bool, origin *types.AuditOrigin) error {
+	// favorites are personal, any member can mark a shared account
+	if err := s.policy.CanReadAccount(userId, token); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if account.UserID != userId {
-		return fmt.Errorf("user does not have permission to favorite this account")
+	err = s.updateMembership(tx, token, userId, origin,
+		"UPDATE account_members SET is_favorite = $1 WHERE account_token = $2 AND user_id = $3", isFavorite)
+	if err != nil {
+		return err
 	}
 
-	_, err = db.ExecWithValidation(s.db,
-		"UPDATE accounts SET is_favorite = $1 WHERE token = $2 AND user_id = $3",
-		isFavorite, token, userId)
+	return tx.Commit()
+}
 
-	return err
+// updateMembership changes how the user sees the account and audits it. The update takes the
+// new value, the account token and the user id, in that order.
+func (s *Store) updateMembership(tx *sql.Tx, token string, userId int, origin *types.AuditOrigin, update string, value interface{}) error {
+	previous, err := getAccount(tx, token, userId)
+	if err != nil {
+		return fmt.Errorf("error fetching account: %w", err)
+	}
+
+	if _, err := tx.Exec(update, value, token, userId); err != nil {
+		return err
+	}
+
+	updated, err := getAccount(tx, token, userId)
+	if err != nil {
+		return fmt.Errorf("error fetching updated account: %w", err)
+	}
+
+	return audit.Record(tx, origin, accountChange(userId, types.AuditActionUpdate, previous, updated))
+}
+
+// accountChange describes a change to one account, either side is nil when it doesn't exist
+func accountChange(userId int, action string, before, after *types.Account) types.AuditChange {
+	account := after
+	if account == nil {
+		account = before
+	}
+
+	change := types.AuditChange{
+		UserID:       userId,
+		AccountToken: account.Token,
+		EntityType:   types.AuditEntityAccount,
+		EntityID:     account.Token,
+		Action:       action,
+	}
+	// a nil pointer would be stored as JSON null instead of leaving the side out
+	if before != nil {
+		change.Before = before
+	}
+	if after != nil {
+		change.After = after
+	}
+	return change
 }
 
 func scanRowIntoAccount(row *sql.Row) (*types.Account, error) {
@@ -232,6 +407,8 @@ func scanRowIntoAccount(row *sql.Row) (*types.Account, error) {
 		&a.CreatedAt,
 		&a.OrderIndex,
 		&a.IsFavorite,
+		&a.Role,
+		&a.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -250,6 +427,8 @@ func scanRowsIntoAccount(rows *sql.Rows) (*types.Account, error) {
 		&a.CreatedAt,
 		&a.OrderIndex,
 		&a.IsFavorite,
+		&a.Role,
+		&a.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -258,77 +437,51 @@ func scanRowsIntoAccount(rows *sql.Rows) (*types.Account, error) {
 }
 
 func (s *Store) GetAccountFeedbackMonthly(userId int, accountToken, language string, month, year int) (*types.MonthlyFeedback, error) {
-	// check if the account belongs to the user
-	account, err := s.GetAccountByToken(accountToken, userId)
-	if err != nil {
+	// any member of the account can read the feedback
+	if err := s.policy.CanReadAccount(userId, accountToken); err != nil {
 		return nil, err
 	}
-	if account.UserID != userId {
-		return nil, fmt.Errorf("user does not have permission to access this account")
-	}
 
-	// Get the transactions for the account using the transaction store
-	transactions, err := s.transactionsStore.GetTransactionsByAccountToken(accountToken, &month, &year)
+	// Get the transactions for the account using the transaction store, each with its own
+	// category, members of a shared account have their own categories
+	transactions, err := s.transactionsStore.GetTransactionsDTOByAccountToken(userId, accountToken, &month, &year)
 	if err != nil {
 		return nil, fmt.Errorf("error getting transactions: %v", err)
 	}
 
-	categories, err := s.categoryStore.GetCategoriesByUserId(userId)
+	settings, err := s.settingsStore.GetSettingsByUserId(userId)
 	if err != nil {
-		return nil, fmt.Errorf("error getting categories: %v", err)
+		return nil, fmt.Errorf("error getting settings: %v", err)
 	}
-
-	// Create a map to store category names by ID
-	categoryMap := make(map[int]*types.Category)
-	for _, category := range categories {
-		categoryMap[category.ID] = category
+	if language == "" {
+		language = settings.FeedbackLanguage()
 	}
 
-	// Format transactions for the prompt
-	var transactionsData strings.Builder
-
-	for _, tx := range transactions {
-		// Determine transaction type based on transaction type ID
-		txType := "DEBIT"
-		categoryName := "Uncategorized"
-
-		// Get category info if available
-		if category, exists := categoryMap[tx.CategoryId]; exists {
-			categoryName = category.CategoryName
-
-			// Determine transaction type based on category's transaction type ID
-			switch category.TransactionTypeID {
-			case int(types.CreditTransactionType):
-				txType = "CREDIT"
-			case int(types.DebitTransactionType):
-				txType = "DEBIT"
-			case int(types.TransferTransactionType):
-				txType = "TRANSFER"
-			}
-		}
+	// Format transactions for the prompt, honouring the user's privacy settings
+	transactionsData := buildTransactionsPromptData(transactions, settings)
 
-		// get the transaction type by the category transaction type id
-
-		// Format the transaction line
-		transactionsData.WriteString(fmt.Sprintf("- Date: %s | Description: %s | Amount: %.2f | Type: %s | Category: %s\n",
-			tx.Date,
-			tx.Description,
-			tx.Amount,
-			txType,
-			categoryName))
+	// The statistical detector gives the model facts instead of asking it to guess outliers
+	anomalies, err := s.anomalyStore.DetectAnomalies(userId, accountToken, &month, &year)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting anomalies: %v", err)
 	}
-
-	// Read the prompt template
-	promptTemplate, err := os.ReadFile("prompts/monthlyFeedback.txt")
+	anomaliesData, err := buildAnomaliesPromptData(anomalies.Anomalies, settings)
 	if err != nil {
-		return nil, fmt.Errorf("error reading prompt template: %v", err)
+		return nil, fmt.Errorf("error formatting anomalies: %v", err)
 	}
 
-	// Combine template with transactions data
-	feedbackLanguage := fmt.Sprintf("\n\n\n Give the feedback in the following language: %s", language)
-	fullPrompt := string(promptTemplate) + "\n" + transactionsData.String() + feedbackLanguage
+	prompt, err := prompts.Render(prompts.MonthlyFeedback, language, prompts.MonthlyFeedbackData{
+		Transactions: transactionsData,
+		Anomalies:    anomaliesData,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error rendering prompt: %v", err)
+	}
+	fullPrompt := prompt.Text
 
-	log.Println("Full prompt:", fullPrompt)
+	if config.Envs.LogAIPrompts {
+		log.Println("Full prompt:", fullPrompt)
+	}
 
 	// Call the OpenAI API to get the feedback
 	message, err := s.openAiStore.GenerateGPT4Response(fullPrompt)
@@ -336,7 +489,9 @@ func (s *Store) GetAccountFeedbackMonthly(userId int, accountToken, language str
 		return nil, fmt.Errorf("error generating feedback: %v", err)
 	}
 
-	log.Println("Generated message:", message)
+	if config.Envs.LogAIPrompts {
+		log.Println("Generated message:", message)
+	}
 
 	// unmarshal the message to get the feedback
 	feedback := new(types.MonthlyFeedback)
@@ -344,6 +499,7 @@ func (s *Store) GetAccountFeedbackMonthly(userId int, accountToken, language str
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling feedback: %v", err)
 	}
+	feedback.PromptVersion = prompt.Version
 
 	return feedback, nil
 }
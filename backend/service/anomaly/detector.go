@@ -0,0 +1,411 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+// Options tunes the statistical thresholds of the detector
+type Options struct {
+	// Minimum number of past transactions in a category before judging a single amount
+	MinCategoryHistory int
+	// Robust z-score (median / MAD based) above which a transaction is unusually large
+	LargeTransactionScore float64
+	// Number of past months compared against when looking for category spikes
+	SpikeLookbackMonths int
+	// Standard deviations above the monthly mean that count as a spike
+	SpikeStdDevs float64
+	// Minimum increase in euros for a spike to be reported, avoids noise on tiny categories
+	SpikeMinIncrease float64
+	// Same amount and description within this many days is a possible duplicate
+	DuplicateWindowDays int
+	// Income seen in at least this many of the lookback months is considered expected
+	IncomeMinOccurrences int
+	// Days after the usual income day before a missing income is reported
+	IncomeGraceDays int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MinCategoryHistory:    5,
+		LargeTransactionScore: 3.5,
+		SpikeLookbackMonths:   6,
+		SpikeStdDevs:          2,
+		SpikeMinIncrease:      20,
+		DuplicateWindowDays:   3,
+		IncomeMinOccurrences:  3,
+		IncomeGraceDays:       5,
+	}
+}
+
+// Detect runs every detector over the full transaction history of an account and
+// reports the anomalies that fall inside the given month
+func Detect(transactions []*types.TransactionDTO, month, year int, now time.Time, opts Options) []*types.Anomaly {
+	periodStart := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, now.Location())
+	periodEnd := periodStart.AddDate(0, 1, 0)
+
+	valid := make([]*types.TransactionDTO, 0, len(transactions))
+	for _, tx := range transactions {
+		if tx.Category != nil && tx.Category.TransactionType != nil {
+			valid = append(valid, tx)
+		}
+	}
+	sort.Slice(valid, func(i, j int) bool {
+		if valid[i].Date.Equal(valid[j].Date) {
+			return valid[i].ID < valid[j].ID
+		}
+		return valid[i].Date.Before(valid[j].Date)
+	})
+
+	anomalies := []*types.Anomaly{}
+	anomalies = append(anomalies, detectLargeTransactions(valid, periodStart, periodEnd, opts)...)
+	anomalies = append(anomalies, detectCategorySpikes(valid, periodStart, opts)...)
+	anomalies = append(anomalies, detectDuplicates(valid, periodStart, periodEnd, opts)...)
+	anomalies = append(anomalies, detectMissingIncome(valid, periodStart, periodEnd, now, opts)...)
+	return anomalies
+}
+
+func inPeriod(tx *types.TransactionDTO, start, end time.Time) bool {
+	return !tx.Date.Before(start) && tx.Date.Before(end)
+}
+
+func isType(tx *types.TransactionDTO, typeId types.TransactionTypeID) bool {
+	return tx.Category.TransactionType.ID == int(typeId)
+}
+
+// detectLargeTransactions compares each debit with the earlier debits of its category
+// using a robust z-score, so a single past outlier does not hide a new one
+func detectLargeTransactions(transactions []*types.TransactionDTO, start, end time.Time, opts Options) []*types.Anomaly {
+	anomalies := []*types.Anomaly{}
+	history := make(map[int][]float64)
+
+	for _, tx := range transactions {
+		if !isType(tx, types.DebitTransactionType) {
+			continue
+		}
+		past := history[tx.Category.ID]
+		history[tx.Category.ID] = append(past, tx.Amount)
+
+		if !inPeriod(tx, start, end) || len(past) < opts.MinCategoryHistory {
+			continue
+		}
+
+		median := percentile(past, 0.5)
+		score := robustScore(tx.Amount, past)
+		if score < opts.LargeTransactionScore || tx.Amount < 2*median {
+			continue
+		}
+
+		anomalies = append(anomalies, &types.Anomaly{
+			Type:           types.AnomalyLargeTransaction,
+			Severity:       severityFromScore(score, opts.LargeTransactionScore),
+			Category:       tx.Category.CategoryName,
+			Description:    tx.Description,
+			Amount:         utils.Round(tx.Amount, 2),
+			Expected:       utils.Round(median, 2),
+			Score:          utils.Round(score, 2),
+			Date:           tx.Date.Format("2006-01-02"),
+			TransactionIDs: []int{tx.ID},
+			Explanation: fmt.Sprintf("%.2f€ in %s is %.1fx the usual %.2f€ for this category (based on %d previous transactions)",
+				tx.Amount, tx.Category.CategoryName, tx.Amount/median, median, len(past)),
+		})
+	}
+
+	return anomalies
+}
+
+// detectCategorySpikes compares each category's total in the period with its previous months
+func detectCategorySpikes(transactions []*types.TransactionDTO, start time.Time, opts Options) []*types.Anomaly {
+	anomalies := []*types.Anomaly{}
+	lookbackStart := start.AddDate(0, -opts.SpikeLookbackMonths, 0)
+
+	type categoryMonths struct {
+		name   string
+		totals map[string]float64
+		ids    []int
+	}
+	categories := make(map[int]*categoryMonths)
+	for _, tx := range transactions {
+		if !isType(tx, types.DebitTransactionType) || tx.Date.Before(lookbackStart) || !tx.Date.Before(start.AddDate(0, 1, 0)) {
+			continue
+		}
+		entry, exists := categories[tx.Category.ID]
+		if !exists {
+			entry = &categoryMonths{name: tx.Category.CategoryName, totals: make(map[string]float64)}
+			categories[tx.Category.ID] = entry
+		}
+		key := tx.Date.Format("2006-01")
+		entry.totals[key] += tx.Amount
+		if key == start.Format("2006-01") {
+			entry.ids = append(entry.ids, tx.ID)
+		}
+	}
+
+	// iterate in a stable order so results are deterministic
+	ids := make([]int, 0, len(categories))
+	for id := range categories {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		entry := categories[id]
+		current := entry.totals[start.Format("2006-01")]
+		if current == 0 {
+			continue
+		}
+
+		// months without spending count as zero once the category has history
+		past := []float64{}
+		seen := false
+		for i := opts.SpikeLookbackMonths; i >= 1; i-- {
+			total, exists := entry.totals[start.AddDate(0, -i, 0).Format("2006-01")]
+			seen = seen || exists
+			if seen {
+				past = append(past, total)
+			}
+		}
+		if len(past) < 3 {
+			continue
+		}
+
+		mean, stdDev := meanAndStdDev(past)
+		threshold := mean + opts.SpikeStdDevs*stdDev
+		if current <= threshold || current < 1.5*mean || current-mean < opts.SpikeMinIncrease {
+			continue
+		}
+
+		score := (current - mean) / math.Max(stdDev, 1)
+		anomalies = append(anomalies, &types.Anomaly{
+			Type:           types.AnomalyCategorySpike,
+			Severity:       severityFromScore(score, opts.SpikeStdDevs),
+			Category:       entry.name,
+			Amount:         utils.Round(current, 2),
+			Expected:       utils.Round(mean, 2),
+			Score:          utils.Round(score, 2),
+			TransactionIDs: entry.ids,
+			Explanation: fmt.Sprintf("spending in %s reached %.2f€ this month against an average of %.2f€ over the previous %d months (+%.0f%%)",
+				entry.name, current, mean, len(past), (current-mean)/math.Max(mean, 1)*100),
+		})
+	}
+
+	return anomalies
+}
+
+// detectDuplicates flags debits with the same amount and description close in time
+func detectDuplicates(transactions []*types.TransactionDTO, start, end time.Time, opts Options) []*types.Anomaly {
+	anomalies := []*types.Anomaly{}
+	window := time.Duration(opts.DuplicateWindowDays) * 24 * time.Hour
+	reported := make(map[int]bool)
+
+	for i, first := range transactions {
+		if !isType(first, types.DebitTransactionType) || reported[first.ID] {
+			continue
+		}
+		key := normalizeDescription(first.Description)
+		if key == "" {
+			continue
+		}
+
+		group := []*types.TransactionDTO{first}
+		for _, other := range transactions[i+1:] {
+			if other.Date.Sub(first.Date) > window {
+				break
+			}
+			if isType(other, types.DebitTransactionType) && other.Amount == first.Amount && normalizeDescription(other.Description) == key {
+				group = append(group, other)
+			}
+		}
+		if len(group) < 2 || !anyInPeriod(group, start, end) {
+			continue
+		}
+
+		ids := make([]int, len(group))
+		for j, tx := range group {
+			ids[j] = tx.ID
+			reported[tx.ID] = true
+		}
+
+		severity := types.AnomalySeverityMedium
+		if group[len(group)-1].Date.Sub(first.Date) < 24*time.Hour {
+			severity = types.AnomalySeverityHigh
+		}
+
+		anomalies = append(anomalies, &types.Anomaly{
+			Type:           types.AnomalyDuplicateCharge,
+			Severity:       severity,
+			Category:       first.Category.CategoryName,
+			Description:    first.Description,
+			Amount:         utils.Round(first.Amount, 2),
+			Expected:       utils.Round(first.Amount, 2),
+			Score:          float64(len(group)),
+			Date:           first.Date.Format("2006-01-02"),
+			TransactionIDs: ids,
+			Explanation: fmt.Sprintf("%d charges of %.2f€ in %s with the same description within %d days, possibly duplicated",
+				len(group), first.Amount, first.Category.CategoryName, opts.DuplicateWindowDays),
+		})
+	}
+
+	return anomalies
+}
+
+// detectMissingIncome looks for credits that arrived in most previous months but not in this one,
+// waiting for the usual day of the month plus a grace period before reporting
+func detectMissingIncome(transactions []*types.TransactionDTO, start, end time.Time, now time.Time, opts Options) []*types.Anomaly {
+	anomalies := []*types.Anomaly{}
+	lookbackStart := start.AddDate(0, -opts.SpikeLookbackMonths, 0)
+
+	type incomeSource struct {
+		category string
+		months   map[string]bool
+		days     []float64
+		amounts  []float64
+		current  bool
+	}
+	sources := make(map[int]*incomeSource)
+	for _, tx := range transactions {
+		if !isType(tx, types.CreditTransactionType) || tx.Date.Before(lookbackStart) || !tx.Date.Before(end) {
+			continue
+		}
+		source, exists := sources[tx.Category.ID]
+		if !exists {
+			source = &incomeSource{category: tx.Category.CategoryName, months: make(map[string]bool)}
+			sources[tx.Category.ID] = source
+		}
+		if inPeriod(tx, start, end) {
+			source.current = true
+			continue
+		}
+		source.months[tx.Date.Format("2006-01")] = true
+		source.days = append(source.days, float64(tx.Date.Day()))
+		source.amounts = append(source.amounts, tx.Amount)
+	}
+
+	ids := make([]int, 0, len(sources))
+	for id := range sources {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		source := sources[id]
+		if source.current || len(source.months) < opts.IncomeMinOccurrences {
+			continue
+		}
+
+		usualDay := int(percentile(source.days, 0.5))
+		deadline := start.AddDate(0, 0, usualDay-1+opts.IncomeGraceDays)
+		if deadline.After(end) {
+			deadline = end
+		}
+		if now.Before(deadline) {
+			continue
+		}
+
+		expected := percentile(source.amounts, 0.5)
+		anomalies = append(anomalies, &types.Anomaly{
+			Type:           types.AnomalyMissingIncome,
+			Severity:       types.AnomalySeverityHigh,
+			Category:       source.category,
+			Amount:         0,
+			Expected:       utils.Round(expected, 2),
+			Score:          float64(len(source.months)),
+			TransactionIDs: []int{},
+			Explanation: fmt.Sprintf("%s of about %.2f€ usually arrives around day %d (seen in %d of the last %d months) but has not been recorded this month",
+				source.category, expected, usualDay, len(source.months), opts.SpikeLookbackMonths),
+		})
+	}
+
+	return anomalies
+}
+
+func anyInPeriod(transactions []*types.TransactionDTO, start, end time.Time) bool {
+	for _, tx := range transactions {
+		if inPeriod(tx, start, end) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDescription(description string) string {
+	return strings.Join(strings.Fields(strings.ToLower(description)), " ")
+}
+
+// maxScore caps scores that would otherwise be infinite so they can be encoded as JSON
+const maxScore = 99
+
+// robustScore is the modified z-score based on the median absolute deviation,
+// falling back to the standard deviation when most values are identical
+func robustScore(value float64, sample []float64) float64 {
+	median := percentile(sample, 0.5)
+	deviations := make([]float64, len(sample))
+	for i, v := range sample {
+		deviations[i] = math.Abs(v - median)
+	}
+	mad := percentile(deviations, 0.5)
+	if mad > 0 {
+		return 0.6745 * (value - median) / mad
+	}
+
+	mean, stdDev := meanAndStdDev(sample)
+	if stdDev > 0 {
+		return (value - mean) / stdDev
+	}
+	if median > 0 && value > 3*median {
+		// every past value was identical, anything three times bigger stands out
+		return maxScore
+	}
+	return 0
+}
+
+func meanAndStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+// percentile returns the p-th percentile (0..1) using linear interpolation
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	position := p * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
+
+func severityFromScore(score, threshold float64) string {
+	switch {
+	case score >= threshold*2:
+		return types.AnomalySeverityHigh
+	case score >= threshold*1.4:
+		return types.AnomalySeverityMedium
+	default:
+		return types.AnomalySeverityLow
+	}
+}
@@ -0,0 +1,107 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+var (
+	groceries = &types.CategoryDTO{ID: 1, CategoryName: "Groceries", TransactionType: &types.TransactionType{ID: int(types.DebitTransactionType)}}
+	salary    = &types.CategoryDTO{ID: 2, CategoryName: "Salary", TransactionType: &types.TransactionType{ID: int(types.CreditTransactionType)}}
+)
+
+type txBuilder struct {
+	nextId       int
+	transactions []*types.TransactionDTO
+}
+
+func (b *txBuilder) add(category *types.CategoryDTO, amount float64, description string, date time.Time) {
+	b.nextId++
+	b.transactions = append(b.transactions, &types.TransactionDTO{
+		ID:          b.nextId,
+		Amount:      amount,
+		Description: description,
+		Date:        date,
+		Category:    category,
+	})
+}
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 12, 0, 0, 0, time.UTC)
+}
+
+func findByType(anomalies []*types.Anomaly, kind string) []*types.Anomaly {
+	found := []*types.Anomaly{}
+	for _, a := range anomalies {
+		if a.Type == kind {
+			found = append(found, a)
+		}
+	}
+	return found
+}
+
+func TestDetect(t *testing.T) {
+	b := &txBuilder{}
+	// six months of regular groceries and salary
+	for m := time.January; m <= time.June; m++ {
+		b.add(groceries, 50, "Continente", day(2025, m, 5))
+		b.add(groceries, 45, "Pingo Doce", day(2025, m, 15))
+		b.add(groceries, 55, "Lidl", day(2025, m, 25))
+		b.add(salary, 1500, "Ordenado", day(2025, m, 1))
+	}
+	// July: one huge purchase, a duplicate charge and no salary
+	b.add(groceries, 400, "Continente", day(2025, time.July, 3))
+	b.add(groceries, 30, "Lidl", day(2025, time.July, 10))
+	b.add(groceries, 30, "lidl", day(2025, time.July, 11))
+
+	now := day(2025, time.July, 20)
+	anomalies := Detect(b.transactions, 7, 2025, now, DefaultOptions())
+
+	large := findByType(anomalies, types.AnomalyLargeTransaction)
+	if len(large) != 1 || large[0].Amount != 400 {
+		t.Errorf("expected the 400€ purchase to be flagged as large, got %+v", large)
+	}
+
+	spikes := findByType(anomalies, types.AnomalyCategorySpike)
+	if len(spikes) != 1 || spikes[0].Category != "Groceries" {
+		t.Errorf("expected a groceries spike, got %+v", spikes)
+	}
+
+	duplicates := findByType(anomalies, types.AnomalyDuplicateCharge)
+	if len(duplicates) != 1 || len(duplicates[0].TransactionIDs) != 2 {
+		t.Errorf("expected one duplicate pair, got %+v", duplicates)
+	}
+
+	missing := findByType(anomalies, types.AnomalyMissingIncome)
+	if len(missing) != 1 || missing[0].Category != "Salary" || missing[0].Expected != 1500 {
+		t.Errorf("expected the missing salary to be reported, got %+v", missing)
+	}
+}
+
+func TestDetectWaitsForUsualIncomeDay(t *testing.T) {
+	b := &txBuilder{}
+	for m := time.January; m <= time.June; m++ {
+		b.add(salary, 1500, "Ordenado", day(2025, m, 25))
+	}
+
+	// the salary usually arrives on the 25th, nothing is missing yet on the 10th
+	anomalies := Detect(b.transactions, 7, 2025, day(2025, time.July, 10), DefaultOptions())
+	if missing := findByType(anomalies, types.AnomalyMissingIncome); len(missing) != 0 {
+		t.Errorf("expected no missing income before the usual day, got %+v", missing)
+	}
+}
+
+func TestDetectIgnoresRegularSpending(t *testing.T) {
+	b := &txBuilder{}
+	for m := time.January; m <= time.July; m++ {
+		b.add(groceries, 50, "Continente", day(2025, m, 5))
+		b.add(groceries, 60, "Lidl", day(2025, m, 20))
+	}
+
+	anomalies := Detect(b.transactions, 7, 2025, day(2025, time.July, 28), DefaultOptions())
+	if len(anomalies) != 0 {
+		t.Errorf("expected no anomalies for regular spending, got %+v", anomalies)
+	}
+}
@@ -0,0 +1,64 @@
+package anomaly
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+type Handler struct {
+	store types.AnomalyStore
+}
+
+func NewHandler(store types.AnomalyStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/accounts/{token}/anomalies", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.GetAnomalies,
+		}),
+	))
+}
+
+func (h *Handler) GetAnomalies(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract account token from URL path (/accounts/{token}/anomalies)
+	accountToken, ok := middleware.ExtractPathParamAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	// month and year are optional, both must be sent to pick a month other than the current one
+	query := r.URL.Query()
+	var month, year *int
+	if monthStr, yearStr := query.Get("month"), query.Get("year"); monthStr != "" && yearStr != "" {
+		monthVal, monthErr := strconv.Atoi(monthStr)
+		yearVal, yearErr := strconv.Atoi(yearStr)
+		if monthErr != nil || yearErr != nil || monthVal < 1 || monthVal > 12 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid month or year parameters"))
+			return
+		}
+		month = &monthVal
+		year = &yearVal
+	}
+
+	report, err := h.store.DetectAnomalies(userId, accountToken, month, year)
+	if err != nil {
+		utils.WriteError(w, authz.StatusCode(err), err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, report)
+}
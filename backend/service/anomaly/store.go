@@ -0,0 +1,43 @@
+package anomaly
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+type Store struct {
+	transactionStore types.TransactionStore
+	options          Options
+}
+
+func NewStore(transactionStore types.TransactionStore) *Store {
+	return &Store{
+		transactionStore: transactionStore,
+		options:          DefaultOptions(),
+	}
+}
+
+// DetectAnomalies runs the detector for a month of an account, defaulting to the current month
+func (s *Store) DetectAnomalies(userId int, accountToken string, month, year *int) (*types.AnomalyReport, error) {
+	now := time.Now()
+	targetMonth, targetYear := int(now.Month()), now.Year()
+	if month != nil && year != nil {
+		targetMonth, targetYear = *month, *year
+	}
+
+	// the whole history is needed to build the per-category baselines, reading it checks the
+	// user is a member of the account
+	transactions, err := s.transactionStore.GetTransactionsDTOByAccountToken(userId, accountToken, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %w", err)
+	}
+
+	return &types.AnomalyReport{
+		AccountToken: accountToken,
+		Month:        targetMonth,
+		Year:         targetYear,
+		Anomalies:    Detect(transactions, targetMonth, targetYear, now, s.options),
+	}, nil
+}
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const maxUserAgentLen = 255
+
+// Origin reads where the request came from the same way sessions do
+func Origin(r *http.Request) *types.AuditOrigin {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLen {
+		userAgent = userAgent[:maxUserAgentLen]
+	}
+
+	return &types.AuditOrigin{
+		IPAddress: middleware.GetClientIP(r),
+		UserAgent: userAgent,
+	}
+}
+
+// NewEvent turns a change into an event stamped with its origin
+func NewEvent(origin *types.AuditOrigin, change types.AuditChange) (*types.AuditEvent, error) {
+	before, err := marshalState(change.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := marshalState(change.After)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &types.AuditEvent{
+		UserID:     change.UserID,
+		EntityType: change.EntityType,
+		EntityID:   change.EntityID,
+		Action:     change.Action,
+		Before:     before,
+		After:      after,
+		IPAddress:  origin.IPAddress,
+		UserAgent:  origin.UserAgent,
+	}
+	if change.AccountToken != "" {
+		accountToken := change.AccountToken
+		event.AccountToken = &accountToken
+	}
+
+	return event, nil
+}
+
+// Record saves the change in tx, the database transaction that makes it, so the change and
+// its event are committed or rolled back together
+func Record(tx *sql.Tx, origin *types.AuditOrigin, change types.AuditChange) error {
+	event, err := NewEvent(origin, change)
+	if err == nil {
+		err = insertEvent(tx, event)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to audit %s %s %s: %w", change.Action, change.EntityType, change.EntityID, err)
+	}
+	return nil
+}
+
+func marshalState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type Handler struct {
+	store types.AuditStore
+}
+
+func NewHandler(store types.AuditStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/audit-events", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.GetAuditEvents,
+		}),
+	))
+}
+
+// GetAuditEvents lists the user's own changes, newest first. The next page starts before
+// the id returned as next_before.
+func (h *Handler) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	limit, beforeId, err := parsePage(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	events, err := h.store.GetEventsByUserId(userId, limit, beforeId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"events": events,
+	}
+	if len(events) == limit {
+		response["next_before"] = events[len(events)-1].ID
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func parsePage(r *http.Request) (limit int, beforeId int64, err error) {
+	limit = defaultPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, fmt.Errorf("query parameter limit must be between 1 and %d", maxPageSize)
+		}
+	}
+
+	if value := r.URL.Query().Get("before"); value != "" {
+		beforeId, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || beforeId < 1 {
+			return 0, 0, fmt.Errorf("query parameter before must be a positive integer")
+		}
+	}
+
+	return limit, beforeId, nil
+}
@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+// mockAuditStore keeps the events in memory, in the order they were recorded
+type mockAuditStore struct {
+	events []*types.AuditEvent
+}
+
+func (m *mockAuditStore) add(event *types.AuditEvent) {
+	event.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, event)
+}
+
+func (m *mockAuditStore) GetEventsByUserId(userId int, limit int, beforeId int64) ([]*types.AuditEvent, error) {
+	events := []*types.AuditEvent{}
+	for i := len(m.events) - 1; i >= 0 && len(events) < limit; i-- {
+		event := m.events[i]
+		if event.UserID == userId && (beforeId == 0 || event.ID < beforeId) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockAuditStore) GetAllEventsByUserId(userId int) ([]*types.AuditEvent, error) {
+	return m.GetEventsByUserId(userId, len(m.events), 0)
+}
+
+func TestNewEventStampsOrigin(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPut, "/settings", nil)
+	req.RemoteAddr = "203.0.113.7:5123"
+	// not from a trusted proxy, so the header is ignored
+	req.Header.Set("X-Forwarded-For", "198.51.100.9")
+	req.Header.Set("User-Agent", strings.Repeat("a", 300))
+
+	event, err := NewEvent(Origin(req), types.AuditChange{
+		UserID:       1,
+		AccountToken: "shared",
+		EntityType:   types.AuditEntityTransaction,
+		EntityID:     "10",
+		Action:       types.AuditActionUpdate,
+		Before:       map[string]float64{"amount": 10},
+		After:        map[string]float64{"amount": 12.5},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if event.IPAddress != "203.0.113.7" {
+		t.Errorf("expected the connection's ip, got %q", event.IPAddress)
+	}
+	if len(event.UserAgent) != maxUserAgentLen {
+		t.Errorf("expected the user agent to be cut to %d characters, got %d", maxUserAgentLen, len(event.UserAgent))
+	}
+	if event.AccountToken == nil || *event.AccountToken != "shared" {
+		t.Errorf("expected the account token to be kept, got %v", event.AccountToken)
+	}
+	if string(event.Before) != `{"amount":10}` || string(event.After) != `{"amount":12.5}` {
+		t.Errorf("unexpected states, before %s after %s", event.Before, event.After)
+	}
+}
+
+func TestNewEventLeavesMissingSideEmpty(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/categories", nil)
+	req.RemoteAddr = "198.51.100.2:5123"
+
+	event, err := NewEvent(Origin(req), types.AuditChange{
+		UserID:     1,
+		EntityType: types.AuditEntityCategory,
+		EntityID:   "3",
+		Action:     types.AuditActionCreate,
+		After:      &types.CategoryDTO{ID: 3, CategoryName: "Food"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if event.Before != nil {
+		t.Errorf("expected no before state for a creation, got %s", event.Before)
+	}
+	if event.AccountToken != nil {
+		t.Errorf("expected no account for a category, got %q", *event.AccountToken)
+	}
+	if event.IPAddress != "198.51.100.2" {
+		t.Errorf("expected the remote address, got %q", event.IPAddress)
+	}
+}
+
+func TestNewEventRejectsUnencodableState(t *testing.T) {
+	_, err := NewEvent(&types.AuditOrigin{}, types.AuditChange{
+		UserID:     1,
+		EntityType: types.AuditEntityAccount,
+		EntityID:   "abc",
+		Action:     types.AuditActionUpdate,
+		After:      make(chan int),
+	})
+	if err == nil {
+		t.Fatal("expected a state that can't be stored to fail the change")
+	}
+}
+
+func TestGetAuditEventsPages(t *testing.T) {
+	store := &mockAuditStore{}
+	for i := 0; i < 5; i++ {
+		store.add(&types.AuditEvent{UserID: 1, EntityType: types.AuditEntityAccount, Action: types.AuditActionUpdate})
+	}
+	// someone else's trail is never listed
+	store.add(&types.AuditEvent{UserID: 2, EntityType: types.AuditEntityAccount, Action: types.AuditActionUpdate})
+
+	handler := NewHandler(store)
+
+	rr := performRequest(handler, 1, "/audit-events?limit=3")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	page := decodePage(t, rr)
+	if ids := eventIds(page.Events); ids != "5,4,3" {
+		t.Errorf("expected the newest events first, got %s", ids)
+	}
+	if page.NextBefore == nil || *page.NextBefore != 3 {
+		t.Fatalf("expected the next page to start before 3, got %v", page.NextBefore)
+	}
+
+	rr = performRequest(handler, 1, "/audit-events?limit=3&before=3")
+	page = decodePage(t, rr)
+	if ids := eventIds(page.Events); ids != "2,1" {
+		t.Errorf("expected the older events, got %s", ids)
+	}
+	if page.NextBefore != nil {
+		t.Errorf("expected the last page to have no next page, got %d", *page.NextBefore)
+	}
+}
+
+func TestGetAuditEventsRejectsBadPage(t *testing.T) {
+	handler := NewHandler(&mockAuditStore{})
+
+	for _, query := range []string{"limit=0", "limit=201", "limit=ten", "before=-1"} {
+		rr := performRequest(handler, 1, "/audit-events?"+query)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+type eventsPage struct {
+	Events     []*types.AuditEvent `json:"events"`
+	NextBefore *int64              `json:"next_before"`
+}
+
+func performRequest(handler *Handler, userId int, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userId))
+	rr := httptest.NewRecorder()
+	handler.GetAuditEvents(rr, req)
+	return rr
+}
+
+func decodePage(t *testing.T, rr *httptest.ResponseRecorder) eventsPage {
+	t.Helper()
+
+	var page eventsPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return page
+}
+
+func eventIds(events []*types.AuditEvent) string {
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = strconv.FormatInt(event.ID, 10)
+	}
+	return strings.Join(ids, ",")
+}
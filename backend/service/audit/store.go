@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+const eventColumns = `
+    id, user_id, account_token, entity_type, entity_id, action, before, after, ip_address, user_agent, created_at
+`
+
+// insertEvent appends the event, q is the transaction of the change it records
+func insertEvent(q db.Querier, event *types.AuditEvent) error {
+	var accountToken sql.NullString
+	if event.AccountToken != nil {
+		accountToken = sql.NullString{String: *event.AccountToken, Valid: true}
+	}
+
+	err := q.QueryRow(
+		`INSERT INTO audit_events (user_id, account_token, entity_type, entity_id, action, before, after, ip_address, user_agent)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING id, created_at`,
+		event.UserID, accountToken, event.EntityType, event.EntityID, event.Action,
+		nullableJson(event.Before), nullableJson(event.After), event.IPAddress, event.UserAgent,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) GetEventsByUserId(userId int, limit int, beforeId int64) ([]*types.AuditEvent, error) {
+	if beforeId > 0 {
+		query := fmt.Sprintf(`SELECT %s FROM audit_events WHERE user_id = $1 AND id < $2 ORDER BY id DESC LIMIT $3`, eventColumns)
+		return db.QueryList(s.db, query, scanRowsIntoEvent, userId, beforeId, limit)
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM audit_events WHERE user_id = $1 ORDER BY id DESC LIMIT $2`, eventColumns)
+	return db.QueryList(s.db, query, scanRowsIntoEvent, userId, limit)
+}
+
+// GetAllEventsByUserId returns the whole trail, oldest first, for the data export
+func (s *Store) GetAllEventsByUserId(userId int) ([]*types.AuditEvent, error) {
+	query := fmt.Sprintf(`SELECT %s FROM audit_events WHERE user_id = $1 ORDER BY id`, eventColumns)
+	return db.QueryList(s.db, query, scanRowsIntoEvent, userId)
+}
+
+// nullableJson stores a missing side of the change as NULL instead of the JSON null
+func nullableJson(value []byte) interface{} {
+	if len(value) == 0 || string(value) == "null" {
+		return nil
+	}
+	return string(value)
+}
+
+func scanRowsIntoEvent(rows *sql.Rows) (*types.AuditEvent, error) {
+	e := new(types.AuditEvent)
+	var accountToken sql.NullString
+	var before, after []byte
+	err := rows.Scan(&e.ID, &e.UserID, &accountToken, &e.EntityType, &e.EntityID, &e.Action,
+		&before, &after, &e.IPAddress, &e.UserAgent, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if accountToken.Valid {
+		e.AccountToken = &accountToken.String
+	}
+	if before != nil {
+		e.Before = before
+	}
+	if after != nil {
+		e.After = after
+	}
+	return e, nil
+}
@@ -1,20 +1,48 @@
 package auth
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/utils"
 )
 
-func CreateJWT(secret []byte, userID int) (string, error) {
+// Claims of the short-lived access token. The session ID ties the token to a
+// refresh token session so it stops working as soon as the session is revoked.
+type Claims struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	// Purpose is only set on intermediate tokens, which are never valid access tokens
+	Purpose string `json:"purpose,omitempty"`
+	jwt.RegisteredClaims
+}
+
+const (
+	PurposeTwoFactor  = "2fa"
+	twoFactorTokenTTL = 5 * time.Minute
+)
+
+func CreateJWT(secret []byte, userID int, sessionID string) (string, error) {
 	expiration := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":    strconv.Itoa(userID),
-		"expired_at": time.Now().Add(expiration).Unix(),
+	jti, err := utils.GenerateToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:    strconv.Itoa(userID),
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		},
 	})
 
 	tokenString, err := token.SignedString(secret)
@@ -25,44 +53,102 @@ func CreateJWT(secret []byte, userID int) (string, error) {
 	return tokenString, nil
 }
 
-func VerifyJWT(tokenString string) (bool, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.Envs.JWTSecret), nil
-	})
+// ParseJWT validates the signature, algorithm and expiration of an access token
+func ParseJWT(secret []byte, bearerToken string) (*Claims, error) {
+	tokenString := strings.TrimPrefix(bearerToken, "Bearer ")
 
+	claims := new(Claims)
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	if _, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return true, nil
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("token cannot be used for authentication")
+	}
+	if claims.SessionID == "" {
+		return nil, fmt.Errorf("token is not bound to a session")
 	}
 
-	return false, nil
+	return claims, nil
 }
 
-// get the user id from jwt token
-func GetUserIdFromToken(bearerToken string) (int, error) {
-	tokenString := strings.TrimPrefix(bearerToken, "Bearer ")
-	secret := []byte(config.Envs.JWTSecret)
+// CreateTwoFactorToken issues the intermediate token returned by a login that still
+// needs the second factor. Only the two factor verification endpoint accepts it.
+func CreateTwoFactorToken(secret []byte, userID int) (string, error) {
+	jti, err := utils.GenerateToken(16)
+	if err != nil {
+		return "", err
+	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:  strconv.Itoa(userID),
+		Purpose: PurposeTwoFactor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorTokenTTL)),
+		},
 	})
 
+	return token.SignedString(secret)
+}
+
+// ParseTwoFactorToken returns the claims of an intermediate token, the jti identifies the
+// login attempt so its codes can be counted
+func ParseTwoFactorToken(secret []byte, tokenString string) (*Claims, error) {
+	claims := new(Claims)
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, err
+	if !token.Valid || claims.Purpose != PurposeTwoFactor || claims.ID == "" {
+		return nil, fmt.Errorf("invalid two factor token")
 	}
 
-	userId, err := strconv.Atoi(claims["user_id"].(string))
+	return claims, nil
+}
+
+func VerifyJWT(tokenString string) (bool, error) {
+	_, err := ParseJWT([]byte(config.Envs.JWTSecret), tokenString)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// get the user id from jwt token
+func GetUserIdFromToken(bearerToken string) (int, error) {
+	claims, err := ParseJWT([]byte(config.Envs.JWTSecret), bearerToken)
 	if err != nil {
 		return 0, err
 	}
 
+	return claims.GetUserId()
+}
+
+func (c *Claims) GetUserId() (int, error) {
+	userId, err := strconv.Atoi(c.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user id in token")
+	}
+
 	return userId, nil
 }
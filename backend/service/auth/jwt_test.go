@@ -1,11 +1,16 @@
 package auth
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 func TestCreateJWT(t *testing.T){
 	secret := []byte("secret")
 
-	token, err := CreateJWT(secret, 1)
+	token, err := CreateJWT(secret, 1, "session")
 	if err != nil {
 		t.Errorf("error creating jwt %v", err)
 	}
@@ -14,4 +19,114 @@ func TestCreateJWT(t *testing.T){
 		t.Error("expected token to be not empty")
 	}
 
-}
\ No newline at end of file
+}
+
+func TestParseJWT(t *testing.T) {
+	secret := []byte("secret")
+
+	token, err := CreateJWT(secret, 42, "session")
+	if err != nil {
+		t.Fatalf("error creating jwt %v", err)
+	}
+
+	claims, err := ParseJWT(secret, "Bearer "+token)
+	if err != nil {
+		t.Fatalf("expected a valid token, got %v", err)
+	}
+	userId, err := claims.GetUserId()
+	if err != nil || userId != 42 {
+		t.Errorf("expected user 42, got %d (%v)", userId, err)
+	}
+	if claims.SessionID != "session" || claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		t.Errorf("expected sid, jti, iat and exp claims, got %+v", claims)
+	}
+
+	if _, err := ParseJWT([]byte("other-secret"), token); err == nil {
+		t.Error("expected an error for a token signed with another secret")
+	}
+}
+
+func TestParseJWTRejectsInvalidTokens(t *testing.T) {
+	secret := []byte("secret")
+
+	tests := []struct {
+		name  string
+		token *jwt.Token
+	}{
+		{
+			name: "expired",
+			token: jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+				UserID:    "1",
+				SessionID: "session",
+				RegisteredClaims: jwt.RegisteredClaims{
+					IssuedAt:  jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+				},
+			}),
+		},
+		{
+			name: "legacy token without exp",
+			token: jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"user_id":    "1",
+				"expired_at": time.Now().Add(time.Hour).Unix(),
+			}),
+		},
+		{
+			name: "no session",
+			token: jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+				UserID: "1",
+				RegisteredClaims: jwt.RegisteredClaims{
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				},
+			}),
+		},
+		{
+			name: "other algorithm",
+			token: jwt.NewWithClaims(jwt.SigningMethodHS512, Claims{
+				UserID:    "1",
+				SessionID: "session",
+				RegisteredClaims: jwt.RegisteredClaims{
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				},
+			}),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			signed, err := tc.token.SignedString(secret)
+			if err != nil {
+				t.Fatalf("error signing token %v", err)
+			}
+			if _, err := ParseJWT(secret, signed); err == nil {
+				t.Error("expected the token to be rejected")
+			}
+		})
+	}
+}
+
+func TestTwoFactorTokenIsNotAnAccessToken(t *testing.T) {
+	secret := []byte("secret")
+
+	token, err := CreateTwoFactorToken(secret, 7)
+	if err != nil {
+		t.Fatalf("error creating token %v", err)
+	}
+
+	if _, err := ParseJWT(secret, token); err == nil {
+		t.Error("expected the intermediate token to be rejected as an access token")
+	}
+
+	claims, err := ParseTwoFactorToken(secret, token)
+	if err != nil {
+		t.Fatalf("error parsing token %v", err)
+	}
+	if userId, _ := claims.GetUserId(); userId != 7 || claims.ID == "" {
+		t.Errorf("expected user 7 and a token id, got %d and %q", userId, claims.ID)
+	}
+
+	accessToken, _ := CreateJWT(secret, 7, "session")
+	if _, err := ParseTwoFactorToken(secret, accessToken); err == nil {
+		t.Error("expected an access token to be rejected by the two factor endpoint")
+	}
+}
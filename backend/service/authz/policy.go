@@ -0,0 +1,154 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+var (
+	// ErrNotFound is returned to users who aren't members, so they can't tell a resource exists
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden is returned to members whose role doesn't allow the action
+	ErrForbidden = errors.New("user does not have permission")
+)
+
+// RoleSource answers who can see what, the policy builds its decisions on it. Accounts and
+// transactions in the trash don't exist for the first three methods.
+type RoleSource interface {
+	// AccountRole returns the role of the user on the account, empty when they aren't a member
+	AccountRole(userId int, accountToken string) (string, error)
+	// AccountToken returns the token of the account with the id, empty when there is none
+	AccountToken(accountId int) (string, error)
+	// TransactionAccount returns the account of the transaction, empty when there is none
+	TransactionAccount(transactionId int) (string, error)
+	// TrashedAccountRole is AccountRole for an account in the trash
+	TrashedAccountRole(userId int, accountToken string) (string, error)
+	// TrashedTransactionAccount is TransactionAccount for a transaction in the trash
+	TrashedTransactionAccount(transactionId int) (string, error)
+}
+
+// Policy is the single place that decides whether a user may act on an account and the
+// resources inside it. Stores ask it before touching any of their data.
+type Policy struct {
+	roles RoleSource
+}
+
+func NewPolicy(roles RoleSource) *Policy {
+	return &Policy{roles: roles}
+}
+
+// CanReadAccount allows every member of the account
+func (p *Policy) CanReadAccount(userId int, accountToken string) error {
+	return p.requireRole(userId, accountToken, types.AccountRoleViewer, "read this account")
+}
+
+// CanEditAccount allows the members that record transactions
+func (p *Policy) CanEditAccount(userId int, accountToken string) error {
+	return p.requireRole(userId, accountToken, types.AccountRoleEditor, "change the transactions of this account")
+}
+
+// CanManageAccount allows the owners, who change the account itself and its members
+func (p *Policy) CanManageAccount(userId int, accountToken string) error {
+	return p.requireRole(userId, accountToken, types.AccountRoleOwner, "manage this account")
+}
+
+// CanManageAccountById is CanManageAccount for routes that address the account by id
+func (p *Policy) CanManageAccountById(userId int, accountId int) (string, error) {
+	accountToken, err := p.roles.AccountToken(accountId)
+	if err != nil {
+		return "", err
+	}
+	if accountToken == "" {
+		return "", fmt.Errorf("account %w", ErrNotFound)
+	}
+
+	return accountToken, p.CanManageAccount(userId, accountToken)
+}
+
+// CanReadTransaction allows every member of the transaction's account and returns that account
+func (p *Policy) CanReadTransaction(userId int, transactionId int) (string, error) {
+	return p.requireTransactionRole(userId, transactionId, types.AccountRoleViewer, "read this transaction")
+}
+
+// CanEditTransaction allows the editors of the transaction's account and returns that account
+func (p *Policy) CanEditTransaction(userId int, transactionId int) (string, error) {
+	return p.requireTransactionRole(userId, transactionId, types.AccountRoleEditor, "change this transaction")
+}
+
+// CanRestoreAccount allows the owners of an account in the trash
+func (p *Policy) CanRestoreAccount(userId int, accountToken string) error {
+	return p.requireRoleIn(p.roles.TrashedAccountRole, userId, accountToken, types.AccountRoleOwner, "restore this account")
+}
+
+// CanRestoreTransaction allows the editors of the account a transaction in the trash belongs
+// to and returns that account. The account itself can't be in the trash.
+func (p *Policy) CanRestoreTransaction(userId int, transactionId int) (string, error) {
+	return p.requireTransactionRoleIn(p.roles.TrashedTransactionAccount, userId, transactionId, types.AccountRoleEditor, "restore this transaction")
+}
+
+func (p *Policy) requireTransactionRole(userId int, transactionId int, required, action string) (string, error) {
+	return p.requireTransactionRoleIn(p.roles.TransactionAccount, userId, transactionId, required, action)
+}
+
+// requireTransactionRoleIn checks the role on the account that lookup finds for the transaction
+func (p *Policy) requireTransactionRoleIn(lookup func(int) (string, error), userId int, transactionId int, required, action string) (string, error) {
+	accountToken, err := lookup(transactionId)
+	if err != nil {
+		return "", err
+	}
+
+	// a transaction in someone else's account looks the same as one that doesn't exist
+	role := ""
+	if accountToken != "" {
+		if role, err = p.roles.AccountRole(userId, accountToken); err != nil {
+			return "", err
+		}
+	}
+	if role == "" {
+		return "", fmt.Errorf("transaction %w", ErrNotFound)
+	}
+	if err := checkRole(role, required, action); err != nil {
+		return "", err
+	}
+
+	return accountToken, nil
+}
+
+func (p *Policy) requireRole(userId int, accountToken string, required, action string) error {
+	return p.requireRoleIn(p.roles.AccountRole, userId, accountToken, required, action)
+}
+
+// requireRoleIn checks the role that lookup finds for the user on the account
+func (p *Policy) requireRoleIn(lookup func(int, string) (string, error), userId int, accountToken string, required, action string) error {
+	role, err := lookup(userId, accountToken)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return fmt.Errorf("account %w", ErrNotFound)
+	}
+	return checkRole(role, required, action)
+}
+
+// checkRole tells a member that their role doesn't allow the action
+func checkRole(role, required, action string) error {
+	if !types.AccountRoleAtLeast(role, required) {
+		return fmt.Errorf("%w to %s", ErrForbidden, action)
+	}
+	return nil
+}
+
+// StatusCode is the HTTP status for an error that may come from the policy
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
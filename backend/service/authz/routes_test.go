@@ -0,0 +1,333 @@
+package authz_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/account"
+	"github.com/lucas-remigio/wallet-tracker/service/anomaly"
+	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/service/category"
+	"github.com/lucas-remigio/wallet-tracker/service/chat"
+	"github.com/lucas-remigio/wallet-tracker/service/goal"
+	"github.com/lucas-remigio/wallet-tracker/service/investment_calculator"
+	"github.com/lucas-remigio/wallet-tracker/service/membership"
+	"github.com/lucas-remigio/wallet-tracker/service/quick_entry"
+	"github.com/lucas-remigio/wallet-tracker/service/settings"
+	"github.com/lucas-remigio/wallet-tracker/service/transaction"
+	"github.com/lucas-remigio/wallet-tracker/service/trash"
+	"github.com/lucas-remigio/wallet-tracker/service/user"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const (
+	ownerId = iota + 1
+	editorId
+	viewerId
+	strangerId
+)
+
+const (
+	sharedAccountId     = 7
+	sharedAccountToken  = "shared"
+	trashedAccountToken = "trashed"
+	transactionId       = 10
+	trashedTransaction  = 12
+)
+
+// fakeRoles knows an account shared by an owner, an editor and a viewer, and another one
+// they share in the trash
+type fakeRoles struct{}
+
+var memberRoles = map[int]string{
+	ownerId:  types.AccountRoleOwner,
+	editorId: types.AccountRoleEditor,
+	viewerId: types.AccountRoleViewer,
+}
+
+func (fakeRoles) AccountRole(userId int, accountToken string) (string, error) {
+	if accountToken != sharedAccountToken {
+		return "", nil
+	}
+	return memberRoles[userId], nil
+}
+
+func (fakeRoles) TrashedAccountRole(userId int, accountToken string) (string, error) {
+	if accountToken != trashedAccountToken {
+		return "", nil
+	}
+	return memberRoles[userId], nil
+}
+
+func (fakeRoles) AccountToken(accountId int) (string, error) {
+	if accountId == sharedAccountId {
+		return sharedAccountToken, nil
+	}
+	return "", nil
+}
+
+func (fakeRoles) TransactionAccount(id int) (string, error) {
+	if id == transactionId {
+		return sharedAccountToken, nil
+	}
+	return "", nil
+}
+
+func (fakeRoles) TrashedTransactionAccount(id int) (string, error) {
+	if id == trashedTransaction {
+		return sharedAccountToken, nil
+	}
+	return "", nil
+}
+
+type activeSessions struct{}
+
+func (activeSessions) CreateSession(userId int, userAgent, ipAddress string) (*types.Session, string, error) {
+	return nil, "", nil
+}
+func (activeSessions) RotateRefreshToken(refreshToken, userAgent, ipAddress string) (*types.Session, string, error) {
+	return nil, "", nil
+}
+func (activeSessions) IsSessionActive(sessionId string, userId int) (bool, error) { return true, nil }
+func (activeSessions) GetActiveSessionsByUserId(userId int) ([]*types.Session, error) {
+	return nil, nil
+}
+func (activeSessions) RevokeSession(sessionId string, userId int) error           { return nil }
+func (activeSessions) RevokeOtherSessions(userId int, keepSessionId string) error { return nil }
+
+// newRouter registers the real handlers and stores on a database that can't be reached, so
+// a request only gets a 403 or 404 if the policy stopped it before any query
+func newRouter(t *testing.T) *http.ServeMux {
+	t.Helper()
+
+	db, err := sql.Open("postgres", "host=/nonexistent dbname=wallet sslmode=disable")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	middleware.SetSessionStore(activeSessions{})
+	t.Cleanup(func() { middleware.SetSessionStore(nil) })
+
+	policy := authz.NewPolicy(fakeRoles{})
+	settingsStore := settings.NewStore(db, policy)
+	categoryStore := category.NewStore(db)
+	accountStore := account.NewStore(db, categoryStore, nil, settingsStore, policy)
+	transactionStore := transaction.NewStore(db, accountStore, policy)
+	accountStore.SetTransactionStore(transactionStore)
+	anomalyStore := anomaly.NewStore(transactionStore)
+	accountStore.SetAnomalyStore(anomalyStore)
+
+	router := http.NewServeMux()
+	account.NewHandler(accountStore).RegisterRoutes(router)
+	transaction.NewHandler(transactionStore).RegisterRoutes(router)
+	membership.NewHandler(membership.NewStore(db, policy), user.NewStore(db), nil).RegisterRoutes(router)
+	anomaly.NewHandler(anomalyStore).RegisterRoutes(router)
+	trash.NewHandler(accountStore, transactionStore, categoryStore, 30).RegisterRoutes(router)
+	goal.NewHandler(goal.NewStore(db, policy)).RegisterRoutes(router)
+	chat.NewHandler(chat.NewStore(db, accountStore, categoryStore, transactionStore, nil, settingsStore)).RegisterRoutes(router)
+	quick_entry.NewHandler(quick_entry.NewStore(accountStore, categoryStore, nil, settingsStore)).RegisterRoutes(router)
+	investment_calculator.NewHandler(investment_calculator.NewStore(), transactionStore).RegisterRoutes(router)
+	return router
+}
+
+func TestCrossUserAccess(t *testing.T) {
+	router := newRouter(t)
+	sharedToken := sharedAccountToken
+
+	routes := []struct {
+		method   string
+		path     string
+		body     interface{}
+		required string
+	}{
+		// transactions
+		{http.MethodGet, "/transactions/shared", nil, types.AccountRoleViewer},
+		{http.MethodGet, "/transactions/dto/shared?month=1&year=2025", nil, types.AccountRoleViewer},
+		{http.MethodGet, "/transactions/months/shared", nil, types.AccountRoleViewer},
+		{http.MethodGet, "/transactions/statistics/shared", nil, types.AccountRoleViewer},
+		{http.MethodPost, "/transactions", types.CreateTransactionPayload{
+			AccountToken: sharedAccountToken, CategoryID: 1, Amount: 10, Date: "2025-01-31",
+		}, types.AccountRoleEditor},
+		{http.MethodPut, "/transactions/10", types.UpdateTransactionPayload{
+			CategoryID: 1, Amount: 10, Date: "2025-01-31",
+		}, types.AccountRoleEditor},
+		{http.MethodDelete, "/transactions/10", nil, types.AccountRoleEditor},
+
+		// accounts
+		{http.MethodPut, "/accounts/7", map[string]interface{}{"account_name": "Renamed", "balance": 10}, types.AccountRoleOwner},
+		{http.MethodDelete, "/accounts/shared", nil, types.AccountRoleOwner},
+		{http.MethodPatch, "/accounts/shared/favorite", types.FavoriteAccountPayload{IsFavorite: true}, types.AccountRoleViewer},
+		{http.MethodPost, "/accounts/reorder", types.ReorderAccountsPayload{
+			Accounts: []types.ReorderAccount{{Token: sharedAccountToken, OrderIndex: 1}},
+		}, types.AccountRoleViewer},
+		{http.MethodGet, "/accounts/shared/feedback-month?month=1&year=2025", nil, types.AccountRoleViewer},
+		{http.MethodGet, "/accounts/shared/anomalies", nil, types.AccountRoleViewer},
+
+		// members and invitations
+		{http.MethodGet, "/accounts/shared/members", nil, types.AccountRoleViewer},
+		{http.MethodPatch, "/accounts/shared/members/1", types.UpdateMemberRolePayload{Role: types.AccountRoleViewer}, types.AccountRoleOwner},
+		{http.MethodDelete, "/accounts/shared/members/1", nil, types.AccountRoleOwner},
+		{http.MethodGet, "/accounts/shared/invitations", nil, types.AccountRoleOwner},
+		{http.MethodPost, "/accounts/shared/invitations", types.InviteMemberPayload{
+			Email: "guest@example.com", Role: types.AccountRoleViewer,
+		}, types.AccountRoleOwner},
+		{http.MethodDelete, "/accounts/shared/invitations/5", nil, types.AccountRoleOwner},
+
+		// trash
+		{http.MethodPost, "/trash/accounts/trashed/restore", nil, types.AccountRoleOwner},
+		{http.MethodPost, "/trash/transactions/12/restore", nil, types.AccountRoleEditor},
+
+		// goals following an account
+		{http.MethodPost, "/goals", types.CreateGoalPayload{
+			Name: "Trip", TargetAmount: 1000, TargetDate: "2026-12-31", AccountToken: &sharedToken,
+		}, types.AccountRoleViewer},
+		{http.MethodPut, "/goals/1", types.UpdateGoalPayload{
+			Name: "Trip", TargetAmount: 1000, TargetDate: "2026-12-31", AccountToken: &sharedToken,
+		}, types.AccountRoleViewer},
+
+		// routes that only name the user's own data, everyone goes on to the database
+		{http.MethodGet, "/goals", nil, ""},
+		{http.MethodGet, "/goals/1", nil, ""},
+		{http.MethodPost, "/goals/1/contributions", types.AddContributionPayload{Amount: 10, Date: "2025-01-31"}, ""},
+		{http.MethodGet, "/chat/conversations", nil, ""},
+		{http.MethodPost, "/chat/conversations", types.CreateConversationPayload{Title: "Budget"}, ""},
+		{http.MethodGet, "/chat/conversations/1", nil, ""},
+		{http.MethodDelete, "/chat/conversations/1", nil, ""},
+		{http.MethodPost, "/chat/conversations/1/messages", types.SendChatMessagePayload{Message: "How much did I spend?"}, ""},
+		{http.MethodGet, "/chat/conversations/1/tool-calls", nil, ""},
+		{http.MethodPost, "/transactions/parse", types.ParseTransactionPayload{Text: "spent 12€ at Continente"}, ""},
+		{http.MethodPost, "/investment-calculator/fire", types.FirePayload{}, ""},
+	}
+
+	users := []struct {
+		id   int
+		role string
+	}{
+		{ownerId, types.AccountRoleOwner},
+		{editorId, types.AccountRoleEditor},
+		{viewerId, types.AccountRoleViewer},
+		{strangerId, ""},
+	}
+
+	for _, route := range routes {
+		for _, u := range users {
+			name := fmt.Sprintf("%s %s as %s", route.method, route.path, u.role)
+			if u.role == "" {
+				name = fmt.Sprintf("%s %s as a stranger", route.method, route.path)
+			}
+
+			t.Run(name, func(t *testing.T) {
+				// strangers can't tell the account exists, members are told what they may not do.
+				// Allowed requests go on to the database, which fails.
+				want := http.StatusInternalServerError
+				switch {
+				case route.required == "":
+				case u.role == "":
+					want = http.StatusNotFound
+				case !types.AccountRoleAtLeast(u.role, route.required):
+					want = http.StatusForbidden
+				}
+
+				rr := performRequest(t, router, u.id, route.method, route.path, route.body)
+				if rr.Code != want {
+					t.Errorf("expected status %d, got %d: %s", want, rr.Code, rr.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestDefaultAccountNeedsEditRole(t *testing.T) {
+	db, err := sql.Open("postgres", "host=/nonexistent dbname=wallet sslmode=disable")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store := settings.NewStore(db, authz.NewPolicy(fakeRoles{}))
+
+	for _, tc := range []struct {
+		userId int
+		want   error
+	}{
+		{viewerId, authz.ErrForbidden},
+		{strangerId, settings.ErrDefaultAccountNotFound},
+	} {
+		_, err := store.UpdateSettings(&types.UserSettings{UserID: tc.userId, DefaultAccountToken: sharedAccountToken}, &types.AuditOrigin{})
+		if !errors.Is(err, tc.want) {
+			t.Errorf("user %d: expected %v, got %v", tc.userId, tc.want, err)
+		}
+	}
+
+	// editors get on to saving, which fails without a database
+	_, err = store.UpdateSettings(&types.UserSettings{UserID: editorId, DefaultAccountToken: sharedAccountToken}, &types.AuditOrigin{})
+	if err == nil || errors.Is(err, authz.ErrForbidden) || errors.Is(err, settings.ErrDefaultAccountNotFound) {
+		t.Errorf("expected the editor to be allowed, got %v", err)
+	}
+}
+
+func TestUnknownResourcesLookMissing(t *testing.T) {
+	router := newRouter(t)
+
+	for _, path := range []string{"/transactions/unknown", "/accounts/unknown/members", "/accounts/8"} {
+		method := http.MethodGet
+		var body interface{}
+		if path == "/accounts/8" {
+			method = http.MethodPut
+			body = map[string]interface{}{"account_name": "Renamed", "balance": 10}
+		}
+
+		rr := performRequest(t, router, ownerId, method, path, body)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected status %d, got %d", method, path, http.StatusNotFound, rr.Code)
+		}
+	}
+
+	rr := performRequest(t, router, ownerId, http.MethodDelete, "/transactions/11", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a missing transaction, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// what isn't in the trash can't be restored, and what is can't be used until it is
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/trash/accounts/shared/restore"},
+		{http.MethodPost, "/trash/transactions/10/restore"},
+		{http.MethodGet, "/transactions/trashed"},
+		{http.MethodDelete, "/transactions/12"},
+	} {
+		rr := performRequest(t, router, ownerId, route.method, route.path, nil)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected status %d, got %d", route.method, route.path, http.StatusNotFound, rr.Code)
+		}
+	}
+}
+
+func performRequest(t *testing.T, router http.Handler, userId int, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	token, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userId, fmt.Sprintf("session-%d", userId))
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
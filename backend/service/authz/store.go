@@ -0,0 +1,50 @@
+package authz
+
+import (
+	"database/sql"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+const memberRole = `
+    SELECT m.role FROM account_members m JOIN accounts a ON a.token = m.account_token
+    WHERE m.account_token = $1 AND m.user_id = $2
+`
+
+func (s *Store) AccountRole(userId int, accountToken string) (string, error) {
+	return s.queryString(memberRole+"AND a.deleted_at IS NULL", accountToken, userId)
+}
+
+func (s *Store) AccountToken(accountId int) (string, error) {
+	return s.queryString("SELECT token FROM accounts WHERE id = $1 AND deleted_at IS NULL", accountId)
+}
+
+func (s *Store) TransactionAccount(transactionId int) (string, error) {
+	return s.queryString("SELECT account_token FROM transactions WHERE id = $1 AND deleted_at IS NULL", transactionId)
+}
+
+func (s *Store) TrashedAccountRole(userId int, accountToken string) (string, error) {
+	return s.queryString(memberRole+"AND a.deleted_at IS NOT NULL", accountToken, userId)
+}
+
+func (s *Store) TrashedTransactionAccount(transactionId int) (string, error) {
+	return s.queryString("SELECT account_token FROM transactions WHERE id = $1 AND deleted_at IS NOT NULL", transactionId)
+}
+
+// queryString reads a single value, a missing row is an empty string
+func (s *Store) queryString(query string, args ...interface{}) (string, error) {
+	var value string
+	err := s.db.QueryRow(query, args...).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
@@ -1,9 +1,12 @@
 package category
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
 	"github.com/lucas-remigio/wallet-tracker/types"
 	"github.com/lucas-remigio/wallet-tracker/utils"
 )
@@ -24,12 +27,38 @@ func (h *Handler) RegisterRoutes(router *http.ServeMux) {
 		}),
 	))
 	router.HandleFunc("/categories/dto", middleware.AuthMiddleware(h.GetCategoriesDtoByUserId))
+	router.HandleFunc("/categories/templates", middleware.AuthMiddleware(h.GetCategoryTemplates))
+	router.HandleFunc("/categories/templates/{language}/apply", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.ApplyCategoryTemplate,
+		}),
+	))
+	router.HandleFunc("/categories/reorder", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.ReorderCategories,
+		}),
+	))
 	router.HandleFunc("/categories/{id}", middleware.AuthMiddleware(
 		middleware.MethodRouter(map[string]http.HandlerFunc{
 			http.MethodPut:    h.UpdateCategory,
 			http.MethodDelete: h.DeleteCategory,
 		}),
 	))
+	router.HandleFunc("/categories/{id}/merge", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.MergeCategory,
+		}),
+	))
+}
+
+// statusCode maps the store errors a user can fix to a bad request
+func statusCode(err error) int {
+	switch err {
+	case ErrInvalidParent, ErrHasSubcategories, ErrInvalidMerge:
+		return http.StatusBadRequest
+	default:
+		return authz.StatusCode(err)
+	}
 }
 
 func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
@@ -51,10 +80,12 @@ func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
 		TransactionTypeID: payload.TransactionTypeId,
 		CategoryName:      payload.CategoryName,
 		Color:             payload.Color,
-	})
+		ParentID:          payload.ParentID,
+		Icon:              payload.Icon,
+	}, audit.Origin(r))
 
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, statusCode(err), err)
 		return
 	}
 
@@ -131,10 +162,12 @@ func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		UserID:       userId,
 		CategoryName: payload.CategoryName,
 		Color:        payload.Color,
-	}, userId)
+		ParentID:     payload.ParentID,
+		Icon:         payload.Icon,
+	}, userId, audit.Origin(r))
 
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, statusCode(err), err)
 		return
 	}
 
@@ -158,11 +191,112 @@ func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.store.DeleteCategory(categoryIdInt, userId)
+	err := h.store.DeleteCategory(categoryIdInt, userId, audit.Origin(r))
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, statusCode(err), err)
 		return
 	}
 
 	middleware.WriteSuccessResponse(w)
 }
+
+func (h *Handler) MergeCategory(w http.ResponseWriter, r *http.Request) {
+	// get the category id from the url using path segment extraction
+	categoryIdInt, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.MergeCategoryPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	dto, err := h.store.MergeCategory(categoryIdInt, payload.TargetCategoryID, userId, audit.Origin(r))
+	if err != nil {
+		utils.WriteError(w, statusCode(err), err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"category": dto,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func (h *Handler) ReorderCategories(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.ReorderCategoriesPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	// call store to update order indexes
+	err := h.store.ReorderCategories(userId, payload.Categories, audit.Origin(r))
+	if err != nil {
+		utils.WriteError(w, statusCode(err), err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) GetCategoryTemplates(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	if _, ok := middleware.RequireAuth(w, r); !ok {
+		return
+	}
+
+	response := map[string]interface{}{
+		"templates": TemplateSets(),
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+// ApplyCategoryTemplate adds the categories of a template set, the ones the user already has are skipped
+func (h *Handler) ApplyCategoryTemplate(w http.ResponseWriter, r *http.Request) {
+	// extract the language from URL path (/categories/templates/{language}/apply)
+	language, ok := middleware.ExtractPathParamAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	set, ok := TemplateSet(language)
+	if !ok {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("no category template for language %s", language))
+		return
+	}
+
+	categories, err := h.store.ApplyTemplate(userId, set, audit.Origin(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"categories": categories,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
@@ -2,11 +2,21 @@ package category
 
 import (
 	"database/sql"
+	"fmt"
+	"strconv"
 
 	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
 	"github.com/lucas-remigio/wallet-tracker/types"
 )
 
+var (
+	ErrInvalidParent    = fmt.Errorf("the parent must be another top level category of the same type")
+	ErrHasSubcategories = fmt.Errorf("category has subcategories, move or delete them first")
+	ErrInvalidMerge     = fmt.Errorf("categories can only be merged into another category of the same type")
+)
+
 type Store struct {
 	db *sql.DB
 }
@@ -17,73 +27,115 @@ func NewStore(db *sql.DB) *Store {
 	}
 }
 
+const categoryColumns = `
+    id, user_id, transaction_type_id, category_name, color, parent_id, order_index, icon, created_at, updated_at, deleted_at
+`
+
+const categoryDtoColumns = `
+    c.id, c.category_name, c.color, c.parent_id, c.order_index, c.icon, c.created_at, c.updated_at, c.deleted_at,
+    tt.id, tt.type_name, tt.type_slug
+`
+
+const categoryDtoFrom = `
+    categories c JOIN transaction_types tt ON c.transaction_type_id = tt.id
+`
+
 func (s *Store) GetCategoriesByUserId(userId int) ([]*types.Category, error) {
-	query := `SELECT id, user_id, transaction_type_id, category_name, color, created_at, updated_at, deleted_at
+	query := fmt.Sprintf(`SELECT %s
 		  FROM categories
 		  WHERE user_id = $1 AND deleted_at IS NULL
-		  ORDER BY created_at DESC`
+		  ORDER BY order_index, created_at DESC`, categoryColumns)
 	return db.QueryList(s.db, query, scanRowsIntoCategory, userId)
 }
 
 func (s *Store) GetCategoryById(id int, userId int) (*types.Category, error) {
-	query := `SELECT id, user_id, transaction_type_id, category_name, color, created_at, updated_at, deleted_at
+	query := fmt.Sprintf(`SELECT %s
 		  FROM categories
-		  WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+		  WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, categoryColumns)
 	return db.QuerySingle(s.db, query, scanRowIntoCategory, id, userId)
 }
 
 func (s *Store) GetCategoriesDtoByUserId(userId int) ([]*types.CategoryDTO, error) {
-	query := `SELECT c.id, c.category_name, c.color, c.created_at, c.updated_at, c.deleted_at,
-				 tt.id, tt.type_name, tt.type_slug
-		  FROM categories c
-		  JOIN transaction_types tt ON c.transaction_type_id = tt.id
+	query := fmt.Sprintf(`SELECT %s
+		  FROM %s
 		  WHERE c.user_id = $1 AND c.deleted_at IS NULL
-		  ORDER BY c.created_at DESC`
+		  ORDER BY c.order_index, c.created_at DESC`, categoryDtoColumns, categoryDtoFrom)
 	return db.QueryList(s.db,
 		query,
 		scanRowsIntoCategoryDto, userId)
 }
 
 func (s *Store) GetCategoryDtoById(id int, userId int) (*types.CategoryDTO, error) {
-	query := `SELECT c.id, c.category_name, c.color, c.created_at, c.updated_at, c.deleted_at,
-				 tt.id, tt.type_name, tt.type_slug
-		  FROM categories c
-		  JOIN transaction_types tt ON c.transaction_type_id = tt.id
-		  WHERE c.id = $1 AND c.user_id = $2 AND c.deleted_at IS NULL`
-	return db.QuerySingle(s.db, query, scanRowIntoCategoryDto, id, userId)
+	return getCategoryDto(s.db, id, userId)
 }
 
-func (s *Store) CreateCategory(category *types.Category) (*types.Category, error) {
-	var id int
-	err := s.db.QueryRow(
-		"INSERT INTO categories (user_id, transaction_type_id, category_name, color) VALUES ($1, $2, $3, $4) RETURNING id",
-		category.UserID, category.TransactionTypeID, category.CategoryName, category.Color).Scan(&id)
+func getCategoryDto(q db.Querier, id int, userId int) (*types.CategoryDTO, error) {
+	query := fmt.Sprintf(`SELECT %s
+		  FROM %s
+		  WHERE c.id = $1 AND c.user_id = $2 AND c.deleted_at IS NULL`, categoryDtoColumns, categoryDtoFrom)
+	return db.QuerySingle(q, query, scanRowIntoCategoryDto, id, userId)
+}
+
+// lockCategory holds the category until tx ends, so what is read as its previous state stays true
+func lockCategory(tx *sql.Tx, id int, userId int) error {
+	var lockedId int
+	err := tx.QueryRow("SELECT id FROM categories WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE",
+		id, userId).Scan(&lockedId)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("category %w", authz.ErrNotFound)
+	}
+	return err
+}
+
+func (s *Store) CreateCategoryAndReturn(category *types.Category, origin *types.AuditOrigin) (*types.CategoryDTO, error) {
+	if category.ParentID != nil {
+		if err := s.validateParent(category.ID, category.TransactionTypeID, *category.ParentID, category.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	// Return the created category with its ID
-	category.ID = id
-
-	return category, nil
-}
+	// new categories go to the end of the user's list
+	var maxOrderIndex int
+	err = tx.QueryRow("SELECT COALESCE(MAX(order_index), 0) FROM categories WHERE user_id = $1", category.UserID).Scan(&maxOrderIndex)
+	if err != nil {
+		return nil, err
+	}
+	category.OrderIndex = maxOrderIndex + 1
 
-func (s *Store) CreateCategoryAndReturn(category *types.Category) (*types.CategoryDTO, error) {
-	updatedCategory, err := s.CreateCategory(category)
+	var id int
+	err = tx.QueryRow(
+		`INSERT INTO categories (user_id, transaction_type_id, category_name, color, parent_id, order_index, icon)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		category.UserID, category.TransactionTypeID, category.CategoryName, category.Color,
+		category.ParentID, category.OrderIndex, category.Icon).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
 
 	// Fetch the full DTO for the created category
-	dto, err := s.GetCategoryDtoById(updatedCategory.ID, updatedCategory.UserID)
+	dto, err := getCategoryDto(tx, id, category.UserID)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := audit.Record(tx, origin, categoryChange(category.UserID, types.AuditActionCreate, nil, dto)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return dto, nil
 }
 
-func (s *Store) UpdateCategory(editCategory *types.Category, userId int) (*types.Category, error) {
+func (s *Store) UpdateCategoryAndReturn(editCategory *types.Category, userId int, origin *types.AuditOrigin) (*types.CategoryDTO, error) {
 	// get current category to check if incoming user is the same
 	currentCategory, err := s.GetCategoryById(editCategory.ID, userId)
 	if err != nil {
@@ -94,36 +146,92 @@ func (s *Store) UpdateCategory(editCategory *types.Category, userId int) (*types
 		return nil, err
 	}
 
-	_, err = db.ExecWithValidation(s.db,
-		"UPDATE categories SET category_name = $1, color = $2 WHERE id = $3",
-		editCategory.CategoryName, editCategory.Color, editCategory.ID)
+	if editCategory.ParentID != nil {
+		if err := s.validateParent(editCategory.ID, currentCategory.TransactionTypeID, *editCategory.ParentID, userId); err != nil {
+			return nil, err
+		}
+	}
 
+	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	currentCategory.CategoryName = editCategory.CategoryName
-	currentCategory.Color = editCategory.Color
+	if err := lockCategory(tx, editCategory.ID, userId); err != nil {
+		return nil, err
+	}
 
-	return currentCategory, nil
-}
+	previous, err := getCategoryDto(tx, editCategory.ID, userId)
+	if err != nil {
+		return nil, err
+	}
 
-func (s *Store) UpdateCategoryAndReturn(editCategory *types.Category, userId int) (*types.CategoryDTO, error) {
-	updatedCategory, err := s.UpdateCategory(editCategory, userId)
+	_, err = tx.Exec(
+		"UPDATE categories SET category_name = $1, color = $2, parent_id = $3, icon = $4 WHERE id = $5",
+		editCategory.CategoryName, editCategory.Color, editCategory.ParentID, editCategory.Icon, editCategory.ID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Fetch the full DTO for the updated category
-	dto, err := s.GetCategoryDtoById(updatedCategory.ID, updatedCategory.UserID)
+	dto, err := getCategoryDto(tx, editCategory.ID, userId)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := audit.Record(tx, origin, categoryChange(userId, types.AuditActionUpdate, previous, dto)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return dto, nil
 }
 
-func (s *Store) DeleteCategory(id int, userId int) error {
+// validateParent checks the category can go under the parent. Categories are only one level
+// deep, so the parent can't have a parent and the category can't have subcategories.
+// categoryId is 0 for a category that doesn't exist yet.
+func (s *Store) validateParent(categoryId, transactionTypeId, parentId, userId int) error {
+	if parentId == categoryId {
+		return ErrInvalidParent
+	}
+
+	parent, err := s.GetCategoryById(parentId, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidParent
+		}
+		return err
+	}
+	if parent.ParentID != nil || parent.TransactionTypeID != transactionTypeId {
+		return ErrInvalidParent
+	}
+
+	if categoryId == 0 {
+		return nil
+	}
+	hasChildren, err := s.hasSubcategories(categoryId)
+	if err != nil {
+		return err
+	}
+	if hasChildren {
+		return ErrHasSubcategories
+	}
+
+	return nil
+}
+
+func (s *Store) hasSubcategories(id int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE parent_id = $1 AND deleted_at IS NULL)", id).Scan(&exists)
+	return exists, err
+}
+
+// DeleteCategory moves the category to the trash, transactions keep showing it
+func (s *Store) DeleteCategory(id int, userId int, origin *types.AuditOrigin) error {
 	// get current category to check if incoming user is the same
 	currentCategory, err := s.GetCategoryById(id, userId)
 	if err != nil {
@@ -134,39 +242,266 @@ func (s *Store) DeleteCategory(id int, userId int) error {
 		return err
 	}
 
-	// check if the category is used in any transactions
-	var exists bool
-	err = s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM transactions WHERE category_id = $1)", id).Scan(&exists)
+	// subcategories would be left under a parent nobody can see
+	hasChildren, err := s.hasSubcategories(id)
 	if err != nil {
 		return err
 	}
+	if hasChildren {
+		return ErrHasSubcategories
+	}
 
-	if exists {
-		// Soft delete if used in transactions
-		_, err := s.db.Exec(
-			`UPDATE categories SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
-			id, userId,
-		)
+	tx, err := s.db.Begin()
+	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// Hard delete if not used
-	_, err = db.ExecWithValidation(s.db, "DELETE FROM categories WHERE id = $1", id)
+	if err := lockCategory(tx, id, userId); err != nil {
+		return err
+	}
 
-	return err
-}
-func (s *Store) SoftDeleteCategory(id int, userId int) error {
-	_, err := s.db.Exec(
+	deleted, err := getCategoryDto(tx, id, userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
 		`UPDATE categories SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
 		id, userId,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if err := audit.Record(tx, origin, categoryChange(userId, types.AuditActionDelete, deleted, nil)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RestoreCategory takes the category out of the trash, back under its parent unless the
+// parent is in the trash too
+func (s *Store) RestoreCategory(id int, userId int, origin *types.AuditOrigin) (*types.CategoryDTO, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE categories c SET deleted_at = NULL,
+			parent_id = (SELECT p.id FROM categories p WHERE p.id = c.parent_id AND p.deleted_at IS NULL)
+		 WHERE c.id = $1 AND c.user_id = $2 AND c.deleted_at IS NOT NULL`,
+		id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	// someone else's category looks the same as one that isn't in the trash
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("category %w", authz.ErrNotFound)
+	}
+
+	dto, err := getCategoryDto(tx, id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := audit.Record(tx, origin, categoryChange(userId, types.AuditActionRestore, nil, dto)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return dto, nil
+}
+
+func (s *Store) GetTrashedCategoriesByUserId(userId int) ([]*types.CategoryDTO, error) {
+	query := fmt.Sprintf(`SELECT %s
+		  FROM %s
+		  WHERE c.user_id = $1 AND c.deleted_at IS NOT NULL
+		  ORDER BY c.deleted_at DESC`, categoryDtoColumns, categoryDtoFrom)
+	return db.QueryList(s.db, query, scanRowsIntoCategoryDto, userId)
+}
+
+// MergeCategory moves the transactions and subcategories of the source to the target and
+// deletes the source, all in one transaction. Transactions in the trash move too.
+func (s *Store) MergeCategory(sourceId int, targetId int, userId int, origin *types.AuditOrigin) (*types.CategoryDTO, error) {
+	if sourceId == targetId {
+		return nil, ErrInvalidMerge
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// lock both categories so they can't change while the transactions move
+	rows, err := tx.Query(
+		fmt.Sprintf(`SELECT %s FROM categories
+			WHERE id IN ($1, $2) AND user_id = $3 AND deleted_at IS NULL
+			FOR UPDATE`, categoryColumns),
+		sourceId, targetId, userId)
+	if err != nil {
+		return nil, err
+	}
+	categories := make(map[int]*types.Category)
+	for rows.Next() {
+		category, err := scanRowsIntoCategory(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		categories[category.ID] = category
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	source, target := categories[sourceId], categories[targetId]
+	if source == nil || target == nil {
+		return nil, fmt.Errorf("category %w", authz.ErrNotFound)
+	}
+	if source.TransactionTypeID != target.TransactionTypeID {
+		return nil, ErrInvalidMerge
+	}
+
+	// the subcategories of the source go under the target, which has to be able to take them
+	var hasChildren bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE parent_id = $1)", sourceId).Scan(&hasChildren)
+	if err != nil {
+		return nil, err
+	}
+	if hasChildren && target.ParentID != nil {
+		return nil, ErrInvalidParent
+	}
+
+	merged, err := getCategoryDto(tx, sourceId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET category_id = $1 WHERE category_id = $2", targetId, sourceId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move transactions: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE categories SET parent_id = $1 WHERE parent_id = $2", targetId, sourceId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move subcategories: %w", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM categories WHERE id = $1", sourceId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete merged category: %w", err)
+	}
+
+	dto, err := getCategoryDto(tx, targetId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	// the merged category is gone, its transactions now show under the target
+	if err := audit.Record(tx, origin, categoryChange(userId, types.AuditActionDelete, merged, dto)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return dto, nil
+}
+
+func (s *Store) ReorderCategories(userId int, categories []types.ReorderCategory, origin *types.AuditOrigin) error {
+	// Check: all categories belong to the user
+	for _, category := range categories {
+		if _, err := s.GetCategoryById(category.ID, userId); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("category %w", authz.ErrNotFound)
+			}
+			return err
+		}
+	}
+
+	// Check: all order indexes are unique
+	orderIndexes := make(map[int]bool)
+	for _, category := range categories {
+		if orderIndexes[category.OrderIndex] {
+			return fmt.Errorf("duplicate order_index found: %d", category.OrderIndex)
+		}
+		orderIndexes[category.OrderIndex] = true
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Proceed with update
+	for _, category := range categories {
+		previous, err := getCategoryDto(tx, category.ID, userId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE categories SET order_index = $1 WHERE id = $2 AND user_id = $3", category.OrderIndex, category.ID, userId)
+		if err != nil {
+			return err
+		}
+
+		updated, err := getCategoryDto(tx, category.ID, userId)
+		if err != nil {
+			return err
+		}
+
+		if err := audit.Record(tx, origin, categoryChange(userId, types.AuditActionUpdate, previous, updated)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// categoryChange describes a change to one category, either side is nil when it doesn't exist
+func categoryChange(userId int, action string, before, after *types.CategoryDTO) types.AuditChange {
+	category := before
+	if category == nil {
+		category = after
+	}
+
+	change := types.AuditChange{
+		UserID:     userId,
+		EntityType: types.AuditEntityCategory,
+		EntityID:   strconv.Itoa(category.ID),
+		Action:     action,
+	}
+	// a nil pointer would be stored as JSON null instead of leaving the side out
+	if before != nil {
+		change.Before = before
+	}
+	if after != nil {
+		change.After = after
+	}
+	return change
 }
 
 func scanRowsIntoCategory(rows *sql.Rows) (*types.Category, error) {
 	c := new(types.Category)
 
-	err := rows.Scan(&c.ID, &c.UserID, &c.TransactionTypeID, &c.CategoryName, &c.Color, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
+	err := rows.Scan(&c.ID, &c.UserID, &c.TransactionTypeID, &c.CategoryName, &c.Color,
+		&c.ParentID, &c.OrderIndex, &c.Icon, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
 
 	if err != nil {
 		return nil, err
@@ -182,7 +517,7 @@ func scanRowsIntoCategoryDto(rows *sql.Rows) (*types.CategoryDTO, error) {
 	c.TransactionType = &types.TransactionType{}
 
 	err := rows.Scan(
-		&c.ID, &c.CategoryName, &c.Color, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt,
+		&c.ID, &c.CategoryName, &c.Color, &c.ParentID, &c.OrderIndex, &c.Icon, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt,
 		&c.TransactionType.ID, &c.TransactionType.TypeName, &c.TransactionType.TypeSlug)
 
 	if err != nil {
@@ -199,7 +534,7 @@ func scanRowIntoCategoryDto(row *sql.Row) (*types.CategoryDTO, error) {
 	c.TransactionType = &types.TransactionType{}
 
 	err := row.Scan(
-		&c.ID, &c.CategoryName, &c.Color, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt,
+		&c.ID, &c.CategoryName, &c.Color, &c.ParentID, &c.OrderIndex, &c.Icon, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt,
 		&c.TransactionType.ID, &c.TransactionType.TypeName, &c.TransactionType.TypeSlug)
 
 	if err != nil {
@@ -212,7 +547,8 @@ func scanRowIntoCategoryDto(row *sql.Row) (*types.CategoryDTO, error) {
 func scanRowIntoCategory(row *sql.Row) (*types.Category, error) {
 	c := new(types.Category)
 
-	err := row.Scan(&c.ID, &c.UserID, &c.TransactionTypeID, &c.CategoryName, &c.Color, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
+	err := row.Scan(&c.ID, &c.UserID, &c.TransactionTypeID, &c.CategoryName, &c.Color,
+		&c.ParentID, &c.OrderIndex, &c.Icon, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,135 @@
+package category
+
+import (
+	"database/sql"
+
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+// DefaultTemplateLanguage is seeded when the user didn't pick a language or picked one without a set
+const DefaultTemplateLanguage = "en"
+
+// templateSets are the categories new users start with. Bump the version of a set when its
+// categories change, applying it again only adds the ones the user doesn't have.
+var templateSets = []*types.CategoryTemplateSet{
+	{
+		Language: "en",
+		Version:  1,
+		Categories: []types.CategoryTemplate{
+			{TransactionTypeID: int(types.CreditTransactionType), CategoryName: "Salary", Color: "#22c55e", Icon: "briefcase"},
+			{TransactionTypeID: int(types.CreditTransactionType), CategoryName: "Investments", Color: "#14b8a6", Icon: "trending-up"},
+			{TransactionTypeID: int(types.CreditTransactionType), CategoryName: "Gifts", Color: "#a855f7", Icon: "gift"},
+			{TransactionTypeID: int(types.CreditTransactionType), CategoryName: "Other income", Color: "#64748b", Icon: "plus-circle"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Groceries", Color: "#f97316", Icon: "shopping-cart"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Rent", Color: "#ef4444", Icon: "home"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Utilities", Color: "#eab308", Icon: "zap"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Transport", Color: "#3b82f6", Icon: "car"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Restaurants", Color: "#ec4899", Icon: "utensils"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Health", Color: "#10b981", Icon: "heart-pulse"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Leisure", Color: "#8b5cf6", Icon: "film"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Other expenses", Color: "#6b7280", Icon: "more-horizontal"},
+		},
+	},
+	{
+		Language: "pt-PT",
+		Version:  1,
+		Categories: []types.CategoryTemplate{
+			{TransactionTypeID: int(types.CreditTransactionType), CategoryName: "Salário", Color: "#22c55e", Icon: "briefcase"},
+			{TransactionTypeID: int(types.CreditTransactionType), CategoryName: "Investimentos", Color: "#14b8a6", Icon: "trending-up"},
+			{TransactionTypeID: int(types.CreditTransactionType), CategoryName: "Presentes", Color: "#a855f7", Icon: "gift"},
+			{TransactionTypeID: int(types.CreditTransactionType), CategoryName: "Outros rendimentos", Color: "#64748b", Icon: "plus-circle"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Supermercado", Color: "#f97316", Icon: "shopping-cart"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Renda", Color: "#ef4444", Icon: "home"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Água, luz e gás", Color: "#eab308", Icon: "zap"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Transportes", Color: "#3b82f6", Icon: "car"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Restaurantes", Color: "#ec4899", Icon: "utensils"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Saúde", Color: "#10b981", Icon: "heart-pulse"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Lazer", Color: "#8b5cf6", Icon: "film"},
+			{TransactionTypeID: int(types.DebitTransactionType), CategoryName: "Outras despesas", Color: "#6b7280", Icon: "more-horizontal"},
+		},
+	},
+}
+
+// TemplateSets returns every template set there is
+func TemplateSets() []*types.CategoryTemplateSet {
+	return templateSets
+}
+
+// TemplateSet returns the set of the language, ok is false when there is none
+func TemplateSet(language string) (set *types.CategoryTemplateSet, ok bool) {
+	for _, set := range templateSets {
+		if set.Language == language {
+			return set, true
+		}
+	}
+	return nil, false
+}
+
+// TemplateSetOrDefault returns the set of the language, or the default one when there is none
+func TemplateSetOrDefault(language string) *types.CategoryTemplateSet {
+	if set, ok := TemplateSet(language); ok {
+		return set
+	}
+	set, _ := TemplateSet(DefaultTemplateLanguage)
+	return set
+}
+
+// SeedTemplate adds the categories of the set the user doesn't have yet, trashed ones count
+// as had so they aren't brought back. It runs in the caller's transaction so registration can
+// create the user and the categories together. Returns the ids of the created categories.
+func SeedTemplate(tx *sql.Tx, userId int, set *types.CategoryTemplateSet) ([]int, error) {
+	var ids []int
+	for _, template := range set.Categories {
+		var id int
+		err := tx.QueryRow(
+			`INSERT INTO categories (user_id, transaction_type_id, category_name, color, icon, order_index)
+			 VALUES ($1, $2, $3, $4, $5, (SELECT COALESCE(MAX(order_index), 0) + 1 FROM categories WHERE user_id = $1))
+			 ON CONFLICT (user_id, transaction_type_id, category_name) DO NOTHING
+			 RETURNING id`,
+			userId, template.TransactionTypeID, template.CategoryName, template.Color, template.Icon,
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			// the user already has it
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// ApplyTemplate adds the categories of the set the user doesn't have yet and returns them
+func (s *Store) ApplyTemplate(userId int, set *types.CategoryTemplateSet, origin *types.AuditOrigin) ([]*types.CategoryDTO, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids, err := SeedTemplate(tx, userId, set)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make([]*types.CategoryDTO, 0, len(ids))
+	for _, id := range ids {
+		category, err := getCategoryDto(tx, id, userId)
+		if err != nil {
+			return nil, err
+		}
+		if err := audit.Record(tx, origin, categoryChange(userId, types.AuditActionCreate, nil, category)); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
@@ -0,0 +1,45 @@
+package category
+
+import (
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+func TestTemplateSetOrDefault(t *testing.T) {
+	if set := TemplateSetOrDefault("pt-PT"); set.Language != "pt-PT" {
+		t.Errorf("expected the pt-PT set, got %s", set.Language)
+	}
+	if set := TemplateSetOrDefault("xx"); set.Language != DefaultTemplateLanguage {
+		t.Errorf("expected the default set for an unknown language, got %s", set.Language)
+	}
+	if set := TemplateSetOrDefault(""); set.Language != DefaultTemplateLanguage {
+		t.Errorf("expected the default set without a language, got %s", set.Language)
+	}
+}
+
+func TestTemplateSetsFitCategoryRules(t *testing.T) {
+	for _, set := range TemplateSets() {
+		names := make(map[int]map[string]bool)
+		for _, template := range set.Categories {
+			// the same checks a category created through the API goes through
+			if err := utils.Validate.Struct(types.CreateCategoryPayload{
+				TransactionTypeId: template.TransactionTypeID,
+				CategoryName:      template.CategoryName,
+				Color:             template.Color,
+				Icon:              template.Icon,
+			}); err != nil {
+				t.Errorf("%s template %q is invalid: %v", set.Language, template.CategoryName, err)
+			}
+
+			if names[template.TransactionTypeID] == nil {
+				names[template.TransactionTypeID] = make(map[string]bool)
+			}
+			if names[template.TransactionTypeID][template.CategoryName] {
+				t.Errorf("%s template repeats %q", set.Language, template.CategoryName)
+			}
+			names[template.TransactionTypeID][template.CategoryName] = true
+		}
+	}
+}
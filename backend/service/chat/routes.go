@@ -0,0 +1,202 @@
+package chat
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+type Handler struct {
+	store types.ChatStore
+}
+
+func NewHandler(store types.ChatStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/chat/conversations", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet:  h.GetConversations,
+			http.MethodPost: h.CreateConversation,
+		}),
+	))
+	router.HandleFunc("/chat/conversations/{id}", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet:    h.GetConversationMessages,
+			http.MethodDelete: h.DeleteConversation,
+		}),
+	))
+	router.HandleFunc("/chat/conversations/{id}/messages", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.SendMessage,
+		}),
+	))
+	router.HandleFunc("/chat/conversations/{id}/tool-calls", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.GetConversationToolCalls,
+		}),
+	))
+}
+
+func (h *Handler) GetConversations(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	conversations, err := h.store.GetConversationsByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"conversations": conversations,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func (h *Handler) CreateConversation(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.CreateConversationPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	conversation, err := h.store.CreateConversation(userId, payload.Title)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"conversation": conversation,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func (h *Handler) GetConversationMessages(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract conversation ID from URL path (/chat/conversations/{id})
+	conversationId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	messages, err := h.store.GetConversationMessages(conversationId, userId)
+	if err != nil {
+		if errors.Is(err, ErrConversationNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"messages": messages,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func (h *Handler) DeleteConversation(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract conversation ID from URL path (/chat/conversations/{id})
+	conversationId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteConversation(conversationId, userId); err != nil {
+		if errors.Is(err, ErrConversationNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract conversation ID from URL path (/chat/conversations/{id}/messages)
+	conversationId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.SendChatMessagePayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	reply, err := h.store.SendMessage(conversationId, userId, payload.Message, payload.Language)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, reply)
+}
+
+func (h *Handler) GetConversationToolCalls(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract conversation ID from URL path (/chat/conversations/{id}/tool-calls)
+	conversationId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	toolCalls, err := h.store.GetConversationToolCalls(conversationId, userId)
+	if err != nil {
+		if errors.Is(err, ErrConversationNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"tool_calls": toolCalls,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
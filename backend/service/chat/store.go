@@ -0,0 +1,400 @@
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/prompts"
+	"github.com/lucas-remigio/wallet-tracker/service/privacy"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const (
+	defaultConversationTitle = "New conversation"
+	maxHistoryMessages       = 40
+	maxToolRounds            = 5
+)
+
+var ErrConversationNotFound = fmt.Errorf("conversation not found")
+
+type Store struct {
+	db               *sql.DB
+	accountStore     types.AccountStore
+	categoryStore    types.CategoryStore
+	transactionStore types.TransactionStore
+	openAiStore      types.OpenAIStore
+	settingsStore    types.SettingsStore
+}
+
+func NewStore(db *sql.DB, accountStore types.AccountStore, categoryStore types.CategoryStore, transactionStore types.TransactionStore, openAiStore types.OpenAIStore, settingsStore types.SettingsStore) *Store {
+	return &Store{
+		db:               db,
+		accountStore:     accountStore,
+		categoryStore:    categoryStore,
+		transactionStore: transactionStore,
+		openAiStore:      openAiStore,
+		settingsStore:    settingsStore,
+	}
+}
+
+func (s *Store) CreateConversation(userId int, title string) (*types.ChatConversation, error) {
+	if title == "" {
+		title = defaultConversationTitle
+	}
+
+	var id int
+	err := s.db.QueryRow(
+		"INSERT INTO chat_conversations (user_id, title) VALUES ($1, $2) RETURNING id",
+		userId, title).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	return s.GetConversationById(id, userId)
+}
+
+func (s *Store) GetConversationsByUserId(userId int) ([]*types.ChatConversation, error) {
+	return db.QueryList(s.db,
+		`SELECT id, user_id, title, created_at, updated_at
+		 FROM chat_conversations WHERE user_id = $1 ORDER BY updated_at DESC`,
+		scanRowsIntoConversation, userId)
+}
+
+func (s *Store) GetConversationById(conversationId, userId int) (*types.ChatConversation, error) {
+	conversation, err := db.QuerySingle(s.db,
+		`SELECT id, user_id, title, created_at, updated_at
+		 FROM chat_conversations WHERE id = $1 AND user_id = $2`,
+		scanRowIntoConversation, conversationId, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	return conversation, nil
+}
+
+func (s *Store) GetConversationMessages(conversationId, userId int) ([]*types.ChatMessage, error) {
+	if _, err := s.GetConversationById(conversationId, userId); err != nil {
+		return nil, err
+	}
+
+	return db.QueryList(s.db,
+		`SELECT id, conversation_id, role, content, tool_calls, tool_call_id, prompt_version, created_at
+		 FROM chat_messages WHERE conversation_id = $1 ORDER BY id`,
+		scanRowsIntoMessage, conversationId)
+}
+
+func (s *Store) GetConversationToolCalls(conversationId, userId int) ([]*types.ChatToolCall, error) {
+	if _, err := s.GetConversationById(conversationId, userId); err != nil {
+		return nil, err
+	}
+
+	return db.QueryList(s.db,
+		`SELECT id, conversation_id, user_id, tool_name, arguments, result, error, duration_ms, created_at
+		 FROM chat_tool_calls WHERE conversation_id = $1 AND user_id = $2 ORDER BY id`,
+		scanRowsIntoToolCall, conversationId, userId)
+}
+
+func (s *Store) DeleteConversation(conversationId, userId int) error {
+	if _, err := s.GetConversationById(conversationId, userId); err != nil {
+		return err
+	}
+
+	_, err := db.ExecWithValidation(s.db,
+		"DELETE FROM chat_conversations WHERE id = $1 AND user_id = $2",
+		conversationId, userId)
+	return err
+}
+
+// SendMessage stores the user's message and runs the model until it produces an answer,
+// executing the tool calls it requests in between. Every tool call is audited.
+func (s *Store) SendMessage(conversationId, userId int, content, language string) (*types.ChatReply, error) {
+	conversation, err := s.GetConversationById(conversationId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := s.settingsStore.GetSettingsByUserId(userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+	tools := availableTools(settings)
+	ctx := &toolContext{
+		userId:   userId,
+		redactor: privacy.NewRedactor(settings.AIPrivacyMode),
+	}
+
+	history, err := s.GetConversationMessages(conversationId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %w", err)
+	}
+
+	if len(history) == 0 && conversation.Title == defaultConversationTitle {
+		if err := s.updateTitle(conversationId, titleFromMessage(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if language == "" {
+		language = settings.FeedbackLanguage()
+	}
+	loc, err := utils.LoadLocation(settings.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	systemPrompt, err := prompts.Render(prompts.ChatSystem, language, prompts.ChatSystemData{Today: time.Now().In(loc).Format(dateLayout)})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []types.Message{{Role: "system", Content: systemPrompt.Text}}
+	for _, message := range trimHistory(history) {
+		messages = append(messages, types.Message{
+			Role:       message.Role,
+			Content:    message.Content,
+			ToolCalls:  message.ToolCalls,
+			ToolCallID: message.ToolCallID,
+		})
+	}
+
+	userMessage := types.Message{Role: "user", Content: content}
+	if _, err := s.saveMessage(conversationId, userMessage, ""); err != nil {
+		return nil, err
+	}
+	messages = append(messages, userMessage)
+
+	reply := &types.ChatReply{ToolCalls: []*types.ChatToolCall{}}
+	for round := 0; round < maxToolRounds; round++ {
+		response, err := s.openAiStore.GenerateChatCompletion(messages, toolDefinitions(tools))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate answer: %w", err)
+		}
+		response.Role = "assistant"
+
+		saved, err := s.saveMessage(conversationId, *response, systemPrompt.Version)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *response)
+
+		if len(response.ToolCalls) == 0 {
+			reply.Message = saved
+			return reply, nil
+		}
+
+		for _, call := range response.ToolCalls {
+			output, audit := s.executeToolCall(ctx, conversationId, tools, call)
+			reply.ToolCalls = append(reply.ToolCalls, audit)
+
+			toolMessage := types.Message{Role: "tool", Content: output, ToolCallID: call.ID}
+			if _, err := s.saveMessage(conversationId, toolMessage, ""); err != nil {
+				return nil, err
+			}
+			messages = append(messages, toolMessage)
+		}
+	}
+
+	// the model kept asking for tools, stop here rather than looping forever
+	saved, err := s.saveMessage(conversationId, types.Message{
+		Role:    "assistant",
+		Content: "Sorry, I could not find an answer to that question.",
+	}, systemPrompt.Version)
+	if err != nil {
+		return nil, err
+	}
+	reply.Message = saved
+	return reply, nil
+}
+
+// executeToolCall runs a single tool and records it in the audit table.
+// Errors are returned to the model as content so it can correct its arguments.
+func (s *Store) executeToolCall(ctx *toolContext, conversationId int, tools []chatTool, call types.ToolCall) (string, *types.ChatToolCall) {
+	started := time.Now()
+	var result any
+	var runErr error
+
+	tool, exists := findTool(tools, call.Function.Name)
+	args, parseErr := parseToolArguments(call.Function.Arguments)
+	switch {
+	case !exists:
+		runErr = fmt.Errorf("unknown tool %q", call.Function.Name)
+	case parseErr != nil:
+		runErr = parseErr
+	default:
+		result, runErr = tool.run(s, ctx, args)
+	}
+
+	var output string
+	var resultJson, errorText *string
+	if runErr != nil {
+		text := runErr.Error()
+		errorText = &text
+		encoded, _ := json.Marshal(map[string]string{"error": text})
+		output = string(encoded)
+	} else {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			encoded, _ = json.Marshal(map[string]string{"error": "failed to encode result"})
+		}
+		output = string(encoded)
+		resultJson = &output
+	}
+
+	audit := &types.ChatToolCall{
+		ConversationID: &conversationId,
+		UserID:         ctx.userId,
+		ToolName:       call.Function.Name,
+		Arguments:      normalizeArguments(call.Function.Arguments),
+		Result:         resultJson,
+		Error:          errorText,
+		DurationMs:     int(time.Since(started).Milliseconds()),
+	}
+	if err := s.saveToolCall(audit); err != nil {
+		// the answer can still be produced, but never silently skip the audit trail
+		errText := fmt.Sprintf("failed to audit tool call: %v", err)
+		encoded, _ := json.Marshal(map[string]string{"error": errText})
+		return string(encoded), audit
+	}
+
+	return output, audit
+}
+
+func (s *Store) saveMessage(conversationId int, message types.Message, promptVersion string) (*types.ChatMessage, error) {
+	var toolCalls, toolCallID, version any
+	if len(message.ToolCalls) > 0 {
+		encoded, err := json.Marshal(message.ToolCalls)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode tool calls: %w", err)
+		}
+		toolCalls = string(encoded)
+	}
+	if message.ToolCallID != "" {
+		toolCallID = message.ToolCallID
+	}
+	if promptVersion != "" {
+		version = promptVersion
+	}
+
+	saved := &types.ChatMessage{
+		ConversationID: conversationId,
+		Role:           message.Role,
+		Content:        message.Content,
+		ToolCalls:      message.ToolCalls,
+		ToolCallID:     message.ToolCallID,
+		PromptVersion:  promptVersion,
+	}
+	err := s.db.QueryRow(
+		`INSERT INTO chat_messages (conversation_id, role, content, tool_calls, tool_call_id, prompt_version)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		conversationId, message.Role, message.Content, toolCalls, toolCallID, version,
+	).Scan(&saved.ID, &saved.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save message: %w", err)
+	}
+
+	_, err = db.ExecWithValidation(s.db,
+		"UPDATE chat_conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", conversationId)
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+func (s *Store) saveToolCall(call *types.ChatToolCall) error {
+	return s.db.QueryRow(
+		`INSERT INTO chat_tool_calls (conversation_id, user_id, tool_name, arguments, result, error, duration_ms)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`,
+		call.ConversationID, call.UserID, call.ToolName, call.Arguments, call.Result, call.Error, call.DurationMs,
+	).Scan(&call.ID, &call.CreatedAt)
+}
+
+func (s *Store) updateTitle(conversationId int, title string) error {
+	_, err := db.ExecWithValidation(s.db,
+		"UPDATE chat_conversations SET title = $1 WHERE id = $2", title, conversationId)
+	return err
+}
+
+// trimHistory keeps the most recent messages, always starting at a user message so
+// tool results are never sent without the assistant message that requested them
+func trimHistory(history []*types.ChatMessage) []*types.ChatMessage {
+	if len(history) <= maxHistoryMessages {
+		return history
+	}
+
+	trimmed := history[len(history)-maxHistoryMessages:]
+	for i, message := range trimmed {
+		if message.Role == "user" {
+			return trimmed[i:]
+		}
+	}
+	return []*types.ChatMessage{}
+}
+
+func titleFromMessage(content string) string {
+	runes := []rune(content)
+	if len(runes) > 60 {
+		return string(runes[:60]) + "…"
+	}
+	return content
+}
+
+// normalizeArguments makes sure invalid JSON from the model can still be stored in a JSONB column
+func normalizeArguments(raw string) string {
+	if json.Valid([]byte(raw)) {
+		return raw
+	}
+	encoded, _ := json.Marshal(map[string]string{"raw": raw})
+	return string(encoded)
+}
+
+func scanRowIntoConversation(row *sql.Row) (*types.ChatConversation, error) {
+	c := new(types.ChatConversation)
+	err := row.Scan(&c.ID, &c.UserID, &c.Title, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func scanRowsIntoConversation(rows *sql.Rows) (*types.ChatConversation, error) {
+	c := new(types.ChatConversation)
+	err := rows.Scan(&c.ID, &c.UserID, &c.Title, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func scanRowsIntoMessage(rows *sql.Rows) (*types.ChatMessage, error) {
+	m := new(types.ChatMessage)
+	var toolCalls, toolCallID, promptVersion sql.NullString
+	err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &toolCalls, &toolCallID, &promptVersion, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if toolCalls.Valid {
+		if err := json.Unmarshal([]byte(toolCalls.String), &m.ToolCalls); err != nil {
+			return nil, fmt.Errorf("failed to decode tool calls: %w", err)
+		}
+	}
+	m.ToolCallID = toolCallID.String
+	m.PromptVersion = promptVersion.String
+	return m, nil
+}
+
+func scanRowsIntoToolCall(rows *sql.Rows) (*types.ChatToolCall, error) {
+	c := new(types.ChatToolCall)
+	err := rows.Scan(&c.ID, &c.ConversationID, &c.UserID, &c.ToolName, &c.Arguments, &c.Result, &c.Error, &c.DurationMs, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,394 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/service/privacy"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const (
+	dateLayout       = "2006-01-02"
+	maxRangeYears    = 10
+	defaultTopLimit  = 10
+	maxTopLimit      = 50
+	kindCreditFilter = "credit"
+	kindDebitFilter  = "debit"
+)
+
+// toolArguments is the union of every parameter a tool accepts.
+// Unknown fields are rejected so the model cannot smuggle anything else in.
+type toolArguments struct {
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Type      string `json:"type"`
+	Category  string `json:"category"`
+	Account   string `json:"account"`
+	Limit     int    `json:"limit"`
+}
+
+// toolContext carries what a tool needs to run for a single user
+type toolContext struct {
+	userId   int
+	redactor *privacy.Redactor
+}
+
+type chatTool struct {
+	definition types.Tool
+	run        func(s *Store, ctx *toolContext, args *toolArguments) (any, error)
+}
+
+func dateRangeParameters(extra map[string]any) map[string]any {
+	properties := map[string]any{
+		"start_date": map[string]any{"type": "string", "description": "Inclusive start date, YYYY-MM-DD"},
+		"end_date":   map[string]any{"type": "string", "description": "Inclusive end date, YYYY-MM-DD"},
+	}
+	for key, value := range extra {
+		properties[key] = value
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             []string{"start_date", "end_date"},
+		"additionalProperties": false,
+	}
+}
+
+func newTool(name, description string, parameters map[string]any, run func(s *Store, ctx *toolContext, args *toolArguments) (any, error)) chatTool {
+	return chatTool{
+		definition: types.Tool{
+			Type: "function",
+			Function: types.ToolFunction{
+				Name:        name,
+				Description: description,
+				Parameters:  parameters,
+			},
+		},
+		run: run,
+	}
+}
+
+// chatTools is the fixed set of read-only queries the model may use.
+// None of them accept SQL or free-form filters: every parameter is validated here.
+var chatTools = []chatTool{
+	newTool("list_accounts", "List the user's accounts with their current balance.",
+		map[string]any{"type": "object", "properties": map[string]any{}, "additionalProperties": false},
+		(*Store).toolListAccounts),
+	newTool("list_categories", "List the user's categories and whether they are credit or debit.",
+		map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"type": map[string]any{"type": "string", "enum": []string{kindCreditFilter, kindDebitFilter}},
+			},
+			"additionalProperties": false,
+		},
+		(*Store).toolListCategories),
+	newTool("category_totals", "Total amount and number of transactions per category over a date range.",
+		dateRangeParameters(map[string]any{
+			"type":     map[string]any{"type": "string", "enum": []string{kindCreditFilter, kindDebitFilter}},
+			"category": map[string]any{"type": "string", "description": "Only this category name"},
+			"account":  map[string]any{"type": "string", "description": "Only this account name"},
+		}),
+		(*Store).toolCategoryTotals),
+	newTool("monthly_totals", "Credit, debit and difference per month over a date range.",
+		dateRangeParameters(map[string]any{
+			"account": map[string]any{"type": "string", "description": "Only this account name"},
+		}),
+		(*Store).toolMonthlyTotals),
+	newTool("top_merchants", "Merchants (transaction descriptions) where the user spent the most over a date range.",
+		dateRangeParameters(map[string]any{
+			"limit": map[string]any{"type": "integer", "minimum": 1, "maximum": maxTopLimit},
+		}),
+		(*Store).toolTopMerchants),
+}
+
+// availableTools hides tools that would expose line items to users who opted into aggregates only
+func availableTools(settings *types.UserSettings) []chatTool {
+	tools := make([]chatTool, 0, len(chatTools))
+	for _, tool := range chatTools {
+		if settings.AIAggregatesOnly && tool.definition.Function.Name == "top_merchants" {
+			continue
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+func toolDefinitions(tools []chatTool) []types.Tool {
+	definitions := make([]types.Tool, len(tools))
+	for i, tool := range tools {
+		definitions[i] = tool.definition
+	}
+	return definitions
+}
+
+func findTool(tools []chatTool, name string) (*chatTool, bool) {
+	for i := range tools {
+		if tools[i].definition.Function.Name == name {
+			return &tools[i], true
+		}
+	}
+	return nil, false
+}
+
+func parseToolArguments(raw string) (*toolArguments, error) {
+	args := new(toolArguments)
+	if strings.TrimSpace(raw) == "" {
+		return args, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewBufferString(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	if args.Type != "" && args.Type != kindCreditFilter && args.Type != kindDebitFilter {
+		return nil, fmt.Errorf("type must be %q or %q", kindCreditFilter, kindDebitFilter)
+	}
+	if args.Limit < 0 || args.Limit > maxTopLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxTopLimit)
+	}
+	return args, nil
+}
+
+func parseDateRange(args *toolArguments) (time.Time, time.Time, error) {
+	start, err := time.Parse(dateLayout, args.StartDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("start_date must be YYYY-MM-DD")
+	}
+	end, err := time.Parse(dateLayout, args.EndDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("end_date must be YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end_date must not be before start_date")
+	}
+	if end.After(start.AddDate(maxRangeYears, 0, 0)) {
+		return time.Time{}, time.Time{}, fmt.Errorf("date range cannot exceed %d years", maxRangeYears)
+	}
+	// inclusive end date
+	return start, end.AddDate(0, 0, 1), nil
+}
+
+// loadTransactions returns the user's transactions in [start, end) through the existing stores
+func (s *Store) loadTransactions(userId int, accountName string, start, end time.Time) ([]*types.TransactionDTO, error) {
+	accounts, err := s.accountStore.GetAccountsByUserId(userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts: %w", err)
+	}
+
+	var result []*types.TransactionDTO
+	matchedAccount := accountName == ""
+	for _, account := range accounts {
+		if accountName != "" && !strings.EqualFold(account.AccountName, accountName) {
+			continue
+		}
+		matchedAccount = true
+
+		transactions, err := s.transactionStore.GetTransactionsDTOByAccountToken(userId, account.Token, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transactions: %w", err)
+		}
+		for _, tx := range transactions {
+			if !tx.Date.Before(start) && tx.Date.Before(end) {
+				result = append(result, tx)
+			}
+		}
+	}
+
+	if !matchedAccount {
+		return nil, fmt.Errorf("account %q not found", accountName)
+	}
+	return result, nil
+}
+
+func matchesType(tx *types.TransactionDTO, kind string) bool {
+	if tx.Category == nil || tx.Category.TransactionType == nil {
+		return false
+	}
+	switch kind {
+	case kindCreditFilter:
+		return tx.Category.TransactionType.ID == int(types.CreditTransactionType)
+	case kindDebitFilter:
+		return tx.Category.TransactionType.ID == int(types.DebitTransactionType)
+	default:
+		return tx.Category.TransactionType.ID != int(types.TransferTransactionType)
+	}
+}
+
+func (s *Store) toolListAccounts(ctx *toolContext, _ *toolArguments) (any, error) {
+	accounts, err := s.accountStore.GetAccountsByUserId(ctx.userId)
+	if err != nil {
+		return nil, err
+	}
+
+	type accountResult struct {
+		Name    string  `json:"name"`
+		Balance float64 `json:"balance"`
+	}
+	result := make([]accountResult, 0, len(accounts))
+	for _, account := range accounts {
+		result = append(result, accountResult{Name: account.AccountName, Balance: account.Balance})
+	}
+	return result, nil
+}
+
+func (s *Store) toolListCategories(ctx *toolContext, args *toolArguments) (any, error) {
+	categories, err := s.categoryStore.GetCategoriesDtoByUserId(ctx.userId)
+	if err != nil {
+		return nil, err
+	}
+
+	type categoryResult struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	result := make([]categoryResult, 0, len(categories))
+	for _, category := range categories {
+		if args.Type != "" && category.TransactionType.TypeSlug != args.Type {
+			continue
+		}
+		result = append(result, categoryResult{Name: category.CategoryName, Type: category.TransactionType.TypeSlug})
+	}
+	return result, nil
+}
+
+func (s *Store) toolCategoryTotals(ctx *toolContext, args *toolArguments) (any, error) {
+	start, end, err := parseDateRange(args)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.loadTransactions(ctx.userId, args.Account, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	type categoryTotal struct {
+		Category string  `json:"category"`
+		Type     string  `json:"type"`
+		Total    float64 `json:"total"`
+		Count    int     `json:"count"`
+	}
+	totals := make(map[string]*categoryTotal)
+	for _, tx := range transactions {
+		if !matchesType(tx, args.Type) {
+			continue
+		}
+		if args.Category != "" && !strings.EqualFold(tx.Category.CategoryName, args.Category) {
+			continue
+		}
+		key := tx.Category.TransactionType.TypeSlug + ":" + tx.Category.CategoryName
+		if _, exists := totals[key]; !exists {
+			totals[key] = &categoryTotal{Category: tx.Category.CategoryName, Type: tx.Category.TransactionType.TypeSlug}
+		}
+		totals[key].Total += tx.Amount
+		totals[key].Count++
+	}
+
+	result := make([]*categoryTotal, 0, len(totals))
+	for _, total := range totals {
+		total.Total = utils.Round(total.Total, 2)
+		result = append(result, total)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Total > result[j].Total })
+	return result, nil
+}
+
+func (s *Store) toolMonthlyTotals(ctx *toolContext, args *toolArguments) (any, error) {
+	start, end, err := parseDateRange(args)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.loadTransactions(ctx.userId, args.Account, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	type monthTotal struct {
+		Month      string  `json:"month"`
+		Credit     float64 `json:"credit"`
+		Debit      float64 `json:"debit"`
+		Difference float64 `json:"difference"`
+	}
+	months := make(map[string]*monthTotal)
+	for _, tx := range transactions {
+		if !matchesType(tx, "") {
+			continue
+		}
+		key := tx.Date.Format("2006-01")
+		if _, exists := months[key]; !exists {
+			months[key] = &monthTotal{Month: key}
+		}
+		if tx.Category.TransactionType.ID == int(types.CreditTransactionType) {
+			months[key].Credit += tx.Amount
+		} else {
+			months[key].Debit += tx.Amount
+		}
+	}
+
+	result := make([]*monthTotal, 0, len(months))
+	for _, month := range months {
+		month.Credit = utils.Round(month.Credit, 2)
+		month.Debit = utils.Round(month.Debit, 2)
+		month.Difference = utils.Round(month.Credit-month.Debit, 2)
+		result = append(result, month)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Month < result[j].Month })
+	return result, nil
+}
+
+func (s *Store) toolTopMerchants(ctx *toolContext, args *toolArguments) (any, error) {
+	start, end, err := parseDateRange(args)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.loadTransactions(ctx.userId, "", start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := args.Limit
+	if limit == 0 {
+		limit = defaultTopLimit
+	}
+
+	type merchantTotal struct {
+		Merchant string  `json:"merchant"`
+		Total    float64 `json:"total"`
+		Count    int     `json:"count"`
+	}
+	merchants := make(map[string]*merchantTotal)
+	for _, tx := range transactions {
+		if !matchesType(tx, kindDebitFilter) {
+			continue
+		}
+		name := strings.TrimSpace(tx.Description)
+		if name == "" {
+			name = tx.Category.CategoryName
+		}
+		key := strings.ToLower(name)
+		if _, exists := merchants[key]; !exists {
+			merchants[key] = &merchantTotal{Merchant: ctx.redactor.Sanitize(name)}
+		}
+		merchants[key].Total += tx.Amount
+		merchants[key].Count++
+	}
+
+	result := make([]*merchantTotal, 0, len(merchants))
+	for _, merchant := range merchants {
+		merchant.Total = utils.Round(merchant.Total, 2)
+		result = append(result, merchant)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Total > result[j].Total })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
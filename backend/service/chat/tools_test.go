@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func TestParseToolArguments(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{name: "empty arguments", raw: "", wantErr: false},
+		{name: "valid range", raw: `{"start_date":"2025-04-01","end_date":"2025-06-30","type":"debit"}`, wantErr: false},
+		{name: "unknown field is rejected", raw: `{"start_date":"2025-04-01","sql":"DROP TABLE users"}`, wantErr: true},
+		{name: "invalid type", raw: `{"type":"transfer"}`, wantErr: true},
+		{name: "limit too high", raw: `{"limit":500}`, wantErr: true},
+		{name: "malformed json", raw: `{"start_date":`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseToolArguments(tc.raw)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	start, end, err := parseDateRange(&toolArguments{StartDate: "2025-04-01", EndDate: "2025-06-30"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if start.Format(dateLayout) != "2025-04-01" || end.Format(dateLayout) != "2025-07-01" {
+		t.Errorf("expected an inclusive range, got %s - %s", start, end)
+	}
+
+	if _, _, err := parseDateRange(&toolArguments{StartDate: "2025-06-30", EndDate: "2025-04-01"}); err == nil {
+		t.Error("expected an error for an inverted range")
+	}
+	if _, _, err := parseDateRange(&toolArguments{StartDate: "2000-01-01", EndDate: "2025-01-01"}); err == nil {
+		t.Error("expected an error for a range above the limit")
+	}
+}
+
+func TestAvailableToolsHonoursAggregatesOnly(t *testing.T) {
+	settings := types.DefaultUserSettings(1)
+	if _, exists := findTool(availableTools(settings), "top_merchants"); !exists {
+		t.Error("expected top_merchants to be available by default")
+	}
+
+	settings.AIAggregatesOnly = true
+	if _, exists := findTool(availableTools(settings), "top_merchants"); exists {
+		t.Error("expected top_merchants to be hidden for aggregates only users")
+	}
+}
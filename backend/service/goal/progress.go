@@ -0,0 +1,93 @@
+package goal
+
+import (
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/service/investment_calculator"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+// maxProjectionMonths is how far ahead the completion date is looked for before giving up
+const maxProjectionMonths = 100 * 12
+
+// calculateProgress projects the goal from the current amount and the net contributions of the
+// lookback window. Savings earn the goal's rate both in the required contribution and the
+// projection.
+func calculateProgress(goal *types.Goal, current, netContributions float64, lookbackMonths int, now time.Time) *types.GoalProgress {
+	progress := &types.GoalProgress{
+		CurrentAmount:   utils.Round(current, 2),
+		RemainingAmount: utils.Round(max(goal.TargetAmount-current, 0), 2),
+		Percentage:      utils.Round(current/goal.TargetAmount*100, 2),
+		LookbackMonths:  lookbackMonths,
+	}
+	if lookbackMonths > 0 {
+		progress.AverageMonthlyContribution = utils.Round(netContributions/float64(lookbackMonths), 2)
+	}
+
+	targetDate, err := time.Parse("2006-01-02", goal.TargetDate)
+	if err != nil {
+		return progress
+	}
+	progress.MonthsRemaining = monthsBetween(now, targetDate)
+	progress.RequiredMonthlyContribution = utils.Round(
+		requiredMonthlyContribution(current, goal.TargetAmount, goal.AnnualReturnRate, progress.MonthsRemaining), 2)
+
+	if completion, ok := projectCompletion(current, goal.TargetAmount, progress.AverageMonthlyContribution, goal.AnnualReturnRate, now); ok {
+		date := completion.Format("2006-01-02")
+		progress.ProjectedCompletionDate = &date
+		progress.OnTrack = !completion.After(targetDate)
+	}
+
+	return progress
+}
+
+// monthsBetween counts the whole months from one date to the other, 0 when it is in the past
+func monthsBetween(from, to time.Time) int {
+	months := (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+	if to.Day() < from.Day() {
+		months--
+	}
+	return max(months, 0)
+}
+
+// requiredMonthlyContribution solves the compound interest formula for the contribution, what
+// the current amount grows to on its own is taken off the target first
+func requiredMonthlyContribution(current, target, annualReturnRate float64, months int) float64 {
+	if current >= target {
+		return 0
+	}
+	if months == 0 {
+		// the target date is here, everything that is missing is due
+		return target - current
+	}
+
+	missing := target - investment_calculator.FutureValue(current, 0, annualReturnRate, months)
+	if missing <= 0 {
+		return 0
+	}
+
+	// what one unit a month grows to, so the contribution is a plain division
+	perUnit := investment_calculator.FutureValue(0, 1, annualReturnRate, months)
+	return missing / perUnit
+}
+
+// projectCompletion finds the first month the savings reach the target at the monthly
+// contribution, ok is false when that doesn't happen within maxProjectionMonths
+func projectCompletion(current, target, monthlyContribution, annualReturnRate float64, now time.Time) (time.Time, bool) {
+	if current >= target {
+		return now, true
+	}
+	// nothing would ever grow
+	if monthlyContribution <= 0 && (annualReturnRate == 0 || current <= 0) {
+		return time.Time{}, false
+	}
+
+	for months := 1; months <= maxProjectionMonths; months++ {
+		if investment_calculator.FutureValue(current, monthlyContribution, annualReturnRate, months) >= target {
+			return now.AddDate(0, months, 0), true
+		}
+	}
+
+	return time.Time{}, false
+}
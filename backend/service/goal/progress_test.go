@@ -0,0 +1,82 @@
+package goal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func TestMonthsBetween(t *testing.T) {
+	now := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		to       time.Time
+		expected int
+	}{
+		{time.Date(2026, 7, 15, 0, 0, 0, 0, time.UTC), 6},
+		{time.Date(2026, 7, 14, 0, 0, 0, 0, time.UTC), 5},
+		{time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC), 12},
+		{time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC), 0},
+	}
+
+	for _, c := range cases {
+		if got := monthsBetween(now, c.to); got != c.expected {
+			t.Errorf("monthsBetween(%s) = %d, expected %d", c.to.Format("2006-01-02"), got, c.expected)
+		}
+	}
+}
+
+func TestRequiredMonthlyContribution(t *testing.T) {
+	// without interest the missing amount is split evenly
+	if got := requiredMonthlyContribution(400, 1000, 0, 12); got != 50 {
+		t.Errorf("expected 50 a month without interest, got %f", got)
+	}
+
+	// with interest less is needed, and reaching it gives back the target
+	withInterest := requiredMonthlyContribution(400, 1000, 0.05, 12)
+	if withInterest >= 50 {
+		t.Errorf("expected interest to lower the contribution, got %f", withInterest)
+	}
+	monthlyRate := 0.05 / 12
+	value := 400 * math.Pow(1+monthlyRate, 12)
+	value += withInterest * (math.Pow(1+monthlyRate, 12) - 1) / monthlyRate
+	if math.Abs(value-1000) > 0.01 {
+		t.Errorf("expected the contribution to reach 1000, reaches %f", value)
+	}
+
+	if got := requiredMonthlyContribution(400, 1000, 0, 0); got != 600 {
+		t.Errorf("expected everything due on the target date, got %f", got)
+	}
+	if got := requiredMonthlyContribution(1200, 1000, 0, 12); got != 0 {
+		t.Errorf("expected nothing required for a reached goal, got %f", got)
+	}
+}
+
+func TestCalculateProgress(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	goal := &types.Goal{TargetAmount: 1000, TargetDate: "2026-12-01"}
+
+	// 600 saved over the last 6 months, 100 a month
+	progress := calculateProgress(goal, 400, 600, 6, now)
+
+	if progress.Percentage != 40 || progress.RemainingAmount != 600 {
+		t.Errorf("expected 40%% with 600 remaining, got %+v", progress)
+	}
+	if progress.AverageMonthlyContribution != 100 {
+		t.Errorf("expected an average of 100, got %f", progress.AverageMonthlyContribution)
+	}
+	if progress.ProjectedCompletionDate == nil || *progress.ProjectedCompletionDate != "2026-07-01" {
+		t.Errorf("expected completion in 6 months, got %v", progress.ProjectedCompletionDate)
+	}
+	if !progress.OnTrack {
+		t.Error("expected the goal to be on track")
+	}
+
+	// nothing saved lately and no interest, it never completes
+	stalled := calculateProgress(goal, 400, 0, 6, now)
+	if stalled.ProjectedCompletionDate != nil || stalled.OnTrack {
+		t.Errorf("expected no completion date, got %+v", stalled)
+	}
+}
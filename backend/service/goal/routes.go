@@ -0,0 +1,302 @@
+package goal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+// maxLookbackMonths caps how far back the projection looks at contributions
+const maxLookbackMonths = 24
+
+type Handler struct {
+	store types.GoalStore
+}
+
+func NewHandler(store types.GoalStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/goals", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet:  h.GetGoals,
+			http.MethodPost: h.CreateGoal,
+		}),
+	))
+	router.HandleFunc("/goals/{id}", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet:    h.GetGoal,
+			http.MethodPut:    h.UpdateGoal,
+			http.MethodDelete: h.DeleteGoal,
+		}),
+	))
+	router.HandleFunc("/goals/{id}/contributions", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet:  h.GetContributions,
+			http.MethodPost: h.AddContribution,
+		}),
+	))
+	router.HandleFunc("/goals/{id}/contributions/{contributionId}", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodDelete: h.DeleteContribution,
+		}),
+	))
+}
+
+func (h *Handler) GetGoals(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	lookbackMonths, err := parseLookbackMonths(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	goals, err := h.store.GetGoalsByUserId(userId, lookbackMonths)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, map[string]interface{}{
+		"goals": goals,
+	})
+}
+
+func (h *Handler) GetGoal(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract goal ID from URL path (/goals/{id})
+	goalId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	lookbackMonths, err := parseLookbackMonths(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	goal, err := h.store.GetGoalById(goalId, userId, lookbackMonths)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, map[string]interface{}{
+		"goal": goal,
+	})
+}
+
+func (h *Handler) CreateGoal(w http.ResponseWriter, r *http.Request) {
+	// parse and validate JSON payload
+	var payload types.CreateGoalPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	goal, err := h.store.CreateGoal(&types.Goal{
+		UserID:           userId,
+		Name:             payload.Name,
+		TargetAmount:     payload.TargetAmount,
+		TargetDate:       payload.TargetDate,
+		AccountToken:     payload.AccountToken,
+		AnnualReturnRate: payload.AnnualReturnRate,
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, map[string]interface{}{
+		"goal": goal,
+	})
+}
+
+func (h *Handler) UpdateGoal(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract goal ID from URL path (/goals/{id})
+	goalId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.UpdateGoalPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	goal, err := h.store.UpdateGoal(&types.Goal{
+		ID:               goalId,
+		UserID:           userId,
+		Name:             payload.Name,
+		TargetAmount:     payload.TargetAmount,
+		TargetDate:       payload.TargetDate,
+		AccountToken:     payload.AccountToken,
+		AnnualReturnRate: payload.AnnualReturnRate,
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, map[string]interface{}{
+		"goal": goal,
+	})
+}
+
+func (h *Handler) DeleteGoal(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract goal ID from URL path (/goals/{id})
+	goalId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteGoal(goalId, userId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) GetContributions(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract goal ID from URL path (/goals/{id}/contributions)
+	goalId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	contributions, err := h.store.GetContributions(goalId, userId)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, map[string]interface{}{
+		"contributions": contributions,
+	})
+}
+
+func (h *Handler) AddContribution(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract goal ID from URL path (/goals/{id}/contributions)
+	goalId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.AddContributionPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	contribution, err := h.store.AddContribution(userId, &types.GoalContribution{
+		GoalID: goalId,
+		Amount: payload.Amount,
+		Date:   payload.Date,
+		Note:   payload.Note,
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, map[string]interface{}{
+		"contribution": contribution,
+	})
+}
+
+func (h *Handler) DeleteContribution(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract goal and contribution IDs from URL path (/goals/{id}/contributions/{contributionId})
+	goalId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+	contributionId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 3)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteContribution(goalId, contributionId, userId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// parseLookbackMonths reads the months query parameter, the default when it is missing
+func parseLookbackMonths(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("months")
+	if value == "" {
+		return DefaultLookbackMonths, nil
+	}
+
+	months, err := strconv.Atoi(value)
+	if err != nil || months < 1 || months > maxLookbackMonths {
+		return 0, fmt.Errorf("months must be a number between 1 and %d", maxLookbackMonths)
+	}
+	return months, nil
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrLinkedGoal):
+		utils.WriteError(w, http.StatusBadRequest, err)
+	default:
+		utils.WriteError(w, authz.StatusCode(err), err)
+	}
+}
@@ -0,0 +1,288 @@
+package goal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+// DefaultLookbackMonths is how many months of contributions the projection averages by default
+const DefaultLookbackMonths = 6
+
+var ErrLinkedGoal = fmt.Errorf("the goal follows an account, record a transaction in the account instead")
+
+type Store struct {
+	db     *sql.DB
+	policy *authz.Policy
+}
+
+func NewStore(db *sql.DB, policy *authz.Policy) *Store {
+	return &Store{
+		db:     db,
+		policy: policy,
+	}
+}
+
+const goalColumns = `
+    id, user_id, name, target_amount, target_date, account_token, annual_return_rate, created_at, updated_at
+`
+
+func (s *Store) GetGoalsByUserId(userId int, lookbackMonths int) ([]*types.Goal, error) {
+	query := fmt.Sprintf(`SELECT %s FROM goals WHERE user_id = $1 ORDER BY target_date, id`, goalColumns)
+	goals, err := db.QueryList(s.db, query, scanRowsIntoGoal, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, goal := range goals {
+		if err := s.attachProgress(goal, lookbackMonths); err != nil {
+			return nil, err
+		}
+	}
+
+	return goals, nil
+}
+
+func (s *Store) GetGoalById(id int, userId int, lookbackMonths int) (*types.Goal, error) {
+	goal, err := s.getGoal(id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachProgress(goal, lookbackMonths); err != nil {
+		return nil, err
+	}
+
+	return goal, nil
+}
+
+// getGoal reads a goal of the user without its progress, someone else's goal is not found
+func (s *Store) getGoal(id int, userId int) (*types.Goal, error) {
+	query := fmt.Sprintf(`SELECT %s FROM goals WHERE id = $1 AND user_id = $2`, goalColumns)
+	goal, err := db.QuerySingle(s.db, query, scanRowIntoGoal, id, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("goal %w", authz.ErrNotFound)
+		}
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (s *Store) CreateGoal(goal *types.Goal) (*types.Goal, error) {
+	// any member of an account can follow its balance
+	if goal.AccountToken != nil {
+		if err := s.policy.CanReadAccount(goal.UserID, *goal.AccountToken); err != nil {
+			return nil, err
+		}
+	}
+
+	var id int
+	err := s.db.QueryRow(
+		`INSERT INTO goals (user_id, name, target_amount, target_date, account_token, annual_return_rate)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		goal.UserID, goal.Name, goal.TargetAmount, goal.TargetDate, goal.AccountToken, goal.AnnualReturnRate,
+	).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create goal: %w", err)
+	}
+
+	return s.GetGoalById(id, goal.UserID, DefaultLookbackMonths)
+}
+
+func (s *Store) UpdateGoal(goal *types.Goal) (*types.Goal, error) {
+	if goal.AccountToken != nil {
+		if err := s.policy.CanReadAccount(goal.UserID, *goal.AccountToken); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := s.getGoal(goal.ID, goal.UserID); err != nil {
+		return nil, err
+	}
+
+	_, err := db.ExecWithValidation(s.db,
+		`UPDATE goals
+		 SET name = $1, target_amount = $2, target_date = $3, account_token = $4, annual_return_rate = $5, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $6 AND user_id = $7`,
+		goal.Name, goal.TargetAmount, goal.TargetDate, goal.AccountToken, goal.AnnualReturnRate, goal.ID, goal.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update goal: %w", err)
+	}
+
+	return s.GetGoalById(goal.ID, goal.UserID, DefaultLookbackMonths)
+}
+
+// DeleteGoal deletes the goal with its contributions, a linked account is left as it is
+func (s *Store) DeleteGoal(id int, userId int) error {
+	result, err := db.ExecWithValidation(s.db, "DELETE FROM goals WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("goal %w", authz.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (s *Store) GetContributions(goalId int, userId int) ([]*types.GoalContribution, error) {
+	if _, err := s.getGoal(goalId, userId); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, goal_id, amount, date, note, created_at
+		FROM goal_contributions
+		WHERE goal_id = $1
+		ORDER BY date DESC, id DESC`
+	return db.QueryList(s.db, query, scanRowsIntoContribution, goalId)
+}
+
+// AddContribution records a contribution by hand, goals that follow an account take theirs
+// from its transactions
+func (s *Store) AddContribution(userId int, contribution *types.GoalContribution) (*types.GoalContribution, error) {
+	goal, err := s.getGoal(contribution.GoalID, userId)
+	if err != nil {
+		return nil, err
+	}
+	if goal.AccountToken != nil {
+		return nil, ErrLinkedGoal
+	}
+
+	err = s.db.QueryRow(
+		`INSERT INTO goal_contributions (goal_id, amount, date, note) VALUES ($1, $2, $3, $4)
+		 RETURNING id, created_at`,
+		contribution.GoalID, contribution.Amount, contribution.Date, contribution.Note,
+	).Scan(&contribution.ID, &contribution.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add contribution: %w", err)
+	}
+
+	return contribution, nil
+}
+
+func (s *Store) DeleteContribution(goalId int, contributionId int, userId int) error {
+	if _, err := s.getGoal(goalId, userId); err != nil {
+		return err
+	}
+
+	result, err := db.ExecWithValidation(s.db,
+		"DELETE FROM goal_contributions WHERE id = $1 AND goal_id = $2", contributionId, goalId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("contribution %w", authz.ErrNotFound)
+	}
+
+	return nil
+}
+
+// attachProgress reads where the goal stands and projects it
+func (s *Store) attachProgress(goal *types.Goal, lookbackMonths int) error {
+	now := time.Now()
+	since := now.AddDate(0, -lookbackMonths, 0)
+
+	var current, net float64
+	var err error
+	if goal.AccountToken != nil {
+		current, net, err = s.accountSavings(goal.UserID, *goal.AccountToken, since)
+	} else {
+		current, net, err = s.contributedSavings(goal.ID, since)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read goal progress: %w", err)
+	}
+
+	goal.Progress = calculateProgress(goal, current, net, lookbackMonths, now)
+	return nil
+}
+
+// accountSavings returns the balance of the account and what its transactions added since
+// the date. An account the user can no longer read, left or in the trash, counts as empty.
+func (s *Store) accountSavings(userId int, accountToken string, since time.Time) (balance, net float64, err error) {
+	if err := s.policy.CanReadAccount(userId, accountToken); err != nil {
+		if errors.Is(err, authz.ErrNotFound) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+
+	err = s.db.QueryRow(
+		`SELECT a.balance, COALESCE((
+			SELECT SUM(CASE c.transaction_type_id WHEN $3 THEN t.amount WHEN $4 THEN -t.amount ELSE 0 END)
+			FROM transactions t
+			JOIN categories c ON c.id = t.category_id
+			WHERE t.account_token = a.token AND t.deleted_at IS NULL AND t.date >= $2
+		 ), 0)
+		 FROM accounts a
+		 WHERE a.token = $1`,
+		accountToken, since, int(types.CreditTransactionType), int(types.DebitTransactionType),
+	).Scan(&balance, &net)
+	return balance, net, err
+}
+
+// contributedSavings returns the sum of the contributions and the part of it since the date
+func (s *Store) contributedSavings(goalId int, since time.Time) (total, net float64, err error) {
+	err = s.db.QueryRow(
+		`SELECT COALESCE(SUM(amount), 0), COALESCE(SUM(amount) FILTER (WHERE date >= $2), 0)
+		 FROM goal_contributions
+		 WHERE goal_id = $1`,
+		goalId, since,
+	).Scan(&total, &net)
+	return total, net, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanGoalFromScanner(row scanner) (*types.Goal, error) {
+	g := new(types.Goal)
+	var targetDate time.Time
+
+	err := row.Scan(&g.ID, &g.UserID, &g.Name, &g.TargetAmount, &targetDate, &g.AccountToken,
+		&g.AnnualReturnRate, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	g.TargetDate = targetDate.Format("2006-01-02")
+	return g, nil
+}
+
+func scanRowsIntoGoal(rows *sql.Rows) (*types.Goal, error) {
+	return scanGoalFromScanner(rows)
+}
+
+func scanRowIntoGoal(row *sql.Row) (*types.Goal, error) {
+	return scanGoalFromScanner(row)
+}
+
+func scanRowsIntoContribution(rows *sql.Rows) (*types.GoalContribution, error) {
+	c := new(types.GoalContribution)
+	var date time.Time
+
+	err := rows.Scan(&c.ID, &c.GoalID, &c.Amount, &date, &c.Note, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Date = date.Format("2006-01-02")
+	return c, nil
+}
@@ -0,0 +1,118 @@
+package investment_calculator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+// defaultDrawdownYears is how long a drawdown is followed when the payload doesn't say
+const defaultDrawdownYears = 60
+
+var ErrNoExpenses = fmt.Errorf("there are no expenses to plan for, record some debit transactions first")
+
+func (s *Store) CalculateDrawdown(drawdown *types.DrawdownPayload) (*types.DrawdownResult, error) {
+	if drawdown.StartingPortfolio <= 0 {
+		return nil, fmt.Errorf("starting portfolio must be positive")
+	}
+
+	maxYears := drawdown.MaxYears
+	if maxYears == 0 {
+		maxYears = defaultDrawdownYears
+	}
+
+	// the withdrawal of a year before there is any money to take it from
+	var plannedWithdrawal func(year int, startValue float64) float64
+	switch drawdown.WithdrawalStrategy {
+	case types.WithdrawalFixed:
+		plannedWithdrawal = func(year int, startValue float64) float64 {
+			return drawdown.AnnualWithdrawal
+		}
+	case types.WithdrawalInflationAdjusted:
+		plannedWithdrawal = func(year int, startValue float64) float64 {
+			return drawdown.AnnualWithdrawal * math.Pow(1+drawdown.AnnualInflationRate, float64(year-1))
+		}
+	case types.WithdrawalPercentage:
+		plannedWithdrawal = func(year int, startValue float64) float64 {
+			return startValue * drawdown.WithdrawalRate
+		}
+	default:
+		return nil, fmt.Errorf("unknown withdrawal strategy %q", drawdown.WithdrawalStrategy)
+	}
+
+	result := &types.DrawdownResult{YearlyBreakdown: make([]types.DrawdownYear, 0, maxYears)}
+	value := drawdown.StartingPortfolio
+
+	for year := 1; year <= maxYears; year++ {
+		startValue := value
+		withdrawal := plannedWithdrawal(year, startValue)
+		if withdrawal > value {
+			// the last of the money doesn't cover the year
+			withdrawal = value
+			result.Depleted = true
+		} else {
+			result.YearsLasted = year
+		}
+
+		value -= withdrawal
+		yearReturn := value * drawdown.AnnualReturnRate
+		value += yearReturn
+		result.TotalWithdrawn += withdrawal
+
+		result.YearlyBreakdown = append(result.YearlyBreakdown, types.DrawdownYear{
+			Year:         year,
+			StartValue:   utils.Round(startValue, 2),
+			Withdrawal:   utils.Round(withdrawal, 2),
+			Return:       utils.Round(yearReturn, 2),
+			EndValue:     utils.Round(value, 2),
+			RealEndValue: utils.Round(toRealValue(value, drawdown.AnnualInflationRate, year), 2),
+		})
+
+		if result.Depleted || value <= 0 {
+			result.Depleted = true
+			break
+		}
+	}
+
+	result.FinalPortfolio = utils.Round(value, 2)
+	result.TotalWithdrawn = utils.Round(result.TotalWithdrawn, 2)
+	return result, nil
+}
+
+func (s *Store) PlanFire(annualExpenses float64, fire *types.FirePayload) (*types.FireResult, error) {
+	if annualExpenses <= 0 {
+		return nil, ErrNoExpenses
+	}
+
+	withdrawalRate := fire.WithdrawalRate
+	if withdrawalRate == 0 {
+		withdrawalRate = types.DefaultFireWithdrawalRate
+	}
+	target := annualExpenses / withdrawalRate
+
+	result := &types.FireResult{
+		AnnualExpenses:     annualExpenses,
+		LookbackMonths:     fire.LookbackMonths,
+		WithdrawalRate:     withdrawalRate,
+		TargetPortfolio:    utils.Round(target, 2),
+		CurrentPortfolio:   fire.CurrentPortfolio,
+		ProgressPercentage: utils.Round(fire.CurrentPortfolio/target*100, 2),
+	}
+
+	// reaching the target is the years solve mode of the calculator
+	if fire.CurrentPortfolio >= target || fire.MonthlyContribution > 0 {
+		years, err := solveYears(target, fire.CurrentPortfolio, fire.MonthlyContribution, fire.AnnualReturnRate, nil)
+		if err != nil && !errors.Is(err, ErrTargetUnreachable) {
+			return nil, err
+		}
+		if err == nil {
+			years = utils.Round(years, 2)
+			result.YearsToTarget = &years
+		}
+	}
+
+	return result, nil
+}
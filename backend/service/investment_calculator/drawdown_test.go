@@ -0,0 +1,84 @@
+package investment_calculator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func TestFixedWithdrawalDepletes(t *testing.T) {
+	result, err := NewStore().CalculateDrawdown(&types.DrawdownPayload{
+		StartingPortfolio:  100000,
+		WithdrawalStrategy: types.WithdrawalFixed,
+		AnnualWithdrawal:   10000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Depleted || result.YearsLasted != 10 {
+		t.Errorf("expected to last 10 years and deplete, got %d years, depleted %v", result.YearsLasted, result.Depleted)
+	}
+	assertClose(t, "total withdrawn", result.TotalWithdrawn, 100000, 0.001)
+	assertClose(t, "final portfolio", result.FinalPortfolio, 0, 0.001)
+}
+
+func TestInflationAdjustedWithdrawalGrows(t *testing.T) {
+	result, err := NewStore().CalculateDrawdown(&types.DrawdownPayload{
+		StartingPortfolio:   1000000,
+		WithdrawalStrategy:  types.WithdrawalInflationAdjusted,
+		AnnualWithdrawal:    10000,
+		AnnualInflationRate: 0.1,
+		MaxYears:            3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []float64{10000, 11000, 12100}
+	for i, year := range result.YearlyBreakdown {
+		assertClose(t, "withdrawal", year.Withdrawal, expected[i], 0.001)
+	}
+}
+
+func TestPercentageWithdrawalNeverDepletes(t *testing.T) {
+	result, err := NewStore().CalculateDrawdown(&types.DrawdownPayload{
+		StartingPortfolio:  100000,
+		WithdrawalStrategy: types.WithdrawalPercentage,
+		WithdrawalRate:     0.5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Depleted || result.YearsLasted != defaultDrawdownYears {
+		t.Errorf("expected to last %d years, got %d years, depleted %v", defaultDrawdownYears, result.YearsLasted, result.Depleted)
+	}
+}
+
+func TestPlanFire(t *testing.T) {
+	store := NewStore()
+
+	result, err := store.PlanFire(20000, &types.FirePayload{
+		LookbackMonths:      12,
+		CurrentPortfolio:    100000,
+		MonthlyContribution: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the 4% rule, 25 times the expenses
+	assertClose(t, "target portfolio", result.TargetPortfolio, 500000, 0.001)
+	assertClose(t, "progress", result.ProgressPercentage, 20, 0.001)
+	if result.YearsToTarget == nil {
+		t.Fatal("expected the years to the target")
+	}
+	// 400000 missing at 12000 a year without returns
+	assertClose(t, "years to target", *result.YearsToTarget, 400000.0/12000, 0.01)
+
+	if _, err := store.PlanFire(0, &types.FirePayload{}); !errors.Is(err, ErrNoExpenses) {
+		t.Errorf("expected ErrNoExpenses, got %v", err)
+	}
+}
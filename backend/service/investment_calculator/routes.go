@@ -1,6 +1,8 @@
 package investment_calculator
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/lucas-remigio/wallet-tracker/middleware"
@@ -8,16 +10,33 @@ import (
 	"github.com/lucas-remigio/wallet-tracker/utils"
 )
 
+// defaultFireLookbackMonths is how many months of expenses FIRE averages when not given
+const defaultFireLookbackMonths = 12
+
 type Handler struct {
-	store types.InvestmentCalculatorStore
+	store            types.InvestmentCalculatorStore
+	transactionStore types.TransactionStore
 }
 
-func NewHandler(store types.InvestmentCalculatorStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(store types.InvestmentCalculatorStore, transactionStore types.TransactionStore) *Handler {
+	return &Handler{store: store, transactionStore: transactionStore}
 }
 
 func (h *Handler) RegisterRoutes(router *http.ServeMux) {
 	router.HandleFunc("/investment-calculator", h.handleCalculate)
+	router.HandleFunc("/investment-calculator/drawdown", h.handleDrawdown)
+	// simulations are the most expensive calculation, only users can run them
+	router.HandleFunc("/investment-calculator/simulate", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.handleSimulate,
+		}),
+	))
+	// FIRE reads the user's own expenses
+	router.HandleFunc("/investment-calculator/fire", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.handleFire,
+		}),
+	))
 }
 
 func (h *Handler) handleCalculate(w http.ResponseWriter, r *http.Request) {
@@ -32,13 +51,118 @@ func (h *Handler) handleCalculate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// call the store to calculate the investment
-	result, err := h.store.CalculateInvestmentYearlyReturn(
-		payload.InitialInvestment,
-		payload.MonthlyContribution,
-		payload.AnnualReturnRate,
-		payload.InvestmentDurationYears,
-	)
+	// solve for the missing input when asked to, otherwise calculate the investment
+	var result *types.InvestmentCalculatorResult
+	var err error
+	if payload.SolveFor != "" {
+		result, err = h.store.SolveInvestment(
+			payload.SolveFor,
+			payload.TargetValue,
+			payload.InitialInvestment,
+			payload.MonthlyContribution,
+			payload.AnnualReturnRate,
+			payload.InvestmentDurationYears,
+			payload.Options(),
+		)
+	} else {
+		result, err = h.store.CalculateInvestmentYearlyReturn(
+			payload.InitialInvestment,
+			payload.MonthlyContribution,
+			payload.AnnualReturnRate,
+			payload.InvestmentDurationYears,
+			payload.Options(),
+		)
+	}
+	if errors.Is(err, ErrTargetUnreachable) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, result)
+}
+
+func (h *Handler) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	if _, ok := middleware.RequireAuth(w, r); !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.InvestmentSimulationPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	// the simulation gives up when the client leaves or it runs too long
+	result, err := h.store.SimulateInvestment(r.Context(), &payload)
+	if errors.Is(err, ErrSimulationTooLarge) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		utils.WriteError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, result)
+}
+
+func (h *Handler) handleDrawdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.DrawdownPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	result, err := h.store.CalculateDrawdown(&payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, result)
+}
+
+func (h *Handler) handleFire(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.FirePayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+	if payload.LookbackMonths == 0 {
+		payload.LookbackMonths = defaultFireLookbackMonths
+	}
+
+	annualExpenses, err := h.transactionStore.GetAverageAnnualExpenses(userId, payload.LookbackMonths)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result, err := h.store.PlanFire(annualExpenses, &payload)
+	if errors.Is(err, ErrNoExpenses) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
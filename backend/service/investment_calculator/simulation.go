@@ -0,0 +1,228 @@
+package investment_calculator
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const (
+	defaultSimulations = 1000
+	// maxSimulationTime bounds the CPU a single request can take
+	maxSimulationTime = 5 * time.Second
+	// maxSimulatedYears bounds the simulations times the years a single request can ask for
+	maxSimulatedYears = 200_000
+	// maxConcurrentSimulations is how many requests simulate at once, the others wait for a
+	// slot within their time limit
+	maxConcurrentSimulations = 2
+	// lowest yearly return a draw can have, a normal distribution could go below losing everything
+	minYearlyReturn = -0.99
+)
+
+// historicalReturnsJSON holds the yearly returns the historical model draws from
+//
+//go:embed data/historical_returns.json
+var historicalReturnsJSON []byte
+
+var historicalReturns = mustLoadHistoricalReturns()
+
+var ErrSimulationTooLarge = fmt.Errorf("at most %d simulations times years can be simulated at once", maxSimulatedYears)
+
+// simulationSlots keeps the simulations of all requests together from taking every CPU
+var simulationSlots = make(chan struct{}, maxConcurrentSimulations)
+
+func mustLoadHistoricalReturns() []float64 {
+	var data struct {
+		Returns []struct {
+			Year   int     `json:"year"`
+			Return float64 `json:"return"`
+		} `json:"returns"`
+	}
+	if err := json.Unmarshal(historicalReturnsJSON, &data); err != nil {
+		panic(fmt.Sprintf("invalid historical returns: %v", err))
+	}
+
+	returns := make([]float64, len(data.Returns))
+	for i, year := range data.Returns {
+		returns[i] = year.Return
+	}
+	return returns
+}
+
+func (s *Store) SimulateInvestment(ctx context.Context, simulation *types.InvestmentSimulationPayload) (*types.InvestmentSimulationResult, error) {
+	if simulation.InvestmentDurationYears <= 0 {
+		return nil, fmt.Errorf("investment duration must be positive")
+	}
+
+	simulations := simulation.Simulations
+	if simulations == 0 {
+		simulations = defaultSimulations
+	}
+	if simulations*simulation.InvestmentDurationYears > maxSimulatedYears {
+		return nil, ErrSimulationTooLarge
+	}
+	returnModel := simulation.ReturnModel
+	if returnModel == "" {
+		returnModel = types.ReturnModelNormal
+	}
+	var seed int64
+	if simulation.Seed != nil {
+		seed = *simulation.Seed
+	} else {
+		seed = rand.Int64()
+	}
+
+	var drawReturn func(rng *rand.Rand) float64
+	switch returnModel {
+	case types.ReturnModelNormal:
+		drawReturn = func(rng *rand.Rand) float64 {
+			return simulation.ExpectedReturn + simulation.Volatility*rng.NormFloat64()
+		}
+	case types.ReturnModelHistorical:
+		drawReturn = func(rng *rand.Rand) float64 {
+			return historicalReturns[rng.IntN(len(historicalReturns))]
+		}
+	default:
+		return nil, fmt.Errorf("unknown return model %q", returnModel)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxSimulationTime)
+	defer cancel()
+
+	select {
+	case simulationSlots <- struct{}{}:
+		defer func() { <-simulationSlots }()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no simulation slot became free: %w", ctx.Err())
+	}
+
+	values, err := runSimulations(ctx, simulations, seed, func(rng *rand.Rand) []float64 {
+		return simulatePath(simulation.InitialInvestment, simulation.MonthlyContribution, simulation.InvestmentDurationYears, func() float64 {
+			return drawReturn(rng)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.InvestmentSimulationResult{
+		Seed:              seed,
+		Simulations:       simulations,
+		ReturnModel:       returnModel,
+		TotalInvestment:   simulation.InitialInvestment + simulation.MonthlyContribution*float64(simulation.InvestmentDurationYears*12),
+		YearlyPercentiles: yearlyPercentiles(values, simulation.InitialInvestment, simulation.MonthlyContribution),
+	}
+
+	if simulation.TargetValue > 0 {
+		reached := 0
+		for _, path := range values {
+			if path[len(path)-1] >= simulation.TargetValue {
+				reached++
+			}
+		}
+		probability := float64(reached) / float64(simulations)
+		result.ProbabilityOfReachingTarget = &probability
+	}
+
+	return result, nil
+}
+
+// runSimulations fans the simulations out over one goroutine per CPU. Every simulation gets its
+// own generator seeded from the seed and its index, so the result doesn't depend on which
+// goroutine ran it.
+func runSimulations(ctx context.Context, simulations int, seed int64, simulate func(rng *rand.Rand) []float64) ([][]float64, error) {
+	values := make([][]float64, simulations)
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < runtime.GOMAXPROCS(0); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				rng := rand.New(rand.NewPCG(uint64(seed), uint64(i)))
+				values[i] = simulate(rng)
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := 0; i < simulations; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			err = fmt.Errorf("simulation stopped before finishing: %w", ctx.Err())
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	return values, err
+}
+
+// simulatePath returns the value at the end of every year, each year draws its return and
+// compounds it monthly with the contributions at the end of the month
+func simulatePath(initialInvestment, monthlyContribution float64, years int, drawReturn func() float64) []float64 {
+	path := make([]float64, years)
+	value := initialInvestment
+
+	for year := 0; year < years; year++ {
+		yearlyReturn := math.Max(drawReturn(), minYearlyReturn)
+		monthlyReturn := math.Pow(1+yearlyReturn, 1.0/12) - 1
+
+		for month := 0; month < 12; month++ {
+			value = value*(1+monthlyReturn) + monthlyContribution
+		}
+		path[year] = value
+	}
+
+	return path
+}
+
+// yearlyPercentiles sorts the values of every year across the simulations to read the bands
+func yearlyPercentiles(values [][]float64, initialInvestment, monthlyContribution float64) []types.YearlyPercentiles {
+	years := len(values[0])
+	percentiles := make([]types.YearlyPercentiles, years)
+	yearValues := make([]float64, len(values))
+
+	for year := 0; year < years; year++ {
+		for i, path := range values {
+			yearValues[i] = path[year]
+		}
+		sort.Float64s(yearValues)
+
+		percentiles[year] = types.YearlyPercentiles{
+			Year:            year + 1,
+			TotalInvestment: initialInvestment + monthlyContribution*float64((year+1)*12),
+			P10:             percentile(yearValues, 0.1),
+			P50:             percentile(yearValues, 0.5),
+			P90:             percentile(yearValues, 0.9),
+		}
+	}
+
+	return percentiles
+}
+
+// percentile interpolates between the two closest ranks of the sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
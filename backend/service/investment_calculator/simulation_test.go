@@ -0,0 +1,146 @@
+package investment_calculator
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func simulationPayload(seed int64) *types.InvestmentSimulationPayload {
+	return &types.InvestmentSimulationPayload{
+		InitialInvestment:       10000,
+		MonthlyContribution:     200,
+		InvestmentDurationYears: 20,
+		ExpectedReturn:          0.07,
+		Volatility:              0.15,
+		Simulations:             500,
+		Seed:                    &seed,
+		TargetValue:             150000,
+	}
+}
+
+func TestSimulationIsReproducibleFromTheSeed(t *testing.T) {
+	store := NewStore()
+
+	first, err := store.SimulateInvestment(context.Background(), simulationPayload(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fewer goroutines must not change which numbers each simulation draws
+	previous := runtime.GOMAXPROCS(1)
+	defer runtime.GOMAXPROCS(previous)
+	second, err := store.SimulateInvestment(context.Background(), simulationPayload(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(first, second) {
+		t.Error("expected the same seed to give the same result")
+	}
+
+	other, err := store.SimulateInvestment(context.Background(), simulationPayload(43))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(first.YearlyPercentiles, other.YearlyPercentiles) {
+		t.Error("expected another seed to give another result")
+	}
+}
+
+func TestSimulationBands(t *testing.T) {
+	result, err := NewStore().SimulateInvestment(context.Background(), simulationPayload(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.YearlyPercentiles) != 20 {
+		t.Fatalf("expected 20 years, got %d", len(result.YearlyPercentiles))
+	}
+	for _, year := range result.YearlyPercentiles {
+		if !(year.P10 < year.P50 && year.P50 < year.P90) {
+			t.Errorf("expected P10 < P50 < P90 in year %d, got %+v", year.Year, year)
+		}
+	}
+	if p := result.ProbabilityOfReachingTarget; p == nil || *p <= 0 || *p >= 1 {
+		t.Errorf("expected a probability strictly between 0 and 1, got %v", p)
+	}
+}
+
+func TestSimulationWithoutVolatilityMatchesCompounding(t *testing.T) {
+	payload := simulationPayload(1)
+	payload.Volatility = 0
+	result, err := NewStore().SimulateInvestment(context.Background(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same yearly return every year, compounded monthly
+	monthlyReturn := math.Pow(1.07, 1.0/12) - 1
+	expected := 10000 * math.Pow(1+monthlyReturn, 240)
+	expected += 200 * (math.Pow(1+monthlyReturn, 240) - 1) / monthlyReturn
+
+	last := result.YearlyPercentiles[19]
+	assertClose(t, "P10", last.P10, expected, 0.01)
+	assertClose(t, "P90", last.P90, expected, 0.01)
+}
+
+func TestHistoricalSimulation(t *testing.T) {
+	if len(historicalReturns) == 0 {
+		t.Fatal("expected the embedded historical returns to load")
+	}
+
+	payload := simulationPayload(3)
+	payload.ReturnModel = types.ReturnModelHistorical
+	result, err := NewStore().SimulateInvestment(context.Background(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ReturnModel != types.ReturnModelHistorical || len(result.YearlyPercentiles) != 20 {
+		t.Errorf("unexpected historical result %+v", result)
+	}
+}
+
+func TestSimulationStopsWithTheContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	payload := simulationPayload(1)
+	payload.Simulations = 10000
+	if _, err := NewStore().SimulateInvestment(ctx, payload); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the simulation to stop, got %v", err)
+	}
+}
+
+func TestSimulationIsCappedPerRequest(t *testing.T) {
+	payload := simulationPayload(1)
+	payload.Simulations = 10000
+	payload.InvestmentDurationYears = 100
+	if _, err := NewStore().SimulateInvestment(context.Background(), payload); !errors.Is(err, ErrSimulationTooLarge) {
+		t.Errorf("expected the simulation to be refused, got %v", err)
+	}
+}
+
+func TestSimulationWaitsForAFreeSlot(t *testing.T) {
+	// other requests hold every slot
+	for i := 0; i < maxConcurrentSimulations; i++ {
+		simulationSlots <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < maxConcurrentSimulations; i++ {
+			<-simulationSlots
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := NewStore().SimulateInvestment(ctx, simulationPayload(1)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the simulation to give up waiting, got %v", err)
+	}
+}
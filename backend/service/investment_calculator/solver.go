@@ -0,0 +1,160 @@
+package investment_calculator
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+// maxSolvedYears is the longest duration the years solver looks at, the same the payload allows
+const maxSolvedYears = 100
+
+var ErrTargetUnreachable = fmt.Errorf("the target value can't be reached with these inputs")
+
+func (s *Store) SolveInvestment(solveFor string, targetValue, initialInvestment, monthlyContribution, annualReturnRate float64, investmentDurationYears int, options *types.InvestmentOptions) (*types.InvestmentCalculatorResult, error) {
+	if targetValue <= 0 {
+		return nil, fmt.Errorf("target value must be positive")
+	}
+	if initialInvestment < 0 {
+		return nil, fmt.Errorf("initial investment cannot be negative")
+	}
+
+	var value float64
+	var err error
+	switch solveFor {
+	case types.SolveForMonthlyContribution:
+		if investmentDurationYears <= 0 {
+			return nil, fmt.Errorf("investment duration must be positive")
+		}
+		value, err = solveMonthlyContribution(targetValue, initialInvestment, annualReturnRate, investmentDurationYears, options)
+		monthlyContribution = value
+	case types.SolveForYears:
+		if monthlyContribution <= 0 {
+			return nil, fmt.Errorf("monthly contribution must be positive")
+		}
+		value, err = solveYears(targetValue, initialInvestment, monthlyContribution, annualReturnRate, options)
+		investmentDurationYears = int(math.Ceil(value))
+	case types.SolveForAnnualReturnRate:
+		if investmentDurationYears <= 0 {
+			return nil, fmt.Errorf("investment duration must be positive")
+		}
+		value, err = solveAnnualReturnRate(targetValue, initialInvestment, monthlyContribution, investmentDurationYears, options)
+		annualReturnRate = value
+	default:
+		return nil, fmt.Errorf("unknown solve mode %q", solveFor)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := project(initialInvestment, monthlyContribution, annualReturnRate, investmentDurationYears, options)
+	result.Solution = &types.InvestmentSolution{
+		SolveFor:    solveFor,
+		Value:       value,
+		TargetValue: targetValue,
+	}
+	return result, nil
+}
+
+// finalValue is the value the target is compared with, after the capital gains tax when the
+// options apply it
+func finalValue(initialInvestment, monthlyContribution, annualReturnRate float64, years int, options *types.InvestmentOptions) float64 {
+	result := project(initialInvestment, monthlyContribution, annualReturnRate, years, options)
+	if options.IsDefault() {
+		return result.TotalValue
+	}
+	return result.NetValue
+}
+
+// solveMonthlyContribution inverts the annuity formula, FV = P(1+r)^n + PMT * [(1+r)^n - 1] / r.
+// The value grows with the contribution, so with options it is bracketed and bisected.
+func solveMonthlyContribution(targetValue, initialInvestment, annualReturnRate float64, years int, options *types.InvestmentOptions) (float64, error) {
+	if options.IsDefault() {
+		months := years * 12
+		monthlyReturn := annualReturnRate / 12
+		missing := targetValue - calculateCompoundInterest(initialInvestment, 0, monthlyReturn, months)
+		if missing <= 0 {
+			// the initial investment gets there on its own
+			return 0, nil
+		}
+		return missing / calculateCompoundInterest(0, 1, monthlyReturn, months), nil
+	}
+
+	valueAt := func(contribution float64) float64 {
+		return finalValue(initialInvestment, contribution, annualReturnRate, years, options)
+	}
+	if valueAt(0) >= targetValue {
+		return 0, nil
+	}
+
+	// contributing the whole target every month is far more than enough, unless fees eat it all
+	high := targetValue
+	if valueAt(high) < targetValue {
+		return 0, ErrTargetUnreachable
+	}
+	return bisect(func(contribution float64) float64 { return valueAt(contribution) - targetValue }, 0, high), nil
+}
+
+// solveYears inverts the annuity formula for n, n = ln((FV*r + PMT) / (P*r + PMT)) / ln(1+r), and
+// gives fractional years. The simulation only steps whole years, so with options it returns the
+// first whole year the target is reached.
+func solveYears(targetValue, initialInvestment, monthlyContribution, annualReturnRate float64, options *types.InvestmentOptions) (float64, error) {
+	if initialInvestment >= targetValue {
+		return 0, nil
+	}
+
+	if options.IsDefault() {
+		monthlyReturn := annualReturnRate / 12
+		var months float64
+		if monthlyReturn == 0 {
+			months = (targetValue - initialInvestment) / monthlyContribution
+		} else {
+			months = math.Log((targetValue*monthlyReturn+monthlyContribution)/(initialInvestment*monthlyReturn+monthlyContribution)) /
+				math.Log(1+monthlyReturn)
+		}
+		if months > maxSolvedYears*12 {
+			return 0, ErrTargetUnreachable
+		}
+		return months / 12, nil
+	}
+
+	for years := 1; years <= maxSolvedYears; years++ {
+		if finalValue(initialInvestment, monthlyContribution, annualReturnRate, years, options) >= targetValue {
+			return float64(years), nil
+		}
+	}
+	return 0, ErrTargetUnreachable
+}
+
+// solveAnnualReturnRate has no closed form, the value grows with the rate so it is bisected
+// between no return and the highest rate the payload allows
+func solveAnnualReturnRate(targetValue, initialInvestment, monthlyContribution float64, years int, options *types.InvestmentOptions) (float64, error) {
+	valueAt := func(rate float64) float64 {
+		return finalValue(initialInvestment, monthlyContribution, rate, years, options)
+	}
+
+	if valueAt(0) >= targetValue {
+		return 0, nil
+	}
+	if valueAt(1) < targetValue {
+		return 0, ErrTargetUnreachable
+	}
+	return bisect(func(rate float64) float64 { return valueAt(rate) - targetValue }, 0, 1), nil
+}
+
+// bisect finds the root of an increasing function that is negative at low and positive at high
+func bisect(f func(float64) float64, low, high float64) float64 {
+	for i := 0; i < 200; i++ {
+		mid := (low + high) / 2
+		if f(mid) < 0 {
+			low = mid
+		} else {
+			high = mid
+		}
+		if high-low < 1e-10 {
+			break
+		}
+	}
+	return (low + high) / 2
+}
@@ -0,0 +1,110 @@
+package investment_calculator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+func TestSolveMonthlyContribution(t *testing.T) {
+	store := NewStore()
+
+	// PMT(5%/12, 120, 0, 100000) = 643.99
+	result, err := store.SolveInvestment(types.SolveForMonthlyContribution, 100000, 0, 0, 0.05, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertClose(t, "monthly contribution", result.Solution.Value, 643.99, 0.01)
+	assertClose(t, "projected value", result.TotalValue, 100000, 0.01)
+
+	// the initial investment already gets there
+	result, err = store.SolveInvestment(types.SolveForMonthlyContribution, 1000, 1000, 0, 0.05, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Solution.Value != 0 {
+		t.Errorf("expected no contribution needed, got %f", result.Solution.Value)
+	}
+}
+
+func TestSolveMonthlyContributionWithOptions(t *testing.T) {
+	options := &types.InvestmentOptions{
+		CompoundingFrequency: types.CompoundingYearly,
+		ContributionTiming:   types.ContributionTimingEnd,
+		CapitalGainsTaxRate:  types.PortugalCapitalGainsTaxRate,
+	}
+
+	contribution, err := solveMonthlyContribution(50000, 1000, 0.07, 15, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the value after tax lands on the target
+	assertClose(t, "value after tax", finalValue(1000, contribution, 0.07, 15, options), 50000, 0.001)
+}
+
+func TestSolveYears(t *testing.T) {
+	// NPER(6%/12, -500, 0, 100000) = 138.98 months
+	years, err := solveYears(100000, 0, 500, 0.06, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertClose(t, "months", years*12, 138.98, 0.01)
+
+	// without a return it is a division
+	years, err = solveYears(12000, 0, 100, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertClose(t, "years", years, 10, 1e-9)
+
+	// the simulation rounds up to whole years
+	options := &types.InvestmentOptions{CompoundingFrequency: types.CompoundingYearly}
+	years, err = solveYears(12000, 0, 100, 0, options)
+	if err != nil || years != 10 {
+		t.Errorf("expected 10 whole years, got %f (%v)", years, err)
+	}
+	years, err = solveYears(12001, 0, 100, 0, options)
+	if err != nil || years != 11 {
+		t.Errorf("expected 11 whole years, got %f (%v)", years, err)
+	}
+}
+
+func TestSolveAnnualReturnRate(t *testing.T) {
+	// FV(6%/12, 120, -100) = 16387.93
+	rate, err := solveAnnualReturnRate(16387.93, 0, 100, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertClose(t, "annual return rate", rate, 0.06, 1e-6)
+
+	if _, err := solveAnnualReturnRate(1e9, 0, 1, 1, nil); !errors.Is(err, ErrTargetUnreachable) {
+		t.Errorf("expected an unreachable target, got %v", err)
+	}
+}
+
+func TestSolveForLetsTheSolvedInputOut(t *testing.T) {
+	solving := types.InvestmentCalculatorPayload{
+		SolveFor:                types.SolveForMonthlyContribution,
+		TargetValue:             100000,
+		AnnualReturnRate:        0.05,
+		InvestmentDurationYears: 10,
+	}
+	if err := utils.Validate.Struct(solving); err != nil {
+		t.Errorf("expected the contribution to be optional when solving for it, got %v", err)
+	}
+
+	withoutTarget := solving
+	withoutTarget.TargetValue = 0
+	if err := utils.Validate.Struct(withoutTarget); err == nil {
+		t.Error("expected a target value to be required when solving")
+	}
+
+	notSolving := solving
+	notSolving.SolveFor = ""
+	notSolving.TargetValue = 0
+	if err := utils.Validate.Struct(notSolving); err == nil {
+		t.Error("expected the contribution to be required when not solving for it")
+	}
+}
@@ -14,7 +14,7 @@ func NewStore() *Store {
 	return &Store{}
 }
 
-func (s *Store) CalculateInvestmentYearlyReturn(initialInvestment, monthlyContribution, annualReturnRate float64, investmentDurationYears int) (*types.InvestmentCalculatorResult, error) {
+func (s *Store) CalculateInvestmentYearlyReturn(initialInvestment, monthlyContribution, annualReturnRate float64, investmentDurationYears int, options *types.InvestmentOptions) (*types.InvestmentCalculatorResult, error) {
 	// Validate inputs
 	if monthlyContribution <= 0 || investmentDurationYears <= 0 {
 		return nil, fmt.Errorf("monthly contribution and investment duration must be positive")
@@ -29,6 +29,17 @@ func (s *Store) CalculateInvestmentYearlyReturn(initialInvestment, monthlyContri
 		return nil, fmt.Errorf("annual return rate must be between 0 and 1")
 	}
 
+	return project(initialInvestment, monthlyContribution, annualReturnRate, investmentDurationYears, options), nil
+}
+
+// project calculates the investment without validating it, the solvers also project values the
+// payload wouldn't allow like a zero contribution
+func project(initialInvestment, monthlyContribution, annualReturnRate float64, investmentDurationYears int, options *types.InvestmentOptions) *types.InvestmentCalculatorResult {
+	// Inflation, fees and the rest need the period by period simulation
+	if !options.IsDefault() {
+		return simulateInvestment(initialInvestment, monthlyContribution, annualReturnRate, investmentDurationYears, options)
+	}
+
 	// Pre-calculate common values to avoid redundant calculations
 	monthlyReturn := annualReturnRate / 12
 	totalMonths := investmentDurationYears * 12
@@ -46,7 +57,7 @@ func (s *Store) CalculateInvestmentYearlyReturn(initialInvestment, monthlyContri
 		TotalReturn:     totalReturn,
 		TotalValue:      totalValue,
 		YearlyBreakdown: yearlyBreakdown,
-	}, nil
+	}
 }
 
 // calculateCompoundInterest calculates final value with optimized math operations
@@ -104,3 +115,82 @@ func generateYearlyBreakdown(initialInvestment, monthlyContribution, monthlyRetu
 
 	return breakdown
 }
+
+// FutureValue is the value after months of monthly contributions earning the annual rate,
+// compounded monthly
+func FutureValue(initialInvestment, monthlyContribution, annualReturnRate float64, months int) float64 {
+	return calculateCompoundInterest(initialInvestment, monthlyContribution, annualReturnRate/12, months)
+}
+
+// compoundingPeriodsPerYear maps a compounding frequency to the periods in a year
+var compoundingPeriodsPerYear = map[string]int{
+	types.CompoundingMonthly:   12,
+	types.CompoundingQuarterly: 4,
+	types.CompoundingYearly:    1,
+}
+
+// simulateInvestment steps through every compounding period. The monthly contributions of a
+// period are made together at its start or end, and fees come out of the value after growth.
+func simulateInvestment(initialInvestment, monthlyContribution, annualReturnRate float64, years int, options *types.InvestmentOptions) *types.InvestmentCalculatorResult {
+	periodsPerYear, ok := compoundingPeriodsPerYear[options.CompoundingFrequency]
+	if !ok {
+		periodsPerYear = 12
+	}
+	periodReturn := annualReturnRate / float64(periodsPerYear)
+	periodFee := options.AnnualFeeRate / float64(periodsPerYear)
+	contributeAtStart := options.ContributionTiming == types.ContributionTimingStart
+
+	value := initialInvestment
+	totalInvestment := initialInvestment
+	totalFees := 0.0
+	breakdown := make([]types.YearlyBreakdown, years)
+
+	for year := 1; year <= years; year++ {
+		// the contribution grows once a year
+		periodContribution := monthlyContribution * math.Pow(1+options.ContributionGrowthRate, float64(year-1)) *
+			12 / float64(periodsPerYear)
+
+		for period := 0; period < periodsPerYear; period++ {
+			if contributeAtStart {
+				value += periodContribution
+			}
+			value *= 1 + periodReturn
+			fee := value * periodFee
+			value -= fee
+			totalFees += fee
+			if !contributeAtStart {
+				value += periodContribution
+			}
+			totalInvestment += periodContribution
+		}
+
+		breakdown[year-1] = types.YearlyBreakdown{
+			Year:            year,
+			TotalInvestment: totalInvestment,
+			TotalReturn:     value - totalInvestment,
+			TotalValue:      value,
+			RealTotalValue:  toRealValue(value, options.AnnualInflationRate, year),
+			TotalFees:       totalFees,
+		}
+	}
+
+	// the tax is only due on a gain
+	capitalGainsTax := math.Max(value-totalInvestment, 0) * options.CapitalGainsTaxRate
+	netValue := value - capitalGainsTax
+
+	return &types.InvestmentCalculatorResult{
+		TotalInvestment: totalInvestment,
+		TotalReturn:     value - totalInvestment,
+		TotalValue:      value,
+		TotalFees:       totalFees,
+		CapitalGainsTax: capitalGainsTax,
+		NetValue:        netValue,
+		RealNetValue:    toRealValue(netValue, options.AnnualInflationRate, years),
+		YearlyBreakdown: breakdown,
+	}
+}
+
+// toRealValue discounts a value years from now to today's money
+func toRealValue(value, annualInflationRate float64, years int) float64 {
+	return value / math.Pow(1+annualInflationRate, float64(years))
+}
@@ -0,0 +1,74 @@
+package investment_calculator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func assertClose(t *testing.T, name string, got, expected, tolerance float64) {
+	t.Helper()
+	if math.Abs(got-expected) > tolerance {
+		t.Errorf("%s = %f, expected %f", name, got, expected)
+	}
+}
+
+func TestSimulationMatchesClosedForm(t *testing.T) {
+	store := NewStore()
+
+	fast, err := store.CalculateInvestmentYearlyReturn(1000, 100, 0.06, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulated := simulateInvestment(1000, 100, 0.06, 10, &types.InvestmentOptions{
+		CompoundingFrequency: types.CompoundingMonthly,
+		ContributionTiming:   types.ContributionTimingEnd,
+	})
+
+	assertClose(t, "total value", simulated.TotalValue, fast.TotalValue, 0.01)
+	for i := range fast.YearlyBreakdown {
+		assertClose(t, "yearly value", simulated.YearlyBreakdown[i].TotalValue, fast.YearlyBreakdown[i].TotalValue, 0.01)
+	}
+}
+
+func TestContributionAtStartEarnsOneMorePeriod(t *testing.T) {
+	options := &types.InvestmentOptions{CompoundingFrequency: types.CompoundingYearly, ContributionTiming: types.ContributionTimingStart}
+	result := simulateInvestment(0, 100, 0.1, 2, options)
+
+	// 1200 a year paid at the start: 1200 * 1.1 * 1.1 + 1200 * 1.1 (annuity due)
+	assertClose(t, "total value", result.TotalValue, 1200*1.1*1.1+1200*1.1, 0.001)
+}
+
+func TestInflationFeesAndTax(t *testing.T) {
+	options := &types.InvestmentOptions{
+		AnnualInflationRate:    0.02,
+		ContributionGrowthRate: 0.1,
+		CompoundingFrequency:   types.CompoundingYearly,
+		ContributionTiming:     types.ContributionTimingEnd,
+		AnnualFeeRate:          0.01,
+		CapitalGainsTaxRate:    types.PortugalCapitalGainsTaxRate,
+	}
+	result := simulateInvestment(1000, 100, 0.05, 2, options)
+
+	// year 1: 1000 grows to 1050, 1% fee, then 1200 in. Year 2: 10% more contribution
+	yearOne := 1050 * 0.99
+	yearTwo := (yearOne+1200)*1.05*0.99 + 1320
+	assertClose(t, "total value", result.TotalValue, yearTwo, 0.001)
+	assertClose(t, "total investment", result.TotalInvestment, 1000+1200+1320, 0.001)
+	assertClose(t, "fees", result.TotalFees, 1050*0.01+(yearOne+1200)*1.05*0.01, 0.001)
+
+	gain := yearTwo - result.TotalInvestment
+	assertClose(t, "tax", result.CapitalGainsTax, gain*0.28, 0.001)
+	assertClose(t, "real net value", result.RealNetValue, (yearTwo-gain*0.28)/(1.02*1.02), 0.001)
+	assertClose(t, "real value", result.YearlyBreakdown[0].RealTotalValue, (yearOne+1200)/1.02, 0.001)
+}
+
+func TestNoTaxOnALoss(t *testing.T) {
+	options := &types.InvestmentOptions{AnnualFeeRate: 0.05, CapitalGainsTaxRate: 0.28}
+	result := simulateInvestment(1000, 10, 0, 1, options)
+
+	if result.CapitalGainsTax != 0 || result.NetValue != result.TotalValue {
+		t.Errorf("expected no tax when fees ate the gain, got %+v", result)
+	}
+}
@@ -0,0 +1,228 @@
+package login_guard
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+// Policy controls how quickly a key is slowed down and then locked
+type Policy struct {
+	// failures allowed before every new attempt has to wait
+	BackoffAfter int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// failures that lock the key, every further failure doubles the lockout
+	LockoutAfter       int
+	LockoutDuration    time.Duration
+	MaxLockoutDuration time.Duration
+	// failures older than this are forgotten
+	ResetAfter time.Duration
+}
+
+// An IP can legitimately fail for several accounts (shared networks), so it gets more room
+var (
+	IdentityPolicy = Policy{
+		BackoffAfter:       3,
+		BaseDelay:          time.Second,
+		MaxDelay:           5 * time.Minute,
+		LockoutAfter:       10,
+		LockoutDuration:    15 * time.Minute,
+		MaxLockoutDuration: 24 * time.Hour,
+		ResetAfter:         time.Hour,
+	}
+	IPPolicy = Policy{
+		BackoffAfter:       20,
+		BaseDelay:          time.Second,
+		MaxDelay:           time.Minute,
+		LockoutAfter:       50,
+		LockoutDuration:    15 * time.Minute,
+		MaxLockoutDuration: 24 * time.Hour,
+		ResetAfter:         time.Hour,
+	}
+)
+
+type Guard struct {
+	store          types.LoginAttemptStore
+	identityPolicy Policy
+	ipPolicy       Policy
+	now            func() time.Time
+}
+
+func NewGuard(store types.LoginAttemptStore) *Guard {
+	return NewGuardWithClock(store, time.Now)
+}
+
+// NewGuardWithClock lets tests move time forward instead of sleeping through backoffs
+func NewGuardWithClock(store types.LoginAttemptStore, now func() time.Time) *Guard {
+	return &Guard{
+		store:          store,
+		identityPolicy: IdentityPolicy,
+		ipPolicy:       IPPolicy,
+		now:            now,
+	}
+}
+
+type guardedKey struct {
+	key    string
+	policy Policy
+}
+
+func (g *Guard) identityKey(identity string) string {
+	return "id:" + strings.ToLower(strings.TrimSpace(identity))
+}
+
+// keys are the counters an attempt goes against. An empty identity only counts against the IP,
+// for attempts that don't name an account yet.
+func (g *Guard) keys(identity, ipAddress string) []guardedKey {
+	keys := []guardedKey{{key: "ip:" + ipAddress, policy: g.ipPolicy}}
+	if identity != "" {
+		keys = append(keys, guardedKey{key: g.identityKey(identity), policy: g.identityPolicy})
+	}
+	return keys
+}
+
+// Check returns how long the caller has to wait before the next attempt, zero if allowed, without
+// counting it. The identity doesn't have to exist, so the answer never reveals registered emails.
+func (g *Guard) Check(identity, ipAddress string) (time.Duration, error) {
+	now := g.now()
+	wait := time.Duration(0)
+
+	for _, k := range g.keys(identity, ipAddress) {
+		attempt, err := g.store.GetAttempt(k.key)
+		if err != nil {
+			return 0, err
+		}
+		if attempt == nil || k.policy.isStale(attempt, now) {
+			continue
+		}
+
+		if keyWait := k.policy.waitFor(attempt, now); keyWait > wait {
+			wait = keyWait
+		}
+	}
+
+	return wait, nil
+}
+
+// Attempt counts the attempt as a failure before the credentials are checked, and returns how
+// long the caller has to wait instead, zero if allowed. Checking first and counting after the slow
+// password comparison would let parallel requests all pass the same check.
+func (g *Guard) Attempt(identity, ipAddress string) (time.Duration, error) {
+	wait, err := g.Check(identity, ipAddress)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+
+	now := g.now()
+	for _, k := range g.keys(identity, ipAddress) {
+		previous, err := g.store.GetAttempt(k.key)
+		if err != nil {
+			return 0, err
+		}
+		if previous == nil || k.policy.isStale(previous, now) {
+			previous = &types.LoginAttempt{}
+		}
+
+		attempt, err := g.store.IncrementFailures(k.key, now, now.Add(-k.policy.ResetAfter))
+		if err != nil {
+			return 0, err
+		}
+
+		if attempt.Failures >= k.policy.LockoutAfter {
+			lockedUntil := now.Add(k.policy.lockoutDuration(attempt.Failures))
+			if err := g.store.LockUntil(k.key, lockedUntil); err != nil {
+				return 0, err
+			}
+			attempt.LockedUntil = &lockedUntil
+
+			err = g.store.RecordLockout(&types.LoginLockout{
+				Key:         k.key,
+				Failures:    attempt.Failures,
+				IPAddress:   ipAddress,
+				LockedUntil: lockedUntil,
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// other attempts were counted since the check, this one would have had to wait for them
+		raced := attempt.Failures > previous.Failures+1
+		if raced && attempt.Failures > k.policy.BackoffAfter {
+			if keyWait := k.policy.waitFor(attempt, now); keyWait > wait {
+				wait = keyWait
+			}
+		}
+	}
+
+	return wait, nil
+}
+
+// Release takes back an attempt whose credentials turned out right
+func (g *Guard) Release(identity, ipAddress string) error {
+	for _, k := range g.keys(identity, ipAddress) {
+		if err := g.store.DecrementFailures(k.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordSuccess resets the identity once the login is complete. The IP keeps its failures,
+// logging into one account doesn't excuse guessing at others from the same address.
+func (g *Guard) RecordSuccess(identity string) error {
+	return g.store.DeleteAttempts(g.identityKey(identity))
+}
+
+// WriteTooManyAttempts never says whether the email exists
+func WriteTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	utils.WriteError(w, http.StatusTooManyRequests, fmt.Errorf("too many login attempts, try again later"))
+}
+
+func (p Policy) isStale(attempt *types.LoginAttempt, now time.Time) bool {
+	locked := attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil)
+	return !locked && now.Sub(attempt.LastFailureAt) > p.ResetAfter
+}
+
+func (p Policy) waitFor(attempt *types.LoginAttempt, now time.Time) time.Duration {
+	if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+		return attempt.LockedUntil.Sub(now)
+	}
+	if attempt.Failures < p.BackoffAfter {
+		return 0
+	}
+
+	nextAllowed := attempt.LastFailureAt.Add(p.backoffDelay(attempt.Failures))
+	if now.Before(nextAllowed) {
+		return nextAllowed.Sub(now)
+	}
+	return 0
+}
+
+// backoffDelay doubles with every failure past the backoff threshold
+func (p Policy) backoffDelay(failures int) time.Duration {
+	return exponential(p.BaseDelay, failures-p.BackoffAfter, p.MaxDelay)
+}
+
+func (p Policy) lockoutDuration(failures int) time.Duration {
+	return exponential(p.LockoutDuration, failures-p.LockoutAfter, p.MaxLockoutDuration)
+}
+
+func exponential(base time.Duration, exponent int, max time.Duration) time.Duration {
+	delay := base
+	for i := 0; i < exponent; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
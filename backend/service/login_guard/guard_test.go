@@ -0,0 +1,179 @@
+package login_guard
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestGuard() (*Guard, *MemoryStore, *testClock) {
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	return NewGuardWithClock(store, clock.Now), store, clock
+}
+
+func mustCheck(t *testing.T, guard *Guard, identity, ip string) time.Duration {
+	t.Helper()
+	wait, err := guard.Check(identity, ip)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return wait
+}
+
+// fail waits out any backoff and then makes an attempt whose credentials turn out wrong
+func fail(t *testing.T, guard *Guard, clock *testClock, identity, ip string) {
+	t.Helper()
+	clock.now = clock.now.Add(mustCheck(t, guard, identity, ip))
+	wait, err := guard.Attempt(identity, ip)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wait > 0 {
+		t.Fatalf("expected the attempt to be allowed, got a wait of %v", wait)
+	}
+}
+
+func TestBackoffDoubles(t *testing.T) {
+	guard, _, clock := newTestGuard()
+
+	expected := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for i, want := range expected {
+		fail(t, guard, clock, "user@mail.pt", "10.0.0.1")
+		if wait := mustCheck(t, guard, "user@mail.pt", "10.0.0.1"); wait != want {
+			t.Errorf("after %d failures expected a wait of %v, got %v", i+1, want, wait)
+		}
+	}
+}
+
+func TestAttemptIsRefusedWhileWaiting(t *testing.T) {
+	guard, store, clock := newTestGuard()
+
+	for i := 0; i < IdentityPolicy.BackoffAfter; i++ {
+		fail(t, guard, clock, "user@mail.pt", "10.0.0.1")
+	}
+
+	wait, err := guard.Attempt("user@mail.pt", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wait != time.Second {
+		t.Errorf("expected a wait of %v, got %v", time.Second, wait)
+	}
+	// a refused attempt doesn't make the wait longer
+	attempt, _ := store.GetAttempt("id:user@mail.pt")
+	if attempt.Failures != IdentityPolicy.BackoffAfter {
+		t.Errorf("expected %d failures, got %d", IdentityPolicy.BackoffAfter, attempt.Failures)
+	}
+}
+
+func TestLockoutEscalates(t *testing.T) {
+	guard, store, clock := newTestGuard()
+
+	for i := 0; i < IdentityPolicy.LockoutAfter; i++ {
+		fail(t, guard, clock, "user@mail.pt", "10.0.0.1")
+	}
+	if wait := mustCheck(t, guard, "user@mail.pt", "10.0.0.1"); wait != IdentityPolicy.LockoutDuration {
+		t.Errorf("expected a lockout of %v, got %v", IdentityPolicy.LockoutDuration, wait)
+	}
+
+	// one more failure once the lock expires doubles it
+	fail(t, guard, clock, "user@mail.pt", "10.0.0.1")
+	if wait := mustCheck(t, guard, "user@mail.pt", "10.0.0.1"); wait != 2*IdentityPolicy.LockoutDuration {
+		t.Errorf("expected a lockout of %v, got %v", 2*IdentityPolicy.LockoutDuration, wait)
+	}
+
+	if len(store.Lockouts) != 2 {
+		t.Fatalf("expected two lockout records, got %d", len(store.Lockouts))
+	}
+	if store.Lockouts[1].Failures != IdentityPolicy.LockoutAfter+1 || store.Lockouts[1].IPAddress != "10.0.0.1" {
+		t.Errorf("unexpected lockout record %+v", store.Lockouts[1])
+	}
+}
+
+func TestPasswordSprayingLocksTheIP(t *testing.T) {
+	guard, store, clock := newTestGuard()
+
+	// a different email every time never trips the per email limit
+	for i := 0; i < IPPolicy.LockoutAfter; i++ {
+		fail(t, guard, clock, fmt.Sprintf("user%d@mail.pt", i), "10.0.0.1")
+	}
+
+	if wait := mustCheck(t, guard, "fresh@mail.pt", "10.0.0.1"); wait != IPPolicy.LockoutDuration {
+		t.Errorf("expected the IP to be locked for %v, got %v", IPPolicy.LockoutDuration, wait)
+	}
+	if wait := mustCheck(t, guard, "fresh@mail.pt", "10.0.0.2"); wait != 0 {
+		t.Errorf("expected other IPs to be unaffected, got %v", wait)
+	}
+	if len(store.Lockouts) != 1 || store.Lockouts[0].Key != "ip:10.0.0.1" {
+		t.Errorf("expected a single IP lockout, got %v", store.Lockouts)
+	}
+}
+
+func TestOldFailuresAreForgotten(t *testing.T) {
+	guard, _, clock := newTestGuard()
+
+	for i := 0; i < IdentityPolicy.LockoutAfter-1; i++ {
+		fail(t, guard, clock, "user@mail.pt", "10.0.0.1")
+	}
+
+	clock.now = clock.now.Add(IdentityPolicy.ResetAfter + time.Minute)
+	fail(t, guard, clock, "user@mail.pt", "10.0.0.1")
+
+	if wait := mustCheck(t, guard, "user@mail.pt", "10.0.0.1"); wait != 0 {
+		t.Errorf("expected the counter to restart, got a wait of %v", wait)
+	}
+}
+
+func TestRecordSuccessOnlyResetsTheIdentity(t *testing.T) {
+	guard, store, clock := newTestGuard()
+
+	for i := 0; i < 5; i++ {
+		fail(t, guard, clock, "User@Mail.pt", "10.0.0.1")
+	}
+	fail(t, guard, clock, "user@mail.pt", "10.0.0.1")
+	guard.Release("user@mail.pt", "10.0.0.1")
+	guard.RecordSuccess("user@mail.pt")
+
+	if attempt, _ := store.GetAttempt("id:user@mail.pt"); attempt != nil {
+		t.Errorf("expected the identity to be reset, got %+v", attempt)
+	}
+	// the successful attempt is taken back, the failures before it stay
+	attempt, _ := store.GetAttempt("ip:10.0.0.1")
+	if attempt == nil || attempt.Failures != 5 {
+		t.Errorf("expected the IP to keep 5 failures, got %+v", attempt)
+	}
+}
+
+func TestParallelAttemptsAreLimited(t *testing.T) {
+	guard, _, _ := newTestGuard()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < IdentityPolicy.LockoutAfter; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := guard.Attempt("user@mail.pt", "10.0.0.1")
+			if err == nil && wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the clock doesn't move, so only the attempts before the backoff may get through
+	if allowed > IdentityPolicy.BackoffAfter {
+		t.Errorf("expected at most %d attempts to be allowed, got %d", IdentityPolicy.BackoffAfter, allowed)
+	}
+}
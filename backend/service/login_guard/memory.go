@@ -0,0 +1,88 @@
+package login_guard
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+// MemoryStore keeps attempts in memory, it is used in tests
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]types.LoginAttempt
+	Lockouts []types.LoginLockout
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]types.LoginAttempt)}
+}
+
+func (m *MemoryStore) GetAttempt(key string) (*types.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, exists := m.attempts[key]
+	if !exists {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+func (m *MemoryStore) IncrementFailures(key string, now, staleBefore time.Time) (*types.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, exists := m.attempts[key]
+	locked := attempt.LockedUntil != nil && attempt.LockedUntil.After(now)
+	if !exists || (!locked && attempt.LastFailureAt.Before(staleBefore)) {
+		attempt = types.LoginAttempt{Key: key}
+	}
+
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	m.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (m *MemoryStore) LockUntil(key string, lockedUntil time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, exists := m.attempts[key]
+	if exists && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(lockedUntil)) {
+		attempt.LockedUntil = &lockedUntil
+		m.attempts[key] = attempt
+	}
+	return nil
+}
+
+func (m *MemoryStore) DecrementFailures(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, exists := m.attempts[key]
+	if exists && attempt.Failures > 0 {
+		attempt.Failures--
+		m.attempts[key] = attempt
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteAttempts(keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.attempts, key)
+	}
+	return nil
+}
+
+func (m *MemoryStore) RecordLockout(lockout *types.LoginLockout) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Lockouts = append(m.Lockouts, *lockout)
+	return nil
+}
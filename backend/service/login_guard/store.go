@@ -0,0 +1,111 @@
+package login_guard
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) GetAttempt(key string) (*types.LoginAttempt, error) {
+	attempt, err := db.QuerySingle(s.db,
+		"SELECT key, failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1",
+		scanRowIntoAttempt, key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return attempt, nil
+}
+
+func (s *Store) IncrementFailures(key string, now, staleBefore time.Time) (*types.LoginAttempt, error) {
+	attempt := new(types.LoginAttempt)
+	err := s.db.QueryRow(
+		`INSERT INTO login_attempts (key, failures, last_failure_at)
+		 VALUES ($1, 1, $2)
+		 ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN (login_attempts.locked_until IS NULL OR login_attempts.locked_until <= $2)
+					AND login_attempts.last_failure_at < $3 THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			locked_until = CASE
+				WHEN (login_attempts.locked_until IS NULL OR login_attempts.locked_until <= $2)
+					AND login_attempts.last_failure_at < $3 THEN NULL
+				ELSE login_attempts.locked_until
+			END,
+			last_failure_at = $2
+		 RETURNING key, failures, last_failure_at, locked_until`,
+		key, now, staleBefore,
+	).Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &attempt.LockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return attempt, nil
+}
+
+func (s *Store) LockUntil(key string, lockedUntil time.Time) error {
+	_, err := db.ExecWithValidation(s.db,
+		"UPDATE login_attempts SET locked_until = $2 WHERE key = $1 AND (locked_until IS NULL OR locked_until < $2)",
+		key, lockedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to lock login attempts: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) DecrementFailures(key string) error {
+	_, err := db.ExecWithValidation(s.db,
+		"UPDATE login_attempts SET failures = failures - 1 WHERE key = $1 AND failures > 0",
+		key)
+	if err != nil {
+		return fmt.Errorf("failed to take back login attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) DeleteAttempts(keys ...string) error {
+	_, err := db.ExecWithValidation(s.db,
+		"DELETE FROM login_attempts WHERE key = ANY($1)",
+		pq.Array(keys))
+	return err
+}
+
+func (s *Store) RecordLockout(lockout *types.LoginLockout) error {
+	_, err := db.ExecWithValidation(s.db,
+		"INSERT INTO login_lockouts (key, failures, ip_address, locked_until) VALUES ($1, $2, $3, $4)",
+		lockout.Key, lockout.Failures, lockout.IPAddress, lockout.LockedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to record lockout: %w", err)
+	}
+
+	return nil
+}
+
+func scanRowIntoAttempt(row *sql.Row) (*types.LoginAttempt, error) {
+	attempt := new(types.LoginAttempt)
+	err := row.Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &attempt.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
@@ -0,0 +1,19 @@
+package mailer
+
+import (
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const (
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+)
+
+// NewFromConfig returns the mailer selected by MAIL_DRIVER, defaulting to the file mailer
+func NewFromConfig() types.Mailer {
+	if config.Envs.MailDriver == DriverSMTP {
+		return NewSMTPMailer(config.Envs.SMTPHost, config.Envs.SMTPPort, config.Envs.SMTPUsername, config.Envs.SMTPPassword, config.Envs.MailFrom)
+	}
+	return NewFileMailer(config.Envs.MailDir, config.Envs.MailFrom)
+}
@@ -0,0 +1,140 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+// smtpSink is a minimal local SMTP server that records the messages it receives
+type smtpSink struct {
+	listener net.Listener
+	messages chan sinkMessage
+}
+
+type sinkMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start smtp sink: %v", err)
+	}
+	sink := &smtpSink{listener: listener, messages: make(chan sinkMessage, 1)}
+	t.Cleanup(func() { listener.Close() })
+
+	go sink.serve()
+	return sink
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 sink ready")
+
+	var message sinkMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			text.PrintfLine("250 sink")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.to = append(message.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			text.PrintfLine("250 OK")
+		case command == "DATA":
+			text.PrintfLine("354 send data")
+			data, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			message.data = strings.Join(data, "\n")
+			s.messages <- message
+			text.PrintfLine("250 OK")
+		case command == "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	sink := newSMTPSink(t)
+	host, port, _ := net.SplitHostPort(sink.listener.Addr().String())
+
+	mailer := NewSMTPMailer(host, port, "", "", "no-reply@example.com")
+	err := mailer.Send(&types.MailMessage{
+		To:      "user@example.com",
+		Subject: "Reset your password\r\nBcc: attacker@example.com",
+		Body:    "Hi,\nopen this link",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	message := <-sink.messages
+	if message.from != "no-reply@example.com" {
+		t.Errorf("expected sender no-reply@example.com, got %s", message.from)
+	}
+	if len(message.to) != 1 || message.to[0] != "user@example.com" {
+		t.Errorf("expected a single recipient user@example.com, got %v", message.to)
+	}
+	if !strings.Contains(message.data, "Subject: Reset your passwordBcc: attacker@example.com") {
+		t.Errorf("expected the subject to be sanitised, got:\n%s", message.data)
+	}
+	if !strings.Contains(message.data, "open this link") {
+		t.Errorf("expected the body to be sent, got:\n%s", message.data)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewFileMailer(dir, "no-reply@example.com")
+
+	if err := mailer.Send(&types.MailMessage{To: "user@example.com", Subject: "Hello", Body: "body"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one email file, got %d", len(files))
+	}
+
+	content, _ := os.ReadFile(files[0])
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(string(content))))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("invalid email file: %v", err)
+	}
+	if header.Get("To") != "user@example.com" || header.Get("Subject") != "Hello" {
+		t.Errorf("unexpected headers %v", header)
+	}
+}
@@ -0,0 +1,368 @@
+package membership
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+type Handler struct {
+	store     types.MembershipStore
+	userStore types.UserStore
+	mailer    types.Mailer
+}
+
+func NewHandler(store types.MembershipStore, userStore types.UserStore, mailer types.Mailer) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+		mailer:    mailer,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/accounts/{token}/members", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.GetMembers,
+		}),
+	))
+	router.HandleFunc("/accounts/{token}/members/{userId}", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPatch:  h.UpdateMemberRole,
+			http.MethodDelete: h.RemoveMember,
+		}),
+	))
+	router.HandleFunc("/accounts/{token}/invitations", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet:  h.GetAccountInvitations,
+			http.MethodPost: h.InviteMember,
+		}),
+	))
+	router.HandleFunc("/accounts/{token}/invitations/{id}", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodDelete: h.RevokeInvitation,
+		}),
+	))
+	router.HandleFunc("/invitations", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.GetMyInvitations,
+		}),
+	))
+	router.HandleFunc("/invitations/{id}/accept", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.AcceptInvitation,
+		}),
+	))
+	router.HandleFunc("/invitations/{id}/decline", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.DeclineInvitation,
+		}),
+	))
+}
+
+func (h *Handler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract account token from URL path (/accounts/{token}/members)
+	accountToken, ok := middleware.ExtractPathParamAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	members, err := h.store.GetMembers(userId, accountToken)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, map[string]interface{}{
+		"members": members,
+	})
+}
+
+func (h *Handler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// extract account token and member id from URL path (/accounts/{token}/members/{userId})
+	accountToken, ok := middleware.ExtractPathParamAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+	memberId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 3)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.UpdateMemberRolePayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	if err := h.store.UpdateMemberRole(userId, accountToken, memberId, payload.Role); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// RemoveMember lets owners remove anyone and every member leave on their own
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// extract account token and member id from URL path (/accounts/{token}/members/{userId})
+	accountToken, ok := middleware.ExtractPathParamAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+	memberId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 3)
+	if !ok {
+		return
+	}
+
+	if err := h.store.RemoveMember(userId, accountToken, memberId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) GetAccountInvitations(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract account token from URL path (/accounts/{token}/invitations)
+	accountToken, ok := middleware.ExtractPathParamAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	invitations, err := h.store.GetInvitationsByAccount(userId, accountToken)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, map[string]interface{}{
+		"invitations": invitations,
+	})
+}
+
+func (h *Handler) InviteMember(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// extract account token from URL path (/accounts/{token}/invitations)
+	accountToken, ok := middleware.ExtractPathParamAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.InviteMemberPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	invitation := &types.AccountInvitation{
+		AccountToken: accountToken,
+		Email:        payload.Email,
+		Role:         payload.Role,
+	}
+	if err := h.store.CreateInvitation(userId, invitation); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	// the invitation is answered from the app, so a failed email can be resent by inviting again
+	if err := h.mailer.Send(invitationEmail(invitation)); err != nil {
+		log.Printf("failed to send invitation %d: %v", invitation.ID, err)
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"invitation": invitation,
+	})
+}
+
+func (h *Handler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// extract account token and invitation id from URL path (/accounts/{token}/invitations/{id})
+	accountToken, ok := middleware.ExtractPathParamAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+	invitationId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 3)
+	if !ok {
+		return
+	}
+
+	if err := h.store.RevokeInvitation(userId, accountToken, invitationId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// GetMyInvitations lists the pending invitations sent to the user's verified email
+func (h *Handler) GetMyInvitations(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.userStore.GetUserById(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	invitations := []*types.AccountInvitation{}
+	if user.EmailVerified {
+		invitations, err = h.store.GetPendingInvitationsByEmail(user.Email)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	middleware.WriteDataResponse(w, map[string]interface{}{
+		"invitations": invitations,
+	})
+}
+
+func (h *Handler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// extract invitation id from URL path (/invitations/{id}/accept)
+	invitationId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	if _, ok := h.requireInvitee(w, invitationId, userId); !ok {
+		return
+	}
+
+	if err := h.store.AcceptInvitation(invitationId, userId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// extract invitation id from URL path (/invitations/{id}/decline)
+	invitationId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 1)
+	if !ok {
+		return
+	}
+
+	if _, ok := h.requireInvitee(w, invitationId, userId); !ok {
+		return
+	}
+
+	if err := h.store.DeclineInvitation(invitationId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// requireInvitee only lets the owner of the invited address answer an invitation, which
+// is only proven once the address is verified
+func (h *Handler) requireInvitee(w http.ResponseWriter, invitationId int, userId int) (*types.AccountInvitation, bool) {
+	invitation, err := h.store.GetPendingInvitationById(invitationId)
+	if err != nil {
+		writeStoreError(w, err)
+		return nil, false
+	}
+
+	user, err := h.userStore.GetUserById(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		writeStoreError(w, ErrInvitationNotFound)
+		return nil, false
+	}
+	if !user.EmailVerified {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("verify your email before answering invitations"))
+		return nil, false
+	}
+
+	return invitation, true
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvitationNotFound), errors.Is(err, ErrMemberNotFound):
+		utils.WriteError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrLastOwner):
+		utils.WriteError(w, http.StatusConflict, err)
+	case errors.Is(err, ErrAlreadyMember):
+		utils.WriteError(w, http.StatusBadRequest, err)
+	default:
+		utils.WriteError(w, authz.StatusCode(err), err)
+	}
+}
+
+func invitationEmail(invitation *types.AccountInvitation) *types.MailMessage {
+	return &types.MailMessage{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("%s shared an account with you", invitation.InviterName),
+		Body: fmt.Sprintf("Hi,\n\n%s invited you to the account \"%s\" as %s.\n\n"+
+			"Sign in with this email address to accept or decline the invitation:\n\n%s\n\n"+
+			"The invitation expires in %d days. If you don't know the sender you can ignore this email.\n",
+			invitation.InviterName, invitation.AccountName, invitation.Role,
+			config.Envs.FrontendUrl+"/invitations", int(invitationTTL.Hours()/24)),
+	}
+}
@@ -0,0 +1,416 @@
+package membership
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const testAccountToken = "shared"
+
+// mockMembershipStore keeps members and invitations in memory, members[userId] = role. It is
+// also the role source of the real policy, so the permission checks are the ones in production.
+type mockMembershipStore struct {
+	members     map[int]string
+	users       *mockUserStore
+	invitations map[int]*types.AccountInvitation
+	nextId      int
+	policy      *authz.Policy
+}
+
+func (m *mockMembershipStore) AccountRole(userId int, accountToken string) (string, error) {
+	if accountToken != testAccountToken {
+		return "", nil
+	}
+	return m.members[userId], nil
+}
+
+func (m *mockMembershipStore) AccountToken(accountId int) (string, error)           { return "", nil }
+func (m *mockMembershipStore) TransactionAccount(transactionId int) (string, error) { return "", nil }
+func (m *mockMembershipStore) TrashedAccountRole(userId int, accountToken string) (string, error) {
+	return "", nil
+}
+func (m *mockMembershipStore) TrashedTransactionAccount(transactionId int) (string, error) {
+	return "", nil
+}
+
+func (m *mockMembershipStore) GetMembers(userId int, accountToken string) ([]*types.AccountMember, error) {
+	if err := m.policy.CanReadAccount(userId, accountToken); err != nil {
+		return nil, err
+	}
+	members := []*types.AccountMember{}
+	for userId, role := range m.members {
+		user := m.users.users[userId]
+		members = append(members, &types.AccountMember{UserID: userId, Email: user.Email, Role: role})
+	}
+	return members, nil
+}
+
+func (m *mockMembershipStore) UpdateMemberRole(userId int, accountToken string, memberId int, role string) error {
+	if err := m.policy.CanManageAccount(userId, accountToken); err != nil {
+		return err
+	}
+	if _, ok := m.members[memberId]; !ok {
+		return ErrMemberNotFound
+	}
+	if role != types.AccountRoleOwner && m.lastOwner(memberId) {
+		return ErrLastOwner
+	}
+	m.members[memberId] = role
+	return nil
+}
+
+func (m *mockMembershipStore) RemoveMember(userId int, accountToken string, memberId int) error {
+	check := m.policy.CanManageAccount
+	if memberId == userId {
+		check = m.policy.CanReadAccount
+	}
+	if err := check(userId, accountToken); err != nil {
+		return err
+	}
+	if _, ok := m.members[memberId]; !ok {
+		return ErrMemberNotFound
+	}
+	if m.lastOwner(memberId) {
+		return ErrLastOwner
+	}
+	delete(m.members, memberId)
+	return nil
+}
+
+func (m *mockMembershipStore) lastOwner(userId int) bool {
+	if m.members[userId] != types.AccountRoleOwner {
+		return false
+	}
+	for memberId, role := range m.members {
+		if memberId != userId && role == types.AccountRoleOwner {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *mockMembershipStore) CreateInvitation(userId int, invitation *types.AccountInvitation) error {
+	if err := m.policy.CanManageAccount(userId, invitation.AccountToken); err != nil {
+		return err
+	}
+	for memberId := range m.members {
+		if strings.EqualFold(m.users.users[memberId].Email, invitation.Email) {
+			return ErrAlreadyMember
+		}
+	}
+	inviter := m.users.users[userId]
+	invitation.InvitedBy = userId
+	invitation.InviterName = inviter.FirstName + " " + inviter.LastName
+	invitation.AccountName = "Household"
+	m.nextId++
+	invitation.ID = m.nextId
+	invitation.Status = types.InvitationStatusPending
+	invitation.ExpiresAt = time.Now().Add(invitationTTL)
+	m.invitations[invitation.ID] = invitation
+	return nil
+}
+
+func (m *mockMembershipStore) GetInvitationsByAccount(userId int, accountToken string) ([]*types.AccountInvitation, error) {
+	if err := m.policy.CanManageAccount(userId, accountToken); err != nil {
+		return nil, err
+	}
+	return m.pending(func(i *types.AccountInvitation) bool { return i.AccountToken == accountToken }), nil
+}
+
+func (m *mockMembershipStore) GetPendingInvitationsByEmail(email string) ([]*types.AccountInvitation, error) {
+	return m.pending(func(i *types.AccountInvitation) bool { return strings.EqualFold(i.Email, email) }), nil
+}
+
+func (m *mockMembershipStore) pending(match func(*types.AccountInvitation) bool) []*types.AccountInvitation {
+	invitations := []*types.AccountInvitation{}
+	for _, invitation := range m.invitations {
+		if invitation.Status == types.InvitationStatusPending && match(invitation) {
+			invitations = append(invitations, invitation)
+		}
+	}
+	return invitations
+}
+
+func (m *mockMembershipStore) GetPendingInvitationById(invitationId int) (*types.AccountInvitation, error) {
+	invitation, ok := m.invitations[invitationId]
+	if !ok || invitation.Status != types.InvitationStatusPending {
+		return nil, ErrInvitationNotFound
+	}
+	return invitation, nil
+}
+
+func (m *mockMembershipStore) AcceptInvitation(invitationId int, userId int) error {
+	invitation, err := m.GetPendingInvitationById(invitationId)
+	if err != nil {
+		return err
+	}
+	invitation.Status = types.InvitationStatusAccepted
+	m.members[userId] = invitation.Role
+	return nil
+}
+
+func (m *mockMembershipStore) DeclineInvitation(invitationId int) error {
+	invitation, err := m.GetPendingInvitationById(invitationId)
+	if err != nil {
+		return err
+	}
+	invitation.Status = types.InvitationStatusDeclined
+	return nil
+}
+
+func (m *mockMembershipStore) RevokeInvitation(userId int, accountToken string, invitationId int) error {
+	if err := m.policy.CanManageAccount(userId, accountToken); err != nil {
+		return err
+	}
+	invitation, err := m.GetPendingInvitationById(invitationId)
+	if err != nil || invitation.AccountToken != accountToken {
+		return ErrInvitationNotFound
+	}
+	invitation.Status = types.InvitationStatusRevoked
+	return nil
+}
+
+type mockUserStore struct {
+	users map[int]*types.User
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserById(id int) (*types.User, error) {
+	user, ok := m.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+	return user, nil
+}
+
+func (m *mockUserStore) CreateUser(user *types.User, templateLanguage string) error { return nil }
+func (m *mockUserStore) ValidatePassword(password string) error                     { return nil }
+func (m *mockUserStore) DeleteUser(userId int) error                                { return nil }
+func (m *mockUserStore) MarkEmailVerified(userId int) error                         { return nil }
+func (m *mockUserStore) UpdatePassword(userId int, hashedPassword string) error     { return nil }
+func (m *mockUserStore) UpdateProfile(userId int, firstName, lastName string) error { return nil }
+func (m *mockUserStore) SetPendingEmail(userId int, email string) error             { return nil }
+func (m *mockUserStore) ConfirmPendingEmail(userId int) (string, error)             { return "", nil }
+
+type mockMailer struct {
+	sent []*types.MailMessage
+}
+
+func (m *mockMailer) Send(message *types.MailMessage) error {
+	m.sent = append(m.sent, message)
+	return nil
+}
+
+const (
+	ownerId    = 1
+	editorId   = 2
+	viewerId   = 3
+	inviteeId  = 4
+	strangerId = 5
+)
+
+func newTestHandler() (*Handler, *mockMembershipStore, *mockUserStore, *mockMailer) {
+	users := &mockUserStore{users: map[int]*types.User{
+		ownerId:    {ID: ownerId, FirstName: "Ana", LastName: "Silva", Email: "ana@example.com", EmailVerified: true},
+		editorId:   {ID: editorId, Email: "edu@example.com", EmailVerified: true},
+		viewerId:   {ID: viewerId, Email: "vera@example.com", EmailVerified: true},
+		inviteeId:  {ID: inviteeId, Email: "ines@example.com", EmailVerified: true},
+		strangerId: {ID: strangerId, Email: "sam@example.com", EmailVerified: true},
+	}}
+	memberships := &mockMembershipStore{
+		members: map[int]string{
+			ownerId:  types.AccountRoleOwner,
+			editorId: types.AccountRoleEditor,
+			viewerId: types.AccountRoleViewer,
+		},
+		users:       users,
+		invitations: map[int]*types.AccountInvitation{},
+	}
+	memberships.policy = authz.NewPolicy(memberships)
+	mailer := &mockMailer{}
+	handler := NewHandler(memberships, users, mailer)
+	return handler, memberships, users, mailer
+}
+
+func performAuthenticatedRequest(handler http.HandlerFunc, userId int, method, path string, body interface{}) *httptest.ResponseRecorder {
+	marshalled, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(marshalled))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userId))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func invite(t *testing.T, handler *Handler, email, role string) *types.AccountInvitation {
+	t.Helper()
+
+	rr := performAuthenticatedRequest(handler.InviteMember, ownerId, http.MethodPost, "/accounts/shared/invitations",
+		types.InviteMemberPayload{Email: email, Role: role})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Invitation types.AccountInvitation `json:"invitation"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return &response.Invitation
+}
+
+func TestInviteAndAcceptInvitation(t *testing.T) {
+	handler, memberships, _, mailer := newTestHandler()
+
+	invitation := invite(t, handler, "Ines@Example.com", types.AccountRoleEditor)
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "Ines@Example.com" {
+		t.Fatalf("expected the invitee to be emailed, got %v", mailer.sent)
+	}
+	if !strings.Contains(mailer.sent[0].Body, "Household") || !strings.Contains(mailer.sent[0].Body, "Ana Silva") {
+		t.Errorf("expected the email to name the account and the inviter, got %q", mailer.sent[0].Body)
+	}
+
+	// the invitee finds it regardless of the email's case
+	rr := performAuthenticatedRequest(handler.GetMyInvitations, inviteeId, http.MethodGet, "/invitations", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"account_name":"Household"`) {
+		t.Fatalf("expected the pending invitation to be listed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	path := fmt.Sprintf("/invitations/%d/accept", invitation.ID)
+	rr = performAuthenticatedRequest(handler.AcceptInvitation, inviteeId, http.MethodPost, path, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if memberships.members[inviteeId] != types.AccountRoleEditor {
+		t.Errorf("expected the invitee to join as editor, got %q", memberships.members[inviteeId])
+	}
+
+	// an invitation can only be answered once
+	rr = performAuthenticatedRequest(handler.AcceptInvitation, inviteeId, http.MethodPost, path, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestAnswerInvitationRequiresTheInvitedEmail(t *testing.T) {
+	handler, memberships, users, _ := newTestHandler()
+	invitation := invite(t, handler, "ines@example.com", types.AccountRoleViewer)
+	path := fmt.Sprintf("/invitations/%d/accept", invitation.ID)
+
+	rr := performAuthenticatedRequest(handler.AcceptInvitation, strangerId, http.MethodPost, path, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected someone else to get status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	users.users[inviteeId].EmailVerified = false
+	rr = performAuthenticatedRequest(handler.AcceptInvitation, inviteeId, http.MethodPost, path, nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected an unverified email to get status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+	if _, ok := memberships.members[inviteeId]; ok {
+		t.Fatal("expected the invitee not to join")
+	}
+
+	users.users[inviteeId].EmailVerified = true
+	rr = performAuthenticatedRequest(handler.DeclineInvitation, inviteeId, http.MethodPost,
+		fmt.Sprintf("/invitations/%d/decline", invitation.ID), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if invitation := memberships.invitations[invitation.ID]; invitation.Status != types.InvitationStatusDeclined {
+		t.Errorf("expected the invitation to be declined, got %q", invitation.Status)
+	}
+}
+
+func TestOnlyOwnersManageMembers(t *testing.T) {
+	handler, memberships, _, _ := newTestHandler()
+	payload := types.InviteMemberPayload{Email: "ines@example.com", Role: types.AccountRoleViewer}
+
+	for _, userId := range []int{editorId, viewerId} {
+		rr := performAuthenticatedRequest(handler.InviteMember, userId, http.MethodPost, "/accounts/shared/invitations", payload)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected user %d to get status %d, got %d", userId, http.StatusForbidden, rr.Code)
+		}
+	}
+
+	rr := performAuthenticatedRequest(handler.UpdateMemberRole, editorId, http.MethodPatch,
+		fmt.Sprintf("/accounts/shared/members/%d", viewerId), types.UpdateMemberRolePayload{Role: types.AccountRoleEditor})
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	// other users can't tell the account exists
+	rr = performAuthenticatedRequest(handler.GetMembers, strangerId, http.MethodGet, "/accounts/shared/members", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// every member can see the others
+	rr = performAuthenticatedRequest(handler.GetMembers, viewerId, http.MethodGet, "/accounts/shared/members", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "ana@example.com") {
+		t.Errorf("expected the members to be listed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = performAuthenticatedRequest(handler.UpdateMemberRole, ownerId, http.MethodPatch,
+		fmt.Sprintf("/accounts/shared/members/%d", viewerId), types.UpdateMemberRolePayload{Role: types.AccountRoleEditor})
+	if rr.Code != http.StatusOK || memberships.members[viewerId] != types.AccountRoleEditor {
+		t.Errorf("expected the owner to promote the viewer, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestInviteExistingMember(t *testing.T) {
+	handler, _, _, mailer := newTestHandler()
+
+	rr := performAuthenticatedRequest(handler.InviteMember, ownerId, http.MethodPost, "/accounts/shared/invitations",
+		types.InviteMemberPayload{Email: "EDU@example.com", Role: types.AccountRoleViewer})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("expected no email, got %d", len(mailer.sent))
+	}
+}
+
+func TestLeaveAccount(t *testing.T) {
+	handler, memberships, _, _ := newTestHandler()
+
+	// members can leave without being owners
+	rr := performAuthenticatedRequest(handler.RemoveMember, viewerId, http.MethodDelete,
+		fmt.Sprintf("/accounts/shared/members/%d", viewerId), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if _, ok := memberships.members[viewerId]; ok {
+		t.Error("expected the viewer to leave")
+	}
+
+	// but can't remove anyone else
+	rr = performAuthenticatedRequest(handler.RemoveMember, editorId, http.MethodDelete,
+		fmt.Sprintf("/accounts/shared/members/%d", ownerId), nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	// the last owner has to hand the account over first
+	rr = performAuthenticatedRequest(handler.RemoveMember, ownerId, http.MethodDelete,
+		fmt.Sprintf("/accounts/shared/members/%d", ownerId), nil)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, rr.Code)
+	}
+}
@@ -0,0 +1,353 @@
+package membership
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrMemberNotFound     = fmt.Errorf("member not found")
+	ErrInvitationNotFound = fmt.Errorf("invitation not found or no longer pending")
+	ErrLastOwner          = fmt.Errorf("an account needs at least one owner")
+	ErrAlreadyMember      = fmt.Errorf("user is already a member of this account")
+)
+
+type Store struct {
+	db     *sql.DB
+	policy *authz.Policy
+}
+
+func NewStore(db *sql.DB, policy *authz.Policy) *Store {
+	return &Store{
+		db:     db,
+		policy: policy,
+	}
+}
+
+const invitationColumns = `
+    i.id, i.account_token, a.account_name, i.email, i.role, i.invited_by,
+    u.first_name || ' ' || u.last_name, i.status, i.expires_at, i.created_at
+`
+
+// invitations to an account in the trash can't be seen or answered until it is restored
+const invitationFrom = `
+    account_invitations i
+    JOIN accounts a ON a.token = i.account_token AND a.deleted_at IS NULL
+    JOIN users u ON u.id = i.invited_by
+`
+
+const pendingInvitation = `i.status = 'pending' AND i.expires_at > CURRENT_TIMESTAMP`
+
+// GetMembers lists who shares the account, any member can see the others
+func (s *Store) GetMembers(userId int, accountToken string) ([]*types.AccountMember, error) {
+	if err := s.policy.CanReadAccount(userId, accountToken); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT u.id, u.first_name, u.last_name, u.email, m.role, m.created_at
+		FROM account_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.account_token = $1
+		ORDER BY m.created_at`
+	return db.QueryList(s.db, query, scanRowsIntoMember, accountToken)
+}
+
+// UpdateMemberRole changes the role of a member, the last owner can't be demoted
+func (s *Store) UpdateMemberRole(userId int, accountToken string, memberId int, role string) error {
+	if err := s.policy.CanManageAccount(userId, accountToken); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role != types.AccountRoleOwner {
+		if err := checkOtherOwner(tx, accountToken, memberId); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec(
+		"UPDATE account_members SET role = $1 WHERE account_token = $2 AND user_id = $3",
+		role, accountToken, memberId)
+	if err != nil {
+		return fmt.Errorf("failed to update member: %w", err)
+	}
+	if err := requireAffected(result, ErrMemberNotFound); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMember takes a member out of the account. Owners remove anyone and every member can
+// leave on their own, but the last owner can't.
+func (s *Store) RemoveMember(userId int, accountToken string, memberId int) error {
+	check := s.policy.CanManageAccount
+	if memberId == userId {
+		check = s.policy.CanReadAccount
+	}
+	if err := check(userId, accountToken); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkOtherOwner(tx, accountToken, memberId); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		"DELETE FROM account_members WHERE account_token = $1 AND user_id = $2",
+		accountToken, memberId)
+	if err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+	if err := requireAffected(result, ErrMemberNotFound); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkOtherOwner fails when userId is an owner and nobody else is. The member rows are
+// locked so two owners can't demote each other at the same time.
+func checkOtherOwner(tx *sql.Tx, accountToken string, userId int) error {
+	rows, err := tx.Query(
+		"SELECT user_id, role FROM account_members WHERE account_token = $1 FOR UPDATE",
+		accountToken)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	isOwner, otherOwners := false, 0
+	for rows.Next() {
+		var memberId int
+		var role string
+		if err := rows.Scan(&memberId, &role); err != nil {
+			return err
+		}
+		if role != types.AccountRoleOwner {
+			continue
+		}
+		if memberId == userId {
+			isOwner = true
+		} else {
+			otherOwners++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if isOwner && otherOwners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// CreateInvitation replaces any pending invitation to the same email for the account and
+// fills in the names of the account and of the inviter
+func (s *Store) CreateInvitation(userId int, invitation *types.AccountInvitation) error {
+	if err := s.policy.CanManageAccount(userId, invitation.AccountToken); err != nil {
+		return err
+	}
+	invitation.InvitedBy = userId
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// inviting someone who is already in the account would do nothing once accepted
+	var isMember bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (
+			SELECT 1 FROM account_members m JOIN users u ON u.id = m.user_id
+			WHERE m.account_token = $1 AND LOWER(u.email) = LOWER($2)
+		 )`,
+		invitation.AccountToken, invitation.Email).Scan(&isMember)
+	if err != nil {
+		return err
+	}
+	if isMember {
+		return ErrAlreadyMember
+	}
+
+	_, err = tx.Exec(
+		`UPDATE account_invitations SET status = 'revoked', responded_at = CURRENT_TIMESTAMP
+		 WHERE account_token = $1 AND LOWER(email) = LOWER($2) AND status = 'pending'`,
+		invitation.AccountToken, invitation.Email)
+	if err != nil {
+		return fmt.Errorf("failed to replace previous invitation: %w", err)
+	}
+
+	var invitationId int
+	err = tx.QueryRow(
+		`INSERT INTO account_invitations (account_token, email, role, invited_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id`,
+		invitation.AccountToken, invitation.Email, invitation.Role, invitation.InvitedBy, time.Now().Add(invitationTTL),
+	).Scan(&invitationId)
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	created, err := scanRowIntoInvitation(tx.QueryRow(
+		fmt.Sprintf("SELECT %s FROM %s WHERE i.id = $1", invitationColumns, invitationFrom), invitationId))
+	if err != nil {
+		return fmt.Errorf("failed to read invitation: %w", err)
+	}
+	*invitation = *created
+
+	return tx.Commit()
+}
+
+func (s *Store) GetInvitationsByAccount(userId int, accountToken string) ([]*types.AccountInvitation, error) {
+	if err := s.policy.CanManageAccount(userId, accountToken); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE i.account_token = $1 AND %s ORDER BY i.created_at DESC",
+		invitationColumns, invitationFrom, pendingInvitation)
+	return db.QueryList(s.db, query, scanRowsIntoInvitation, accountToken)
+}
+
+func (s *Store) GetPendingInvitationsByEmail(email string) ([]*types.AccountInvitation, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE LOWER(i.email) = LOWER($1) AND %s ORDER BY i.created_at DESC",
+		invitationColumns, invitationFrom, pendingInvitation)
+	return db.QueryList(s.db, query, scanRowsIntoInvitation, email)
+}
+
+func (s *Store) GetPendingInvitationById(invitationId int) (*types.AccountInvitation, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE i.id = $1 AND %s", invitationColumns, invitationFrom, pendingInvitation)
+	invitation, err := db.QuerySingle(s.db, query, scanRowIntoInvitation, invitationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// AcceptInvitation adds the user to the account with the invited role. Someone who is
+// already a member keeps their current role.
+func (s *Store) AcceptInvitation(invitationId int, userId int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var accountToken, role string
+	err = tx.QueryRow(
+		`UPDATE account_invitations i SET status = 'accepted', responded_at = CURRENT_TIMESTAMP
+		 WHERE i.id = $1 AND `+pendingInvitation+`
+		 RETURNING i.account_token, i.role`,
+		invitationId,
+	).Scan(&accountToken, &role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvitationNotFound
+		}
+		return err
+	}
+
+	// the shared account goes to the end of the member's list
+	_, err = tx.Exec(
+		`INSERT INTO account_members (account_token, user_id, role, order_index)
+		 SELECT $1, $2, $3, COALESCE(MAX(order_index), 0) + 1 FROM account_members WHERE user_id = $2
+		 ON CONFLICT (account_token, user_id) DO NOTHING`,
+		accountToken, userId, role)
+	if err != nil {
+		return fmt.Errorf("failed to add member: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) DeclineInvitation(invitationId int) error {
+	result, err := db.ExecWithValidation(s.db,
+		`UPDATE account_invitations i SET status = 'declined', responded_at = CURRENT_TIMESTAMP
+		 WHERE i.id = $1 AND `+pendingInvitation,
+		invitationId)
+	if err != nil {
+		return fmt.Errorf("failed to decline invitation: %w", err)
+	}
+
+	return requireAffected(result, ErrInvitationNotFound)
+}
+
+func (s *Store) RevokeInvitation(userId int, accountToken string, invitationId int) error {
+	if err := s.policy.CanManageAccount(userId, accountToken); err != nil {
+		return err
+	}
+
+	result, err := db.ExecWithValidation(s.db,
+		`UPDATE account_invitations i SET status = 'revoked', responded_at = CURRENT_TIMESTAMP
+		 WHERE i.id = $1 AND i.account_token = $2 AND i.status = 'pending'`,
+		invitationId, accountToken)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	return requireAffected(result, ErrInvitationNotFound)
+}
+
+func requireAffected(result sql.Result, notFound error) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func scanRowsIntoMember(rows *sql.Rows) (*types.AccountMember, error) {
+	m := new(types.AccountMember)
+	err := rows.Scan(&m.UserID, &m.FirstName, &m.LastName, &m.Email, &m.Role, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func scanRowIntoInvitation(row *sql.Row) (*types.AccountInvitation, error) {
+	i := new(types.AccountInvitation)
+	err := row.Scan(&i.ID, &i.AccountToken, &i.AccountName, &i.Email, &i.Role, &i.InvitedBy,
+		&i.InviterName, &i.Status, &i.ExpiresAt, &i.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func scanRowsIntoInvitation(rows *sql.Rows) (*types.AccountInvitation, error) {
+	i := new(types.AccountInvitation)
+	err := rows.Scan(&i.ID, &i.AccountToken, &i.AccountName, &i.Email, &i.Role, &i.InvitedBy,
+		&i.InviterName, &i.Status, &i.ExpiresAt, &i.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
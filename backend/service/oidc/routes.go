@@ -0,0 +1,272 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/service/session"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const (
+	stateCookieName = "oidcState"
+	stateCookiePath = "/api/v1/auth/oidc"
+)
+
+// errors the frontend login page can show, passed in the error query parameter
+const (
+	loginErrorFailed           = "oidc_failed"
+	loginErrorNoAccount        = "oidc_no_account"
+	loginErrorEmailNotVerified = "oidc_email_not_verified"
+)
+
+type Handler struct {
+	providers      []*Provider
+	identityStore  types.OIDCIdentityStore
+	userStore      types.UserStore
+	sessionStore   types.SessionStore
+	twoFactorStore types.TwoFactorStore
+}
+
+func NewHandler(providers []*Provider, identityStore types.OIDCIdentityStore, userStore types.UserStore, sessionStore types.SessionStore, twoFactorStore types.TwoFactorStore) *Handler {
+	return &Handler{
+		providers:      providers,
+		identityStore:  identityStore,
+		userStore:      userStore,
+		sessionStore:   sessionStore,
+		twoFactorStore: twoFactorStore,
+	}
+}
+
+// NewProviders creates a provider for every issuer in the configuration
+func NewProviders(configs []config.OIDCProviderConfig) []*Provider {
+	providers := []*Provider{}
+	for _, providerConfig := range configs {
+		providers = append(providers, NewProvider(providerConfig, nil))
+	}
+	return providers
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/auth/oidc/providers", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodGet: h.GetProviders,
+	}))
+	router.HandleFunc("/auth/oidc/{provider}/login", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodGet: h.Login,
+	}))
+	router.HandleFunc("/auth/oidc/{provider}/callback", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodGet: h.Callback,
+	}))
+}
+
+func (h *Handler) GetProviders(w http.ResponseWriter, r *http.Request) {
+	providers := []types.OIDCProvider{}
+	for _, provider := range h.providers {
+		providers = append(providers, types.OIDCProvider{
+			Name:     provider.Name(),
+			LoginUrl: providerUrl(provider.Name(), "login"),
+		})
+	}
+
+	response := map[string]interface{}{
+		"providers": providers,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+// Login sends the browser to the provider, remembering the attempt in a signed cookie
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.providerFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := newLoginState(provider.Name())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	signedState, err := state.sign(stateSecret())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	authUrl, err := provider.AuthCodeURL(providerUrl(provider.Name(), "callback"), state.State, state.Nonce, codeChallenge(state.CodeVerifier))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	// Lax, the callback is a top level navigation coming from the provider
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    signedState,
+		Path:     stateCookiePath,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(loginStateTTL.Seconds()),
+	})
+
+	http.Redirect(w, r, authUrl, http.StatusFound)
+}
+
+// Callback finishes the login: it checks the state, exchanges the code with the PKCE
+// verifier, verifies the ID token and signs in the linked user
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.providerFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	cookie, err := r.Cookie(stateCookieName)
+	clearStateCookie(w, r)
+	if err != nil {
+		redirectToLogin(w, r, loginErrorFailed, fmt.Errorf("missing login state"))
+		return
+	}
+	state, err := parseLoginState(stateSecret(), cookie.Value)
+	if err != nil {
+		redirectToLogin(w, r, loginErrorFailed, err)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		redirectToLogin(w, r, loginErrorFailed, fmt.Errorf("provider returned %s", providerError))
+		return
+	}
+	if state.Provider != provider.Name() || subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		redirectToLogin(w, r, loginErrorFailed, fmt.Errorf("state mismatch"))
+		return
+	}
+
+	idToken, err := provider.Exchange(query.Get("code"), state.CodeVerifier, providerUrl(provider.Name(), "callback"))
+	if err != nil {
+		redirectToLogin(w, r, loginErrorFailed, err)
+		return
+	}
+	claims, err := provider.VerifyIDToken(idToken, state.Nonce)
+	if err != nil {
+		redirectToLogin(w, r, loginErrorFailed, err)
+		return
+	}
+
+	userId, err := h.resolveUser(provider, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEmailNotVerified):
+			redirectToLogin(w, r, loginErrorEmailNotVerified, err)
+		case errors.Is(err, ErrIdentityNotFound):
+			redirectToLogin(w, r, loginErrorNoAccount, err)
+		default:
+			redirectToLogin(w, r, loginErrorFailed, err)
+		}
+		return
+	}
+
+	// the provider replaces the password, not the second factor
+	twoFactorEnabled, err := h.twoFactorStore.IsEnabled(userId)
+	if err != nil {
+		redirectToLogin(w, r, loginErrorFailed, err)
+		return
+	}
+	if twoFactorEnabled {
+		twoFactorToken, err := auth.CreateTwoFactorToken([]byte(config.Envs.JWTSecret), userId)
+		if err != nil {
+			redirectToLogin(w, r, loginErrorFailed, err)
+			return
+		}
+		http.Redirect(w, r, config.Envs.FrontendUrl+"/login#two_factor_token="+url.QueryEscape(twoFactorToken), http.StatusFound)
+		return
+	}
+
+	session.StartSessionAndRedirect(w, r, h.sessionStore, userId, config.Envs.FrontendUrl+"/")
+}
+
+// resolveUser returns the user linked to the external account. The first login links
+// it to the user with the same email, but only when the provider verified that email.
+func (h *Handler) resolveUser(provider *Provider, claims *IDTokenClaims) (int, error) {
+	userId, err := h.identityStore.GetUserIdByIdentity(provider.Issuer(), claims.Subject)
+	if err == nil {
+		return userId, nil
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return 0, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, ErrEmailNotVerified
+	}
+
+	user, err := h.userStore.GetUserByEmail(claims.Email)
+	if err != nil {
+		return 0, fmt.Errorf("%w: no user with email %s", ErrIdentityNotFound, claims.Email)
+	}
+
+	if err := h.identityStore.LinkIdentity(user.ID, provider.Issuer(), claims.Subject, claims.Email); err != nil {
+		return 0, err
+	}
+	// the provider proved the user owns the email
+	if !user.EmailVerified {
+		if err := h.userStore.MarkEmailVerified(user.ID); err != nil {
+			log.Printf("failed to mark email verified for user %d: %v", user.ID, err)
+		}
+	}
+
+	return user.ID, nil
+}
+
+func (h *Handler) providerFromPath(w http.ResponseWriter, r *http.Request) (*Provider, bool) {
+	// extract provider name from URL path (/auth/oidc/{provider}/...)
+	name, ok := middleware.ExtractPathParamAndRespond(w, r, 2)
+	if !ok {
+		return nil, false
+	}
+
+	for _, provider := range h.providers {
+		if provider.Name() == name {
+			return provider, true
+		}
+	}
+
+	utils.WriteError(w, http.StatusNotFound, fmt.Errorf("unknown identity provider %s", name))
+	return nil, false
+}
+
+func providerUrl(name, action string) string {
+	return config.Envs.OIDCRedirectBaseUrl + "/auth/oidc/" + url.PathEscape(name) + "/" + action
+}
+
+// the login state is signed with its own key so it can never pass as an access token
+func stateSecret() []byte {
+	return []byte(config.Envs.JWTSecret + ":oidc-state")
+}
+
+func clearStateCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    "",
+		Path:     stateCookiePath,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+}
+
+// redirectToLogin sends the browser back to the login page, the details stay in the logs
+func redirectToLogin(w http.ResponseWriter, r *http.Request, code string, err error) {
+	log.Printf("oidc login failed: %v", err)
+	http.Redirect(w, r, config.Envs.FrontendUrl+"/login?error="+code, http.StatusFound)
+}
@@ -0,0 +1,398 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const (
+	testClientID = "wallet-tracker"
+	testKeyID    = "test-key"
+)
+
+// stubProvider is a local OIDC provider: it serves the discovery document and the
+// signing keys, hands out a code on /authorize and checks the PKCE verifier on /token
+type stubProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]pendingCode
+	claims jwt.MapClaims
+	// overrides applied to the next ID token
+	tamper func(claims jwt.MapClaims)
+}
+
+type pendingCode struct {
+	nonce     string
+	challenge string
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	stub := &stubProvider{key: key, codes: make(map[string]pendingCode)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.discovery)
+	mux.HandleFunc("/jwks", stub.jwks)
+	mux.HandleFunc("/authorize", stub.authorize)
+	mux.HandleFunc("/token", stub.token)
+	stub.server = httptest.NewServer(mux)
+	t.Cleanup(stub.server.Close)
+
+	return stub
+}
+
+func (s *stubProvider) issuer() string {
+	return s.server.URL
+}
+
+func (s *stubProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(Discovery{
+		Issuer:                s.issuer(),
+		AuthorizationEndpoint: s.issuer() + "/authorize",
+		TokenEndpoint:         s.issuer() + "/token",
+		JWKSURI:               s.issuer() + "/jwks",
+	})
+}
+
+func (s *stubProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *stubProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	code := fmt.Sprintf("code-%d", len(s.codes)+1)
+	s.codes[code] = pendingCode{nonce: query.Get("nonce"), challenge: query.Get("code_challenge")}
+	s.mu.Unlock()
+
+	redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (s *stubProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	s.mu.Lock()
+	pending, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	if !ok || codeChallenge(r.PostForm.Get("code_verifier")) != pending.challenge {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   s.issuer(),
+		"aud":   testClientID,
+		"nonce": pending.nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range s.claims {
+		claims[name] = value
+	}
+	if s.tamper != nil {
+		s.tamper(claims)
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": s.sign(claims)})
+}
+
+func (s *stubProvider) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	signed, _ := token.SignedString(s.key)
+	return signed
+}
+
+type mockIdentityStore struct {
+	identities map[string]int
+}
+
+func (m *mockIdentityStore) GetUserIdByIdentity(issuer, subject string) (int, error) {
+	userId, ok := m.identities[issuer+"|"+subject]
+	if !ok {
+		return 0, ErrIdentityNotFound
+	}
+	return userId, nil
+}
+
+func (m *mockIdentityStore) LinkIdentity(userId int, issuer, subject, email string) error {
+	m.identities[issuer+"|"+subject] = userId
+	return nil
+}
+
+type mockUserStore struct {
+	users    map[string]*types.User
+	verified []int
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	user, ok := m.users[email]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+	return user, nil
+}
+func (m *mockUserStore) GetUserById(id int) (*types.User, error)                    { return nil, nil }
+func (m *mockUserStore) CreateUser(user *types.User, templateLanguage string) error { return nil }
+func (m *mockUserStore) ValidatePassword(password string) error                     { return nil }
+func (m *mockUserStore) DeleteUser(userId int) error                                { return nil }
+func (m *mockUserStore) UpdatePassword(userId int, hashedPassword string) error     { return nil }
+func (m *mockUserStore) UpdateProfile(userId int, firstName, lastName string) error { return nil }
+func (m *mockUserStore) SetPendingEmail(userId int, email string) error             { return nil }
+func (m *mockUserStore) ConfirmPendingEmail(userId int) (string, error)             { return "", nil }
+func (m *mockUserStore) MarkEmailVerified(userId int) error {
+	m.verified = append(m.verified, userId)
+	return nil
+}
+
+type mockSessionStore struct {
+	types.SessionStore
+	createdFor []int
+}
+
+func (m *mockSessionStore) CreateSession(userId int, userAgent, ipAddress string) (*types.Session, string, error) {
+	m.createdFor = append(m.createdFor, userId)
+	return &types.Session{ID: "session", UserID: userId}, "refresh", nil
+}
+
+type mockTwoFactorStore struct {
+	types.TwoFactorStore
+	enabled bool
+}
+
+func (m *mockTwoFactorStore) IsEnabled(userId int) (bool, error) { return m.enabled, nil }
+
+type testEnv struct {
+	stub       *stubProvider
+	handler    *Handler
+	router     *http.ServeMux
+	identities *mockIdentityStore
+	users      *mockUserStore
+	sessions   *mockSessionStore
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	stub := newStubProvider(t)
+	env := &testEnv{
+		stub:       stub,
+		identities: &mockIdentityStore{identities: make(map[string]int)},
+		users: &mockUserStore{users: map[string]*types.User{
+			"ana@mail.pt": {ID: 1, Email: "ana@mail.pt"},
+		}},
+		sessions: &mockSessionStore{},
+	}
+
+	provider := NewProvider(config.OIDCProviderConfig{Name: "stub", Issuer: stub.issuer(), ClientID: testClientID}, stub.server.Client())
+	env.handler = NewHandler([]*Provider{provider}, env.identities, env.users, env.sessions, &mockTwoFactorStore{})
+	env.router = http.NewServeMux()
+	env.handler.RegisterRoutes(env.router)
+
+	stub.claims = jwt.MapClaims{"sub": "stub-user-1", "email": "ana@mail.pt", "email_verified": true}
+	return env
+}
+
+// signIn plays the browser: start the login, follow the provider redirect and call the callback
+func (env *testEnv) signIn(t *testing.T) *httptest.ResponseRecorder {
+	t.Helper()
+
+	login := httptest.NewRecorder()
+	env.router.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/auth/oidc/stub/login", nil))
+	if login.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider, got %d: %s", login.Code, login.Body.String())
+	}
+	stateCookie := login.Result().Cookies()[0]
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(login.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to reach the provider: %v", err)
+	}
+	resp.Body.Close()
+
+	callbackUrl, _ := url.Parse(resp.Header.Get("Location"))
+	callback := httptest.NewRequest(http.MethodGet, "/auth/oidc/stub/callback?"+callbackUrl.RawQuery, nil)
+	callback.AddCookie(stateCookie)
+
+	rr := httptest.NewRecorder()
+	env.router.ServeHTTP(rr, callback)
+	return rr
+}
+
+func loginError(rr *httptest.ResponseRecorder) string {
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	return location.Query().Get("error")
+}
+
+func TestLoginLinksUserByVerifiedEmail(t *testing.T) {
+	env := newTestEnv(t)
+
+	rr := env.signIn(t)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != config.Envs.FrontendUrl+"/" {
+		t.Fatalf("expected a redirect to the app, got %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if len(env.sessions.createdFor) != 1 || env.sessions.createdFor[0] != 1 {
+		t.Fatalf("expected a session for user 1, got %v", env.sessions.createdFor)
+	}
+	if env.identities.identities[env.stub.issuer()+"|stub-user-1"] != 1 {
+		t.Error("expected the identity to be linked to user 1")
+	}
+	if len(env.users.verified) != 1 {
+		t.Error("expected the email to be marked as verified")
+	}
+
+	hasAuthCookie := false
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "authToken" && cookie.Value != "" {
+			hasAuthCookie = true
+		}
+	}
+	if !hasAuthCookie {
+		t.Error("expected the session cookie to be set")
+	}
+
+	// once linked the subject is enough, even if the email changed at the provider
+	env.stub.claims["email"] = "ana.new@mail.pt"
+	rr = env.signIn(t)
+	if rr.Header().Get("Location") != config.Envs.FrontendUrl+"/" {
+		t.Fatalf("expected the linked identity to sign in, got %s", rr.Header().Get("Location"))
+	}
+}
+
+func TestLoginRefusesUnverifiedEmail(t *testing.T) {
+	env := newTestEnv(t)
+	env.stub.claims["email_verified"] = false
+
+	rr := env.signIn(t)
+	if loginError(rr) != loginErrorEmailNotVerified {
+		t.Fatalf("expected %s, got redirect to %s", loginErrorEmailNotVerified, rr.Header().Get("Location"))
+	}
+	if len(env.identities.identities) != 0 || len(env.sessions.createdFor) != 0 {
+		t.Error("expected no identity to be linked and no session to start")
+	}
+}
+
+func TestLoginWithoutAccount(t *testing.T) {
+	env := newTestEnv(t)
+	env.stub.claims["email"] = "stranger@mail.pt"
+
+	rr := env.signIn(t)
+	if loginError(rr) != loginErrorNoAccount {
+		t.Fatalf("expected %s, got redirect to %s", loginErrorNoAccount, rr.Header().Get("Location"))
+	}
+}
+
+func TestLoginRejectsTamperedTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(claims jwt.MapClaims)
+	}{
+		{"wrong audience", func(claims jwt.MapClaims) { claims["aud"] = "another-client" }},
+		{"wrong issuer", func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }},
+		{"replayed nonce", func(claims jwt.MapClaims) { claims["nonce"] = "old-nonce" }},
+		{"expired", func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.stub.tamper = tc.tamper
+
+			rr := env.signIn(t)
+			if loginError(rr) != loginErrorFailed {
+				t.Fatalf("expected %s, got redirect to %s", loginErrorFailed, rr.Header().Get("Location"))
+			}
+			if len(env.sessions.createdFor) != 0 {
+				t.Error("expected no session to start")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsOtherKeys(t *testing.T) {
+	env := newTestEnv(t)
+	provider := env.handler.providers[0]
+	claims := jwt.MapClaims{
+		"iss": env.stub.issuer(), "aud": testClientID, "sub": "stub-user-1", "nonce": "n",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	if _, err := provider.VerifyIDToken(env.stub.sign(claims), "n"); err != nil {
+		t.Fatalf("expected the provider's token to verify, got %v", err)
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	forged.Header["kid"] = testKeyID
+	forgedToken, _ := forged.SignedString(otherKey)
+	if _, err := provider.VerifyIDToken(forgedToken, "n"); err == nil {
+		t.Error("expected a token signed with another key to be rejected")
+	}
+
+	// an HMAC token must not be accepted, whatever the secret
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if _, err := provider.VerifyIDToken(hmacToken, "n"); err == nil {
+		t.Error("expected an HS256 token to be rejected")
+	}
+}
+
+func TestCallbackRequiresMatchingState(t *testing.T) {
+	env := newTestEnv(t)
+
+	login := httptest.NewRecorder()
+	env.router.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/auth/oidc/stub/login", nil))
+	stateCookie := login.Result().Cookies()[0]
+
+	callback := httptest.NewRequest(http.MethodGet, "/auth/oidc/stub/callback?code=code-1&state=forged", nil)
+	callback.AddCookie(stateCookie)
+	rr := httptest.NewRecorder()
+	env.router.ServeHTTP(rr, callback)
+
+	if loginError(rr) != loginErrorFailed {
+		t.Fatalf("expected %s, got redirect to %s", loginErrorFailed, rr.Header().Get("Location"))
+	}
+
+	// without the cookie the callback can't be completed at all
+	rr = httptest.NewRecorder()
+	env.router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/auth/oidc/stub/callback?code=code-1&state=x", nil))
+	if !strings.Contains(rr.Header().Get("Location"), loginErrorFailed) {
+		t.Fatalf("expected %s, got redirect to %s", loginErrorFailed, rr.Header().Get("Location"))
+	}
+}
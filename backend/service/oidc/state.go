@@ -0,0 +1,74 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const loginStateTTL = 10 * time.Minute
+
+// loginState is kept in a signed cookie between the redirect to the provider and the
+// callback, so the callback can only complete a login started by the same browser
+type loginState struct {
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	jwt.RegisteredClaims
+}
+
+func newLoginState(provider string) (*loginState, error) {
+	state, err := utils.GenerateToken(16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := utils.GenerateToken(16)
+	if err != nil {
+		return nil, err
+	}
+	// RFC 7636 asks for 43 to 128 characters, 32 bytes of hex gives 64
+	verifier, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loginState{
+		Provider:     provider,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(loginStateTTL)),
+		},
+	}, nil
+}
+
+// codeChallenge is the S256 PKCE challenge of the verifier
+func codeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func (s *loginState) sign(secret []byte) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, s).SignedString(secret)
+}
+
+func parseLoginState(secret []byte, tokenString string) (*loginState, error) {
+	state := new(loginState)
+	token, err := jwt.ParseWithClaims(tokenString, state, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("login attempt expired, please try again")
+	}
+
+	return state, nil
+}
@@ -0,0 +1,50 @@
+package oidc
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lucas-remigio/wallet-tracker/db"
+)
+
+var ErrIdentityNotFound = fmt.Errorf("identity not linked")
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// GetUserIdByIdentity finds the user of an external account and records the login
+func (s *Store) GetUserIdByIdentity(issuer, subject string) (int, error) {
+	var userId int
+	err := s.db.QueryRow(
+		`UPDATE oidc_identities SET last_login_at = CURRENT_TIMESTAMP
+		 WHERE issuer = $1 AND subject = $2
+		 RETURNING user_id`,
+		issuer, subject,
+	).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrIdentityNotFound
+		}
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+func (s *Store) LinkIdentity(userId int, issuer, subject, email string) error {
+	_, err := db.ExecWithValidation(s.db,
+		"INSERT INTO oidc_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, $4)",
+		userId, issuer, subject, email)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return nil
+}
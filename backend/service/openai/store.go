@@ -35,17 +35,45 @@ func (c *Client) GenerateGPT4Response(prompt string) (string, error) {
 		Temperature: 0.0,
 	}
 
+	responseMessage, err := c.sendChatRequest(request)
+	if err != nil {
+		return "", err
+	}
+
+	message, err := c.cleanAiMessage(responseMessage.Content)
+	if err != nil {
+		return "", fmt.Errorf("failed to clean AI message: %w", err)
+	}
+
+	return message, nil
+}
+
+// GenerateChatCompletion sends a full conversation and returns the assistant message as is,
+// which may contain tool calls instead of content
+func (c *Client) GenerateChatCompletion(messages []types.Message, tools []types.Tool) (*types.Message, error) {
+	request := types.GPTRequest{
+		Model:       "gpt-4.1-mini",
+		Messages:    messages,
+		MaxTokens:   1000,
+		Temperature: 0.0,
+		Tools:       tools,
+	}
+
+	return c.sendChatRequest(request)
+}
+
+func (c *Client) sendChatRequest(request types.GPTRequest) (*types.Message, error) {
 	// Convert the request payload to JSON
 	requestBody, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal request payload: %w", err)
 	}
 
 	// Make the HTTP request
 	url := "https://api.openai.com/v1/chat/completions"
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	// Add headers
@@ -56,7 +84,7 @@ func (c *Client) GenerateGPT4Response(prompt string) (string, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send HTTP request: %w", err)
+		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -65,27 +93,22 @@ func (c *Client) GenerateGPT4Response(prompt string) (string, error) {
 		// Read the response body for debugging
 		body := new(bytes.Buffer)
 		body.ReadFrom(resp.Body)
-		return "", fmt.Errorf("OpenAI API returned status %d: %s", resp.StatusCode, body.String())
+		return nil, fmt.Errorf("OpenAI API returned status %d: %s", resp.StatusCode, body.String())
 	}
 
 	// Parse the response
 	var gptResponse types.GPTResponse
 	err = json.NewDecoder(resp.Body).Decode(&gptResponse)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse OpenAI response: %w", err)
+		return nil, fmt.Errorf("failed to parse OpenAI response: %w", err)
 	}
 
-	// Extract and return the response text
+	// Extract and return the response message
 	if len(gptResponse.Choices) == 0 {
-		return "", fmt.Errorf("no choices returned in OpenAI response")
+		return nil, fmt.Errorf("no choices returned in OpenAI response")
 	}
 
-	message, err := c.cleanAiMessage(gptResponse.Choices[0].Message.Content)
-	if err != nil {
-		return "", fmt.Errorf("failed to clean AI message: %w", err)
-	}
-
-	return message, nil
+	return &gptResponse.Choices[0].Message, nil
 }
 
 func (c *Client) cleanAiMessage(message string) (string, error) {
@@ -0,0 +1,175 @@
+package passkey
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const (
+	challengeBytes = 32
+	challengeTTL   = 5 * time.Minute
+)
+
+var (
+	ErrInvalidChallenge = fmt.Errorf("passkey challenge expired or already used")
+	ErrPasskeyNotFound  = fmt.Errorf("passkey not found")
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+const passkeyColumns = `
+    id, user_id, credential_id, public_key, sign_count, name, created_at, last_used_at
+`
+
+// CreateChallenge issues a random challenge for a ceremony, userId is 0 for logins
+func (s *Store) CreateChallenge(userId int, ceremony string) (string, error) {
+	random := make([]byte, challengeBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(random)
+
+	var owner *int
+	if userId != 0 {
+		owner = &userId
+	}
+
+	// clean up expired challenges as we go
+	if _, err := db.ExecWithValidation(s.db, "DELETE FROM passkey_challenges WHERE expires_at < CURRENT_TIMESTAMP"); err != nil {
+		return "", err
+	}
+
+	_, err := db.ExecWithValidation(s.db,
+		"INSERT INTO passkey_challenges (challenge, ceremony, user_id, expires_at) VALUES ($1, $2, $3, $4)",
+		challenge, ceremony, owner, time.Now().Add(challengeTTL))
+	if err != nil {
+		return "", fmt.Errorf("failed to create passkey challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// ConsumeChallenge deletes the challenge and returns the user it was issued to (0 for logins)
+func (s *Store) ConsumeChallenge(challenge, ceremony string) (int, error) {
+	var userId sql.NullInt64
+	err := s.db.QueryRow(
+		`DELETE FROM passkey_challenges
+		 WHERE challenge = $1 AND ceremony = $2 AND expires_at > CURRENT_TIMESTAMP
+		 RETURNING user_id`,
+		challenge, ceremony,
+	).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidChallenge
+		}
+		return 0, err
+	}
+
+	return int(userId.Int64), nil
+}
+
+func (s *Store) AddPasskey(passkey *types.Passkey) error {
+	_, err := db.ExecWithValidation(s.db,
+		`INSERT INTO passkeys (user_id, credential_id, public_key, sign_count, name)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		passkey.UserID, passkey.CredentialID, passkey.PublicKey, passkey.SignCount, passkey.Name)
+	if err != nil {
+		return fmt.Errorf("failed to save passkey: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) GetPasskeysByUserId(userId int) ([]*types.Passkey, error) {
+	query := fmt.Sprintf("SELECT %s FROM passkeys WHERE user_id = $1 ORDER BY created_at", passkeyColumns)
+	return db.QueryList(s.db, query, scanRowsIntoPasskey, userId)
+}
+
+func (s *Store) GetPasskeyByCredentialId(credentialId string) (*types.Passkey, error) {
+	query := fmt.Sprintf("SELECT %s FROM passkeys WHERE credential_id = $1", passkeyColumns)
+	passkey, err := db.QuerySingle(s.db, query, scanRowIntoPasskey, credentialId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPasskeyNotFound
+		}
+		return nil, err
+	}
+
+	return passkey, nil
+}
+
+func (s *Store) UpdateSignCount(passkeyId int, signCount uint32) error {
+	_, err := db.ExecWithValidation(s.db,
+		"UPDATE passkeys SET sign_count = $1, last_used_at = CURRENT_TIMESTAMP WHERE id = $2",
+		signCount, passkeyId)
+	return err
+}
+
+func (s *Store) DeletePasskey(passkeyId int, userId int) error {
+	result, err := db.ExecWithValidation(s.db,
+		"DELETE FROM passkeys WHERE id = $1 AND user_id = $2",
+		passkeyId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+func scanRowIntoPasskey(row *sql.Row) (*types.Passkey, error) {
+	passkey := new(types.Passkey)
+	err := row.Scan(
+		&passkey.ID,
+		&passkey.UserID,
+		&passkey.CredentialID,
+		&passkey.PublicKey,
+		&passkey.SignCount,
+		&passkey.Name,
+		&passkey.CreatedAt,
+		&passkey.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+func scanRowsIntoPasskey(rows *sql.Rows) (*types.Passkey, error) {
+	passkey := new(types.Passkey)
+	err := rows.Scan(
+		&passkey.ID,
+		&passkey.UserID,
+		&passkey.CredentialID,
+		&passkey.PublicKey,
+		&passkey.SignCount,
+		&passkey.Name,
+		&passkey.CreatedAt,
+		&passkey.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
@@ -0,0 +1,169 @@
+package privacy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	ibanPattern  = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?:[ ]?[A-Z0-9]{4}){2,7}(?:[ ]?[A-Z0-9]{1,4})?\b`)
+	cardPattern  = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+	// International phone numbers (+351 912 345 678, 00351912345678)
+	intlPhonePattern = regexp.MustCompile(`(?:\+|\b00)\d{1,3}[ \-]?\d{2,4}(?:[ \-]?\d{2,4}){1,3}\b`)
+	// Any standalone 9 digit number, classified later as NIF or phone
+	nineDigitPattern = regexp.MustCompile(`\b\d{3}[ ]?\d{3}[ ]?\d{3}\b`)
+)
+
+// Redactor replaces PII-like content found in free text.
+// In redact mode every match becomes a generic placeholder ([EMAIL]),
+// in pseudonymise mode equal values map to the same numbered placeholder ([EMAIL_1])
+// so the model can still tell that two transactions refer to the same entity.
+type Redactor struct {
+	mode       string
+	pseudonyms map[string]string
+	counters   map[string]int
+}
+
+func NewRedactor(mode string) *Redactor {
+	return &Redactor{
+		mode:       mode,
+		pseudonyms: make(map[string]string),
+		counters:   make(map[string]int),
+	}
+}
+
+// Sanitize returns the text with every detected identifier replaced according to the mode
+func (r *Redactor) Sanitize(text string) string {
+	if r.mode != types.AIPrivacyModeRedact && r.mode != types.AIPrivacyModePseudonymise {
+		return text
+	}
+
+	// order matters: the most specific patterns run first so that, for example,
+	// the digits of an IBAN are not picked up as a card number
+	text = emailPattern.ReplaceAllStringFunc(text, func(m string) string { return r.replace("EMAIL", m) })
+	text = ibanPattern.ReplaceAllStringFunc(text, func(m string) string {
+		if !isValidIBAN(m) {
+			return m
+		}
+		return r.replace("IBAN", m)
+	})
+	text = cardPattern.ReplaceAllStringFunc(text, func(m string) string {
+		if !passesLuhn(digitsOnly(m)) {
+			return m
+		}
+		return r.replace("CARD", m)
+	})
+	text = intlPhonePattern.ReplaceAllStringFunc(text, func(m string) string { return r.replace("PHONE", m) })
+	text = nineDigitPattern.ReplaceAllStringFunc(text, func(m string) string {
+		digits := digitsOnly(m)
+		switch {
+		case isValidNIF(digits):
+			return r.replace("NIF", digits)
+		case digits[0] == '9' || digits[0] == '2':
+			return r.replace("PHONE", digits)
+		default:
+			return m
+		}
+	})
+
+	return text
+}
+
+func (r *Redactor) replace(kind, value string) string {
+	if r.mode == types.AIPrivacyModeRedact {
+		return "[" + kind + "]"
+	}
+
+	key := kind + ":" + digitsOrValue(value)
+	if placeholder, exists := r.pseudonyms[key]; exists {
+		return placeholder
+	}
+
+	r.counters[kind]++
+	placeholder := fmt.Sprintf("[%s_%d]", kind, r.counters[kind])
+	r.pseudonyms[key] = placeholder
+	return placeholder
+}
+
+// digitsOrValue normalises a match so that "912 345 678" and "912345678" share a pseudonym
+func digitsOrValue(value string) string {
+	if digits := digitsOnly(value); len(digits) >= 9 {
+		return digits
+	}
+	return strings.ToLower(value)
+}
+
+func digitsOnly(value string) string {
+	var b strings.Builder
+	for _, c := range value {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// passesLuhn validates card numbers with the Luhn checksum
+func passesLuhn(digits string) bool {
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// isValidNIF validates a Portuguese tax number (NIF) using its mod 11 check digit
+func isValidNIF(digits string) bool {
+	if len(digits) != 9 || !strings.ContainsRune("1235689", rune(digits[0])) {
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < 8; i++ {
+		sum += int(digits[i]-'0') * (9 - i)
+	}
+	check := 11 - sum%11
+	if check >= 10 {
+		check = 0
+	}
+	return check == int(digits[8]-'0')
+}
+
+// isValidIBAN validates an IBAN using the ISO 13616 mod 97 check
+func isValidIBAN(value string) bool {
+	iban := strings.ReplaceAll(value, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for _, c := range rearranged {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
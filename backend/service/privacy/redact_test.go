@@ -0,0 +1,59 @@
+package privacy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func TestRedactorRedactMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "email", input: "refund from joao.silva@mail.pt", want: "refund from [EMAIL]"},
+		{name: "iban", input: "transfer to PT50 0002 0123 1234 5678 9015 4 rent", want: "transfer to [IBAN] rent"},
+		{name: "card", input: "paid with 4111 1111 1111 1111", want: "paid with [CARD]"},
+		{name: "nif", input: "fatura NIF 123456789", want: "fatura NIF [NIF]"},
+		{name: "local phone", input: "mbway 912 345 678", want: "mbway [PHONE]"},
+		{name: "international phone", input: "call +351 912 345 678", want: "call [PHONE]"},
+		{name: "amounts untouched", input: "Continente 23,40", want: "Continente 23,40"},
+		{name: "invalid card untouched", input: "ref 1234 5678 9012 3456", want: "ref 1234 5678 9012 3456"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := NewRedactor(types.AIPrivacyModeRedact).Sanitize(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRedactorPseudonymiseModeIsStable(t *testing.T) {
+	r := NewRedactor(types.AIPrivacyModePseudonymise)
+
+	first := r.Sanitize("mbway to 912345678")
+	second := r.Sanitize("mbway to 912 345 678")
+	third := r.Sanitize("mbway to 961234567")
+
+	if first != "mbway to [PHONE_1]" {
+		t.Errorf("unexpected pseudonym %q", first)
+	}
+	if second != first {
+		t.Errorf("expected the same value to keep its pseudonym, got %q and %q", first, second)
+	}
+	if !strings.Contains(third, "[PHONE_2]") {
+		t.Errorf("expected a new pseudonym for a different value, got %q", third)
+	}
+}
+
+func TestRedactorOffModeKeepsText(t *testing.T) {
+	input := "joao.silva@mail.pt 4111 1111 1111 1111"
+	if got := NewRedactor(types.AIPrivacyModeOff).Sanitize(input); got != input {
+		t.Errorf("expected text to be unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,245 @@
+package quick_entry
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind of movement inferred from the verbs used in the text
+const (
+	kindUnknown = ""
+	kindDebit   = "debit"
+	kindCredit  = "credit"
+)
+
+// parsedText holds everything the rule-based parser could extract from free text,
+// before it is resolved against the user's real accounts and categories
+type parsedText struct {
+	Amount   *float64
+	Date     *time.Time
+	Kind     string
+	Merchant string
+	// Normalised text used to match account and category names
+	Normalized string
+}
+
+var (
+	isoDatePattern      = regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	dayMonthPattern     = regexp.MustCompile(`\b(\d{1,2})[/\-](\d{1,2})(?:[/\-](\d{2,4}))?\b`)
+	daysAgoPattern      = regexp.MustCompile(`(?i)\b(\d{1,3})\s+days?\s+ago\b|\bh[aá]\s+(\d{1,3})\s+dias?\b`)
+	relativeDayPattern  = regexp.MustCompile(`(?i)\b(today|yesterday|day before yesterday|hoje|ontem|anteontem)\b`)
+	weekdayPattern      = regexp.MustCompile(`(?i)\b(?:last\s+|on\s+|na\s+|no\s+|(?:esta|última|ultima|passada)\s+)?(monday|tuesday|wednesday|thursday|friday|saturday|sunday|segunda(?:-feira)?|ter[cç]a(?:-feira)?|quarta(?:-feira)?|quinta(?:-feira)?|sexta(?:-feira)?|s[aá]bado|domingo)(?:\s+passad[oa])?\b`)
+	amountPattern       = regexp.MustCompile(`(?i)(€\s*)?(\d+(?:[.,\s]\d{3})*(?:[.,]\d{1,2})?)(\s*(?:€|eur(?:os?)?\b))?`)
+	merchantPattern     = regexp.MustCompile(`(?i)\b(?:at|no|na|em|in)\s+([\p{L}0-9&'][\p{L}0-9&' ]*?)(?:\s+(?:on|for|from|with|using|yesterday|today|para|de|do|da|dos|das|com|ontem|hoje|anteontem|na|no|em)\b|[,.;!?]|$)`)
+	debitVerbPattern    = regexp.MustCompile(`(?i)\b(spent|spend|paid|pay|bought|buy|gastei|paguei|comprei|gasto|pagamento|despesa)\b`)
+	creditVerbPattern   = regexp.MustCompile(`(?i)\b(received|receive|earned|got paid|income|refund|recebi|ganhei|recebido|reembolso|sal[aá]rio|salary)\b`)
+	whitespacePattern   = regexp.MustCompile(`\s+`)
+	accentReplacer      = strings.NewReplacer("á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a", "é", "e", "è", "e", "ê", "e", "í", "i", "ì", "i", "ó", "o", "ò", "o", "ô", "o", "õ", "o", "ú", "u", "ù", "u", "ü", "u", "ç", "c")
+	weekdaysByShortName = map[string]time.Weekday{
+		"monday": time.Monday, "segunda": time.Monday,
+		"tuesday": time.Tuesday, "terca": time.Tuesday,
+		"wednesday": time.Wednesday, "quarta": time.Wednesday,
+		"thursday": time.Thursday, "quinta": time.Thursday,
+		"friday": time.Friday, "sexta": time.Friday,
+		"saturday": time.Saturday, "sabado": time.Saturday,
+		"sunday": time.Sunday, "domingo": time.Sunday,
+	}
+)
+
+// parseText runs the deterministic rules over Portuguese and English phrasings.
+// now is the reference instant used for relative dates ("yesterday", "há 2 dias").
+func parseText(text string, now time.Time) *parsedText {
+	result := &parsedText{Normalized: normalize(text)}
+	remaining := text
+
+	// Dates are extracted first so that their digits are not mistaken for amounts
+	result.Date, remaining = extractDate(remaining, now)
+	result.Amount = extractAmount(remaining)
+	result.Merchant = extractMerchant(remaining)
+
+	switch {
+	case debitVerbPattern.MatchString(text):
+		result.Kind = kindDebit
+	case creditVerbPattern.MatchString(text):
+		result.Kind = kindCredit
+	default:
+		result.Kind = kindUnknown
+	}
+
+	return result
+}
+
+// extractDate returns the first date expression found and the text without it
+func extractDate(text string, now time.Time) (*time.Time, string) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	if m := isoDatePattern.FindStringSubmatchIndex(text); m != nil {
+		year, _ := strconv.Atoi(text[m[2]:m[3]])
+		month, _ := strconv.Atoi(text[m[4]:m[5]])
+		day, _ := strconv.Atoi(text[m[6]:m[7]])
+		if date, ok := buildDate(year, month, day, now.Location()); ok {
+			return &date, cut(text, m[0], m[1])
+		}
+	}
+
+	if m := dayMonthPattern.FindStringSubmatchIndex(text); m != nil {
+		day, _ := strconv.Atoi(text[m[2]:m[3]])
+		month, _ := strconv.Atoi(text[m[4]:m[5]])
+		year := today.Year()
+		if m[6] != -1 {
+			year, _ = strconv.Atoi(text[m[6]:m[7]])
+			if year < 100 {
+				year += 2000
+			}
+		}
+		if date, ok := buildDate(year, month, day, now.Location()); ok {
+			// a date without year that lands in the future refers to last year
+			if m[6] == -1 && date.After(today) {
+				date = date.AddDate(-1, 0, 0)
+			}
+			return &date, cut(text, m[0], m[1])
+		}
+	}
+
+	if m := daysAgoPattern.FindStringSubmatchIndex(text); m != nil {
+		var group string
+		if m[2] != -1 {
+			group = text[m[2]:m[3]]
+		} else {
+			group = text[m[4]:m[5]]
+		}
+		days, _ := strconv.Atoi(group)
+		date := today.AddDate(0, 0, -days)
+		return &date, cut(text, m[0], m[1])
+	}
+
+	if m := relativeDayPattern.FindStringSubmatchIndex(text); m != nil {
+		var date time.Time
+		switch normalize(text[m[2]:m[3]]) {
+		case "today", "hoje":
+			date = today
+		case "yesterday", "ontem":
+			date = today.AddDate(0, 0, -1)
+		default:
+			date = today.AddDate(0, 0, -2)
+		}
+		return &date, cut(text, m[0], m[1])
+	}
+
+	if m := weekdayPattern.FindStringSubmatchIndex(text); m != nil {
+		name := strings.TrimSuffix(normalize(text[m[2]:m[3]]), "-feira")
+		if weekday, ok := weekdaysByShortName[name]; ok {
+			// always the most recent past occurrence, never today
+			diff := (int(today.Weekday()) - int(weekday) + 7) % 7
+			if diff == 0 {
+				diff = 7
+			}
+			date := today.AddDate(0, 0, -diff)
+			return &date, cut(text, m[0], m[1])
+		}
+	}
+
+	return nil, text
+}
+
+// extractAmount prefers a number tagged with a currency marker, falling back to the first number
+func extractAmount(text string) *float64 {
+	var first *float64
+
+	for _, m := range amountPattern.FindAllStringSubmatch(text, -1) {
+		value, ok := parseAmount(strings.TrimSpace(m[2]))
+		if !ok || value <= 0 {
+			continue
+		}
+		if m[1] != "" || m[3] != "" {
+			return &value
+		}
+		if first == nil {
+			first = &value
+		}
+	}
+
+	return first
+}
+
+// parseAmount accepts both "1.234,56" and "1,234.56" as well as "23,40" and "23.40"
+func parseAmount(raw string) (float64, bool) {
+	raw = strings.ReplaceAll(raw, " ", "")
+	lastComma := strings.LastIndex(raw, ",")
+	lastDot := strings.LastIndex(raw, ".")
+
+	decimalSep := -1
+	switch {
+	case lastComma != -1 && lastDot != -1:
+		decimalSep = max(lastComma, lastDot)
+	case lastComma != -1 && len(raw)-lastComma-1 != 3:
+		decimalSep = lastComma
+	case lastDot != -1 && len(raw)-lastDot-1 != 3:
+		decimalSep = lastDot
+	}
+
+	var integerPart, decimalPart string
+	if decimalSep == -1 {
+		integerPart = raw
+	} else {
+		integerPart = raw[:decimalSep]
+		decimalPart = raw[decimalSep+1:]
+	}
+	integerPart = strings.NewReplacer(",", "", ".", "").Replace(integerPart)
+
+	value, err := strconv.ParseFloat(integerPart+"."+decimalPart, 64)
+	if decimalPart == "" {
+		value, err = strconv.ParseFloat(integerPart, 64)
+	}
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+func extractMerchant(text string) string {
+	m := merchantPattern.FindStringSubmatch(text)
+	if m == nil {
+		return ""
+	}
+
+	merchant := strings.TrimSpace(m[1])
+	// "em 23,40" or "on groceries" are not merchants
+	if merchant == "" || amountPattern.FindString(merchant) == merchant {
+		return ""
+	}
+	return merchant
+}
+
+func buildDate(year, month, day int, loc *time.Location) (time.Time, bool) {
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+	// reject overflowing dates such as 31/02
+	if date.Day() != day {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func cut(text string, start, end int) string {
+	return text[:start] + " " + text[end:]
+}
+
+// normalize lowercases, strips accents and collapses whitespace so names can be compared
+func normalize(text string) string {
+	text = accentReplacer.Replace(strings.ToLower(text))
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+}
+
+// containsWords reports whether phrase appears in text on word boundaries
+func containsWords(text, phrase string) bool {
+	if phrase == "" {
+		return false
+	}
+	padded := " " + strings.NewReplacer(",", " ", ".", " ", ";", " ", "!", " ", "?", " ").Replace(text) + " "
+	return strings.Contains(padded, " "+phrase+" ")
+}
@@ -0,0 +1,136 @@
+package quick_entry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+// Wednesday
+var referenceNow = time.Date(2025, time.March, 12, 15, 30, 0, 0, time.UTC)
+
+func TestParseText(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		wantAmount   float64
+		wantDate     string
+		wantKind     string
+		wantMerchant string
+	}{
+		{
+			name:         "english with yesterday",
+			text:         "spent 23,40 at Continente yesterday on groceries from my main account",
+			wantAmount:   23.40,
+			wantDate:     "2025-03-11",
+			wantKind:     kindDebit,
+			wantMerchant: "Continente",
+		},
+		{
+			name:         "portuguese with ontem",
+			text:         "gastei 12.5€ no Pingo Doce ontem",
+			wantAmount:   12.5,
+			wantDate:     "2025-03-11",
+			wantKind:     kindDebit,
+			wantMerchant: "Pingo Doce",
+		},
+		{
+			name:       "portuguese salary with explicit date",
+			text:       "recebi o salário de 1.250,00 euros a 28/02",
+			wantAmount: 1250,
+			wantDate:   "2025-02-28",
+			wantKind:   kindCredit,
+		},
+		{
+			name:       "days ago",
+			text:       "paid 9.99 for spotify 3 days ago",
+			wantAmount: 9.99,
+			wantDate:   "2025-03-09",
+			wantKind:   kindDebit,
+		},
+		{
+			name:       "há dias",
+			text:       "paguei 40 euros de luz há 2 dias",
+			wantAmount: 40,
+			wantDate:   "2025-03-10",
+			wantKind:   kindDebit,
+		},
+		{
+			name:       "weekday is the last past occurrence",
+			text:       "bought coffee for 1,20 on monday",
+			wantAmount: 1.20,
+			wantDate:   "2025-03-10",
+			wantKind:   kindDebit,
+		},
+		{
+			name:       "iso date and currency prefix",
+			text:       "refund €15 on 2025-01-05",
+			wantAmount: 15,
+			wantDate:   "2025-01-05",
+			wantKind:   kindCredit,
+		},
+		{
+			name:       "future day without year refers to last year",
+			text:       "spent 30 on 25/12",
+			wantAmount: 30,
+			wantDate:   "2024-12-25",
+			wantKind:   kindDebit,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed := parseText(tc.text, referenceNow)
+
+			if parsed.Amount == nil || *parsed.Amount != tc.wantAmount {
+				t.Errorf("expected amount %v, got %v", tc.wantAmount, parsed.Amount)
+			}
+			if parsed.Date == nil || parsed.Date.Format(dateLayout) != tc.wantDate {
+				t.Errorf("expected date %s, got %v", tc.wantDate, parsed.Date)
+			}
+			if parsed.Kind != tc.wantKind {
+				t.Errorf("expected kind %q, got %q", tc.wantKind, parsed.Kind)
+			}
+			if tc.wantMerchant != "" && parsed.Merchant != tc.wantMerchant {
+				t.Errorf("expected merchant %q, got %q", tc.wantMerchant, parsed.Merchant)
+			}
+		})
+	}
+}
+
+func TestResolveAgainstUserData(t *testing.T) {
+	accounts := []*types.Account{
+		{Token: "savings", AccountName: "Poupança", IsFavorite: false},
+		{Token: "main", AccountName: "Conta Principal", IsFavorite: true},
+	}
+	categories := []*types.Category{
+		{ID: 1, CategoryName: "Supermercado", TransactionTypeID: int(types.DebitTransactionType)},
+		{ID: 2, CategoryName: "Restaurantes", TransactionTypeID: int(types.DebitTransactionType)},
+		{ID: 3, CategoryName: "Salário", TransactionTypeID: int(types.CreditTransactionType)},
+	}
+
+	parsed := parseText("spent 23,40 at Continente yesterday on groceries from my main account", referenceNow)
+
+	account, explicit := resolveAccount(parsed.Normalized, accounts)
+	if account.Token != "main" || !explicit {
+		t.Errorf("expected the main account to be resolved explicitly, got %s (%v)", account.Token, explicit)
+	}
+
+	category := resolveCategory(parsed, categories)
+	if category == nil || category.ID != 1 {
+		t.Errorf("expected groceries to resolve to Supermercado, got %+v", category)
+	}
+
+	parsed = parseText("recebi o salario", referenceNow)
+	category = resolveCategory(parsed, categories)
+	if category == nil || category.ID != 3 {
+		t.Errorf("expected Salário, got %+v", category)
+	}
+
+	parsed = parseText("jantar 30€ da poupança", referenceNow)
+	account, _ = resolveAccount(parsed.Normalized, accounts)
+	if account.Token != "savings" {
+		t.Errorf("expected the savings account, got %s", account.Token)
+	}
+}
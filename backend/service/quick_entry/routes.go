@@ -0,0 +1,54 @@
+package quick_entry
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+type Handler struct {
+	store types.QuickEntryStore
+}
+
+func NewHandler(store types.QuickEntryStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/transactions/parse", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.ParseTransaction,
+		}),
+	))
+}
+
+// ParseTransaction only proposes a transaction; the client commits it through POST /transactions
+func (h *Handler) ParseTransaction(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.ParseTransactionPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	proposal, err := h.store.ProposeTransaction(userId, payload.Text, payload.Language, payload.UseAI, time.Now())
+	if err != nil {
+		if errors.Is(err, ErrNoAccounts) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, proposal)
+}
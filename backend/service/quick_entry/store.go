@@ -0,0 +1,359 @@
+package quick_entry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lucas-remigio/wallet-tracker/prompts"
+	"github.com/lucas-remigio/wallet-tracker/service/privacy"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const (
+	fieldAccount  = "account_token"
+	fieldCategory = "category_id"
+	fieldAmount   = "amount"
+	fieldDate     = "date"
+
+	dateLayout = "2006-01-02"
+
+	// matches the size of the description column, which counts characters
+	maxDescriptionLen = 255
+)
+
+var ErrNoAccounts = fmt.Errorf("create an account, or get edit access to one, before adding transactions")
+
+// Keyword groups used to match free text against category names in both languages.
+// The first word of each group is the canonical name referenced by merchantCategories.
+var categoryKeywordGroups = [][]string{
+	{"groceries", "grocery", "supermarket", "supermercado", "mercearia", "compras", "alimentacao", "food"},
+	{"restaurants", "restaurant", "restaurante", "restaurantes", "jantar", "dinner", "almoco", "lunch", "cafe", "coffee"},
+	{"transport", "transportes", "transporte", "uber", "metro", "comboio", "train", "autocarro", "bus", "fuel", "gasolina", "combustivel"},
+	{"rent", "renda", "housing", "habitacao", "casa"},
+	{"salary", "salario", "ordenado", "vencimento", "wage"},
+	{"health", "saude", "farmacia", "pharmacy", "medico", "doctor"},
+	{"utilities", "luz", "agua", "electricity", "eletricidade", "internet", "telecomunicacoes"},
+	{"entertainment", "lazer", "cinema", "streaming", "netflix", "spotify"},
+	{"shopping", "roupa", "clothes", "clothing"},
+}
+
+// Well known Portuguese merchants and the canonical category they usually belong to
+var merchantCategories = map[string]string{
+	"continente": "groceries", "pingo doce": "groceries", "lidl": "groceries", "aldi": "groceries",
+	"mercadona": "groceries", "auchan": "groceries", "minipreco": "groceries", "intermarche": "groceries",
+	"galp": "transport", "repsol": "transport", "bolt": "transport", "uber": "transport",
+	"wells": "health", "zara": "shopping", "primark": "shopping", "worten": "shopping", "fnac": "shopping",
+	"mcdonalds": "restaurants", "burger king": "restaurants", "telepizza": "restaurants",
+	"edp": "utilities", "meo": "utilities", "vodafone": "utilities",
+	"netflix": "entertainment", "spotify": "entertainment",
+}
+
+type Store struct {
+	accountStore  types.AccountStore
+	categoryStore types.CategoryStore
+	openAiStore   types.OpenAIStore
+	settingsStore types.SettingsStore
+}
+
+func NewStore(accountStore types.AccountStore, categoryStore types.CategoryStore, openAiStore types.OpenAIStore, settingsStore types.SettingsStore) *Store {
+	return &Store{
+		accountStore:  accountStore,
+		categoryStore: categoryStore,
+		openAiStore:   openAiStore,
+		settingsStore: settingsStore,
+	}
+}
+
+// ProposeTransaction turns free text into a transaction proposal resolved against the
+// user's accounts and categories. Nothing is persisted here.
+func (s *Store) ProposeTransaction(userId int, text, language string, useAI bool, now time.Time) (*types.TransactionProposal, error) {
+	accounts, err := s.accountStore.GetAccountsByUserId(userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts: %w", err)
+	}
+	// a viewer of a shared account can't record the proposal there
+	accounts = filterAccounts(accounts, func(a *types.Account) bool {
+		return types.AccountRoleAtLeast(a.Role, types.AccountRoleEditor)
+	})
+	if len(accounts) == 0 {
+		return nil, ErrNoAccounts
+	}
+
+	settings, err := s.settingsStore.GetSettingsByUserId(userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+	loc, err := utils.LoadLocation(settings.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	// "today" and "yesterday" are the user's days, not the server's
+	now = now.In(loc)
+
+	categories, err := s.categoryStore.GetCategoriesByUserId(userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+	// transfers follow a different flow and cannot be created through POST /transactions
+	categories = filterCategories(categories, func(c *types.Category) bool {
+		return c.TransactionTypeID != int(types.TransferTransactionType)
+	})
+
+	parsed := parseText(text, now)
+	result := &types.TransactionProposal{
+		Source:     types.ProposalSourceRules,
+		Unresolved: []string{},
+		Notes:      []string{},
+	}
+	confidence := 0.0
+
+	// account
+	account, explicit := resolveAccount(parsed.Normalized, accounts)
+	result.Proposal.AccountToken = account.Token
+	if explicit {
+		confidence += 1
+	} else {
+		// the default account is still proposed, but the AI can pick a better one
+		confidence += 0.5
+		result.Unresolved = append(result.Unresolved, fieldAccount)
+		result.Notes = append(result.Notes, fmt.Sprintf("no account mentioned, using %q", account.AccountName))
+	}
+
+	// category
+	if category := resolveCategory(parsed, categories); category != nil {
+		result.Proposal.CategoryID = category.ID
+		confidence += 1
+	} else {
+		result.Unresolved = append(result.Unresolved, fieldCategory)
+	}
+
+	// amount
+	if parsed.Amount != nil {
+		result.Proposal.Amount = *parsed.Amount
+		confidence += 1
+	} else {
+		result.Unresolved = append(result.Unresolved, fieldAmount)
+	}
+
+	// date
+	if parsed.Date != nil {
+		result.Proposal.Date = parsed.Date.Format(dateLayout)
+		confidence += 1
+	} else {
+		result.Proposal.Date = now.Format(dateLayout)
+		confidence += 0.5
+		result.Notes = append(result.Notes, "no date mentioned, using today")
+	}
+
+	// description
+	result.Proposal.Description = parsed.Merchant
+	if result.Proposal.Description == "" {
+		result.Proposal.Description = strings.TrimSpace(text)
+	}
+	if runes := []rune(result.Proposal.Description); len(runes) > maxDescriptionLen {
+		result.Proposal.Description = string(runes[:maxDescriptionLen])
+	}
+
+	if useAI && len(result.Unresolved) > 0 {
+		filled, err := s.fillWithAI(settings, text, language, now, accounts, categories, result)
+		if err != nil {
+			result.Notes = append(result.Notes, "AI fallback unavailable: "+err.Error())
+		} else {
+			confidence += filled * 0.75
+		}
+	}
+
+	// an account picked by the AI adds to the half it counted as the default
+	result.Confidence = float64(int(min(confidence/4, 1)*100)) / 100
+
+	return result, nil
+}
+
+// resolveAccount matches account names mentioned in the text. When none is mentioned
+// the first favorite account is used, falling back to the first account in the user's order.
+func resolveAccount(normalizedText string, accounts []*types.Account) (*types.Account, bool) {
+	sorted := append([]*types.Account{}, accounts...)
+	// longer names first so "Main Savings" wins over "Main"
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].AccountName) > len(sorted[j].AccountName)
+	})
+	for _, account := range sorted {
+		if containsWords(normalizedText, normalize(account.AccountName)) {
+			return account, true
+		}
+	}
+
+	for _, account := range accounts {
+		if account.IsFavorite {
+			return account, containsWords(normalizedText, "main") || containsWords(normalizedText, "principal")
+		}
+	}
+	return accounts[0], false
+}
+
+// resolveCategory scores each category: an exact name match beats a keyword match,
+// which beats a match inferred from a well known merchant
+func resolveCategory(parsed *parsedText, categories []*types.Category) *types.Category {
+	var best *types.Category
+	bestScore := 0
+
+	for _, category := range categories {
+		if parsed.Kind == kindDebit && category.TransactionTypeID != int(types.DebitTransactionType) {
+			continue
+		}
+		if parsed.Kind == kindCredit && category.TransactionTypeID != int(types.CreditTransactionType) {
+			continue
+		}
+
+		score := scoreCategory(parsed.Normalized, normalize(category.CategoryName))
+		if score > bestScore || (score == bestScore && score > 0 && len(category.CategoryName) > len(best.CategoryName)) {
+			best = category
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+func scoreCategory(text, categoryName string) int {
+	if containsWords(text, categoryName) {
+		return 3
+	}
+
+	for _, group := range categoryKeywordGroups {
+		if !groupMatches(categoryName, group) {
+			continue
+		}
+		if groupMatches(text, group) {
+			return 2
+		}
+		for merchant, canonical := range merchantCategories {
+			if canonical == group[0] && containsWords(text, merchant) {
+				return 1
+			}
+		}
+	}
+
+	return 0
+}
+
+func groupMatches(text string, group []string) bool {
+	for _, word := range group {
+		if containsWords(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterAccounts(accounts []*types.Account, keep func(*types.Account) bool) []*types.Account {
+	filtered := make([]*types.Account, 0, len(accounts))
+	for _, a := range accounts {
+		if keep(a) {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+func filterCategories(categories []*types.Category, keep func(*types.Category) bool) []*types.Category {
+	filtered := make([]*types.Category, 0, len(categories))
+	for _, c := range categories {
+		if keep(c) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+type aiProposal struct {
+	Account     *int     `json:"account"`
+	CategoryID  *int     `json:"category_id"`
+	Amount      *float64 `json:"amount"`
+	Date        *string  `json:"date"`
+	Description *string  `json:"description"`
+}
+
+// fillWithAI asks the LLM only for the fields the rules could not resolve and validates
+// every answer against the user's real data. Returns how many fields were filled.
+func (s *Store) fillWithAI(settings *types.UserSettings, text, language string, now time.Time, accounts []*types.Account, categories []*types.Category, result *types.TransactionProposal) (float64, error) {
+	redactor := privacy.NewRedactor(settings.AIPrivacyMode)
+
+	data := prompts.QuickEntryData{
+		Today: now.Format(dateLayout),
+		Text:  redactor.Sanitize(text),
+	}
+	for _, account := range accounts {
+		data.Accounts = append(data.Accounts, account.AccountName)
+	}
+	for _, category := range categories {
+		txType := "DEBIT"
+		if category.TransactionTypeID == int(types.CreditTransactionType) {
+			txType = "CREDIT"
+		}
+		data.Categories = append(data.Categories, prompts.QuickEntryCategory{ID: category.ID, Name: category.CategoryName, Type: txType})
+	}
+
+	prompt, err := prompts.Render(prompts.QuickEntry, language, data)
+	if err != nil {
+		return 0, err
+	}
+
+	message, err := s.openAiStore.GenerateGPT4Response(prompt.Text)
+	if err != nil {
+		return 0, err
+	}
+
+	var answer aiProposal
+	if err := json.Unmarshal([]byte(message), &answer); err != nil {
+		return 0, fmt.Errorf("invalid AI response: %w", err)
+	}
+
+	filled := 0.0
+	stillUnresolved := []string{}
+	for _, field := range result.Unresolved {
+		switch {
+		case field == fieldCategory && answer.CategoryID != nil && categoryExists(categories, *answer.CategoryID):
+			result.Proposal.CategoryID = *answer.CategoryID
+		case field == fieldAmount && answer.Amount != nil && *answer.Amount > 0:
+			result.Proposal.Amount = *answer.Amount
+		case field == fieldAccount && answer.Account != nil && *answer.Account >= 0 && *answer.Account < len(accounts):
+			result.Proposal.AccountToken = accounts[*answer.Account].Token
+		case field == fieldDate && answer.Date != nil && isValidDate(*answer.Date):
+			result.Proposal.Date = *answer.Date
+		default:
+			stillUnresolved = append(stillUnresolved, field)
+			continue
+		}
+		filled++
+	}
+
+	// a model summary reads better than the raw sentence when no merchant was found
+	if answer.Description != nil && *answer.Description != "" && result.Proposal.Description == strings.TrimSpace(text) && utf8.RuneCountInString(*answer.Description) <= maxDescriptionLen {
+		result.Proposal.Description = *answer.Description
+	}
+
+	result.Unresolved = stillUnresolved
+	result.Source = types.ProposalSourceRulesAI
+	result.PromptVersion = prompt.Version
+	return filled, nil
+}
+
+func categoryExists(categories []*types.Category, id int) bool {
+	for _, c := range categories {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidDate(value string) bool {
+	_, err := time.Parse(dateLayout, value)
+	return err == nil
+}
@@ -0,0 +1,144 @@
+package quick_entry
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+type mockAccountStore struct {
+	types.AccountStore
+	accounts []*types.Account
+}
+
+func (m *mockAccountStore) GetAccountsByUserId(userId int) ([]*types.Account, error) {
+	return m.accounts, nil
+}
+
+type mockCategoryStore struct {
+	types.CategoryStore
+	categories []*types.Category
+}
+
+func (m *mockCategoryStore) GetCategoriesByUserId(userId int) ([]*types.Category, error) {
+	return m.categories, nil
+}
+
+type mockOpenAIStore struct {
+	types.OpenAIStore
+	response string
+}
+
+func (m *mockOpenAIStore) GenerateGPT4Response(prompt string) (string, error) {
+	return m.response, nil
+}
+
+type mockSettingsStore struct {
+	types.SettingsStore
+	timezone string
+}
+
+func (m *mockSettingsStore) GetSettingsByUserId(userId int) (*types.UserSettings, error) {
+	return &types.UserSettings{UserID: userId, AIPrivacyMode: types.AIPrivacyModeOff, Timezone: m.timezone}, nil
+}
+
+func newTestStore(aiResponse string) *Store {
+	return newTestStoreWith(aiResponse, &mockSettingsStore{})
+}
+
+func newTestStoreWith(aiResponse string, settings *mockSettingsStore) *Store {
+	return NewStore(
+		&mockAccountStore{accounts: []*types.Account{
+			// shared with the user, who can only read it
+			{Token: "family", AccountName: "Família", Role: types.AccountRoleViewer, IsFavorite: true},
+			{Token: "main", AccountName: "Conta Principal", Role: types.AccountRoleOwner},
+			{Token: "savings", AccountName: "Poupança", Role: types.AccountRoleEditor},
+		}},
+		&mockCategoryStore{categories: []*types.Category{
+			{ID: 1, CategoryName: "Supermercado", TransactionTypeID: int(types.DebitTransactionType)},
+		}},
+		&mockOpenAIStore{response: aiResponse},
+		settings,
+	)
+}
+
+func TestProposeLetsAIPickUnmentionedAccount(t *testing.T) {
+	store := newTestStore(`{"account": 1}`)
+
+	proposal, err := store.ProposeTransaction(1, "spent 12€ at Continente today", "en", true, referenceNow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if proposal.Proposal.AccountToken != "savings" {
+		t.Errorf("expected the account picked by the AI, got %q", proposal.Proposal.AccountToken)
+	}
+	if len(proposal.Unresolved) != 0 {
+		t.Errorf("expected nothing left unresolved, got %v", proposal.Unresolved)
+	}
+	if proposal.Confidence > 1 {
+		t.Errorf("expected the confidence to stay at most 1, got %v", proposal.Confidence)
+	}
+}
+
+func TestProposeFlagsUnmentionedAccount(t *testing.T) {
+	store := newTestStore("")
+
+	proposal, err := store.ProposeTransaction(1, "spent 12€ at Continente today", "en", false, referenceNow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if proposal.Proposal.AccountToken != "main" {
+		t.Errorf("expected the first account as the default, got %q", proposal.Proposal.AccountToken)
+	}
+	if len(proposal.Unresolved) != 1 || proposal.Unresolved[0] != fieldAccount {
+		t.Errorf("expected only the account to be unresolved, got %v", proposal.Unresolved)
+	}
+}
+
+func TestProposeCutsDescriptionByCharacters(t *testing.T) {
+	store := newTestStore("")
+
+	proposal, err := store.ProposeTransaction(1, strings.Repeat("ã", 300), "en", false, referenceNow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	description := proposal.Proposal.Description
+	if !utf8.ValidString(description) {
+		t.Fatalf("expected a valid UTF-8 description")
+	}
+	if count := utf8.RuneCountInString(description); count != maxDescriptionLen {
+		t.Errorf("expected %d characters, got %d", maxDescriptionLen, count)
+	}
+}
+
+func TestProposeSkipsAccountsTheUserCantEdit(t *testing.T) {
+	store := newTestStore("")
+
+	proposal, err := store.ProposeTransaction(1, "spent 12€ at Continente from familia", "en", false, referenceNow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if proposal.Proposal.AccountToken != "main" {
+		t.Errorf("expected an account the user can edit, got %q", proposal.Proposal.AccountToken)
+	}
+}
+
+func TestProposeUsesTheUsersToday(t *testing.T) {
+	// already the next day there while it is the afternoon in UTC
+	store := newTestStoreWith("", &mockSettingsStore{timezone: "Pacific/Kiritimati"})
+
+	proposal, err := store.ProposeTransaction(1, "spent 12€ at Continente", "en", false, referenceNow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if proposal.Proposal.Date != "2025-03-13" {
+		t.Errorf("expected the date in the user's timezone, got %q", proposal.Proposal.Date)
+	}
+}
@@ -0,0 +1,258 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const (
+	authCookieName    = "authToken"
+	refreshCookieName = "refreshToken"
+	// the refresh token is only ever needed by the /auth endpoints
+	refreshCookiePath = "/api/v1/auth"
+)
+
+type Handler struct {
+	store types.SessionStore
+}
+
+func NewHandler(store types.SessionStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/auth/refresh", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodPost: h.Refresh,
+	}))
+	router.HandleFunc("/auth/logout", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.Logout,
+		}),
+	))
+	router.HandleFunc("/auth/sessions", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet:    h.GetSessions,
+			http.MethodDelete: h.RevokeOtherSessions,
+		}),
+	))
+	router.HandleFunc("/auth/sessions/{id}", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodDelete: h.RevokeSession,
+		}),
+	))
+}
+
+// StartSession opens a session for a user that just authenticated and writes the tokens,
+// it reports whether the session was issued
+func StartSession(w http.ResponseWriter, r *http.Request, store types.SessionStore, userId int) bool {
+	session, refreshToken, err := store.CreateSession(userId, r.UserAgent(), middleware.GetClientIP(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	return writeTokens(w, r, session, refreshToken)
+}
+
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	// browsers send the HTTP-only cookie, other clients send the token in the body
+	var refreshToken string
+	if cookie, err := r.Cookie(refreshCookieName); err == nil && cookie.Value != "" {
+		refreshToken = cookie.Value
+	} else {
+		var payload types.RefreshTokenPayload
+		if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+			return
+		}
+		refreshToken = payload.RefreshToken
+	}
+
+	session, newRefreshToken, err := h.store.RotateRefreshToken(refreshToken, r.UserAgent(), middleware.GetClientIP(r))
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			ClearCookies(w, r)
+			utils.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeTokens(w, r, session, newRefreshToken)
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	// require a login session, access tokens can't see or manage sessions
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+	sessionId, ok := middleware.GetSessionIDFromContext(r)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New(middleware.ErrUserNotAuthenticated))
+		return
+	}
+
+	if err := h.store.RevokeSession(sessionId, userId); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ClearCookies(w, r)
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	// require a login session, access tokens can't see or manage sessions
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+	currentSessionId, _ := middleware.GetSessionIDFromContext(r)
+
+	sessions, err := h.store.GetActiveSessionsByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionId
+	}
+
+	response := map[string]interface{}{
+		"sessions": sessions,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	// require a login session, access tokens can't see or manage sessions
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// extract session ID from URL path (/auth/sessions/{id})
+	sessionId, ok := middleware.ExtractPathParamAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	if err := h.store.RevokeSession(sessionId, userId); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// RevokeOtherSessions logs out every device except the one making the request
+func (h *Handler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	// require a login session, access tokens can't see or manage sessions
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+	currentSessionId, _ := middleware.GetSessionIDFromContext(r)
+
+	if err := h.store.RevokeOtherSessions(userId, currentSessionId); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func writeTokens(w http.ResponseWriter, r *http.Request, session *types.Session, refreshToken string) bool {
+	token, err := setSessionCookies(w, r, session, refreshToken)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	utils.WriteJson(w, http.StatusOK, types.AuthTokens{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    config.Envs.JWTExpirationInSeconds,
+	})
+	return true
+}
+
+// StartSessionAndRedirect is StartSession for browser redirects, like the end of an
+// external login, where the tokens can only travel in the cookies
+func StartSessionAndRedirect(w http.ResponseWriter, r *http.Request, store types.SessionStore, userId int, redirectUrl string) {
+	session, refreshToken, err := store.CreateSession(userId, r.UserAgent(), middleware.GetClientIP(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if _, err := setSessionCookies(w, r, session, refreshToken); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, redirectUrl, http.StatusFound)
+}
+
+// setSessionCookies issues the access token and stores both tokens in HTTP-only cookies
+func setSessionCookies(w http.ResponseWriter, r *http.Request, session *types.Session, refreshToken string) (string, error) {
+	secret := []byte(config.Envs.JWTSecret)
+	token, err := auth.CreateJWT(secret, session.UserID, session.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+
+	isSecure := r.TLS != nil
+	sessionExpiration := int(config.Envs.RefreshTokenExpirationInSeconds)
+
+	// The frontend only uses this cookie to know a session exists, so it lives as long
+	// as the session. The token inside still expires with the JWT.
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   isSecure,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   sessionExpiration,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    refreshToken,
+		Path:     refreshCookiePath,
+		HttpOnly: true,
+		Secure:   isSecure,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   sessionExpiration,
+	})
+
+	return token, nil
+}
+
+// ClearCookies removes the auth cookies from the browser
+func ClearCookies(w http.ResponseWriter, r *http.Request) {
+	for _, cookie := range []struct{ name, path string }{
+		{authCookieName, "/"},
+		{refreshCookieName, refreshCookiePath},
+	} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookie.name,
+			Value:    "",
+			Path:     cookie.path,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+			MaxAge:   -1,
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package session
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const (
+	refreshTokenBytes = 32
+	maxUserAgentLen   = 255
+)
+
+var ErrInvalidRefreshToken = fmt.Errorf("invalid or expired refresh token")
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+const sessionColumns = `
+    id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at
+`
+
+// CreateSession opens a new session and returns it with its first refresh token.
+// Only the hash of the refresh token is stored.
+func (s *Store) CreateSession(userId int, userAgent, ipAddress string) (*types.Session, string, error) {
+	sessionId, err := utils.GenerateToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+	refreshToken, err := utils.GenerateToken(refreshTokenBytes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, err = db.ExecWithValidation(s.db,
+		`INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip_address, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		sessionId, userId, hashToken(refreshToken), truncate(userAgent, maxUserAgentLen), ipAddress, refreshExpiry())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	session, err := s.getSessionById(sessionId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one. Presenting a token that
+// was already rotated means it leaked, so the whole session is revoked.
+func (s *Store) RotateRefreshToken(refreshToken, userAgent, ipAddress string) (*types.Session, string, error) {
+	tokenHash := hashToken(refreshToken)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var sessionId, currentHash string
+	var revoked bool
+	var expiresAt time.Time
+	err = tx.QueryRow(
+		`SELECT id, refresh_token_hash, revoked_at IS NOT NULL, expires_at FROM sessions
+		 WHERE refresh_token_hash = $1 OR previous_refresh_token_hash = $1
+		 FOR UPDATE`,
+		tokenHash,
+	).Scan(&sessionId, &currentHash, &revoked, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", ErrInvalidRefreshToken
+		}
+		return nil, "", err
+	}
+
+	if revoked || time.Now().After(expiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if currentHash != tokenHash {
+		if _, err := tx.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1", sessionId); err != nil {
+			return nil, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	newToken, err := utils.GenerateToken(refreshTokenBytes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE sessions SET
+			previous_refresh_token_hash = refresh_token_hash,
+			refresh_token_hash = $1,
+			user_agent = $2,
+			ip_address = $3,
+			last_used_at = CURRENT_TIMESTAMP,
+			expires_at = $4
+		 WHERE id = $5`,
+		hashToken(newToken), truncate(userAgent, maxUserAgentLen), ipAddress, refreshExpiry(), sessionId)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+
+	session, err := s.getSessionById(sessionId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, newToken, nil
+}
+
+func (s *Store) IsSessionActive(sessionId string, userId int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(
+		`SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		 )`,
+		sessionId, userId,
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (s *Store) GetActiveSessionsByUserId(userId int) ([]*types.Session, error) {
+	query := fmt.Sprintf(`SELECT %s FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_used_at DESC`, sessionColumns)
+	return db.QueryList(s.db, query, scanRowsIntoSession, userId)
+}
+
+func (s *Store) RevokeSession(sessionId string, userId int) error {
+	result, err := db.ExecWithValidation(s.db,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		sessionId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("session not found")
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions logs the user out of every device except the current one
+func (s *Store) RevokeOtherSessions(userId int, keepSessionId string) error {
+	_, err := db.ExecWithValidation(s.db,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL",
+		userId, keepSessionId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) getSessionById(sessionId string) (*types.Session, error) {
+	query := fmt.Sprintf(`SELECT %s FROM sessions WHERE id = $1`, sessionColumns)
+	return db.QuerySingle(s.db, query, scanRowIntoSession, sessionId)
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func refreshExpiry() time.Time {
+	return time.Now().Add(time.Second * time.Duration(config.Envs.RefreshTokenExpirationInSeconds))
+}
+
+func truncate(value string, maxLen int) string {
+	if len(value) > maxLen {
+		return value[:maxLen]
+	}
+	return value
+}
+
+func scanRowIntoSession(row *sql.Row) (*types.Session, error) {
+	session := new(types.Session)
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func scanRowsIntoSession(rows *sql.Rows) (*types.Session, error) {
+	session := new(types.Session)
+	err := rows.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
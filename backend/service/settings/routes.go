@@ -0,0 +1,133 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/prompts"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+type Handler struct {
+	store types.SettingsStore
+}
+
+func NewHandler(store types.SettingsStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/settings", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.GetSettings,
+			http.MethodPut: h.UpdateSettings,
+		}),
+	))
+}
+
+func (h *Handler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	settings, err := h.store.GetSettingsByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"settings": settings,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func (h *Handler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.UpdateSettingsPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	settings, err := h.store.GetSettingsByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := applySettingsPayload(settings, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	settings, err = h.store.UpdateSettings(settings, audit.Origin(r))
+	if err != nil {
+		if errors.Is(err, ErrDefaultAccountNotFound) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(w, authz.StatusCode(err), err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"settings": settings,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+// applySettingsPayload copies the payload over the current settings, preferences left out keep their value
+func applySettingsPayload(settings *types.UserSettings, payload *types.UpdateSettingsPayload) error {
+	if payload.AIPrivacyMode != nil {
+		settings.AIPrivacyMode = *payload.AIPrivacyMode
+	}
+	if payload.AIAggregatesOnly != nil {
+		settings.AIAggregatesOnly = *payload.AIAggregatesOnly
+	}
+	if payload.Timezone != nil {
+		if _, err := utils.LoadLocation(*payload.Timezone); err != nil {
+			return err
+		}
+		settings.Timezone = *payload.Timezone
+	}
+	if payload.Locale != nil {
+		settings.Locale = *payload.Locale
+	}
+	if payload.BaseCurrency != nil {
+		settings.BaseCurrency = *payload.BaseCurrency
+	}
+	if payload.WeekStart != nil {
+		settings.WeekStart = *payload.WeekStart
+	}
+	if payload.NumberFormat != nil {
+		settings.NumberFormat = *payload.NumberFormat
+	}
+	if payload.DefaultAccountToken != nil {
+		settings.DefaultAccountToken = *payload.DefaultAccountToken
+	}
+	if payload.AILanguage != nil {
+		// empty goes back to the language of the locale
+		if *payload.AILanguage != "" && !slices.Contains(prompts.SupportedLanguages, *payload.AILanguage) {
+			return fmt.Errorf("ai language must be one of %s", strings.Join(prompts.SupportedLanguages, ", "))
+		}
+		settings.AILanguage = *payload.AILanguage
+	}
+
+	return nil
+}
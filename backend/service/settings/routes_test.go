@@ -0,0 +1,39 @@
+package settings
+
+import (
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func TestApplySettingsPayloadKeepsMissingSettings(t *testing.T) {
+	settings := types.DefaultUserSettings(1)
+	settings.AIPrivacyMode = types.AIPrivacyModeRedact
+	settings.AIAggregatesOnly = true
+
+	timezone := "Europe/Lisbon"
+	if err := applySettingsPayload(settings, &types.UpdateSettingsPayload{Timezone: &timezone}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if settings.Timezone != timezone {
+		t.Errorf("expected the timezone to change, got %q", settings.Timezone)
+	}
+	if settings.AIPrivacyMode != types.AIPrivacyModeRedact || !settings.AIAggregatesOnly {
+		t.Errorf("expected the privacy settings to be kept, got %q and %v", settings.AIPrivacyMode, settings.AIAggregatesOnly)
+	}
+}
+
+func TestApplySettingsPayloadValidatesAILanguage(t *testing.T) {
+	settings := types.DefaultUserSettings(1)
+
+	unsupported := "fr"
+	if err := applySettingsPayload(settings, &types.UpdateSettingsPayload{AILanguage: &unsupported}); err == nil {
+		t.Error("expected an unsupported language to be rejected")
+	}
+
+	portuguese := "pt-PT"
+	if err := applySettingsPayload(settings, &types.UpdateSettingsPayload{AILanguage: &portuguese}); err != nil || settings.AILanguage != portuguese {
+		t.Errorf("expected the language to change, got %q (%v)", settings.AILanguage, err)
+	}
+}
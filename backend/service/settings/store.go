@@ -0,0 +1,140 @@
+package settings
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+type Store struct {
+	db     *sql.DB
+	policy *authz.Policy
+}
+
+func NewStore(db *sql.DB, policy *authz.Policy) *Store {
+	return &Store{
+		db:     db,
+		policy: policy,
+	}
+}
+
+var ErrDefaultAccountNotFound = fmt.Errorf("default account not found")
+
+const settingsColumns = `
+    user_id, ai_privacy_mode, ai_aggregates_only, timezone, locale, base_currency, week_start,
+    number_format, COALESCE(default_account_token, ''), ai_language, created_at, updated_at
+`
+
+// GetSettingsByUserId returns the stored settings, or the defaults if the user never saved any
+func (s *Store) GetSettingsByUserId(userId int) (*types.UserSettings, error) {
+	return getSettings(s.db, userId)
+}
+
+func getSettings(q db.Querier, userId int) (*types.UserSettings, error) {
+	query := fmt.Sprintf(`SELECT %s FROM user_settings WHERE user_id = $1`, settingsColumns)
+	settings, err := db.QuerySingle(q, query, scanRowIntoSettings, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.DefaultUserSettings(userId), nil
+		}
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (s *Store) UpdateSettings(settings *types.UserSettings, origin *types.AuditOrigin) (*types.UserSettings, error) {
+	// transactions go to the default account, so the user has to be able to record them there
+	var defaultAccount *string
+	if settings.DefaultAccountToken != "" {
+		if err := s.policy.CanEditAccount(settings.UserID, settings.DefaultAccountToken); err != nil {
+			if errors.Is(err, authz.ErrNotFound) {
+				return nil, ErrDefaultAccountNotFound
+			}
+			return nil, err
+		}
+		defaultAccount = &settings.DefaultAccountToken
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	previous, err := getSettings(tx, settings.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO user_settings (user_id, ai_privacy_mode, ai_aggregates_only, timezone, locale,
+			base_currency, week_start, number_format, default_account_token, ai_language)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 ON CONFLICT (user_id) DO UPDATE SET
+			ai_privacy_mode = EXCLUDED.ai_privacy_mode,
+			ai_aggregates_only = EXCLUDED.ai_aggregates_only,
+			timezone = EXCLUDED.timezone,
+			locale = EXCLUDED.locale,
+			base_currency = EXCLUDED.base_currency,
+			week_start = EXCLUDED.week_start,
+			number_format = EXCLUDED.number_format,
+			default_account_token = EXCLUDED.default_account_token,
+			ai_language = EXCLUDED.ai_language,
+			updated_at = CURRENT_TIMESTAMP`,
+		settings.UserID, settings.AIPrivacyMode, settings.AIAggregatesOnly, settings.Timezone, settings.Locale,
+		settings.BaseCurrency, settings.WeekStart, settings.NumberFormat, defaultAccount, settings.AILanguage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save settings: %w", err)
+	}
+
+	updated, err := getSettings(tx, settings.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := audit.Record(tx, origin, types.AuditChange{
+		UserID:     settings.UserID,
+		EntityType: types.AuditEntitySettings,
+		EntityID:   strconv.Itoa(settings.UserID),
+		Action:     types.AuditActionUpdate,
+		Before:     previous,
+		After:      updated,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func scanRowIntoSettings(row *sql.Row) (*types.UserSettings, error) {
+	st := new(types.UserSettings)
+	err := row.Scan(
+		&st.UserID,
+		&st.AIPrivacyMode,
+		&st.AIAggregatesOnly,
+		&st.Timezone,
+		&st.Locale,
+		&st.BaseCurrency,
+		&st.WeekStart,
+		&st.NumberFormat,
+		&st.DefaultAccountToken,
+		&st.AILanguage,
+		&st.CreatedAt,
+		&st.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
@@ -6,6 +6,8 @@ import (
 	"strconv"
 
 	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
 	"github.com/lucas-remigio/wallet-tracker/types"
 	"github.com/lucas-remigio/wallet-tracker/utils"
 )
@@ -23,8 +25,10 @@ func (h *Handler) RegisterRoutes(router *http.ServeMux) {
 	router.HandleFunc("/transactions/dto/", middleware.AuthMiddleware(h.GetTransactionsDTOByAccountToken))
 	router.HandleFunc("/transactions/statistics/", middleware.AuthMiddleware(h.GetTransactionStatistics))
 	router.HandleFunc("/transactions/", middleware.AuthMiddleware(h.GetTransactionsByAccountToken))
+	// the pattern also matches /transactions/{token}, so listing an account's transactions goes through it
 	router.HandleFunc("/transactions/{id}", middleware.AuthMiddleware(
 		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet:    h.GetTransactionsByAccountToken,
 			http.MethodPut:    h.UpdateTransaction,
 			http.MethodDelete: h.DeleteTransaction,
 		})))
@@ -39,7 +43,7 @@ func (h *Handler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// require authentication
-	userId, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireScope(w, r, types.ScopeTransactionsWrite)
 	if !ok {
 		return
 	}
@@ -51,10 +55,10 @@ func (h *Handler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 		CategoryId:   payload.CategoryID,
 		Description:  payload.Description,
 		Date:         payload.Date,
-	}, userId)
+	}, userId, audit.Origin(r))
 
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -63,7 +67,7 @@ func (h *Handler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) GetTransactionsByAccountToken(w http.ResponseWriter, r *http.Request) {
 	// require authentication
-	_, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireAuth(w, r)
 	if !ok {
 		return
 	}
@@ -75,9 +79,9 @@ func (h *Handler) GetTransactionsByAccountToken(w http.ResponseWriter, r *http.R
 	}
 
 	// get transactions by account token
-	transactions, err := h.store.GetTransactionsByAccountToken(accountToken, nil, nil)
+	transactions, err := h.store.GetTransactionsByAccountToken(userId, accountToken, nil, nil)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -90,7 +94,7 @@ func (h *Handler) GetTransactionsByAccountToken(w http.ResponseWriter, r *http.R
 
 func (h *Handler) GetTransactionsDTOByAccountToken(w http.ResponseWriter, r *http.Request) {
 	// require authentication
-	_, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireAuth(w, r)
 	if !ok {
 		return
 	}
@@ -121,9 +125,9 @@ func (h *Handler) GetTransactionsDTOByAccountToken(w http.ResponseWriter, r *htt
 	}
 
 	// Always return grouped transactions (with optional month/year filter)
-	transactions, err := h.store.GetTransactionsDTOByAccountToken(accountToken, month, year)
+	transactions, err := h.store.GetTransactionsDTOByAccountToken(userId, accountToken, month, year)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -136,7 +140,7 @@ func (h *Handler) GetTransactionsDTOByAccountToken(w http.ResponseWriter, r *htt
 
 func (h *Handler) GetTransactionsMonthsAndYears(w http.ResponseWriter, r *http.Request) {
 	// require authentication
-	_, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireAuth(w, r)
 	if !ok {
 		return
 	}
@@ -148,9 +152,9 @@ func (h *Handler) GetTransactionsMonthsAndYears(w http.ResponseWriter, r *http.R
 	}
 
 	// get transactions months and years by account token
-	months, err := h.store.GetAvailableTransactionMonthsByAccountToken(accountToken)
+	months, err := h.store.GetAvailableTransactionMonthsByAccountToken(userId, accountToken)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -175,7 +179,7 @@ func (h *Handler) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// require authentication
-	userId, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireScope(w, r, types.ScopeTransactionsWrite)
 	if !ok {
 		return
 	}
@@ -186,10 +190,10 @@ func (h *Handler) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
 		CategoryID:  payload.CategoryID,
 		Description: payload.Description,
 		Date:        payload.Date,
-	}, userId)
+	}, userId, audit.Origin(r))
 
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -204,14 +208,15 @@ func (h *Handler) DeleteTransaction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// require authentication
-	userId, ok := middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireScope(w, r, types.ScopeTransactionsWrite)
 	if !ok {
 		return
 	}
 
-	response, err := h.store.DeleteTransactionAndReturn(transactionIdInt, userId)
+	// the deleted transaction is returned with the balance the account is left with
+	response, err := h.store.DeleteTransactionAndReturn(transactionIdInt, userId, audit.Origin(r))
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
@@ -226,7 +231,7 @@ func (h *Handler) GetTransactionStatistics(w http.ResponseWriter, r *http.Reques
 	}
 
 	// require authentication
-	_, ok = middleware.RequireAuth(w, r)
+	userId, ok := middleware.RequireAuth(w, r)
 	if !ok {
 		return
 	}
@@ -247,9 +252,9 @@ func (h *Handler) GetTransactionStatistics(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Get statistics from store
-	statistics, err := h.store.GetTransactionStatistics(accountToken, month, year)
+	statistics, err := h.store.GetTransactionStatistics(userId, accountToken, month, year)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, authz.StatusCode(err), err)
 		return
 	}
 
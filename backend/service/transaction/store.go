@@ -4,9 +4,13 @@ import (
 	"database/sql"
 	"fmt"
 	"sort"
+	"strconv"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
 	"github.com/lucas-remigio/wallet-tracker/service/category"
 	"github.com/lucas-remigio/wallet-tracker/types"
 	"github.com/lucas-remigio/wallet-tracker/utils"
@@ -15,19 +19,21 @@ import (
 type Store struct {
 	db           *sql.DB
 	accountStore types.AccountStore
+	policy       *authz.Policy
 }
 
-func NewStore(db *sql.DB, accountStore types.AccountStore) *Store {
+func NewStore(db *sql.DB, accountStore types.AccountStore, policy *authz.Policy) *Store {
 	return &Store{
 		db:           db,
 		accountStore: accountStore,
+		policy:       policy,
 	}
 }
 
 // Scanner functions for use with db utilities
 func scanTransaction(rows *sql.Rows) (*types.Transaction, error) {
 	t := new(types.Transaction)
-	err := rows.Scan(&t.ID, &t.AccountToken, &t.CategoryId, &t.Amount, &t.Description, &t.Date, &t.Balance, &t.CreatedAt)
+	err := rows.Scan(&t.ID, &t.AccountToken, &t.CategoryId, &t.Amount, &t.Description, &t.Date, &t.Balance, &t.CreatedAt, &t.CreatedBy)
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +42,7 @@ func scanTransaction(rows *sql.Rows) (*types.Transaction, error) {
 
 func scanTransactionRow(row *sql.Row) (*types.Transaction, error) {
 	t := new(types.Transaction)
-	err := row.Scan(&t.ID, &t.AccountToken, &t.CategoryId, &t.Amount, &t.Description, &t.Date, &t.Balance, &t.CreatedAt)
+	err := row.Scan(&t.ID, &t.AccountToken, &t.CategoryId, &t.Amount, &t.Description, &t.Date, &t.Balance, &t.CreatedAt, &t.CreatedBy)
 	if err != nil {
 		return nil, err
 	}
@@ -53,8 +59,8 @@ func scanTransactionDTOFromScanner(s scanner) (*types.TransactionDTO, error) {
 	t.Category.TransactionType = &types.TransactionType{}
 
 	err := s.Scan(
-		&t.ID, &t.AccountToken, &t.Amount, &t.Description, &t.Date, &t.Balance, &t.CreatedAt,
-		&t.Category.ID, &t.Category.CategoryName, &t.Category.Color, &t.Category.CreatedAt, &t.Category.UpdatedAt,
+		&t.ID, &t.AccountToken, &t.Amount, &t.Description, &t.Date, &t.Balance, &t.CreatedAt, &t.CreatedBy, &t.DeletedAt,
+		&t.Category.ID, &t.Category.CategoryName, &t.Category.Color, &t.Category.ParentID, &t.Category.Icon, &t.Category.CreatedAt, &t.Category.UpdatedAt,
 		&t.Category.TransactionType.ID, &t.Category.TransactionType.TypeName, &t.Category.TransactionType.TypeSlug,
 	)
 	if err != nil {
@@ -73,7 +79,12 @@ func scanTransactionDTO(row *sql.Row) (*types.TransactionDTO, error) {
 	return scanTransactionDTOFromScanner(row)
 }
 
-func (s *Store) CreateTransaction(transaction *types.Transaction, userId int) (*types.Transaction, error) {
+func (s *Store) CreateTransactionAndReturn(transaction *types.Transaction, userId int, origin *types.AuditOrigin) (*types.TransactionChangeResponse, error) {
+	// viewers of a shared account can't record transactions
+	if err := s.policy.CanEditAccount(userId, transaction.AccountToken); err != nil {
+		return nil, err
+	}
+
 	catStore := category.NewStore(s.db)
 	category, err := catStore.GetCategoryById(transaction.CategoryId, userId)
 	if err != nil {
@@ -85,89 +96,84 @@ func (s *Store) CreateTransaction(transaction *types.Transaction, userId int) (*
 		return nil, fmt.Errorf("transfers are not allowed here")
 	}
 
-	account, err := s.accountStore.GetAccountByToken(transaction.AccountToken, userId)
+	loc, err := s.accountLocation(transaction.AccountToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account: %w", err)
+		return nil, err
 	}
 
-	// check if the user is the owner of the account
-	if err := db.ValidateOwnership(account.UserID, userId, "account"); err != nil {
+	tx, err := s.db.Begin()
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	// category transaction type id == 1 means credit
-	// if category.TransactionTypeID == 2 means debit
-	amount := transaction.Amount
-	if category.TransactionTypeID == (int)(types.DebitTransactionType) {
-		amount = amount * -1
+	// update user account balance, the transaction keeps the balance it leaves
+	var newBalance float64
+	err = tx.QueryRow("UPDATE accounts SET balance = balance + $1 WHERE token = $2 AND deleted_at IS NULL RETURNING balance",
+		balanceEffect(transaction.Amount, category.TransactionTypeID), transaction.AccountToken).Scan(&newBalance)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account %w", authz.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to update account balance: %w", err)
 	}
-	newBalance := account.Balance + amount
 
 	var insertedId int
-	err = s.db.QueryRow(
-		"INSERT INTO transactions (account_token, category_id, amount, description, date, balance) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+	err = tx.QueryRow(
+		"INSERT INTO transactions (account_token, category_id, amount, description, date, balance, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
 		transaction.AccountToken,
 		transaction.CategoryId,
 		transaction.Amount,
 		transaction.Description,
-		transaction.Date,
+		transactionDate(transaction.Date, loc),
 		newBalance,
+		userId,
 	).Scan(&insertedId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create transaction: %w", err)
 	}
 
-	// update user account balance
-	_, err = db.ExecWithValidation(s.db, "UPDATE accounts SET balance = $1 WHERE token = $2", newBalance, transaction.AccountToken)
+	createdDTO, err := getTransactionDTO(tx, insertedId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update account balance: %w", err)
+		return nil, fmt.Errorf("failed to get created transaction DTO: %w", err)
 	}
 
-	transaction.ID = insertedId
-	transaction.Balance = newBalance
-
-	return transaction, nil
-}
+	if err := audit.Record(tx, origin, transactionChange(userId, types.AuditActionCreate, nil, createdDTO)); err != nil {
+		return nil, err
+	}
 
-func (s *Store) CreateTransactionAndReturn(transaction *types.Transaction, userId int) (*types.TransactionChangeResponse, error) {
-	createdTransaction, err := s.CreateTransaction(transaction, userId)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	createdDTO, err := s.GetTransactionDTOById(createdTransaction.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get created transaction DTO: %w", err)
+	return s.changeResponse(userId, createdDTO)
+}
+
+func (s *Store) GetTransactionsByAccountToken(userId int, accountToken string, month, year *int) ([]*types.Transaction, error) {
+	if err := s.policy.CanReadAccount(userId, accountToken); err != nil {
+		return nil, err
 	}
 
-	// Get available months for the account token
-	availableMonths, err := s.GetAvailableTransactionMonthsByAccountToken(createdTransaction.AccountToken)
+	loc, err := s.accountLocation(accountToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get available months: %w", err)
+		return nil, err
 	}
 
-	return &types.TransactionChangeResponse{
-		Transaction:    createdDTO,
-		AccountBalance: &createdDTO.Balance,
-		Months:         availableMonths,
-	}, nil
-}
-
-func (s *Store) GetTransactionsByAccountToken(accountToken string, month, year *int) ([]*types.Transaction, error) {
 	var query string
 	var args []interface{}
 
 	baseQuery := `
-        SELECT id, account_token, category_id, amount, description, date, balance, created_at 
+        SELECT id, account_token, category_id, amount, description, date, balance, created_at, created_by
         FROM transactions 
-        WHERE account_token = $1`
+        WHERE account_token = $1 AND deleted_at IS NULL`
 
 	args = append(args, accountToken)
 
 	if month != nil && year != nil {
-		query = baseQuery + " AND EXTRACT(MONTH FROM date) = $2 AND EXTRACT(YEAR FROM date) = $3" +
+		start, end := monthRange(*month, *year, loc)
+		query = baseQuery + " AND date >= $2 AND date < $3" +
 			" ORDER BY date DESC, id DESC"
-		args = append(args, *month, *year)
+		args = append(args, start, end)
 	} else {
 		query = baseQuery + " ORDER BY date DESC, id DESC"
 	}
@@ -175,25 +181,35 @@ func (s *Store) GetTransactionsByAccountToken(accountToken string, month, year *
 	return db.QueryList(s.db, query, scanTransaction, args...)
 }
 
-func (s *Store) GetTransactionsDTOByAccountToken(accountToken string, month, year *int) ([]*types.TransactionDTO, error) {
+func (s *Store) GetTransactionsDTOByAccountToken(userId int, accountToken string, month, year *int) ([]*types.TransactionDTO, error) {
+	if err := s.policy.CanReadAccount(userId, accountToken); err != nil {
+		return nil, err
+	}
+
+	loc, err := s.accountLocation(accountToken)
+	if err != nil {
+		return nil, err
+	}
+
 	var query string
 	var args []interface{}
 
 	baseQuery := "SELECT " +
-		"t.id, t.account_token, t.amount, t.description, t.date, t.balance, t.created_at, " +
-		"c.id, c.category_name, c.color, c.created_at, c.updated_at, " +
+		"t.id, t.account_token, t.amount, t.description, t.date, t.balance, t.created_at, t.created_by, t.deleted_at, " +
+		"c.id, c.category_name, c.color, c.parent_id, c.icon, c.created_at, c.updated_at, " +
 		"tt.id, tt.type_name, tt.type_slug " +
 		"FROM transactions t " +
 		"JOIN categories c ON t.category_id = c.id " +
 		"JOIN transaction_types tt ON c.transaction_type_id = tt.id " +
-		"WHERE t.account_token = $1 "
+		"WHERE t.account_token = $1 AND t.deleted_at IS NULL "
 
 	args = append(args, accountToken)
 
 	if month != nil && year != nil {
-		query = baseQuery + "AND EXTRACT(MONTH FROM t.date) = $2 AND EXTRACT(YEAR FROM t.date) = $3 " +
+		start, end := monthRange(*month, *year, loc)
+		query = baseQuery + "AND t.date >= $2 AND t.date < $3 " +
 			"ORDER BY t.date DESC, t.id DESC"
-		args = append(args, *month, *year)
+		args = append(args, start, end)
 	} else {
 		query = baseQuery + "ORDER BY t.date DESC, t.id DESC"
 	}
@@ -201,214 +217,238 @@ func (s *Store) GetTransactionsDTOByAccountToken(accountToken string, month, yea
 	return db.QueryList(s.db, query, scanTransactionsDTOs, args...)
 }
 
-func (s *Store) GetTransactionDTOById(id int) (*types.TransactionDTO, error) {
+func (s *Store) GetTransactionDTOById(userId int, id int) (*types.TransactionDTO, error) {
+	if _, err := s.policy.CanReadTransaction(userId, id); err != nil {
+		return nil, err
+	}
+
+	return getTransactionDTO(s.db, id)
+}
+
+// getTransactionDTO reads a transaction without checks, callers go through the policy first
+func getTransactionDTO(q db.Querier, id int) (*types.TransactionDTO, error) {
 	query := `
 		SELECT 
-			t.id, t.account_token, t.amount, t.description, t.date, t.balance, t.created_at,
-			c.id, c.category_name, c.color, c.created_at, c.updated_at,
+			t.id, t.account_token, t.amount, t.description, t.date, t.balance, t.created_at, t.created_by, t.deleted_at,
+			c.id, c.category_name, c.color, c.parent_id, c.icon, c.created_at, c.updated_at,
 			tt.id, tt.type_name, tt.type_slug
 		FROM transactions t
 		JOIN categories c ON t.category_id = c.id
 		JOIN transaction_types tt ON c.transaction_type_id = tt.id
 		WHERE t.id = $1`
 
-	return db.QuerySingle(s.db, query, scanTransactionDTO, id)
-}
-
-func (s *Store) GetTransactionById(id int) (*types.Transaction, error) {
-	query := "SELECT id, account_token, category_id, amount, description, date, balance, created_at FROM transactions WHERE id = $1"
-	return db.QuerySingle(s.db, query, scanTransactionRow, id)
+	return db.QuerySingle(q, query, scanTransactionDTO, id)
 }
 
-func (s *Store) UpdateTransaction(transaction *types.UpdateTransactionPayload, userId int) (*types.Transaction, error) {
-	// get the current transaction before the update
-	tx, err := s.GetTransactionById(transaction.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get transaction: %w", err)
+func (s *Store) UpdateTransactionAndReturn(payload *types.UpdateTransactionPayload, userId int, origin *types.AuditOrigin) (*types.TransactionChangeResponse, error) {
+	// viewers of a shared account can't change transactions
+	if _, err := s.policy.CanEditTransaction(userId, payload.ID); err != nil {
+		return nil, err
 	}
 
-	// get the account
-	account, err := s.accountStore.GetAccountByToken(tx.AccountToken, userId)
+	catStore := category.NewStore(s.db)
+	newCategory, err := catStore.GetCategoryById(payload.CategoryID, userId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account: %w", err)
+		return nil, fmt.Errorf("failed to get new category: %w", err)
 	}
 
-	// check if the user is the owner of the account
-	if err := db.ValidateOwnership(account.UserID, userId, "account"); err != nil {
+	tx, err := s.db.Begin()
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	// there are a lot of things that can happen here
-	// most simple case: from credit to credit. if it was 100 and now is 130, we add 30 to the balance
-	// if it was debit to debit, if it was 100 and now is 70, we add 30 to the balance
-	// if it was credit to debit, if it was 100 and now is 70, we subtract 30 from the balance
-	// if it was debit to credit, if it was 100 and now is 130, we subtract 30 from the balance
-
-	// For now, we cannot change the transaction type. If it is debit, it will remain a debit.
-	// We only need to calculate the difference in amount and update the balance accordingly.
-
-	// get the current category
-	catStore := category.NewStore(s.db)
-	currentCategory, err := catStore.GetCategoryById(tx.CategoryId, userId)
+	// hold the transaction so a concurrent change can't apply its difference on top of an old amount
+	current, err := lockTransaction(tx, payload.ID, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get previous category: %w", err)
+		return nil, err
 	}
 
-	newCategory, err := catStore.GetCategoryById(transaction.CategoryID, userId)
+	previousDTO, err := getTransactionDTO(tx, payload.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get new category: %w", err)
+		return nil, fmt.Errorf("failed to get transaction DTO: %w", err)
 	}
 
-	// get the current balance
-	currentBalance := account.Balance
-
-	// get the new balance
+	// For now, we cannot change the transaction type. If it is debit, it will remain a debit.
+	// We only need to calculate the difference in amount and update the balance accordingly.
 
 	// So for a credit, if the user had 200 registered and now is 300, we add 100 to the balance
 	// If the user has 200 registered and now is 100, we subtract 100 from the balance
 	// For a debit, if the user had 200 registered and now is 100, we add 100 to the balance
 	// If the user has 200 registered and now is 300, we subtract 100
 	// Having in mind, in the database, the amount is always positive
-	// Get the current transaction amount (positive for both credit and debit)
-	currentAmount := tx.Amount
-	if currentCategory.TransactionTypeID == (int)(types.DebitTransactionType) {
-		currentAmount = currentAmount * -1 // Negate for debit
-	}
+	amountDifference := balanceEffect(payload.Amount, newCategory.TransactionTypeID) -
+		balanceEffect(current.Amount, previousDTO.Category.TransactionType.ID)
 
-	// Get the new transaction amount (positive for both credit and debit)
-	newAmount := transaction.Amount
-	if newCategory.TransactionTypeID == (int)(types.DebitTransactionType) {
-		newAmount = newAmount * -1 // Negate for debit
+	loc, err := s.accountLocation(current.AccountToken)
+	if err != nil {
+		return nil, err
 	}
 
-	// Calculate the new balance
-	amountDifference := newAmount - currentAmount
-	newBalance := currentBalance + amountDifference
+	// update the account balance
+	var newBalance float64
+	err = tx.QueryRow("UPDATE accounts SET balance = balance + $1 WHERE token = $2 RETURNING balance",
+		amountDifference, current.AccountToken).Scan(&newBalance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update account balance: %w", err)
+	}
 
-	_, err = db.ExecWithValidation(s.db, "UPDATE transactions SET amount = $1, category_id = $2, description = $3, date = $4, balance = $5 WHERE id = $6",
-		transaction.Amount,
-		transaction.CategoryID,
-		transaction.Description,
-		transaction.Date,
+	_, err = tx.Exec("UPDATE transactions SET amount = $1, category_id = $2, description = $3, date = $4, balance = $5 WHERE id = $6",
+		payload.Amount,
+		payload.CategoryID,
+		payload.Description,
+		transactionDate(payload.Date, loc),
 		newBalance,
-		transaction.ID,
+		payload.ID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update transaction: %w", err)
 	}
 
-	// update the account balance
-	_, err = db.ExecWithValidation(s.db, "UPDATE accounts SET balance = $1 WHERE token = $2", newBalance, tx.AccountToken)
+	transactionDTO, err := getTransactionDTO(tx, payload.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update account balance: %w", err)
+		return nil, fmt.Errorf("failed to get updated transaction DTO: %w", err)
+	}
+
+	if err := audit.Record(tx, origin, transactionChange(userId, types.AuditActionUpdate, previousDTO, transactionDTO)); err != nil {
+		return nil, err
 	}
 
-	// Get the updated transaction
-	updatedTransaction := &types.Transaction{
-		ID:           tx.ID,
-		AccountToken: tx.AccountToken,
-		CategoryId:   transaction.CategoryID,
-		Amount:       transaction.Amount,
-		Description:  transaction.Description,
-		Date:         transaction.Date,
-		Balance:      newBalance,
-		CreatedAt:    tx.CreatedAt,
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	return updatedTransaction, nil
+	return s.changeResponse(userId, transactionDTO)
 }
 
-func (s *Store) UpdateTransactionAndReturn(payload *types.UpdateTransactionPayload, userId int) (*types.TransactionChangeResponse, error) {
-	updatedTx, err := s.UpdateTransaction(payload, userId)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update transaction: %w", err)
+// DeleteTransactionAndReturn moves the transaction to the trash, it is returned with the
+// balance the account is left with
+func (s *Store) DeleteTransactionAndReturn(transactionId int, userId int, origin *types.AuditOrigin) (*types.TransactionChangeResponse, error) {
+	// viewers of a shared account can't delete transactions
+	if _, err := s.policy.CanEditTransaction(userId, transactionId); err != nil {
+		return nil, err
 	}
 
-	transactionDTO, err := s.GetTransactionDTOById(updatedTx.ID)
+	tx, err := s.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get updated transaction DTO: %w", err)
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	// Get available months for the account token
-	availableMonths, err := s.GetAvailableTransactionMonthsByAccountToken(transactionDTO.AccountToken)
+	// a concurrent delete waits here and then finds the transaction in the trash
+	transaction, err := lockTransaction(tx, transactionId, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get available months: %w", err)
+		return nil, err
 	}
 
-	return &types.TransactionChangeResponse{
-		Transaction:    transactionDTO,
-		AccountBalance: &transactionDTO.Balance,
-		Months:         availableMonths,
-	}, nil
-}
+	// on a shared account the category may belong to another member
+	transactionDTO, err := getTransactionDTO(tx, transactionId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction DTO: %w", err)
+	}
 
-func (s *Store) DeleteTransaction(transactionId int, userId int) (balance *float64, err error) {
-	// get the transaction
-	tx, err := s.GetTransactionById(transactionId)
+	// the transaction goes to the trash, its amount leaves the balance until it is restored
+	result, err := tx.Exec("UPDATE transactions SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL", transactionId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get transaction: %w", err)
+		return nil, fmt.Errorf("failed to delete transaction: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("transaction %w", authz.ErrNotFound)
 	}
 
-	// get the account
-	account, err := s.accountStore.GetAccountByToken(tx.AccountToken, userId)
+	var newBalance float64
+	err = tx.QueryRow("UPDATE accounts SET balance = balance - $1 WHERE token = $2 RETURNING balance",
+		balanceEffect(transaction.Amount, transactionDTO.Category.TransactionType.ID), transaction.AccountToken).Scan(&newBalance)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account: %w", err)
+		return nil, fmt.Errorf("failed to update account balance: %w", err)
 	}
 
-	// check if the user is the owner of the account
-	if err := db.ValidateOwnership(userId, account.UserID, "transaction"); err != nil {
+	if err := audit.Record(tx, origin, transactionChange(userId, types.AuditActionDelete, transactionDTO, nil)); err != nil {
 		return nil, err
 	}
 
-	// get the transaction category
-	catStore := category.NewStore(s.db)
-	category, err := catStore.GetCategoryById(tx.CategoryId, userId)
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	transactionDTO.Balance = newBalance
+	return s.changeResponse(userId, transactionDTO)
+}
+
+// RestoreTransactionAndReturn takes the transaction out of the trash and adds its amount back
+// to the balance the account has now, which the transaction keeps as its own balance
+func (s *Store) RestoreTransactionAndReturn(transactionId int, userId int, origin *types.AuditOrigin) (*types.TransactionChangeResponse, error) {
+	// the account must be out of the trash and the user allowed to edit it
+	accountToken, err := s.policy.CanRestoreTransaction(userId, transactionId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get category: %w", err)
+		return nil, err
 	}
 
-	// check if the category is a transfer
-	// if the transaction was a credit, we must remove that amount
-	amount := tx.Amount
-	if category.TransactionTypeID == int(types.CreditTransactionType) {
-		amount = amount * -1
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	// get the current balance
-	currentBalance := account.Balance
+	// a concurrent restore waits here and then finds the transaction out of the trash
+	transaction, err := lockTransaction(tx, transactionId, true)
+	if err != nil {
+		return nil, err
+	}
 
-	// get the new balance
-	newBalance := currentBalance + amount
+	transactionTypeId, err := s.categoryTransactionType(transaction.CategoryId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
 
-	_, err = db.ExecWithValidation(s.db, "DELETE FROM transactions WHERE id = $1", transactionId)
+	result, err := tx.Exec("UPDATE transactions SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", transactionId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to delete transaction: %w", err)
+		return nil, fmt.Errorf("failed to restore transaction: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("transaction %w", authz.ErrNotFound)
 	}
 
-	// update the account balance
-	_, err = db.ExecWithValidation(s.db, "UPDATE accounts SET balance = $1 WHERE token = $2", newBalance, tx.AccountToken)
+	var newBalance float64
+	err = tx.QueryRow("UPDATE accounts SET balance = balance + $1 WHERE token = $2 RETURNING balance",
+		balanceEffect(transaction.Amount, transactionTypeId), accountToken).Scan(&newBalance)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update account balance: %w", err)
 	}
 
-	return &newBalance, nil
-}
-
-func (s *Store) DeleteTransactionAndReturn(transactionId int, userId int) (*types.TransactionChangeResponse, error) {
-	transactionDTO, err := s.GetTransactionDTOById(transactionId)
+	_, err = tx.Exec("UPDATE transactions SET balance = $1 WHERE id = $2", newBalance, transactionId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get transaction DTO: %w", err)
+		return nil, fmt.Errorf("failed to update transaction balance: %w", err)
 	}
 
-	balance, err := s.DeleteTransaction(transactionId, userId)
+	transactionDTO, err := getTransactionDTO(tx, transactionId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to delete transaction: %w", err)
+		return nil, fmt.Errorf("failed to get restored transaction DTO: %w", err)
 	}
 
-	transactionDTO.Balance = *balance
+	if err := audit.Record(tx, origin, transactionChange(userId, types.AuditActionRestore, nil, transactionDTO)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
+	return s.changeResponse(userId, transactionDTO)
+}
+
+// changeResponse adds the balance and the months left with transactions to a changed transaction
+func (s *Store) changeResponse(userId int, transactionDTO *types.TransactionDTO) (*types.TransactionChangeResponse, error) {
 	// Get available months for the account token
-	availableMonths, err := s.GetAvailableTransactionMonthsByAccountToken(transactionDTO.AccountToken)
+	availableMonths, err := s.GetAvailableTransactionMonthsByAccountToken(userId, transactionDTO.AccountToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get available months: %w", err)
 	}
@@ -420,8 +460,60 @@ func (s *Store) DeleteTransactionAndReturn(transactionId int, userId int) (*type
 	}, nil
 }
 
-// Store implementation
-func (s *Store) GetAvailableTransactionMonthsByAccountToken(accountToken string) ([]*types.MonthYear, error) {
+// transactionChange describes a change to one transaction, either side is nil when it doesn't exist
+func transactionChange(userId int, action string, before, after *types.TransactionDTO) types.AuditChange {
+	transaction := after
+	if transaction == nil {
+		transaction = before
+	}
+
+	change := types.AuditChange{
+		UserID:       userId,
+		AccountToken: transaction.AccountToken,
+		EntityType:   types.AuditEntityTransaction,
+		EntityID:     strconv.Itoa(transaction.ID),
+		Action:       action,
+	}
+	// a nil pointer would be stored as JSON null instead of leaving the side out
+	if before != nil {
+		change.Before = before
+	}
+	if after != nil {
+		change.After = after
+	}
+	return change
+}
+
+// GetTrashedTransactionsByUserId returns the transactions in the trash the user can restore,
+// the ones of accounts they edit that aren't in the trash themselves
+func (s *Store) GetTrashedTransactionsByUserId(userId int) ([]*types.TransactionDTO, error) {
+	query := `
+		SELECT 
+			t.id, t.account_token, t.amount, t.description, t.date, t.balance, t.created_at, t.created_by, t.deleted_at,
+			c.id, c.category_name, c.color, c.parent_id, c.icon, c.created_at, c.updated_at,
+			tt.id, tt.type_name, tt.type_slug
+		FROM transactions t
+		JOIN categories c ON t.category_id = c.id
+		JOIN transaction_types tt ON c.transaction_type_id = tt.id
+		JOIN accounts a ON a.token = t.account_token AND a.deleted_at IS NULL
+		JOIN account_members m ON m.account_token = t.account_token AND m.user_id = $1
+		WHERE t.deleted_at IS NOT NULL AND m.role IN ($2, $3)
+		ORDER BY t.deleted_at DESC`
+
+	return db.QueryList(s.db, query, scanTransactionsDTOs, userId, types.AccountRoleOwner, types.AccountRoleEditor)
+}
+
+// GetAvailableTransactionMonthsByAccountToken lists the months with transactions, in the owner's timezone
+func (s *Store) GetAvailableTransactionMonthsByAccountToken(userId int, accountToken string) ([]*types.MonthYear, error) {
+	if err := s.policy.CanReadAccount(userId, accountToken); err != nil {
+		return nil, err
+	}
+
+	loc, err := s.accountLocation(accountToken)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
         SELECT 
             year,
@@ -429,17 +521,17 @@ func (s *Store) GetAvailableTransactionMonthsByAccountToken(accountToken string)
             count
         FROM (
             SELECT 
-                DATE_PART('year', date)::int as year,
-                DATE_PART('month', date)::int as month,
+                DATE_PART('year', date AT TIME ZONE $2)::int as year,
+                DATE_PART('month', date AT TIME ZONE $2)::int as month,
                 COUNT(*) as count
             FROM transactions 
-            WHERE account_token = $1 
-            GROUP BY DATE_PART('year', date), DATE_PART('month', date)
+            WHERE account_token = $1 AND deleted_at IS NULL
+            GROUP BY 1, 2
         ) subquery
         ORDER BY year DESC, month DESC
     `
 
-	return db.QueryList(s.db, query, scanMonthYear, accountToken)
+	return db.QueryList(s.db, query, scanMonthYear, accountToken, loc.String())
 }
 
 func scanMonthYear(rows *sql.Rows) (*types.MonthYear, error) {
@@ -498,7 +590,7 @@ func abs(x float64) float64 {
 
 // Process transactions and calculate largest amounts and daily breakdowns
 func (s *Store) calculateLargestAmountsAndDailyTotals(
-	transactions []*types.TransactionDTO,
+	transactions []*types.TransactionDTO, loc *time.Location,
 ) (largestCredit, largestDebit float64, dailyTotals map[string]*types.DailyTotal) {
 	dailyTotals = make(map[string]*types.DailyTotal)
 
@@ -507,7 +599,8 @@ func (s *Store) calculateLargestAmountsAndDailyTotals(
 			continue
 		}
 
-		date := tx.Date.Format("2006-01-02")
+		// the day as the user sees it, not the server
+		date := tx.Date.In(loc).Format("2006-01-02")
 
 		// Initialize daily total if it doesn't exist
 		if dailyTotals[date] == nil {
@@ -619,9 +712,120 @@ func (s *Store) processCategoryBreakdown(categoryMap map[string]*types.CategoryS
 	return breakdown
 }
 
-func (s *Store) GetTransactionStatistics(accountToken string, month, year *int) (*types.TransactionStatistics, error) {
-	// Get transactions for the specified period
-	transactions, err := s.GetTransactionsDTOByAccountToken(accountToken, month, year)
+// parentCategories reads the parents of the categories in the transactions, trashed ones included
+func (s *Store) parentCategories(transactions []*types.TransactionDTO) (map[int]*types.CategoryDTO, error) {
+	parents := make(map[int]*types.CategoryDTO)
+	var ids []int64
+	for _, tx := range transactions {
+		if tx.Category == nil || tx.Category.ParentID == nil {
+			continue
+		}
+		if _, seen := parents[*tx.Category.ParentID]; !seen {
+			parents[*tx.Category.ParentID] = nil
+			ids = append(ids, int64(*tx.Category.ParentID))
+		}
+	}
+	if len(ids) == 0 {
+		return parents, nil
+	}
+
+	rows, err := s.db.Query("SELECT id, category_name, color FROM categories WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		parent := new(types.CategoryDTO)
+		if err := rows.Scan(&parent.ID, &parent.CategoryName, &parent.Color); err != nil {
+			return nil, err
+		}
+		parents[parent.ID] = parent
+	}
+
+	return parents, rows.Err()
+}
+
+// Build category breakdowns where subcategories count towards their parent
+func (s *Store) buildCategoryRollups(transactions []*types.TransactionDTO, parents map[int]*types.CategoryDTO) (
+	creditCategoryMap, debitCategoryMap map[string]*types.CategoryStatistic) {
+
+	creditCategoryMap = make(map[string]*types.CategoryStatistic)
+	debitCategoryMap = make(map[string]*types.CategoryStatistic)
+
+	for _, tx := range transactions {
+		if tx.Category == nil || tx.Category.TransactionType == nil {
+			continue
+		}
+
+		var categoryMap map[string]*types.CategoryStatistic
+		switch tx.Category.TransactionType.ID {
+		case int(types.CreditTransactionType):
+			categoryMap = creditCategoryMap
+		case int(types.DebitTransactionType):
+			categoryMap = debitCategoryMap
+		default:
+			continue
+		}
+
+		absAmount := abs(tx.Amount)
+
+		var parent *types.CategoryDTO
+		if tx.Category.ParentID != nil {
+			parent = parents[*tx.Category.ParentID]
+		}
+		if parent == nil {
+			s.updateCategoryMap(categoryMap, tx.Category.CategoryName, tx.Category.Color, absAmount)
+			continue
+		}
+
+		s.updateCategoryMap(categoryMap, parent.CategoryName, parent.Color, absAmount)
+		stat := categoryMap[parent.CategoryName]
+		subcategory := findCategoryStatistic(stat.Subcategories, tx.Category.CategoryName)
+		if subcategory == nil {
+			subcategory = &types.CategoryStatistic{
+				Name:  tx.Category.CategoryName,
+				Color: tx.Category.Color,
+			}
+			stat.Subcategories = append(stat.Subcategories, subcategory)
+		}
+		subcategory.Count++
+		subcategory.Total += absAmount
+	}
+
+	return creditCategoryMap, debitCategoryMap
+}
+
+func findCategoryStatistic(stats []*types.CategoryStatistic, name string) *types.CategoryStatistic {
+	for _, stat := range stats {
+		if stat.Name == name {
+			return stat
+		}
+	}
+	return nil
+}
+
+// Calculate percentages for a rollup, subcategories are a percentage of their parent
+func (s *Store) processCategoryRollup(categoryMap map[string]*types.CategoryStatistic,
+	totalAmount float64) []*types.CategoryStatistic {
+
+	for _, categoryStat := range categoryMap {
+		if len(categoryStat.Subcategories) == 0 {
+			continue
+		}
+		subcategoryMap := make(map[string]*types.CategoryStatistic, len(categoryStat.Subcategories))
+		for _, subcategory := range categoryStat.Subcategories {
+			subcategoryMap[subcategory.Name] = subcategory
+		}
+		categoryStat.Subcategories = s.processCategoryBreakdown(subcategoryMap, categoryStat.Total)
+	}
+
+	return s.processCategoryBreakdown(categoryMap, totalAmount)
+}
+
+func (s *Store) GetTransactionStatistics(userId int, accountToken string, month, year *int) (*types.TransactionStatistics, error) {
+	// Get transactions for the specified period, reading them checks the user is a member
+	transactions, err := s.GetTransactionsDTOByAccountToken(userId, accountToken, month, year)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get transactions: %w", err)
 	}
@@ -639,6 +843,8 @@ func (s *Store) GetTransactionStatistics(accountToken string, month, year *int)
 		LargestCredit:           0,
 		CreditCategoryBreakdown: []*types.CategoryStatistic{},
 		DebitCategoryBreakdown:  []*types.CategoryStatistic{},
+		CreditCategoryRollup:    []*types.CategoryStatistic{},
+		DebitCategoryRollup:     []*types.CategoryStatistic{},
 		Totals:                  totals,
 	}
 
@@ -646,9 +852,14 @@ func (s *Store) GetTransactionStatistics(accountToken string, month, year *int)
 		return stats, nil
 	}
 
+	loc, err := s.accountLocation(accountToken)
+	if err != nil {
+		return nil, err
+	}
+
 	// Calculate largest amounts and daily totals
 	var dailyTotalsMap map[string]*types.DailyTotal
-	stats.LargestCredit, stats.LargestDebit, dailyTotalsMap = s.calculateLargestAmountsAndDailyTotals(transactions)
+	stats.LargestCredit, stats.LargestDebit, dailyTotalsMap = s.calculateLargestAmountsAndDailyTotals(transactions, loc)
 
 	// Convert daily totals map to a slice and sort by date
 	for _, dailyTotal := range dailyTotalsMap {
@@ -662,8 +873,17 @@ func (s *Store) GetTransactionStatistics(accountToken string, month, year *int)
 	stats.CreditCategoryBreakdown = s.processCategoryBreakdown(creditCategoryMap, totals.Credit)
 	stats.DebitCategoryBreakdown = s.processCategoryBreakdown(debitCategoryMap, totals.Debit)
 
+	// Roll subcategories up into their parents
+	parents, err := s.parentCategories(transactions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parent categories: %w", err)
+	}
+	creditRollup, debitRollup := s.buildCategoryRollups(transactions, parents)
+	stats.CreditCategoryRollup = s.processCategoryRollup(creditRollup, totals.Credit)
+	stats.DebitCategoryRollup = s.processCategoryRollup(debitRollup, totals.Debit)
+
 	if month != nil && year != nil {
-		stats.StartDate, stats.EndDate = getMonthDateRange(month, year)
+		stats.StartDate, stats.EndDate = getMonthDateRange(*month, *year, loc)
 	} else if len(stats.DailyTotals) > 0 {
 		// Find min and max dates from daily totals
 		minDate := stats.DailyTotals[0].Date
@@ -673,7 +893,7 @@ func (s *Store) GetTransactionStatistics(accountToken string, month, year *int)
 			}
 		}
 		stats.StartDate = minDate
-		stats.EndDate = time.Now().Format("2006-01-02")
+		stats.EndDate = time.Now().In(loc).Format("2006-01-02")
 	} else {
 		stats.StartDate = ""
 		stats.EndDate = ""
@@ -682,10 +902,111 @@ func (s *Store) GetTransactionStatistics(accountToken string, month, year *int)
 	return stats, nil
 }
 
+func (s *Store) GetAverageAnnualExpenses(userId int, months int) (float64, error) {
+	now := time.Now()
+	since := now.AddDate(0, -months, 0)
+
+	var total float64
+	var firstDate sql.NullTime
+	err := s.db.QueryRow(
+		`SELECT COALESCE(SUM(t.amount), 0), MIN(t.date)
+		 FROM transactions t
+		 JOIN categories c ON c.id = t.category_id
+		 JOIN accounts a ON a.token = t.account_token AND a.deleted_at IS NULL
+		 JOIN account_members m ON m.account_token = t.account_token AND m.user_id = $1
+		 WHERE c.transaction_type_id = $2 AND t.deleted_at IS NULL AND t.date >= $3 AND t.date <= $4`,
+		userId, int(types.DebitTransactionType), since, now,
+	).Scan(&total, &firstDate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum expenses: %w", err)
+	}
+	if !firstDate.Valid {
+		return 0, nil
+	}
+
+	// a newer user hasn't had the whole window to spend in, at least a month counts
+	start := since
+	if firstDate.Time.After(start) {
+		start = firstDate.Time
+	}
+	days := max(now.Sub(start).Hours()/24, 30)
+
+	return utils.Round(total/days*365, 2), nil
+}
+
 // Returns start and end date (YYYY-MM-DD) for a given month/year
-func getMonthDateRange(month, year *int) (startDate, endDate string) {
-	loc := time.UTC
-	start := time.Date(*year, time.Month(*month), 1, 0, 0, 0, 0, loc)
-	end := start.AddDate(0, 1, -1)
-	return start.Format("2006-01-02"), end.Format("2006-01-02")
+func getMonthDateRange(month, year int, loc *time.Location) (startDate, endDate string) {
+	start, end := monthRange(month, year, loc)
+	return start.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02")
+}
+
+// monthRange returns the first instant of the month and of the next month in loc
+func monthRange(month, year int, loc *time.Location) (start, end time.Time) {
+	start = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, loc)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// transactionDate reads a date without time as midnight in the user's timezone, so it stays
+// on that day for them. Values with a time keep their own offset.
+func transactionDate(date string, loc *time.Location) interface{} {
+	if day, err := time.ParseInLocation("2006-01-02", date, loc); err == nil {
+		return day
+	}
+	return date
+}
+
+// categoryTransactionType reads the type of a category already attached to a transaction
+// balanceEffect is what the transaction adds to the balance of its account. Debits take their
+// amount out, credits and transfers put it in.
+func balanceEffect(amount float64, transactionTypeId int) float64 {
+	if transactionTypeId == int(types.DebitTransactionType) {
+		return -amount
+	}
+	return amount
+}
+
+// lockTransaction reads the transaction inside tx and holds it until tx ends, so only one
+// delete or restore applies its amount. trashed picks which side of the trash it must be on.
+func lockTransaction(tx *sql.Tx, transactionId int, trashed bool) (*types.Transaction, error) {
+	condition := "deleted_at IS NULL"
+	if trashed {
+		condition = "deleted_at IS NOT NULL"
+	}
+
+	transaction, err := scanTransactionRow(tx.QueryRow(
+		`SELECT id, account_token, category_id, amount, description, date, balance, created_at, created_by
+		 FROM transactions WHERE id = $1 AND `+condition+` FOR UPDATE`, transactionId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("transaction %w", authz.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+	return transaction, nil
+}
+
+func (s *Store) categoryTransactionType(categoryId int) (int, error) {
+	var transactionTypeId int
+	err := s.db.QueryRow("SELECT transaction_type_id FROM categories WHERE id = $1", categoryId).Scan(&transactionTypeId)
+	return transactionTypeId, err
+}
+
+// accountLocation returns the timezone of the account owner, months and days are grouped in it
+func (s *Store) accountLocation(accountToken string) (*time.Location, error) {
+	var timezone string
+	err := s.db.QueryRow(
+		`SELECT COALESCE(us.timezone, 'UTC')
+		 FROM accounts a
+		 LEFT JOIN user_settings us ON us.user_id = a.user_id
+		 WHERE a.token = $1`,
+		accountToken,
+	).Scan(&timezone)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.UTC, nil
+		}
+		return nil, fmt.Errorf("failed to get account timezone: %w", err)
+	}
+
+	return utils.LoadLocation(timezone)
 }
@@ -0,0 +1,121 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestMonthRangeUsesUserTimezone(t *testing.T) {
+	lisbon := mustLoadLocation(t, "Europe/Lisbon")
+	start, end := monthRange(7, 2025, lisbon)
+
+	// Lisbon is UTC+1 in the summer, so July starts at 23:00 UTC on the 30th of June
+	if want := time.Date(2025, 6, 30, 23, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("expected the month to start at %s, got %s", want, start.UTC())
+	}
+	if want := time.Date(2025, 7, 31, 23, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("expected the month to end at %s, got %s", want, end.UTC())
+	}
+
+	startDate, endDate := getMonthDateRange(2, 2024, lisbon)
+	if startDate != "2024-02-01" || endDate != "2024-02-29" {
+		t.Errorf("expected 2024-02-01 to 2024-02-29, got %s to %s", startDate, endDate)
+	}
+}
+
+func TestTransactionDate(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	// a plain date is midnight for the user, not for the server
+	day, ok := transactionDate("2025-01-31", newYork).(time.Time)
+	if !ok {
+		t.Fatal("expected a date without time to be parsed")
+	}
+	if want := time.Date(2025, 1, 31, 5, 0, 0, 0, time.UTC); !day.Equal(want) {
+		t.Errorf("expected %s, got %s", want, day.UTC())
+	}
+
+	// timestamps carry their own offset and are passed through
+	if value := transactionDate("2025-01-31T23:30:00Z", newYork); value != "2025-01-31T23:30:00Z" {
+		t.Errorf("expected the timestamp to be kept, got %v", value)
+	}
+}
+
+func TestBalanceEffect(t *testing.T) {
+	// delete and restore take out and put back what create added, for every type
+	tests := map[types.TransactionTypeID]float64{
+		types.CreditTransactionType:   25,
+		types.DebitTransactionType:    -25,
+		types.TransferTransactionType: 25,
+	}
+	for typeId, want := range tests {
+		if got := balanceEffect(25, int(typeId)); got != want {
+			t.Errorf("type %d: expected %v, got %v", typeId, want, got)
+		}
+	}
+}
+
+func TestDailyTotalsUseUserTimezone(t *testing.T) {
+	tokyo := mustLoadLocation(t, "Asia/Tokyo")
+	debit := &types.CategoryDTO{TransactionType: &types.TransactionType{ID: int(types.DebitTransactionType)}}
+
+	// 20:00 UTC on the 31st is already the 1st in Tokyo
+	transactions := []*types.TransactionDTO{
+		{Amount: 10, Date: time.Date(2025, 1, 31, 20, 0, 0, 0, time.UTC), Category: debit},
+		{Amount: 5, Date: time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC), Category: debit},
+	}
+
+	store := &Store{}
+	_, _, dailyTotals := store.calculateLargestAmountsAndDailyTotals(transactions, tokyo)
+
+	if dailyTotals["2025-02-01"] == nil || dailyTotals["2025-02-01"].Debit != 10 {
+		t.Errorf("expected the late transaction on 2025-02-01, got %v", dailyTotals)
+	}
+	if dailyTotals["2025-01-31"] == nil || dailyTotals["2025-01-31"].Debit != 5 {
+		t.Errorf("expected the early transaction on 2025-01-31, got %v", dailyTotals)
+	}
+}
+
+func TestCategoryRollupIncludesSubcategories(t *testing.T) {
+	debitType := &types.TransactionType{ID: int(types.DebitTransactionType)}
+	parentId := 1
+	food := &types.CategoryDTO{ID: parentId, CategoryName: "Food", Color: "#f00", TransactionType: debitType}
+	groceries := &types.CategoryDTO{ID: 2, CategoryName: "Groceries", ParentID: &parentId, TransactionType: debitType}
+	restaurants := &types.CategoryDTO{ID: 3, CategoryName: "Restaurants", ParentID: &parentId, TransactionType: debitType}
+	rent := &types.CategoryDTO{ID: 4, CategoryName: "Rent", TransactionType: debitType}
+
+	transactions := []*types.TransactionDTO{
+		{Amount: 10, Category: food},
+		{Amount: 30, Category: groceries},
+		{Amount: 20, Category: restaurants},
+		{Amount: 40, Category: rent},
+	}
+
+	store := &Store{}
+	_, debitRollup := store.buildCategoryRollups(transactions, map[int]*types.CategoryDTO{parentId: food})
+	rollup := store.processCategoryRollup(debitRollup, 100)
+
+	if len(rollup) != 2 {
+		t.Fatalf("expected Food and Rent at the top level, got %d categories", len(rollup))
+	}
+	if rollup[0].Name != "Food" || rollup[0].Total != 60 || rollup[0].Percentage != 60 {
+		t.Errorf("expected Food first with 60 including subcategories, got %+v", rollup[0])
+	}
+	if len(rollup[0].Subcategories) != 2 || rollup[0].Subcategories[0].Name != "Groceries" || rollup[0].Subcategories[0].Percentage != 50 {
+		t.Errorf("expected Groceries as half of Food, got %+v", rollup[0].Subcategories)
+	}
+	if len(rollup[1].Subcategories) != 0 {
+		t.Errorf("expected Rent without subcategories, got %+v", rollup[1].Subcategories)
+	}
+}
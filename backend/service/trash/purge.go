@@ -0,0 +1,35 @@
+package trash
+
+import (
+	"log"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+// purgeInterval is how often the trash is emptied of what is past the retention
+const purgeInterval = time.Hour
+
+// StartPurge permanently deletes, in the background, whatever stayed in the trash for longer
+// than the retention
+func StartPurge(store types.TrashStore, retention time.Duration) {
+	go func() {
+		for {
+			purge(store, time.Now().Add(-retention))
+			time.Sleep(purgeInterval)
+		}
+	}()
+}
+
+func purge(store types.TrashStore, cutoff time.Time) {
+	result, err := store.PurgeDeletedBefore(cutoff)
+	if err != nil {
+		log.Printf("failed to purge the trash: %v", err)
+		return
+	}
+
+	if result.Transactions+result.Accounts+result.Categories > 0 {
+		log.Printf("purged %d transactions, %d accounts and %d categories deleted before %s",
+			result.Transactions, result.Accounts, result.Categories, cutoff.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,193 @@
+package trash
+
+import (
+	"net/http"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/audit"
+	"github.com/lucas-remigio/wallet-tracker/service/authz"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+type Handler struct {
+	accountStore     types.AccountStore
+	transactionStore types.TransactionStore
+	categoryStore    types.CategoryStore
+	retentionDays    int
+}
+
+func NewHandler(accountStore types.AccountStore, transactionStore types.TransactionStore, categoryStore types.CategoryStore, retentionDays int) *Handler {
+	return &Handler{
+		accountStore:     accountStore,
+		transactionStore: transactionStore,
+		categoryStore:    categoryStore,
+		retentionDays:    retentionDays,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/trash", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.GetTrash,
+		}),
+	))
+	router.HandleFunc("/trash/accounts/{token}/restore", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.RestoreAccount,
+		}),
+	))
+	router.HandleFunc("/trash/transactions/{id}/restore", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.RestoreTransaction,
+		}),
+	))
+	router.HandleFunc("/trash/categories/{id}/restore", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.RestoreCategory,
+		}),
+	))
+	// the categories page has its own archived list, it is the same trash
+	router.HandleFunc("/categories/archived", middleware.AuthMiddleware(h.GetArchivedCategories))
+	router.HandleFunc("/categories/{id}/restore", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.restoreCategoryAt(1),
+		}),
+	))
+}
+
+// GetTrash lists what the user deleted and can still restore
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	accounts, err := h.accountStore.GetTrashedAccountsByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	transactions, err := h.transactionStore.GetTrashedTransactionsByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	categories, err := h.categoryStore.GetTrashedCategoriesByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, &types.Trash{
+		Accounts:      accounts,
+		Transactions:  transactions,
+		Categories:    categories,
+		RetentionDays: h.retentionDays,
+	})
+}
+
+func (h *Handler) RestoreAccount(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireScope(w, r, types.ScopeAccountsWrite)
+	if !ok {
+		return
+	}
+
+	// extract account token from URL path (/trash/accounts/{token}/restore)
+	accountToken, ok := middleware.ExtractPathParamAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	account, err := h.accountStore.RestoreAccount(accountToken, userId, audit.Origin(r))
+	if err != nil {
+		utils.WriteError(w, authz.StatusCode(err), err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"account": account,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func (h *Handler) RestoreTransaction(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireScope(w, r, types.ScopeTransactionsWrite)
+	if !ok {
+		return
+	}
+
+	// extract transaction ID from URL path (/trash/transactions/{id}/restore)
+	transactionId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	response, err := h.transactionStore.RestoreTransactionAndReturn(transactionId, userId, audit.Origin(r))
+	if err != nil {
+		utils.WriteError(w, authz.StatusCode(err), err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+// GetArchivedCategories lists only the categories in the trash
+func (h *Handler) GetArchivedCategories(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	categories, err := h.categoryStore.GetTrashedCategoriesByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"categories": categories,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+// RestoreCategory takes the category id from /trash/categories/{id}/restore
+func (h *Handler) RestoreCategory(w http.ResponseWriter, r *http.Request) {
+	h.restoreCategoryAt(2)(w, r)
+}
+
+// restoreCategoryAt restores the category whose id is the path segment at idIndex
+func (h *Handler) restoreCategoryAt(idIndex int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// require authentication
+		userId, ok := middleware.RequireAuth(w, r)
+		if !ok {
+			return
+		}
+
+		categoryId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, idIndex)
+		if !ok {
+			return
+		}
+
+		category, err := h.categoryStore.RestoreCategory(categoryId, userId, audit.Origin(r))
+		if err != nil {
+			utils.WriteError(w, authz.StatusCode(err), err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"category": category,
+		}
+
+		middleware.WriteDataResponse(w, response)
+	}
+}
@@ -0,0 +1,64 @@
+package trash
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// PurgeDeletedBefore permanently deletes what went to the trash before the cutoff. Categories
+// still used by a transaction stay, the transactions would lose them.
+func (s *Store) PurgeDeletedBefore(cutoff time.Time) (*types.PurgeResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := new(types.PurgeResult)
+
+	result.Transactions, err = execCount(tx, "DELETE FROM transactions WHERE deleted_at < $1", cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge transactions: %w", err)
+	}
+
+	// transactions, members and invitations of the account go with it
+	result.Accounts, err = execCount(tx, "DELETE FROM accounts WHERE deleted_at < $1", cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge accounts: %w", err)
+	}
+
+	result.Categories, err = execCount(tx,
+		`DELETE FROM categories c WHERE c.deleted_at < $1
+		 AND NOT EXISTS (SELECT 1 FROM transactions t WHERE t.category_id = c.id)`,
+		cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge categories: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func execCount(tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
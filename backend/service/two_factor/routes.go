@@ -0,0 +1,286 @@
+package two_factor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/service/login_guard"
+	"github.com/lucas-remigio/wallet-tracker/service/session"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+type Handler struct {
+	store        types.TwoFactorStore
+	userStore    types.UserStore
+	sessionStore types.SessionStore
+	loginGuard   types.LoginGuard
+}
+
+func NewHandler(store types.TwoFactorStore, userStore types.UserStore, sessionStore types.SessionStore, loginGuard types.LoginGuard) *Handler {
+	return &Handler{
+		store:        store,
+		userStore:    userStore,
+		sessionStore: sessionStore,
+		loginGuard:   loginGuard,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("/auth/2fa", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.GetStatus,
+		}),
+	))
+	router.HandleFunc("/auth/2fa/setup", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.BeginEnrolment,
+		}),
+	))
+	router.HandleFunc("/auth/2fa/confirm", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.ConfirmEnrolment,
+		}),
+	))
+	router.HandleFunc("/auth/2fa/disable", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.Disable,
+		}),
+	))
+	router.HandleFunc("/auth/2fa/recovery-codes", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.RegenerateRecoveryCodes,
+		}),
+	))
+	// second step of the login, authenticated by the intermediate token instead of a session
+	router.HandleFunc("/auth/2fa/verify", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodPost: h.VerifyLogin,
+	}))
+}
+
+func (h *Handler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.store.GetStatus(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, status)
+}
+
+func (h *Handler) BeginEnrolment(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.userStore.GetUserById(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setup, err := h.store.BeginEnrolment(userId, user.Email)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, setup)
+}
+
+func (h *Handler) ConfirmEnrolment(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.TwoFactorCodePayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	codes, err := h.store.ConfirmEnrolment(userId, payload.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, types.RecoveryCodes{RecoveryCodes: codes})
+}
+
+func (h *Handler) Disable(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.TwoFactorCodePayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	ok = h.guardCode(w, r, userId, func() error {
+		return h.store.Disable(userId, payload.Code)
+	})
+	if !ok {
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.TwoFactorCodePayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	var codes []string
+	ok = h.guardCode(w, r, userId, func() error {
+		var err error
+		codes, err = h.store.RegenerateRecoveryCodes(userId, payload.Code)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	middleware.WriteDataResponse(w, types.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// guardCode runs an action that checks a code of the signed in user. Wrong codes count against
+// the same limits as at login, so a stolen session can't guess its way to turning 2FA off.
+func (h *Handler) guardCode(w http.ResponseWriter, r *http.Request, userId int, action func() error) bool {
+	user, err := h.userStore.GetUserById(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	ipAddress := middleware.GetClientIP(r)
+	wait, err := h.loginGuard.Attempt(user.Email, ipAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if wait > 0 {
+		login_guard.WriteTooManyAttempts(w, wait)
+		return false
+	}
+
+	// only a wrong code keeps the attempt counted as a failure
+	err = action()
+	if err == nil || !errors.Is(err, ErrInvalidCode) {
+		if err := h.loginGuard.Release(user.Email, ipAddress); err != nil {
+			log.Printf("failed to take back two factor attempt: %v", err)
+		}
+	}
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return false
+	}
+
+	if err := h.loginGuard.RecordSuccess(user.Email); err != nil {
+		log.Printf("failed to reset login attempts: %v", err)
+	}
+	return true
+}
+
+// VerifyLogin exchanges the intermediate login token and a valid code for a session
+func (h *Handler) VerifyLogin(w http.ResponseWriter, r *http.Request) {
+	// parse and validate JSON payload
+	var payload types.TwoFactorLoginPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	claims, err := auth.ParseTwoFactorToken([]byte(config.Envs.JWTSecret), payload.Token)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+	userId, err := claims.GetUserId()
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	user, err := h.userStore.GetUserById(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid two factor token"))
+		return
+	}
+
+	// wrong codes count against the same limits as wrong passwords, counted before the code is checked
+	ipAddress := middleware.GetClientIP(r)
+	wait, err := h.loginGuard.Attempt(user.Email, ipAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if wait > 0 {
+		login_guard.WriteTooManyAttempts(w, wait)
+		return
+	}
+
+	// every token only gets a few codes, logging in again is needed for more
+	if err := h.store.StartChallengeAttempt(claims.ID, userId, claims.ExpiresAt.Time); err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	if err := h.store.VerifyCode(userId, payload.Code); err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	if err := h.loginGuard.Release(user.Email, ipAddress); err != nil {
+		log.Printf("failed to take back two factor attempt: %v", err)
+	}
+
+	if err := h.store.CompleteChallenge(claims.ID); err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	if !session.StartSession(w, r, h.sessionStore, userId) {
+		return
+	}
+	if err := h.loginGuard.RecordSuccess(user.Email); err != nil {
+		log.Printf("failed to reset login attempts: %v", err)
+	}
+}
+
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidCode), errors.Is(err, ErrChallengeUsed):
+		utils.WriteError(w, http.StatusUnauthorized, err)
+	case errors.Is(err, ErrAlreadyEnabled), errors.Is(err, ErrNotEnabled), errors.Is(err, ErrNoEnrolment):
+		utils.WriteError(w, http.StatusBadRequest, err)
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+	}
+}
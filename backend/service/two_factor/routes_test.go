@@ -0,0 +1,162 @@
+package two_factor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/service/login_guard"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const validCode = "123456"
+
+type mockTwoFactorStore struct {
+	types.TwoFactorStore
+	attempts  map[string]int
+	completed map[string]bool
+}
+
+func (m *mockTwoFactorStore) VerifyCode(userId int, code string) error {
+	if code != validCode {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+func (m *mockTwoFactorStore) Disable(userId int, code string) error {
+	return m.VerifyCode(userId, code)
+}
+
+func (m *mockTwoFactorStore) StartChallengeAttempt(tokenId string, userId int, expiresAt time.Time) error {
+	if m.completed[tokenId] || m.attempts[tokenId] >= MaxChallengeAttempts {
+		return ErrChallengeUsed
+	}
+	m.attempts[tokenId]++
+	return nil
+}
+
+func (m *mockTwoFactorStore) CompleteChallenge(tokenId string) error {
+	if m.completed[tokenId] {
+		return ErrChallengeUsed
+	}
+	m.completed[tokenId] = true
+	return nil
+}
+
+type mockUserStore struct {
+	types.UserStore
+}
+
+func (m *mockUserStore) GetUserById(id int) (*types.User, error) {
+	return &types.User{ID: id, Email: "ana@mail.pt"}, nil
+}
+
+type mockSessionStore struct {
+	types.SessionStore
+}
+
+func (m *mockSessionStore) CreateSession(userId int, userAgent, ipAddress string) (*types.Session, string, error) {
+	return &types.Session{ID: "session", UserID: userId}, "refresh", nil
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestHandler() (*Handler, *testClock) {
+	clock := &testClock{now: time.Now()}
+	store := &mockTwoFactorStore{attempts: make(map[string]int), completed: make(map[string]bool)}
+	guard := login_guard.NewGuardWithClock(login_guard.NewMemoryStore(), clock.Now)
+	return NewHandler(store, &mockUserStore{}, &mockSessionStore{}, guard), clock
+}
+
+func newTwoFactorToken(t *testing.T) string {
+	t.Helper()
+	token, err := auth.CreateTwoFactorToken([]byte(config.Envs.JWTSecret), 1)
+	if err != nil {
+		t.Fatalf("error creating token %v", err)
+	}
+	return token
+}
+
+func verifyLogin(handler *Handler, token, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(types.TwoFactorLoginPayload{Token: token, Code: code})
+	rr := httptest.NewRecorder()
+	handler.VerifyLogin(rr, httptest.NewRequest(http.MethodPost, "/auth/2fa/verify", bytes.NewReader(body)))
+	return rr
+}
+
+func disable(handler *Handler, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(types.TwoFactorCodePayload{Code: code})
+	req := httptest.NewRequest(http.MethodPost, "/auth/2fa/disable", bytes.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+	rr := httptest.NewRecorder()
+	handler.Disable(rr, req)
+	return rr
+}
+
+func TestVerifyLoginLimitsCodesPerToken(t *testing.T) {
+	handler, clock := newTestHandler()
+	token := newTwoFactorToken(t)
+
+	for i := 0; i < MaxChallengeAttempts; i++ {
+		if rr := verifyLogin(handler, token, "000000"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status 401, got %d", i+1, rr.Code)
+		}
+		// step past the backoff so only the token limit is tested
+		clock.now = clock.now.Add(time.Hour)
+	}
+
+	if rr := verifyLogin(handler, token, validCode); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the used up token to be rejected even with the right code, got %d", rr.Code)
+	}
+}
+
+func TestVerifyLoginBacksOffWrongCodes(t *testing.T) {
+	handler, _ := newTestHandler()
+
+	for i := 0; i < login_guard.IdentityPolicy.BackoffAfter; i++ {
+		verifyLogin(handler, newTwoFactorToken(t), "000000")
+	}
+
+	// a fresh login doesn't give a fresh set of guesses
+	if rr := verifyLogin(handler, newTwoFactorToken(t), validCode); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429, got %d", rr.Code)
+	}
+}
+
+func TestVerifyLoginTokenIsSingleUse(t *testing.T) {
+	handler, _ := newTestHandler()
+	token := newTwoFactorToken(t)
+
+	if rr := verifyLogin(handler, token, validCode); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := verifyLogin(handler, token, validCode); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the token to be rejected the second time, got %d", rr.Code)
+	}
+}
+
+func TestDisableBacksOffWrongCodes(t *testing.T) {
+	handler, _ := newTestHandler()
+
+	for i := 0; i < login_guard.IdentityPolicy.BackoffAfter; i++ {
+		if rr := disable(handler, "000000"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status 401, got %d", i+1, rr.Code)
+		}
+	}
+
+	if rr := disable(handler, validCode); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429, got %d", rr.Code)
+	}
+}
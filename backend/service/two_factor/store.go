@@ -0,0 +1,384 @@
+package two_factor
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const (
+	issuer            = "Grao Certo"
+	recoveryCodeCount = 10
+	// MaxChallengeAttempts is how many codes one intermediate login token can try
+	MaxChallengeAttempts = 5
+)
+
+var (
+	ErrInvalidCode    = fmt.Errorf("invalid two factor code")
+	ErrAlreadyEnabled = fmt.Errorf("two factor authentication is already enabled")
+	ErrNotEnabled     = fmt.Errorf("two factor authentication is not enabled")
+	ErrNoEnrolment    = fmt.Errorf("start the two factor setup first")
+	ErrChallengeUsed  = fmt.Errorf("this login can no longer be verified, log in again")
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) GetStatus(userId int) (*types.TwoFactorStatus, error) {
+	status := new(types.TwoFactorStatus)
+	err := s.db.QueryRow(
+		`SELECT enabled_at, (SELECT COUNT(*) FROM two_factor_recovery_codes WHERE user_id = $1 AND used_at IS NULL)
+		 FROM user_two_factor WHERE user_id = $1`,
+		userId,
+	).Scan(&status.EnabledAt, &status.RecoveryCodesLeft)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return status, nil
+		}
+		return nil, err
+	}
+
+	status.Enabled = status.EnabledAt != nil
+	if !status.Enabled {
+		status.RecoveryCodesLeft = 0
+	}
+	return status, nil
+}
+
+func (s *Store) IsEnabled(userId int) (bool, error) {
+	var enabled bool
+	err := s.db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM user_two_factor WHERE user_id = $1 AND enabled_at IS NOT NULL)",
+		userId,
+	).Scan(&enabled)
+	if err != nil {
+		return false, err
+	}
+
+	return enabled, nil
+}
+
+// BeginEnrolment generates a new secret that only becomes active once a code is confirmed
+func (s *Store) BeginEnrolment(userId int, accountName string) (*types.TwoFactorSetup, error) {
+	enabled, err := s.IsEnabled(userId)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := encryptSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.ExecWithValidation(s.db,
+		`INSERT INTO user_two_factor (user_id, secret_encrypted)
+		 VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET
+			secret_encrypted = EXCLUDED.secret_encrypted,
+			last_used_step = 0,
+			created_at = CURRENT_TIMESTAMP`,
+		userId, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start two factor setup: %w", err)
+	}
+
+	return &types.TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(secret, issuer, accountName),
+	}, nil
+}
+
+// ConfirmEnrolment enables two factor authentication once the user proves the
+// authenticator works, and returns the recovery codes that are shown only once
+func (s *Store) ConfirmEnrolment(userId int, code string) ([]string, error) {
+	secret, enabled, err := s.getSecret(userId)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE user_two_factor SET enabled_at = CURRENT_TIMESTAMP, last_used_step = $1 WHERE user_id = $2",
+		step, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two factor: %w", err)
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *Store) Disable(userId int, code string) error {
+	if err := s.VerifyCode(userId, code); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM two_factor_recovery_codes WHERE user_id = $1", userId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_two_factor WHERE user_id = $1", userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) RegenerateRecoveryCodes(userId int, code string) ([]string, error) {
+	if err := s.VerifyCode(userId, code); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyCode accepts either a TOTP code or an unused recovery code. A TOTP code can
+// only be used once, so a code seen by someone else can't be replayed within its window.
+func (s *Store) VerifyCode(userId int, code string) error {
+	secret, enabled, err := s.getSecret(userId)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := auth.ValidateTOTP(secret, code, time.Now()); ok {
+		result, err := db.ExecWithValidation(s.db,
+			"UPDATE user_two_factor SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1",
+			step, userId)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	result, err := db.ExecWithValidation(s.db,
+		"UPDATE two_factor_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userId, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return ErrInvalidCode
+	}
+
+	return nil
+}
+
+// StartChallengeAttempt counts the attempt before the code is checked, so parallel guesses
+// can't try more codes than allowed. A token that already earned a session is rejected.
+func (s *Store) StartChallengeAttempt(tokenId string, userId int, expiresAt time.Time) error {
+	if _, err := db.ExecWithValidation(s.db, "DELETE FROM two_factor_challenges WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("failed to delete expired challenges: %w", err)
+	}
+
+	var attempts int
+	err := s.db.QueryRow(
+		`INSERT INTO two_factor_challenges (token_id, user_id, attempts, expires_at)
+		 VALUES ($1, $2, 1, $3)
+		 ON CONFLICT (token_id) DO UPDATE SET attempts = two_factor_challenges.attempts + 1
+		 WHERE two_factor_challenges.completed_at IS NULL AND two_factor_challenges.attempts < $4
+		 RETURNING attempts`,
+		tokenId, userId, expiresAt, MaxChallengeAttempts,
+	).Scan(&attempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrChallengeUsed
+		}
+		return fmt.Errorf("failed to record two factor attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) CompleteChallenge(tokenId string) error {
+	result, err := db.ExecWithValidation(s.db,
+		"UPDATE two_factor_challenges SET completed_at = CURRENT_TIMESTAMP WHERE token_id = $1 AND completed_at IS NULL",
+		tokenId)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return ErrChallengeUsed
+	}
+
+	return nil
+}
+
+func (s *Store) getSecret(userId int) (string, bool, error) {
+	var encrypted string
+	var enabled bool
+	err := s.db.QueryRow(
+		"SELECT secret_encrypted, enabled_at IS NOT NULL FROM user_two_factor WHERE user_id = $1",
+		userId,
+	).Scan(&encrypted, &enabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, ErrNoEnrolment
+		}
+		return "", false, err
+	}
+
+	secret, err := decryptSecret(encrypted)
+	if err != nil {
+		return "", false, err
+	}
+
+	return secret, enabled, nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userId int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM two_factor_recovery_codes WHERE user_id = $1", userId); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := utils.GenerateToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+
+		_, err = tx.Exec(
+			"INSERT INTO two_factor_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userId, hashRecoveryCode(code))
+		if err != nil {
+			return nil, fmt.Errorf("failed to save recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case and dashes so codes can be typed loosely
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hash := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(hash[:])
+}
+
+// TOTP secrets must be readable to verify codes, so they are encrypted rather than hashed
+func encryptionKey() []byte {
+	key := sha256.Sum256([]byte(config.Envs.TwoFactorEncryptionKey))
+	return key[:]
+}
+
+func encryptSecret(secret string) (string, error) {
+	block, err := aes.NewCipher(encryptionKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(encryptionKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted secret")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt two factor secret: %w", err)
+	}
+
+	return string(plain), nil
+}
@@ -0,0 +1,28 @@
+package two_factor
+
+import "testing"
+
+func TestSecretEncryption(t *testing.T) {
+	encrypted, err := encryptSecret("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if encrypted == "JBSWY3DPEHPK3PXP" {
+		t.Fatal("expected the secret to be encrypted")
+	}
+
+	secret, err := decryptSecret(encrypted)
+	if err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("expected the original secret, got %q (%v)", secret, err)
+	}
+
+	if _, err := decryptSecret(encrypted[:len(encrypted)-4] + "AAAA"); err == nil {
+		t.Error("expected tampered ciphertext to be rejected")
+	}
+}
+
+func TestHashRecoveryCodeIgnoresFormatting(t *testing.T) {
+	if hashRecoveryCode("a1b2c-3d4e5") != hashRecoveryCode(" A1B2C3D4E5 ") {
+		t.Error("expected recovery codes to match regardless of case and dashes")
+	}
+}
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+	emailChangeTTL       = 24 * time.Hour
+)
+
+func verificationEmail(user *types.User, token string) *types.MailMessage {
+	link := frontendLink("/verify-email", token)
+	return &types.MailMessage{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not create an account you can ignore this email.\n",
+			user.FirstName, link, int(emailVerificationTTL.Hours())),
+	}
+}
+
+func passwordResetEmail(user *types.User, token string) *types.MailMessage {
+	link := frontendLink("/reset-password", token)
+	return &types.MailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. Open the link below to choose a new one:\n\n%s\n\n"+
+			"The link expires in %d minutes and can only be used once. If you did not ask for this you can ignore this email.\n",
+			user.FirstName, link, int(passwordResetTTL.Minutes())),
+	}
+}
+
+// emailChangeEmail goes to the new address, the change only happens once it is confirmed
+func emailChangeEmail(user *types.User, newEmail, token string) *types.MailMessage {
+	link := frontendLink("/confirm-email-change", token)
+	return &types.MailMessage{
+		To:      newEmail,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that you want to use this address for your account by opening the link below:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not ask for this you can ignore this email.\n",
+			user.FirstName, link, int(emailChangeTTL.Hours())),
+	}
+}
+
+// securityNotice tells the old address about a sensitive change, in case it wasn't the owner
+func securityNotice(user *types.User, subject, change string) *types.MailMessage {
+	return &types.MailMessage{
+		To:      user.Email,
+		Subject: subject,
+		Body: fmt.Sprintf("Hi %s,\n\n%s\n\n"+
+			"If this was you there is nothing else to do. If it wasn't, reset your password right away at %s.\n",
+			user.FirstName, change, config.Envs.FrontendUrl+"/forgot-password"),
+	}
+}
+
+func frontendLink(path, token string) string {
+	return config.Envs.FrontendUrl + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,294 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/login_guard"
+	"github.com/lucas-remigio/wallet-tracker/service/session"
+	"github.com/lucas-remigio/wallet-tracker/service/webauthn"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+// the browser gives up on the ceremony after this many milliseconds
+const passkeyTimeout = 5 * 60 * 1000
+
+var errPasskeyLoginFailed = fmt.Errorf("passkey login failed")
+
+func (h *Handler) registerPasskeyRoutes(router *http.ServeMux) {
+	router.HandleFunc("/auth/passkeys", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.handleGetPasskeys,
+		}),
+	))
+	router.HandleFunc("/auth/passkeys/{id}", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodDelete: h.handleDeletePasskey,
+		}),
+	))
+	router.HandleFunc("/auth/passkeys/register/begin", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.handleBeginPasskeyRegistration,
+		}),
+	))
+	router.HandleFunc("/auth/passkeys/register/finish", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.handleFinishPasskeyRegistration,
+		}),
+	))
+	// passwordless login, no authentication yet
+	router.HandleFunc("/auth/passkeys/login/begin", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodPost: h.handleBeginPasskeyLogin,
+	}))
+	router.HandleFunc("/auth/passkeys/login/finish", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodPost: h.handleFinishPasskeyLogin,
+	}))
+}
+
+func relyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:     config.Envs.WebAuthnRPID,
+		Name:   config.Envs.WebAuthnRPName,
+		Origin: config.Envs.WebAuthnOrigin,
+	}
+}
+
+// userHandle is the opaque user id stored inside the passkey
+func userHandle(userId int) string {
+	return webauthn.EncodeBase64([]byte(strconv.Itoa(userId)))
+}
+
+func (h *Handler) handleGetPasskeys(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	passkeys, err := h.passkeyStore.GetPasskeysByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"passkeys": passkeys,
+	}
+
+	middleware.WriteDataResponse(w, response)
+}
+
+func (h *Handler) handleDeletePasskey(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// extract passkey ID from URL path (/auth/passkeys/{id})
+	passkeyId, ok := middleware.ExtractPathParamAsIntAndRespond(w, r, 2)
+	if !ok {
+		return
+	}
+
+	if err := h.passkeyStore.DeletePasskey(passkeyId, userId); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// handleBeginPasskeyRegistration returns the options for navigator.credentials.create
+func (h *Handler) handleBeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.store.GetUserById(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	existing, err := h.passkeyStore.GetPasskeysByUserId(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	challenge, err := h.passkeyStore.CreateChallenge(userId, types.PasskeyCeremonyRegistration)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the same authenticator can't be registered twice
+	exclude := []types.PasskeyCredentialRef{}
+	for _, passkey := range existing {
+		exclude = append(exclude, types.PasskeyCredentialRef{Type: "public-key", ID: passkey.CredentialID})
+	}
+
+	rp := relyingParty()
+	middleware.WriteDataResponse(w, types.PasskeyRegistrationOptions{
+		Challenge: challenge,
+		RP:        types.PasskeyRelyingParty{ID: rp.ID, Name: rp.Name},
+		User: types.PasskeyUser{
+			ID:          userHandle(userId),
+			Name:        user.Email,
+			DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+		},
+		PubKeyCredParams: []types.PasskeyCredentialParam{
+			{Type: "public-key", Alg: webauthn.AlgES256},
+			{Type: "public-key", Alg: webauthn.AlgRS256},
+		},
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: types.PasskeyAuthenticatorRules{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+		Timeout:     passkeyTimeout,
+	})
+}
+
+func (h *Handler) handleFinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.FinishPasskeyRegistrationPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	challengeUserId, err := h.passkeyStore.ConsumeChallenge(payload.Challenge, types.PasskeyCeremonyRegistration)
+	if err != nil || challengeUserId != userId {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("passkey challenge expired or invalid"))
+		return
+	}
+
+	clientDataJSON, err1 := webauthn.DecodeBase64(payload.ClientDataJSON)
+	attestationObject, err2 := webauthn.DecodeBase64(payload.AttestationObject)
+	if err := errors.Join(err1, err2); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid base64url encoding: %w", err))
+		return
+	}
+
+	credential, err := relyingParty().VerifyRegistration(payload.Challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.passkeyStore.AddPasskey(&types.Passkey{
+		UserID:       userId,
+		CredentialID: webauthn.EncodeBase64(credential.ID),
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		Name:         payload.Name,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteCreatedResponse(w)
+}
+
+// handleBeginPasskeyLogin returns the options for navigator.credentials.get
+func (h *Handler) handleBeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	// anyone can ask for a challenge, so every one counts against the IP until its login succeeds
+	wait, err := h.loginGuard.Attempt("", middleware.GetClientIP(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if wait > 0 {
+		login_guard.WriteTooManyAttempts(w, wait)
+		return
+	}
+
+	challenge, err := h.passkeyStore.CreateChallenge(0, types.PasskeyCeremonyLogin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, types.PasskeyLoginOptions{
+		Challenge:        challenge,
+		RPID:             relyingParty().ID,
+		UserVerification: "required",
+		Timeout:          passkeyTimeout,
+	})
+}
+
+// handleFinishPasskeyLogin verifies the assertion and opens a session. Every failure
+// gets the same answer so the response doesn't reveal which credentials exist.
+func (h *Handler) handleFinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	// parse and validate JSON payload
+	var payload types.FinishPasskeyLoginPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	if _, err := h.passkeyStore.ConsumeChallenge(payload.Challenge, types.PasskeyCeremonyLogin); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, errPasskeyLoginFailed)
+		return
+	}
+
+	passkey, err := h.passkeyStore.GetPasskeyByCredentialId(payload.CredentialID)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, errPasskeyLoginFailed)
+		return
+	}
+	if payload.UserHandle != "" && payload.UserHandle != userHandle(passkey.UserID) {
+		utils.WriteError(w, http.StatusUnauthorized, errPasskeyLoginFailed)
+		return
+	}
+
+	clientDataJSON, err1 := webauthn.DecodeBase64(payload.ClientDataJSON)
+	authenticatorData, err2 := webauthn.DecodeBase64(payload.AuthenticatorData)
+	signature, err3 := webauthn.DecodeBase64(payload.Signature)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid base64url encoding: %w", err))
+		return
+	}
+
+	signCount, err := relyingParty().VerifyAssertion(payload.Challenge, passkey.PublicKey, passkey.SignCount,
+		clientDataJSON, authenticatorData, signature)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCountRollback) {
+			log.Printf("passkey %d of user %d presented an old sign counter, possible clone", passkey.ID, passkey.UserID)
+		}
+		utils.WriteError(w, http.StatusUnauthorized, errPasskeyLoginFailed)
+		return
+	}
+	// a passkey replaces the password and the second factor only when it verified the user
+	if !webauthn.UserVerified(authenticatorData) {
+		utils.WriteError(w, http.StatusUnauthorized, errPasskeyLoginFailed)
+		return
+	}
+
+	if err := h.passkeyStore.UpdateSignCount(passkey.ID, signCount); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !session.StartSession(w, r, h.sessionStore, passkey.UserID) {
+		return
+	}
+	if err := h.loginGuard.Release("", middleware.GetClientIP(r)); err != nil {
+		log.Printf("failed to take back passkey login attempt: %v", err)
+	}
+}
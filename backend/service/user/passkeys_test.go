@@ -0,0 +1,283 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/config"
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/login_guard"
+	"github.com/lucas-remigio/wallet-tracker/service/webauthn/webauthntest"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func performAuthenticatedRequest(handler http.HandlerFunc, userId int, method, path string, body interface{}) *httptest.ResponseRecorder {
+	marshalled, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(marshalled))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userId))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func newTestAuthenticator() *webauthntest.Authenticator {
+	return webauthntest.NewAuthenticator(config.Envs.WebAuthnRPID, config.Envs.WebAuthnOrigin)
+}
+
+// registerPasskey runs both registration steps for user 1 and fails the test if they don't succeed
+func registerPasskey(t *testing.T, handler *Handler, authenticator *webauthntest.Authenticator) {
+	t.Helper()
+
+	rr := performAuthenticatedRequest(handler.handleBeginPasskeyRegistration, 1, http.MethodPost, "/auth/passkeys/register/begin", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var options types.PasskeyRegistrationOptions
+	json.Unmarshal(rr.Body.Bytes(), &options)
+
+	registration := authenticator.Register(options.Challenge, "none")
+	payload := types.FinishPasskeyRegistrationPayload{
+		Challenge:         options.Challenge,
+		Name:              "Laptop",
+		ClientDataJSON:    webauthntest.Base64(registration.ClientDataJSON),
+		AttestationObject: webauthntest.Base64(registration.AttestationObject),
+	}
+	rr = performAuthenticatedRequest(handler.handleFinishPasskeyRegistration, 1, http.MethodPost, "/auth/passkeys/register/finish", payload)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+}
+
+func beginPasskeyLogin(t *testing.T, handler *Handler) string {
+	t.Helper()
+
+	rr := performRequest(handler.handleBeginPasskeyLogin, http.MethodPost, "/auth/passkeys/login/begin", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var options types.PasskeyLoginOptions
+	json.Unmarshal(rr.Body.Bytes(), &options)
+	return options.Challenge
+}
+
+func passkeyLoginPayload(challenge string, authenticator *webauthntest.Authenticator, assertion *webauthntest.Assertion) types.FinishPasskeyLoginPayload {
+	return types.FinishPasskeyLoginPayload{
+		Challenge:         challenge,
+		CredentialID:      webauthntest.Base64(authenticator.CredentialID),
+		ClientDataJSON:    webauthntest.Base64(assertion.ClientDataJSON),
+		AuthenticatorData: webauthntest.Base64(assertion.AuthenticatorData),
+		Signature:         webauthntest.Base64(assertion.Signature),
+		UserHandle:        userHandle(1),
+	}
+}
+
+func newPasskeyTestHandler(passkeys *mockPasskeyStore) *Handler {
+	return NewHandlerForTesting(&mockUserStoreSuccess{}, &mockSessionStore{}, &mockTwoFactorStore{}, &mockTokenStore{}, &mockMailer{}, newTestLoginGuard(), passkeys)
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	passkeys := &mockPasskeyStore{}
+	handler := newPasskeyTestHandler(passkeys)
+	authenticator := newTestAuthenticator()
+
+	registerPasskey(t, handler, authenticator)
+	if len(passkeys.passkeys) != 1 || passkeys.passkeys[0].UserID != 1 || passkeys.passkeys[0].Name != "Laptop" {
+		t.Fatalf("expected one passkey for user 1, got %v", passkeys.passkeys)
+	}
+
+	challenge := beginPasskeyLogin(t, handler)
+	payload := passkeyLoginPayload(challenge, authenticator, authenticator.Assert(challenge))
+	rr := performRequest(handler.handleFinishPasskeyLogin, http.MethodPost, "/auth/passkeys/login/finish", payload)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var responseBody map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &responseBody)
+	if token, _ := responseBody["token"].(string); token == "" {
+		t.Errorf("expected an access token, got %v", responseBody)
+	}
+	if passkeys.passkeys[0].SignCount != authenticator.SignCount {
+		t.Errorf("expected the stored sign count to be %d, got %d", authenticator.SignCount, passkeys.passkeys[0].SignCount)
+	}
+
+	// each challenge can only be answered once
+	rr = performRequest(handler.handleFinishPasskeyLogin, http.MethodPost, "/auth/passkeys/login/finish", payload)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d when replaying the assertion, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestPasskeyRegistrationRequiresOwnChallenge(t *testing.T) {
+	passkeys := &mockPasskeyStore{}
+	handler := newPasskeyTestHandler(passkeys)
+	authenticator := newTestAuthenticator()
+
+	rr := performAuthenticatedRequest(handler.handleBeginPasskeyRegistration, 1, http.MethodPost, "/auth/passkeys/register/begin", nil)
+	var options types.PasskeyRegistrationOptions
+	json.Unmarshal(rr.Body.Bytes(), &options)
+
+	registration := authenticator.Register(options.Challenge, "none")
+	payload := types.FinishPasskeyRegistrationPayload{
+		Challenge:         options.Challenge,
+		Name:              "Laptop",
+		ClientDataJSON:    webauthntest.Base64(registration.ClientDataJSON),
+		AttestationObject: webauthntest.Base64(registration.AttestationObject),
+	}
+	rr = performAuthenticatedRequest(handler.handleFinishPasskeyRegistration, 2, http.MethodPost, "/auth/passkeys/register/finish", payload)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a challenge of another user, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if len(passkeys.passkeys) != 0 {
+		t.Errorf("expected no passkey to be saved, got %d", len(passkeys.passkeys))
+	}
+}
+
+func TestPasskeyLoginRejectsClonedCredential(t *testing.T) {
+	passkeys := &mockPasskeyStore{}
+	handler := newPasskeyTestHandler(passkeys)
+	authenticator := newTestAuthenticator()
+	registerPasskey(t, handler, authenticator)
+
+	// the server has seen a higher counter than the one this copy of the key reports
+	passkeys.passkeys[0].SignCount = 10
+
+	challenge := beginPasskeyLogin(t, handler)
+	payload := passkeyLoginPayload(challenge, authenticator, authenticator.Assert(challenge))
+	rr := performRequest(handler.handleFinishPasskeyLogin, http.MethodPost, "/auth/passkeys/login/finish", payload)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if passkeys.passkeys[0].SignCount != 10 {
+		t.Errorf("expected the sign count to stay at 10, got %d", passkeys.passkeys[0].SignCount)
+	}
+}
+
+func TestPasskeyLoginRejectsUnknownCredential(t *testing.T) {
+	handler := newPasskeyTestHandler(&mockPasskeyStore{})
+	authenticator := newTestAuthenticator()
+
+	challenge := beginPasskeyLogin(t, handler)
+	payload := passkeyLoginPayload(challenge, authenticator, authenticator.Assert(challenge))
+	rr := performRequest(handler.handleFinishPasskeyLogin, http.MethodPost, "/auth/passkeys/login/finish", payload)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestBeginPasskeyLoginIsLimitedPerIP(t *testing.T) {
+	handler := newPasskeyTestHandler(&mockPasskeyStore{})
+
+	for i := 0; i < login_guard.IPPolicy.BackoffAfter; i++ {
+		beginPasskeyLogin(t, handler)
+	}
+
+	rr := performRequest(handler.handleBeginPasskeyLogin, http.MethodPost, "/auth/passkeys/login/begin", nil)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+}
+
+func TestDeletePasskey(t *testing.T) {
+	passkeys := &mockPasskeyStore{}
+	handler := newPasskeyTestHandler(passkeys)
+	authenticator := newTestAuthenticator()
+	registerPasskey(t, handler, authenticator)
+	path := fmt.Sprintf("/auth/passkeys/%d", passkeys.passkeys[0].ID)
+
+	// another user can't remove it
+	rr := performAuthenticatedRequest(handler.handleDeletePasskey, 2, http.MethodDelete, path, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	rr = performAuthenticatedRequest(handler.handleDeletePasskey, 1, http.MethodDelete, path, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	// the removed passkey can no longer sign in
+	challenge := beginPasskeyLogin(t, handler)
+	payload := passkeyLoginPayload(challenge, authenticator, authenticator.Assert(challenge))
+	rr = performRequest(handler.handleFinishPasskeyLogin, http.MethodPost, "/auth/passkeys/login/finish", payload)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+type mockPasskeyStore struct {
+	challenges map[string]passkeyChallenge
+	passkeys   []*types.Passkey
+}
+
+type passkeyChallenge struct {
+	userId   int
+	ceremony string
+}
+
+func (m *mockPasskeyStore) CreateChallenge(userId int, ceremony string) (string, error) {
+	if m.challenges == nil {
+		m.challenges = map[string]passkeyChallenge{}
+	}
+	challenge := fmt.Sprintf("challenge-%d", len(m.challenges)+1)
+	m.challenges[challenge] = passkeyChallenge{userId: userId, ceremony: ceremony}
+	return challenge, nil
+}
+
+func (m *mockPasskeyStore) ConsumeChallenge(challenge, ceremony string) (int, error) {
+	stored, exists := m.challenges[challenge]
+	if !exists || stored.ceremony != ceremony {
+		return 0, fmt.Errorf("passkey challenge expired or already used")
+	}
+	// keep the key so the next challenge gets a new number
+	m.challenges[challenge] = passkeyChallenge{}
+	return stored.userId, nil
+}
+
+func (m *mockPasskeyStore) AddPasskey(passkey *types.Passkey) error {
+	passkey.ID = len(m.passkeys) + 1
+	m.passkeys = append(m.passkeys, passkey)
+	return nil
+}
+
+func (m *mockPasskeyStore) GetPasskeysByUserId(userId int) ([]*types.Passkey, error) {
+	passkeys := []*types.Passkey{}
+	for _, passkey := range m.passkeys {
+		if passkey.UserID == userId {
+			passkeys = append(passkeys, passkey)
+		}
+	}
+	return passkeys, nil
+}
+
+func (m *mockPasskeyStore) GetPasskeyByCredentialId(credentialId string) (*types.Passkey, error) {
+	for _, passkey := range m.passkeys {
+		if passkey.CredentialID == credentialId {
+			return passkey, nil
+		}
+	}
+	return nil, fmt.Errorf("passkey not found")
+}
+
+func (m *mockPasskeyStore) UpdateSignCount(passkeyId int, signCount uint32) error {
+	for _, passkey := range m.passkeys {
+		if passkey.ID == passkeyId {
+			passkey.SignCount = signCount
+		}
+	}
+	return nil
+}
+
+func (m *mockPasskeyStore) DeletePasskey(passkeyId int, userId int) error {
+	for i, passkey := range m.passkeys {
+		if passkey.ID == passkeyId && passkey.UserID == userId {
+			m.passkeys = append(m.passkeys[:i], m.passkeys[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("passkey not found")
+}
@@ -0,0 +1,215 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/types"
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+var errIncorrectPassword = fmt.Errorf("current password is incorrect")
+
+func (h *Handler) registerProfileRoutes(router *http.ServeMux) {
+	router.HandleFunc("/auth/profile", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodGet: h.handleGetProfile,
+			http.MethodPut: h.handleUpdateProfile,
+		}),
+	))
+	router.HandleFunc("/auth/change-password", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.handleChangePassword,
+		}),
+	))
+	router.HandleFunc("/auth/change-email", middleware.AuthMiddleware(
+		middleware.MethodRouter(map[string]http.HandlerFunc{
+			http.MethodPost: h.handleChangeEmail,
+		}),
+	))
+	// opened from the link in the email, the token identifies the user
+	router.HandleFunc("/auth/confirm-email-change", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodPost: h.handleConfirmEmailChange,
+	}))
+}
+
+func (h *Handler) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	// require authentication
+	userId, ok := middleware.RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.store.GetUserById(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	middleware.WriteDataResponse(w, user)
+}
+
+func (h *Handler) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	// require a login session, access tokens can't edit the account
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.UpdateProfilePayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	if err := h.store.UpdateProfile(userId, payload.FirstName, payload.LastName); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	// require a login session, access tokens can't edit the account
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.ChangePasswordPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	user, err := h.store.GetUserById(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if !auth.CheckPasswordHash([]byte(payload.CurrentPassword), user.Password) {
+		utils.WriteError(w, http.StatusBadRequest, errIncorrectPassword)
+		return
+	}
+
+	if err := h.store.ValidatePassword(payload.NewPassword); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.NewPassword)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.UpdatePassword(userId, hashedPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the device making the change stays logged in, every other one is logged out
+	currentSessionId, _ := middleware.GetSessionIDFromContext(r)
+	if err := h.sessionStore.RevokeOtherSessions(userId, currentSessionId); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.sendSecurityNotice(user, "Your password was changed", "The password of your account was just changed.")
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// handleChangeEmail sends a confirmation link to the new address, the email only
+// changes once the link is opened
+func (h *Handler) handleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	// require a login session, access tokens can't edit the account
+	userId, ok := middleware.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// parse and validate JSON payload
+	var payload types.ChangeEmailPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	user, err := h.store.GetUserById(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if !auth.CheckPasswordHash([]byte(payload.Password), user.Password) {
+		utils.WriteError(w, http.StatusBadRequest, errIncorrectPassword)
+		return
+	}
+
+	if strings.EqualFold(payload.Email, user.Email) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("this is already your email"))
+		return
+	}
+	if _, err := h.store.GetUserByEmail(payload.Email); err == nil {
+		utils.WriteError(w, http.StatusBadRequest, ErrEmailTaken)
+		return
+	}
+
+	if err := h.store.SetPendingEmail(userId, payload.Email); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := h.tokenStore.CreateToken(userId, types.TokenPurposeEmailChange, emailChangeTTL)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.mailer.Send(emailChangeEmail(user, payload.Email, token)); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to send confirmation email: %w", err))
+		return
+	}
+
+	h.sendSecurityNotice(user, "Your email is being changed",
+		fmt.Sprintf("We received a request to change the email of your account to %s. "+
+			"This address keeps working until the new one is confirmed.", payload.Email))
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) handleConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	// parse and validate JSON payload
+	var payload types.VerifyEmailPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	userId, err := h.tokenStore.ConsumeToken(payload.Token, types.TokenPurposeEmailChange)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.store.ConfirmPendingEmail(userId); err != nil {
+		if errors.Is(err, ErrEmailTaken) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// sendSecurityNotice only logs failures, the change itself already happened
+func (h *Handler) sendSecurityNotice(user *types.User, subject, change string) {
+	if err := h.mailer.Send(securityNotice(user, subject, change)); err != nil {
+		log.Printf("failed to send security notice to user %d: %v", user.ID, err)
+	}
+}
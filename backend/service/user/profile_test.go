@@ -0,0 +1,253 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/middleware"
+	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/types"
+)
+
+func newProfileTestHandler(users *mockProfileUserStore, sessions *mockSessionStore, mailer *mockMailer) *Handler {
+	return NewHandlerForTesting(users, sessions, &mockTwoFactorStore{}, &mockTokenStore{}, mailer, newTestLoginGuard(), &mockPasskeyStore{})
+}
+
+func TestUpdateProfile(t *testing.T) {
+	users := newMockProfileUserStore()
+	handler := newProfileTestHandler(users, &mockSessionStore{}, &mockMailer{})
+
+	payload := types.UpdateProfilePayload{FirstName: "Maria", LastName: "Silva"}
+	rr := performAuthenticatedRequest(handler.handleUpdateProfile, 1, http.MethodPut, "/auth/profile", payload)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if users.user.FirstName != "Maria" || users.user.LastName != "Silva" {
+		t.Errorf("expected the name to be updated, got %s %s", users.user.FirstName, users.user.LastName)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	users := newMockProfileUserStore()
+	sessions := &mockSessionStore{}
+	mailer := &mockMailer{}
+	handler := newProfileTestHandler(users, sessions, mailer)
+
+	// the current password is required
+	payload := types.ChangePasswordPayload{CurrentPassword: "wrong-password", NewPassword: "NewPassword1!"}
+	rr := performAuthenticatedRequest(handler.handleChangePassword, 1, http.MethodPost, "/auth/change-password", payload)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a wrong current password, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	payload.CurrentPassword = "OldPassword1!"
+	rr = performAuthenticatedRequest(handler.handleChangePassword, 1, http.MethodPost, "/auth/change-password", payload)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if !auth.CheckPasswordHash([]byte("NewPassword1!"), users.user.Password) {
+		t.Error("expected the new password to be stored")
+	}
+	if len(sessions.revokedUsers) != 1 || sessions.revokedUsers[0] != 1 {
+		t.Errorf("expected the other sessions of user 1 to be revoked, got %v", sessions.revokedUsers)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "old@mail.pt" {
+		t.Errorf("expected a notice to the account email, got %v", mailer.sent)
+	}
+}
+
+func TestChangePasswordValidatesNewPassword(t *testing.T) {
+	users := newMockProfileUserStore()
+	users.rejectPasswords = true
+	handler := newProfileTestHandler(users, &mockSessionStore{}, &mockMailer{})
+
+	payload := types.ChangePasswordPayload{CurrentPassword: "OldPassword1!", NewPassword: "weakpassword"}
+	rr := performAuthenticatedRequest(handler.handleChangePassword, 1, http.MethodPost, "/auth/change-password", payload)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if !auth.CheckPasswordHash([]byte("OldPassword1!"), users.user.Password) {
+		t.Error("expected the old password to be kept")
+	}
+}
+
+func TestChangeEmailFlow(t *testing.T) {
+	users := newMockProfileUserStore()
+	mailer := &mockMailer{}
+	handler := newProfileTestHandler(users, &mockSessionStore{}, mailer)
+
+	payload := types.ChangeEmailPayload{Email: "new@mail.pt", Password: "OldPassword1!"}
+	rr := performAuthenticatedRequest(handler.handleChangeEmail, 1, http.MethodPost, "/auth/change-email", payload)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if users.user.Email != "old@mail.pt" {
+		t.Errorf("expected the email to stay the same until confirmed, got %s", users.user.Email)
+	}
+
+	recipients := map[string]*types.MailMessage{}
+	for _, message := range mailer.sent {
+		recipients[message.To] = message
+	}
+	if _, ok := recipients["old@mail.pt"]; !ok {
+		t.Error("expected a notice to the old address")
+	}
+	confirmation, ok := recipients["new@mail.pt"]
+	if !ok {
+		t.Fatal("expected a confirmation email to the new address")
+	}
+	token := regexp.MustCompile(`token=([0-9a-f]{64})`).FindStringSubmatch(confirmation.Body)
+	if token == nil {
+		t.Fatalf("expected a confirmation link, got %q", confirmation.Body)
+	}
+
+	rr = performRequest(handler.handleConfirmEmailChange, http.MethodPost, "/auth/confirm-email-change", types.VerifyEmailPayload{Token: token[1]})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if users.user.Email != "new@mail.pt" || !users.user.EmailVerified {
+		t.Errorf("expected the verified new email, got %s (verified %v)", users.user.Email, users.user.EmailVerified)
+	}
+
+	// tokens are single use
+	rr = performRequest(handler.handleConfirmEmailChange, http.MethodPost, "/auth/confirm-email-change", types.VerifyEmailPayload{Token: token[1]})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d when reusing the token, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestChangeEmailRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload types.ChangeEmailPayload
+	}{
+		{"wrong password", types.ChangeEmailPayload{Email: "new@mail.pt", Password: "wrong-password"}},
+		{"email in use", types.ChangeEmailPayload{Email: "taken@mail.pt", Password: "OldPassword1!"}},
+		{"same email", types.ChangeEmailPayload{Email: "OLD@mail.pt", Password: "OldPassword1!"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			users := newMockProfileUserStore()
+			mailer := &mockMailer{}
+			handler := newProfileTestHandler(users, &mockSessionStore{}, mailer)
+
+			rr := performAuthenticatedRequest(handler.handleChangeEmail, 1, http.MethodPost, "/auth/change-email", tc.payload)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+			if users.user.PendingEmail != "" || len(mailer.sent) != 0 {
+				t.Error("expected no email change to start")
+			}
+		})
+	}
+}
+
+func TestAccountChangesRequireSession(t *testing.T) {
+	handler := newProfileTestHandler(newMockProfileUserStore(), &mockSessionStore{}, &mockMailer{})
+	payload := types.ChangePasswordPayload{CurrentPassword: "OldPassword1!", NewPassword: "NewPassword1!"}
+
+	rr := performAuthenticatedRequest(func(w http.ResponseWriter, r *http.Request) {
+		// requests made with a personal access token carry its scopes
+		ctx := context.WithValue(r.Context(), middleware.ScopesKey, types.AccessTokenScopes)
+		handler.handleChangePassword(w, r.WithContext(ctx))
+	}, 1, http.MethodPost, "/auth/change-password", payload)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestExportRequiresSession(t *testing.T) {
+	handler := newProfileTestHandler(newMockProfileUserStore(), &mockSessionStore{}, &mockMailer{})
+
+	rr := performAuthenticatedRequest(func(w http.ResponseWriter, r *http.Request) {
+		// even a token with the read scope can't download the whole account
+		ctx := context.WithValue(r.Context(), middleware.ScopesKey, []string{types.ScopeRead})
+		handler.handleExportData(w, r.WithContext(ctx))
+	}, 1, http.MethodGet, "/auth/export-data", nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+// mockProfileUserStore holds a single user with id 1, taken@mail.pt belongs to someone else
+type mockProfileUserStore struct {
+	user            *types.User
+	rejectPasswords bool
+}
+
+func newMockProfileUserStore() *mockProfileUserStore {
+	hashedPassword, _ := auth.HashPassword("OldPassword1!")
+	return &mockProfileUserStore{user: &types.User{
+		ID:        1,
+		FirstName: "Test",
+		LastName:  "User",
+		Email:     "old@mail.pt",
+		Password:  hashedPassword,
+	}}
+}
+
+func (m *mockProfileUserStore) GetUserByEmail(email string) (*types.User, error) {
+	if strings.EqualFold(email, m.user.Email) {
+		return m.user, nil
+	}
+	if email == "taken@mail.pt" {
+		return &types.User{ID: 2, Email: email}, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockProfileUserStore) GetUserById(id int) (*types.User, error) {
+	if id != m.user.ID {
+		return nil, fmt.Errorf("user not found")
+	}
+	return m.user, nil
+}
+
+func (m *mockProfileUserStore) CreateUser(user *types.User, templateLanguage string) error {
+	return nil
+}
+
+func (m *mockProfileUserStore) ValidatePassword(password string) error {
+	if m.rejectPasswords {
+		return fmt.Errorf("password is too weak")
+	}
+	return nil
+}
+
+func (m *mockProfileUserStore) DeleteUser(userId int) error { return nil }
+
+func (m *mockProfileUserStore) MarkEmailVerified(userId int) error {
+	m.user.EmailVerified = true
+	return nil
+}
+
+func (m *mockProfileUserStore) UpdatePassword(userId int, hashedPassword string) error {
+	m.user.Password = hashedPassword
+	return nil
+}
+
+func (m *mockProfileUserStore) UpdateProfile(userId int, firstName, lastName string) error {
+	m.user.FirstName = firstName
+	m.user.LastName = lastName
+	return nil
+}
+
+func (m *mockProfileUserStore) SetPendingEmail(userId int, email string) error {
+	m.user.PendingEmail = email
+	return nil
+}
+
+func (m *mockProfileUserStore) ConfirmPendingEmail(userId int) (string, error) {
+	if m.user.PendingEmail == "" {
+		return "", fmt.Errorf("no email change pending")
+	}
+	m.user.Email = m.user.PendingEmail
+	m.user.PendingEmail = ""
+	m.user.EmailVerified = true
+	return m.user.Email, nil
+}
@@ -2,39 +2,63 @@ package user
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/lucas-remigio/wallet-tracker/config"
 	"github.com/lucas-remigio/wallet-tracker/middleware"
 	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/service/login_guard"
+	"github.com/lucas-remigio/wallet-tracker/service/session"
 	"github.com/lucas-remigio/wallet-tracker/types"
 	"github.com/lucas-remigio/wallet-tracker/utils"
 )
 
 // testing v
-func NewHandlerForTesting(userStore types.UserStore) *Handler {
+func NewHandlerForTesting(userStore types.UserStore, sessionStore types.SessionStore, twoFactorStore types.TwoFactorStore, tokenStore types.UserTokenStore, mailer types.Mailer, loginGuard types.LoginGuard, passkeyStore types.PasskeyStore) *Handler {
 	return &Handler{
 		store:            userStore,
+		sessionStore:     sessionStore,
+		twoFactorStore:   twoFactorStore,
+		loginGuard:       loginGuard,
+		passkeyStore:     passkeyStore,
+		tokenStore:       tokenStore,
+		mailer:           mailer,
 		accountStore:     nil, // Not needed for basic user tests
 		categoryStore:    nil,
 		transactionStore: nil,
+		auditStore:       nil,
 	}
 }
 
 type Handler struct {
 	store            types.UserStore
+	sessionStore     types.SessionStore
+	twoFactorStore   types.TwoFactorStore
+	loginGuard       types.LoginGuard
+	passkeyStore     types.PasskeyStore
+	tokenStore       types.UserTokenStore
+	mailer           types.Mailer
 	accountStore     types.AccountStore
 	categoryStore    types.CategoryStore
 	transactionStore types.TransactionStore
+	auditStore       types.AuditStore
 }
 
-func NewHandler(store types.UserStore, accountStore types.AccountStore, categoryStore types.CategoryStore, transactionStore types.TransactionStore) *Handler {
+func NewHandler(store types.UserStore, sessionStore types.SessionStore, twoFactorStore types.TwoFactorStore, loginGuard types.LoginGuard, passkeyStore types.PasskeyStore, tokenStore types.UserTokenStore, mailer types.Mailer, accountStore types.AccountStore, categoryStore types.CategoryStore, transactionStore types.TransactionStore, auditStore types.AuditStore) *Handler {
 	return &Handler{
 		store:            store,
+		sessionStore:     sessionStore,
+		twoFactorStore:   twoFactorStore,
+		loginGuard:       loginGuard,
+		passkeyStore:     passkeyStore,
+		tokenStore:       tokenStore,
+		mailer:           mailer,
 		accountStore:     accountStore,
 		categoryStore:    categoryStore,
 		transactionStore: transactionStore,
+		auditStore:       auditStore,
 	}
 }
 
@@ -44,6 +68,20 @@ func (h *Handler) RegisterRoutes(router *http.ServeMux) {
 	router.HandleFunc("/verify-token", middleware.AuthMiddleware(h.verifyToken))
 	router.HandleFunc("/auth/delete-account", middleware.AuthMiddleware(h.handleDeleteAccount))
 	router.HandleFunc("/auth/export-data", middleware.AuthMiddleware(h.handleExportData))
+	router.HandleFunc("/auth/verify-email", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodPost: h.handleVerifyEmail,
+	}))
+	router.HandleFunc("/auth/resend-verification", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodPost: h.handleResendVerification,
+	}))
+	router.HandleFunc("/auth/forgot-password", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodPost: h.handleForgotPassword,
+	}))
+	router.HandleFunc("/auth/reset-password", middleware.MethodRouter(map[string]http.HandlerFunc{
+		http.MethodPost: h.handleResetPassword,
+	}))
+	h.registerProfileRoutes(router)
+	h.registerPasskeyRoutes(router)
 }
 
 func (h *Handler) verifyToken(w http.ResponseWriter, r *http.Request) {
@@ -64,9 +102,24 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// slow down and lock out repeated failures, the same way for known and unknown emails. The
+	// attempt counts as a failure until the password turns out right.
+	ipAddress := middleware.GetClientIP(r)
+	wait, err := h.loginGuard.Attempt(payload.Email, ipAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if wait > 0 {
+		login_guard.WriteTooManyAttempts(w, wait)
+		return
+	}
+
 	// get the user from the store
 	user, err := h.store.GetUserByEmail(payload.Email)
 	if err != nil {
+		// compare anyway so unknown emails take as long as wrong passwords
+		auth.CheckPasswordHash([]byte(payload.Password), dummyPasswordHash)
 		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("not found, invalid email or password"))
 		return
 	}
@@ -77,30 +130,45 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	secret := []byte(config.Envs.JWTSecret)
-	token, err := auth.CreateJWT(secret, user.ID)
+	// the password was right, only a complete login resets the counters
+	if err := h.loginGuard.Release(payload.Email, ipAddress); err != nil {
+		log.Printf("failed to take back login attempt: %v", err)
+	}
+
+	if config.Envs.RequireEmailVerification && !user.EmailVerified {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("please verify your email before logging in"))
+		return
+	}
+
+	// with two factor enabled the password alone only earns an intermediate token
+	twoFactorEnabled, err := h.twoFactorStore.IsEnabled(user.ID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if twoFactorEnabled {
+		twoFactorToken, err := auth.CreateTwoFactorToken([]byte(config.Envs.JWTSecret), user.ID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		utils.WriteJson(w, http.StatusOK, types.TwoFactorChallenge{TwoFactorRequired: true, TwoFactorToken: twoFactorToken})
+		return
+	}
 
-	isSecure := r.TLS != nil
-	jwtExpiration := config.Envs.JWTExpirationInSeconds
-
-	// Set the authToken as a secure, HTTP-only cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "authToken",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,                    // Prevents client-side JavaScript from accessing the cookie
-		Secure:   isSecure,                // Only send the cookie over HTTPS
-		SameSite: http.SameSiteStrictMode, // Prevents CSRF attacks
-		MaxAge:   int(jwtExpiration),      // Token expires at the same time as the JWT
-	})
-
-	utils.WriteJson(w, http.StatusOK, map[string]string{"token": token})
+	// open a session and return the access and refresh tokens, the counters only reset
+	// once the login is complete
+	if !session.StartSession(w, r, h.sessionStore, user.ID) {
+		return
+	}
+	if err := h.loginGuard.RecordSuccess(payload.Email); err != nil {
+		log.Printf("failed to reset login attempts: %v", err)
+	}
 }
 
+// a valid bcrypt hash that no password matches
+const dummyPasswordHash = "$2a$10$dyOM33QW1Q06PjIv1eAH3.DQ7zYVQlVpGGOKtFzs6HF8Wwn/9x7se"
+
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -133,12 +201,13 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// create a new user
-	err = h.store.CreateUser(&types.User{
+	user := &types.User{
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Email:     payload.Email,
 		Password:  hashedPassword,
-	})
+	}
+	err = h.store.CreateUser(user, payload.Language)
 
 	if err != nil {
 		fmt.Println("Error during user creation:", err) // Debugging
@@ -146,9 +215,132 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the account exists at this point, a failed email can be resent later
+	if err := h.sendVerificationEmail(user); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	middleware.WriteCreatedResponse(w)
 }
 
+func (h *Handler) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	// parse and validate JSON payload
+	var payload types.VerifyEmailPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	userId, err := h.tokenStore.ConsumeToken(payload.Token, types.TokenPurposeEmailVerification)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.MarkEmailVerified(userId); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// handleResendVerification always answers with success so it can't be used to find registered emails
+func (h *Handler) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	// parse and validate JSON payload
+	var payload types.EmailPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	user, err := h.store.GetUserByEmail(payload.Email)
+	if err == nil && !user.EmailVerified {
+		if err := h.sendVerificationEmail(user); err != nil {
+			log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+// handleForgotPassword always answers with success so it can't be used to find registered emails
+func (h *Handler) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	// parse and validate JSON payload
+	var payload types.EmailPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	user, err := h.store.GetUserByEmail(payload.Email)
+	if err == nil {
+		if err := h.sendPasswordResetEmail(user); err != nil {
+			log.Printf("failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	// parse and validate JSON payload
+	var payload types.ResetPasswordPayload
+	if !middleware.ValidatePayloadAndRespond(w, r, &payload) {
+		return
+	}
+
+	if err := h.store.ValidatePassword(payload.Password); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.Password)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the token is only consumed once the new password is known to be valid
+	userId, err := h.tokenStore.ConsumeToken(payload.Token, types.TokenPurposePasswordReset)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.UpdatePassword(userId, hashedPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// receiving the reset email proves the user owns the address
+	if err := h.store.MarkEmailVerified(userId); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// log out every device, whoever knew the old password loses access
+	if err := h.sessionStore.RevokeOtherSessions(userId, ""); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	middleware.WriteSuccessResponse(w)
+}
+
+func (h *Handler) sendVerificationEmail(user *types.User) error {
+	token, err := h.tokenStore.CreateToken(user.ID, types.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(verificationEmail(user, token))
+}
+
+func (h *Handler) sendPasswordResetEmail(user *types.User) error {
+	token, err := h.tokenStore.CreateToken(user.ID, types.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(passwordResetEmail(user, token))
+}
+
 func (h *Handler) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -168,16 +360,8 @@ func (h *Handler) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Clear the auth cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "authToken",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   r.TLS != nil,
-		SameSite: http.SameSiteStrictMode,
-		MaxAge:   -1, // Delete the cookie
-	})
+	// Clear the auth cookies, the sessions were deleted with the user
+	session.ClearCookies(w, r)
 
 	utils.WriteJson(w, http.StatusOK, map[string]string{"message": "Account deleted successfully"})
 }
@@ -188,8 +372,8 @@ func (h *Handler) handleExportData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the user ID from the middleware
-	userId, ok := middleware.RequireAuth(w, r)
+	// require a login session, access tokens can't download the whole account
+	userId, ok := middleware.RequireSession(w, r)
 	if !ok {
 		return
 	}
@@ -236,7 +420,7 @@ func (h *Handler) getUserDataExport(userID int) (*types.ExportData, error) {
 	// Get transactions using transaction store
 	var allTransactions []*types.TransactionDTO
 	for _, account := range accounts {
-		transactions, err := h.transactionStore.GetTransactionsDTOByAccountToken(account.Token, nil, nil)
+		transactions, err := h.transactionStore.GetTransactionsDTOByAccountToken(userID, account.Token, nil, nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get transactions for account %s: %v", account.Token, err)
 		}
@@ -244,5 +428,12 @@ func (h *Handler) getUserDataExport(userID int) (*types.ExportData, error) {
 	}
 	result.Transactions = allTransactions
 
+	// Get the audit trail using audit store
+	auditEvents, err := h.auditStore.GetAllEventsByUserId(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %v", err)
+	}
+	result.AuditEvents = auditEvents
+
 	return result, nil
 }
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lucas-remigio/wallet-tracker/service/auth"
+	"github.com/lucas-remigio/wallet-tracker/service/login_guard"
 	"github.com/lucas-remigio/wallet-tracker/types"
 )
 
@@ -111,7 +115,7 @@ func TestRegisterHandler(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			handler := NewHandlerForTesting(tc.store) // Changed this line
+			handler := NewHandlerForTesting(tc.store, &mockSessionStore{}, &mockTwoFactorStore{}, &mockTokenStore{}, &mockMailer{}, newTestLoginGuard(), &mockPasskeyStore{})
 			rr := performRequest(handler.handleRegister, http.MethodPost, "/register", tc.payload)
 			if rr.Code != tc.wantStatus {
 				t.Errorf("expected status %d, got %d", tc.wantStatus, rr.Code)
@@ -151,7 +155,7 @@ func TestLoginHandler(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			handler := NewHandlerForTesting(tc.store)
+			handler := NewHandlerForTesting(tc.store, &mockSessionStore{}, &mockTwoFactorStore{}, &mockTokenStore{}, &mockMailer{}, newTestLoginGuard(), &mockPasskeyStore{})
 			rr := performRequest(handler.handleLogin, http.MethodPost, "/login", tc.payload)
 			if rr.Code != tc.wantStatus {
 				t.Errorf("expected status %d, got %d", tc.wantStatus, rr.Code)
@@ -167,6 +171,335 @@ func TestLoginHandler(t *testing.T) {
 	}
 }
 
+func TestLoginWithTwoFactor(t *testing.T) {
+	handler := NewHandlerForTesting(&mockUserStoreLogin{}, &mockSessionStore{}, &mockTwoFactorStore{enabled: true}, &mockTokenStore{}, &mockMailer{}, newTestLoginGuard(), &mockPasskeyStore{})
+
+	payload := types.LoginUserPayload{Email: "test@mail.pt", Password: "correct_password"}
+	rr := performRequest(handler.handleLogin, http.MethodPost, "/login", payload)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var responseBody map[string]interface{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &responseBody)
+	if _, ok := responseBody["token"]; ok {
+		t.Error("expected no access token before the second factor")
+	}
+	if responseBody["two_factor_required"] != true || responseBody["two_factor_token"] == "" {
+		t.Errorf("expected a two factor challenge, got %v", responseBody)
+	}
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	mailer := &mockMailer{}
+	sessions := &mockSessionStore{}
+	handler := NewHandlerForTesting(&mockUserStoreSuccess{}, sessions, &mockTwoFactorStore{}, &mockTokenStore{}, mailer, newTestLoginGuard(), &mockPasskeyStore{})
+
+	rr := performRequest(handler.handleForgotPassword, http.MethodPost, "/auth/forgot-password", types.EmailPayload{Email: "test@mail.pt"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("expected one email, got %d", len(mailer.sent))
+	}
+
+	token := regexp.MustCompile(`token=([0-9a-f]{64})`).FindStringSubmatch(mailer.sent[0].Body)
+	if token == nil {
+		t.Fatalf("expected a reset link in the email, got %q", mailer.sent[0].Body)
+	}
+
+	payload := types.ResetPasswordPayload{Token: token[1], Password: "NewPassword1!"}
+	rr = performRequest(handler.handleResetPassword, http.MethodPost, "/auth/reset-password", payload)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if len(sessions.revokedUsers) != 1 || sessions.revokedUsers[0] != 1 {
+		t.Errorf("expected the sessions of user 1 to be revoked, got %v", sessions.revokedUsers)
+	}
+
+	// tokens are single use
+	rr = performRequest(handler.handleResetPassword, http.MethodPost, "/auth/reset-password", payload)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d when reusing the token, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	mailer := &mockMailer{}
+	handler := NewHandlerForTesting(&mockUserStore{}, &mockSessionStore{}, &mockTwoFactorStore{}, &mockTokenStore{}, mailer, newTestLoginGuard(), &mockPasskeyStore{})
+
+	rr := performRequest(handler.handleForgotPassword, http.MethodPost, "/auth/forgot-password", types.EmailPayload{Email: "nobody@mail.pt"})
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d so emails can't be enumerated, got %d", http.StatusOK, rr.Code)
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("expected no email, got %d", len(mailer.sent))
+	}
+}
+
+func TestRegisterSendsVerificationEmail(t *testing.T) {
+	mailer := &mockMailer{}
+	tokens := &mockTokenStore{}
+	handler := NewHandlerForTesting(&mockUserStore{}, &mockSessionStore{}, &mockTwoFactorStore{}, tokens, mailer, newTestLoginGuard(), &mockPasskeyStore{})
+
+	payload := types.RegisterUserPayload{FirstName: "John", LastName: "Doe", Email: "john.doe@example.com", Password: "Password1!"}
+	rr := performRequest(handler.handleRegister, http.MethodPost, "/register", payload)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != payload.Email {
+		t.Fatalf("expected a verification email to %s, got %+v", payload.Email, mailer.sent)
+	}
+
+	token := regexp.MustCompile(`token=([0-9a-f]{64})`).FindStringSubmatch(mailer.sent[0].Body)
+	if token == nil {
+		t.Fatalf("expected a verification link in the email, got %q", mailer.sent[0].Body)
+	}
+	rr = performRequest(handler.handleVerifyEmail, http.MethodPost, "/auth/verify-email", types.VerifyEmailPayload{Token: token[1]})
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+// testClock lets the attack sequences skip through backoffs and lockouts
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time          { return c.now }
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLoginGuard() *login_guard.Guard {
+	return login_guard.NewGuard(login_guard.NewMemoryStore())
+}
+
+// failLogins sends wrong passwords, waiting out the backoff between each one like a patient attacker
+func failLogins(t *testing.T, handler *Handler, clock *testClock, email string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		rr := performRequest(handler.handleLogin, http.MethodPost, "/login", types.LoginUserPayload{Email: email, Password: "wrong_password"})
+		if rr.Code == http.StatusTooManyRequests {
+			t.Fatalf("attempt %d was throttled, the backoff should have passed", i+1)
+		}
+		clock.Advance(10 * time.Minute)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	guard := login_guard.NewGuardWithClock(login_guard.NewMemoryStore(), clock.Now)
+	handler := NewHandlerForTesting(&mockUserStoreLogin{}, &mockSessionStore{}, &mockTwoFactorStore{}, &mockTokenStore{}, &mockMailer{}, guard, &mockPasskeyStore{})
+	payload := types.LoginUserPayload{Email: "test@mail.pt", Password: "wrong_password"}
+
+	for i := 0; i < 3; i++ {
+		rr := performRequest(handler.handleLogin, http.MethodPost, "/login", payload)
+		if rr.Code == http.StatusTooManyRequests {
+			t.Fatalf("attempt %d should not be throttled yet", i+1)
+		}
+	}
+
+	// even the right password has to wait for the backoff
+	payload.Password = "correct_password"
+	rr := performRequest(handler.handleLogin, http.MethodPost, "/login", payload)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", rr.Header().Get("Retry-After"))
+	}
+
+	clock.Advance(time.Second)
+	rr = performRequest(handler.handleLogin, http.MethodPost, "/login", payload)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	// the successful login reset the counters, so new failures start from scratch
+	payload.Password = "wrong_password"
+	for i := 0; i < 3; i++ {
+		rr = performRequest(handler.handleLogin, http.MethodPost, "/login", payload)
+		if rr.Code == http.StatusTooManyRequests {
+			t.Fatalf("attempt %d after a successful login should not be throttled", i+1)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	attempts := login_guard.NewMemoryStore()
+	guard := login_guard.NewGuardWithClock(attempts, clock.Now)
+	handler := NewHandlerForTesting(&mockUserStoreLogin{}, &mockSessionStore{}, &mockTwoFactorStore{}, &mockTokenStore{}, &mockMailer{}, guard, &mockPasskeyStore{})
+
+	failLogins(t, handler, clock, "test@mail.pt", login_guard.IdentityPolicy.LockoutAfter-1)
+	rr := performRequest(handler.handleLogin, http.MethodPost, "/login", types.LoginUserPayload{Email: "test@mail.pt", Password: "wrong_password"})
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+	if len(attempts.Lockouts) != 1 || attempts.Lockouts[0].Key != "id:test@mail.pt" {
+		t.Fatalf("expected one lockout for the email, got %v", attempts.Lockouts)
+	}
+
+	// locked even with the right password, and even after the backoff window
+	clock.Advance(10 * time.Minute)
+	correct := types.LoginUserPayload{Email: "TEST@mail.pt", Password: "correct_password"}
+	rr = performRequest(handler.handleLogin, http.MethodPost, "/login", correct)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "300" {
+		t.Errorf("expected Retry-After 300, got %q", rr.Header().Get("Retry-After"))
+	}
+
+	clock.Advance(5 * time.Minute)
+	rr = performRequest(handler.handleLogin, http.MethodPost, "/login", correct)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d after the lockout, got %d", http.StatusOK, rr.Code)
+	}
+	if attempt, _ := attempts.GetAttempt("id:test@mail.pt"); attempt != nil {
+		t.Errorf("expected the counters to be reset, got %+v", attempt)
+	}
+}
+
+func TestTwoFactorChallengeDoesNotResetFailures(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	attempts := login_guard.NewMemoryStore()
+	guard := login_guard.NewGuardWithClock(attempts, clock.Now)
+	handler := NewHandlerForTesting(&mockUserStoreLogin{}, &mockSessionStore{}, &mockTwoFactorStore{enabled: true}, &mockTokenStore{}, &mockMailer{}, guard, &mockPasskeyStore{})
+
+	failLogins(t, handler, clock, "test@mail.pt", 3)
+
+	// the password alone doesn't finish the login, so the failures stay
+	rr := performRequest(handler.handleLogin, http.MethodPost, "/login", types.LoginUserPayload{Email: "test@mail.pt", Password: "correct_password"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if attempt, _ := attempts.GetAttempt("id:test@mail.pt"); attempt == nil || attempt.Failures != 3 {
+		t.Errorf("expected the 3 failures to be kept, got %+v", attempt)
+	}
+}
+
+func TestLoginLockoutDoesNotRevealUsers(t *testing.T) {
+	lockedResponse := func(store types.UserStore, email string) *httptest.ResponseRecorder {
+		clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+		guard := login_guard.NewGuardWithClock(login_guard.NewMemoryStore(), clock.Now)
+		handler := NewHandlerForTesting(store, &mockSessionStore{}, &mockTwoFactorStore{}, &mockTokenStore{}, &mockMailer{}, guard, &mockPasskeyStore{})
+
+		failLogins(t, handler, clock, email, login_guard.IdentityPolicy.LockoutAfter)
+		return performRequest(handler.handleLogin, http.MethodPost, "/login", types.LoginUserPayload{Email: email, Password: "password123"})
+	}
+
+	existing := lockedResponse(&mockUserStoreLogin{}, "test@mail.pt")
+	unknown := lockedResponse(&mockUserStore{}, "nonexistent@mail.pt")
+
+	if existing.Code != http.StatusTooManyRequests || unknown.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected both to be locked, got %d and %d", existing.Code, unknown.Code)
+	}
+	if existing.Body.String() != unknown.Body.String() {
+		t.Errorf("expected identical bodies, got %q and %q", existing.Body.String(), unknown.Body.String())
+	}
+	if existing.Header().Get("Retry-After") != unknown.Header().Get("Retry-After") {
+		t.Errorf("expected identical Retry-After, got %q and %q", existing.Header().Get("Retry-After"), unknown.Header().Get("Retry-After"))
+	}
+}
+
+type mockTwoFactorStore struct {
+	enabled bool
+}
+
+func (m *mockTwoFactorStore) GetStatus(userId int) (*types.TwoFactorStatus, error) {
+	return &types.TwoFactorStatus{Enabled: m.enabled}, nil
+}
+
+func (m *mockTwoFactorStore) IsEnabled(userId int) (bool, error) { return m.enabled, nil }
+
+func (m *mockTwoFactorStore) BeginEnrolment(userId int, accountName string) (*types.TwoFactorSetup, error) {
+	return &types.TwoFactorSetup{}, nil
+}
+
+func (m *mockTwoFactorStore) ConfirmEnrolment(userId int, code string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (m *mockTwoFactorStore) Disable(userId int, code string) error { return nil }
+
+func (m *mockTwoFactorStore) RegenerateRecoveryCodes(userId int, code string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (m *mockTwoFactorStore) VerifyCode(userId int, code string) error { return nil }
+
+func (m *mockTwoFactorStore) StartChallengeAttempt(tokenId string, userId int, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *mockTwoFactorStore) CompleteChallenge(tokenId string) error { return nil }
+
+type mockMailer struct {
+	sent []*types.MailMessage
+}
+
+func (m *mockMailer) Send(message *types.MailMessage) error {
+	m.sent = append(m.sent, message)
+	return nil
+}
+
+// mockTokenStore keeps tokens in memory and enforces single use like the real store
+type mockTokenStore struct {
+	tokens map[string]mockToken
+}
+
+type mockToken struct {
+	userId  int
+	purpose string
+}
+
+func (m *mockTokenStore) CreateToken(userId int, purpose string, ttl time.Duration) (string, error) {
+	if m.tokens == nil {
+		m.tokens = make(map[string]mockToken)
+	}
+	token := strings.Repeat(fmt.Sprintf("%x", len(m.tokens)+1), 64)[:64]
+	m.tokens[token] = mockToken{userId: userId, purpose: purpose}
+	return token, nil
+}
+
+func (m *mockTokenStore) ConsumeToken(token, purpose string) (int, error) {
+	stored, exists := m.tokens[token]
+	if !exists || stored.purpose != purpose {
+		return 0, fmt.Errorf("invalid or expired token")
+	}
+	delete(m.tokens, token)
+	return stored.userId, nil
+}
+
+type mockSessionStore struct {
+	revokedUsers []int
+}
+
+func (m *mockSessionStore) CreateSession(userId int, userAgent, ipAddress string) (*types.Session, string, error) {
+	return &types.Session{ID: "session", UserID: userId}, "refresh", nil
+}
+
+func (m *mockSessionStore) RotateRefreshToken(refreshToken, userAgent, ipAddress string) (*types.Session, string, error) {
+	return nil, "", fmt.Errorf("invalid or expired refresh token")
+}
+
+func (m *mockSessionStore) IsSessionActive(sessionId string, userId int) (bool, error) {
+	return true, nil
+}
+
+func (m *mockSessionStore) GetActiveSessionsByUserId(userId int) ([]*types.Session, error) {
+	return []*types.Session{}, nil
+}
+
+func (m *mockSessionStore) RevokeSession(sessionId string, userId int) error {
+	return nil
+}
+
+func (m *mockSessionStore) RevokeOtherSessions(userId int, keepSessionId string) error {
+	m.revokedUsers = append(m.revokedUsers, userId)
+	return nil
+}
+
 type mockUserStore struct{}
 
 func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
@@ -177,7 +510,7 @@ func (m *mockUserStore) GetUserById(id int) (*types.User, error) {
 	return &types.User{}, nil
 }
 
-func (m *mockUserStore) CreateUser(user *types.User) error {
+func (m *mockUserStore) CreateUser(user *types.User, templateLanguage string) error {
 	return nil
 }
 
@@ -189,13 +522,23 @@ func (m *mockUserStore) DeleteUser(userId int) error {
 	return nil
 }
 
+func (m *mockUserStore) MarkEmailVerified(userId int) error { return nil }
+
+func (m *mockUserStore) UpdatePassword(userId int, hashedPassword string) error { return nil }
+
+func (m *mockUserStore) UpdateProfile(userId int, firstName, lastName string) error { return nil }
+
+func (m *mockUserStore) SetPendingEmail(userId int, email string) error { return nil }
+
+func (m *mockUserStore) ConfirmPendingEmail(userId int) (string, error) { return "", nil }
+
 type mockUserStoreDuplicate struct{}
 
 func (m *mockUserStoreDuplicate) GetUserByEmail(email string) (*types.User, error) {
 	return &types.User{Email: email}, nil // Simulate existing user
 }
 
-func (m *mockUserStoreDuplicate) CreateUser(user *types.User) error {
+func (m *mockUserStoreDuplicate) CreateUser(user *types.User, templateLanguage string) error {
 	return nil
 }
 
@@ -209,13 +552,25 @@ func (m *mockUserStoreDuplicate) DeleteUser(userId int) error {
 	return nil
 }
 
+func (m *mockUserStoreDuplicate) MarkEmailVerified(userId int) error { return nil }
+
+func (m *mockUserStoreDuplicate) UpdatePassword(userId int, hashedPassword string) error { return nil }
+
+func (m *mockUserStoreDuplicate) UpdateProfile(userId int, firstName, lastName string) error {
+	return nil
+}
+
+func (m *mockUserStoreDuplicate) SetPendingEmail(userId int, email string) error { return nil }
+
+func (m *mockUserStoreDuplicate) ConfirmPendingEmail(userId int) (string, error) { return "", nil }
+
 type mockUserStoreError struct{}
 
 func (m *mockUserStoreError) GetUserByEmail(email string) (*types.User, error) {
 	return nil, fmt.Errorf("user already exists")
 }
 
-func (m *mockUserStoreError) CreateUser(user *types.User) error {
+func (m *mockUserStoreError) CreateUser(user *types.User, templateLanguage string) error {
 	return fmt.Errorf("internal server error")
 }
 
@@ -229,6 +584,20 @@ func (m *mockUserStoreError) DeleteUser(userId int) error {
 	return fmt.Errorf("internal server error")
 }
 
+func (m *mockUserStoreError) MarkEmailVerified(userId int) error {
+	return fmt.Errorf("internal server error")
+}
+
+func (m *mockUserStoreError) UpdatePassword(userId int, hashedPassword string) error {
+	return fmt.Errorf("internal server error")
+}
+
+func (m *mockUserStoreError) UpdateProfile(userId int, firstName, lastName string) error { return nil }
+
+func (m *mockUserStoreError) SetPendingEmail(userId int, email string) error { return nil }
+
+func (m *mockUserStoreError) ConfirmPendingEmail(userId int) (string, error) { return "", nil }
+
 type mockUserStoreLogin struct{}
 
 func (m *mockUserStoreLogin) GetUserByEmail(email string) (*types.User, error) {
@@ -240,7 +609,7 @@ func (m *mockUserStoreLogin) GetUserByEmail(email string) (*types.User, error) {
 	}, nil
 }
 
-func (m *mockUserStoreLogin) CreateUser(*types.User) error            { return nil }
+func (m *mockUserStoreLogin) CreateUser(*types.User, string) error    { return nil }
 func (m *mockUserStoreLogin) GetUserById(id int) (*types.User, error) { return &types.User{}, nil }
 func (m *mockUserStoreLogin) ValidatePassword(password string) error  { return nil }
 
@@ -248,6 +617,16 @@ func (m *mockUserStoreLogin) DeleteUser(userId int) error {
 	return nil
 }
 
+func (m *mockUserStoreLogin) MarkEmailVerified(userId int) error { return nil }
+
+func (m *mockUserStoreLogin) UpdatePassword(userId int, hashedPassword string) error { return nil }
+
+func (m *mockUserStoreLogin) UpdateProfile(userId int, firstName, lastName string) error { return nil }
+
+func (m *mockUserStoreLogin) SetPendingEmail(userId int, email string) error { return nil }
+
+func (m *mockUserStoreLogin) ConfirmPendingEmail(userId int) (string, error) { return "", nil }
+
 type mockUserStoreSuccess struct{}
 
 func (m *mockUserStoreSuccess) GetUserByEmail(email string) (*types.User, error) {
@@ -258,7 +637,7 @@ func (m *mockUserStoreSuccess) GetUserByEmail(email string) (*types.User, error)
 		Password: hashedPassword,
 	}, nil
 }
-func (m *mockUserStoreSuccess) CreateUser(*types.User) error {
+func (m *mockUserStoreSuccess) CreateUser(*types.User, string) error {
 	return nil
 }
 
@@ -271,3 +650,15 @@ func (m *mockUserStoreSuccess) ValidatePassword(password string) error { return
 func (m *mockUserStoreSuccess) DeleteUser(userId int) error {
 	return nil
 }
+
+func (m *mockUserStoreSuccess) MarkEmailVerified(userId int) error { return nil }
+
+func (m *mockUserStoreSuccess) UpdatePassword(userId int, hashedPassword string) error { return nil }
+
+func (m *mockUserStoreSuccess) UpdateProfile(userId int, firstName, lastName string) error {
+	return nil
+}
+
+func (m *mockUserStoreSuccess) SetPendingEmail(userId int, email string) error { return nil }
+
+func (m *mockUserStoreSuccess) ConfirmPendingEmail(userId int) (string, error) { return "", nil }
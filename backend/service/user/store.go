@@ -4,10 +4,14 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/lib/pq"
 	"github.com/lucas-remigio/wallet-tracker/db"
+	"github.com/lucas-remigio/wallet-tracker/service/category"
 	"github.com/lucas-remigio/wallet-tracker/types"
 )
 
+var ErrEmailTaken = fmt.Errorf("email is already in use")
+
 type Store struct {
 	db *sql.DB
 }
@@ -18,9 +22,13 @@ func NewStore(db *sql.DB) *Store {
 	}
 }
 
+const userColumns = `
+    id, first_name, last_name, email, password, email_verified_at IS NOT NULL, COALESCE(pending_email, ''), created_at
+`
+
 func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 	user, err := db.QueryFirstFromRows(s.db,
-		"SELECT * FROM users WHERE email = $1",
+		fmt.Sprintf("SELECT %s FROM users WHERE email = $1", userColumns),
 		scanRowIntoUser, email)
 
 	if err != nil {
@@ -37,17 +45,33 @@ func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 	return user, nil
 }
 
-func (s *Store) CreateUser(user *types.User) error {
-	_, err := db.ExecWithValidation(s.db,
-		"INSERT INTO users (first_name, last_name, email, password) VALUES ($1, $2, $3, $4)",
-		user.FirstName, user.LastName, user.Email, user.Password)
+// CreateUser inserts the user and sets its generated ID
+func (s *Store) CreateUser(user *types.User, templateLanguage string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		"INSERT INTO users (first_name, last_name, email, password) VALUES ($1, $2, $3, $4) RETURNING id",
+		user.FirstName, user.LastName, user.Email, user.Password,
+	).Scan(&user.ID)
+	if err != nil {
+		return err
+	}
+
+	// new users can add transactions right away
+	if _, err := category.SeedTemplate(tx, user.ID, category.TemplateSetOrDefault(templateLanguage)); err != nil {
+		return fmt.Errorf("failed to create default categories: %v", err)
+	}
 
-	return err
+	return tx.Commit()
 }
 
 func (s *Store) GetUserById(id int) (*types.User, error) {
 	user, err := db.QueryFirstFromRows(s.db,
-		"SELECT * FROM users WHERE id = $1",
+		fmt.Sprintf("SELECT %s FROM users WHERE id = $1", userColumns),
 		scanRowIntoUser, id)
 
 	if err != nil {
@@ -87,10 +111,79 @@ func (s *Store) DeleteUser(userId int) error {
 	return nil
 }
 
+func (s *Store) MarkEmailVerified(userId int) error {
+	_, err := db.ExecWithValidation(s.db,
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP) WHERE id = $1",
+		userId)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Store) UpdatePassword(userId int, hashedPassword string) error {
+	_, err := db.ExecWithValidation(s.db,
+		"UPDATE users SET password = $1 WHERE id = $2",
+		hashedPassword, userId)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Store) UpdateProfile(userId int, firstName, lastName string) error {
+	_, err := db.ExecWithValidation(s.db,
+		"UPDATE users SET first_name = $1, last_name = $2 WHERE id = $3",
+		firstName, lastName, userId)
+	if err != nil {
+		return fmt.Errorf("failed to update profile: %v", err)
+	}
+
+	return nil
+}
+
+// SetPendingEmail stores the new address until it is confirmed, the current email keeps working
+func (s *Store) SetPendingEmail(userId int, email string) error {
+	_, err := db.ExecWithValidation(s.db,
+		"UPDATE users SET pending_email = $1 WHERE id = $2",
+		email, userId)
+	if err != nil {
+		return fmt.Errorf("failed to set pending email: %v", err)
+	}
+
+	return nil
+}
+
+// ConfirmPendingEmail replaces the email with the pending one and returns the new address
+func (s *Store) ConfirmPendingEmail(userId int) (string, error) {
+	var email string
+	err := s.db.QueryRow(
+		`UPDATE users
+		 SET email = pending_email, pending_email = NULL, email_verified_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND pending_email IS NOT NULL
+		 RETURNING email`,
+		userId,
+	).Scan(&email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("no email change pending")
+		}
+		// another account registered the address in the meantime
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return "", ErrEmailTaken
+		}
+		return "", fmt.Errorf("failed to change email: %v", err)
+	}
+
+	return email, nil
+}
+
 func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 	user := new(types.User)
 
-	err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.CreatedAt)
+	err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.EmailVerified, &user.PendingEmail, &user.CreatedAt)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,84 @@
+package user_token
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/lucas-remigio/wallet-tracker/utils"
+)
+
+const tokenBytes = 32
+
+var ErrInvalidToken = fmt.Errorf("invalid or expired token")
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// CreateToken issues a new token for the purpose and invalidates the previous unused ones,
+// so only the latest email sent to the user works. Only the hash is stored.
+func (s *Store) CreateToken(userId int, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateToken(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userId, purpose)
+	if err != nil {
+		return "", fmt.Errorf("failed to invalidate previous tokens: %w", err)
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userId, purpose, hashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumeToken marks the token as used and returns its user, a token can only be consumed once
+func (s *Store) ConsumeToken(token, purpose string) (int, error) {
+	var userId int
+	err := s.db.QueryRow(
+		`UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		 WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		 RETURNING user_id`,
+		hashToken(token), purpose,
+	).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidToken
+		}
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
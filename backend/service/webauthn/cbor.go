@@ -0,0 +1,145 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxCBORDepth stops maliciously nested input from exhausting the stack
+const maxCBORDepth = 16
+
+var errCBORTruncated = fmt.Errorf("cbor: unexpected end of data")
+
+// decodeCBOR decodes the first CBOR item in data and returns it with the number of
+// bytes it used. Only the subset used by WebAuthn is supported: integers, byte and
+// text strings, arrays, maps and the simple values false, true and null.
+// Integers decode to int64, maps to map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > maxCBORDepth {
+		return nil, 0, fmt.Errorf("cbor: nesting too deep")
+	}
+	if len(data) == 0 {
+		return nil, 0, errCBORTruncated
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, 1, nil
+		case 21:
+			return true, 1, nil
+		case 22:
+			return nil, 1, nil
+		default:
+			return nil, 0, fmt.Errorf("cbor: unsupported simple value %d", info)
+		}
+	}
+
+	argument, offset, err := decodeCBORArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if argument > 1<<63-1 {
+			return nil, 0, fmt.Errorf("cbor: integer overflow")
+		}
+		return int64(argument), offset, nil
+	case 1:
+		if argument > 1<<63-1 {
+			return nil, 0, fmt.Errorf("cbor: integer overflow")
+		}
+		return -1 - int64(argument), offset, nil
+	case 2, 3:
+		if argument > uint64(len(data)-offset) {
+			return nil, 0, errCBORTruncated
+		}
+		end := offset + int(argument)
+		if major == 2 {
+			value := make([]byte, argument)
+			copy(value, data[offset:end])
+			return value, end, nil
+		}
+		return string(data[offset:end]), end, nil
+	case 4:
+		// every item takes at least one byte, so a longer count can't be honest
+		if argument > uint64(len(data)-offset) {
+			return nil, 0, errCBORTruncated
+		}
+		items := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			item, used, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			offset += used
+		}
+		return items, offset, nil
+	case 5:
+		if argument > uint64(len(data)-offset) {
+			return nil, 0, errCBORTruncated
+		}
+		items := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, used, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += used
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+
+			value, used, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += used
+			items[key] = value
+		}
+		return items, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+}
+
+func decodeCBORArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24:
+		if len(data) < 2 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(data[1]), 2, nil
+	case info == 25:
+		if len(data) < 3 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data[1:3])), 3, nil
+	case info == 26:
+		if len(data) < 5 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data[1:5])), 5, nil
+	case info == 27:
+		if len(data) < 9 {
+			return 0, 0, errCBORTruncated
+		}
+		return binary.BigEndian.Uint64(data[1:9]), 9, nil
+	default:
+		// indefinite lengths are not allowed in WebAuthn's canonical CBOR
+		return 0, 0, fmt.Errorf("cbor: unsupported length encoding %d", info)
+	}
+}
@@ -0,0 +1,102 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms accepted for credentials, ES256 is what almost every passkey uses
+const (
+	AlgES256 = -7
+	AlgRS256 = -257
+)
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKeyType  = 1
+	coseKeyAlg   = 3
+	coseEC2Curve = -1
+	coseEC2X     = -2
+	coseEC2Y     = -3
+	coseRSAN     = -1
+	coseRSAE     = -2
+
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+	coseCurveP256  = 1
+)
+
+// publicKey is a parsed COSE credential public key
+type publicKey struct {
+	alg int64
+	ec  *ecdsa.PublicKey
+	rsa *rsa.PublicKey
+}
+
+func parsePublicKey(coseKey []byte) (*publicKey, error) {
+	decoded, used, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, err
+	}
+	if used != len(coseKey) {
+		return nil, fmt.Errorf("unexpected data after the public key")
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("public key is not a COSE key")
+	}
+
+	keyType, _ := key[int64(coseKeyType)].(int64)
+	alg, _ := key[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && alg == AlgES256:
+		curve, _ := key[int64(coseEC2Curve)].(int64)
+		x, _ := key[int64(coseEC2X)].([]byte)
+		y, _ := key[int64(coseEC2Y)].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid P-256 public key")
+		}
+
+		ecKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !ecKey.Curve.IsOnCurve(ecKey.X, ecKey.Y) {
+			return nil, fmt.Errorf("public key is not on the curve")
+		}
+		return &publicKey{alg: alg, ec: ecKey}, nil
+
+	case keyType == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := key[int64(coseRSAN)].([]byte)
+		e, _ := key[int64(coseRSAE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA public key")
+		}
+		return &publicKey{alg: alg, rsa: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported public key type %d with algorithm %d", keyType, alg)
+	}
+}
+
+func (k *publicKey) verify(signed, signature []byte) error {
+	digest := sha256.Sum256(signed)
+
+	switch {
+	case k.ec != nil:
+		if !ecdsa.VerifyASN1(k.ec, digest[:], signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	case k.rsa != nil:
+		if err := rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key")
+	}
+
+	return nil
+}
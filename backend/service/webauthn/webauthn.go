@@ -0,0 +1,236 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrVerification       = errors.New("passkey verification failed")
+	ErrSignCountRollback  = errors.New("passkey sign counter went backwards, the credential may be cloned")
+	ErrUnsupportedFormat  = errors.New("unsupported attestation format")
+	errUserNotPresent     = errors.New("user presence flag not set")
+	errMissingCredentials = errors.New("authenticator data has no attested credential")
+)
+
+// authenticator data flags
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// RelyingParty identifies the site passkeys are bound to. The ID is the domain and
+// the origin the exact scheme, host and port the frontend is served from.
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// Credential is what gets stored after a successful registration
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create. Only the
+// "none" and self-attested "packed" formats are accepted: passkeys sync between
+// devices, so attestation of the authenticator model is not something we rely on.
+func (rp *RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, used, err := decodeCBOR(attestationObject)
+	if err != nil || used != len(attestationObject) {
+		return nil, fmt.Errorf("%w: invalid attestation object", ErrVerification)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid attestation object", ErrVerification)
+	}
+	format, _ := attestation["fmt"].(string)
+	rawAuthData, _ := attestation["authData"].([]byte)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedCredData == 0 || len(authData.credentialID) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, errMissingCredentials)
+	}
+
+	key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return nil, fmt.Errorf("%w: none attestation with a statement", ErrVerification)
+		}
+	case "packed":
+		// self attestation, signed by the credential itself
+		if _, hasCertificates := statement["x5c"]; hasCertificates {
+			return nil, fmt.Errorf("%w: packed attestation with certificates", ErrUnsupportedFormat)
+		}
+		alg, _ := statement["alg"].(int64)
+		signature, _ := statement["sig"].([]byte)
+		if alg != key.alg {
+			return nil, fmt.Errorf("%w: attestation algorithm does not match the key", ErrVerification)
+		}
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		if err := key.verify(append(append([]byte{}, rawAuthData...), clientDataHash[:]...), signature); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get against the stored
+// credential and returns the new sign counter to store
+func (rp *RelyingParty) VerifyAssertion(challenge string, publicKeyCOSE []byte, storedSignCount uint32, clientDataJSON, rawAuthData, signature []byte) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(publicKeyCOSE)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := key.verify(append(append([]byte{}, rawAuthData...), clientDataHash[:]...), signature); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	// authenticators without a counter always send 0, otherwise it must keep increasing
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, ErrSignCountRollback
+	}
+
+	return authData.signCount, nil
+}
+
+// UserVerified tells whether the authenticator verified the user (PIN, biometrics)
+func UserVerified(rawAuthData []byte) bool {
+	return len(rawAuthData) > 32 && rawAuthData[32]&flagUserVerified != 0
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("%w: invalid client data", ErrVerification)
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: unexpected client data type %q", ErrVerification, data.Type)
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	if data.Origin != rp.Origin {
+		return fmt.Errorf("%w: unexpected origin %q", ErrVerification, data.Origin)
+	}
+
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return fmt.Errorf("%w: credential belongs to another site", ErrVerification)
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: %v", ErrVerification, errUserNotPresent)
+	}
+
+	return nil
+}
+
+// parseAuthenticatorData splits rpIdHash (32) | flags (1) | signCount (4) | attested credential data
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrVerification)
+	}
+
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&flagAttestedCredData == 0 {
+		return authData, nil
+	}
+
+	// aaguid (16) | credentialIdLength (2) | credentialId | credentialPublicKey
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrVerification)
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+		return nil, fmt.Errorf("%w: invalid credential id", ErrVerification)
+	}
+	authData.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	_, used, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid credential public key", ErrVerification)
+	}
+	authData.publicKey = rest[:used]
+
+	return authData, nil
+}
+
+// EncodeBase64 and DecodeBase64 use the unpadded base64url encoding of the WebAuthn API
+func EncodeBase64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeBase64(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
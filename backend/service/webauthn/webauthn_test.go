@@ -0,0 +1,150 @@
+package webauthn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lucas-remigio/wallet-tracker/service/webauthn/webauthntest"
+)
+
+var testRP = &RelyingParty{ID: "localhost", Name: "Grao Certo", Origin: "http://localhost:3000"}
+
+func registerTestCredential(t *testing.T, authenticator *webauthntest.Authenticator) *Credential {
+	t.Helper()
+	registration := authenticator.Register("register-challenge", "none")
+	credential, err := testRP.VerifyRegistration("register-challenge", registration.ClientDataJSON, registration.AttestationObject)
+	if err != nil {
+		t.Fatalf("unexpected registration error: %v", err)
+	}
+	return credential
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	for _, format := range []string{"none", "packed"} {
+		t.Run(format, func(t *testing.T) {
+			authenticator := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+			registration := authenticator.Register("challenge", format)
+
+			credential, err := testRP.VerifyRegistration("challenge", registration.ClientDataJSON, registration.AttestationObject)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(credential.ID) != string(authenticator.CredentialID) {
+				t.Error("expected the credential id of the authenticator")
+			}
+			if string(credential.PublicKey) != string(authenticator.PublicKey()) {
+				t.Error("expected the public key of the authenticator")
+			}
+			if credential.SignCount != 1 {
+				t.Errorf("expected sign count 1, got %d", credential.SignCount)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		rpID      string
+		origin    string
+		format    string
+	}{
+		{"other challenge", "another-challenge", "localhost", "http://localhost:3000", "none"},
+		{"other site", "challenge", "evil.example.com", "http://localhost:3000", "none"},
+		{"other origin", "challenge", "localhost", "https://evil.example.com", "none"},
+		{"unsupported format", "challenge", "localhost", "http://localhost:3000", "fido-u2f"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			authenticator := webauthntest.NewAuthenticator(tc.rpID, tc.origin)
+			registration := authenticator.Register(tc.challenge, tc.format)
+
+			if _, err := testRP.VerifyRegistration("challenge", registration.ClientDataJSON, registration.AttestationObject); err == nil {
+				t.Error("expected the registration to be rejected")
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationRejectsAssertionClientData(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+	registration := authenticator.Register("challenge", "none")
+	clientData := authenticator.ClientData("webauthn.get", "challenge", testRP.Origin)
+
+	if _, err := testRP.VerifyRegistration("challenge", clientData, registration.AttestationObject); err == nil {
+		t.Error("expected client data of another ceremony to be rejected")
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+	credential := registerTestCredential(t, authenticator)
+
+	assertion := authenticator.Assert("login-challenge")
+	signCount, err := testRP.VerifyAssertion("login-challenge", credential.PublicKey, credential.SignCount,
+		assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signCount != 2 {
+		t.Errorf("expected sign count 2, got %d", signCount)
+	}
+	if !UserVerified(assertion.AuthenticatorData) {
+		t.Error("expected the user verified flag")
+	}
+
+	// a signature made by another credential must not verify
+	other := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+	forged := other.Assert("login-challenge")
+	_, err = testRP.VerifyAssertion("login-challenge", credential.PublicKey, signCount,
+		forged.ClientDataJSON, forged.AuthenticatorData, forged.Signature)
+	if !errors.Is(err, ErrVerification) {
+		t.Errorf("expected a verification error, got %v", err)
+	}
+}
+
+func TestVerifyAssertionDetectsClonedCredential(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+	credential := registerTestCredential(t, authenticator)
+
+	// the server has already seen signature number 5 from the real authenticator
+	assertion := authenticator.Assert("challenge")
+	_, err := testRP.VerifyAssertion("challenge", credential.PublicKey, 5,
+		assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+	if !errors.Is(err, ErrSignCountRollback) {
+		t.Errorf("expected a sign count rollback, got %v", err)
+	}
+}
+
+func TestVerifyAssertionWithoutCounter(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+	authenticator.CountsSignatures = false
+	credential := registerTestCredential(t, authenticator)
+
+	for i := 0; i < 2; i++ {
+		assertion := authenticator.Assert("challenge")
+		_, err := testRP.VerifyAssertion("challenge", credential.PublicKey, credential.SignCount,
+			assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+		if err != nil {
+			t.Fatalf("expected authenticators without a counter to be accepted, got %v", err)
+		}
+	}
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	inputs := map[string][]byte{
+		"truncated string":    {0x44, 0x01},
+		"huge array":          {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"indefinite length":   {0x5f},
+		"unsupported map key": {0xa1, 0x41, 0x00, 0x01},
+		"empty":               {},
+	}
+
+	for name, input := range inputs {
+		if _, _, err := decodeCBOR(input); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
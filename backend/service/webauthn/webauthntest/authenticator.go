@@ -0,0 +1,147 @@
+// Package webauthntest provides a software authenticator that produces real
+// registration and assertion responses, so passkeys can be tested without hardware.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// Authenticator holds one ES256 credential, like a passkey stored on a device
+type Authenticator struct {
+	RPID         string
+	Origin       string
+	CredentialID []byte
+	SignCount    uint32
+	// CountsSignatures is false for authenticators that always report a zero counter
+	CountsSignatures bool
+
+	key *ecdsa.PrivateKey
+}
+
+func NewAuthenticator(rpID, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+
+	return &Authenticator{
+		RPID:             rpID,
+		Origin:           origin,
+		CredentialID:     credentialID,
+		CountsSignatures: true,
+		key:              key,
+	}
+}
+
+// Registration is the part of a PublicKeyCredential the server verifies on create
+type Registration struct {
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// Assertion is the part of a PublicKeyCredential the server verifies on get
+type Assertion struct {
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+}
+
+// Register answers a registration challenge with the given attestation format,
+// "none" or "packed" (self attestation)
+func (a *Authenticator) Register(challenge, format string) *Registration {
+	clientDataJSON := a.ClientData("webauthn.create", challenge, a.Origin)
+	authData := a.authenticatorData(true)
+
+	statement := Map{}
+	if format == "packed" {
+		statement = Map{{"alg", int64(-7)}, {"sig", a.Sign(authData, clientDataJSON)}}
+	}
+
+	return &Registration{
+		ClientDataJSON:    clientDataJSON,
+		AttestationObject: EncodeCBOR(Map{{"fmt", format}, {"attStmt", statement}, {"authData", authData}}),
+	}
+}
+
+// Assert answers an authentication challenge, incrementing the sign counter
+func (a *Authenticator) Assert(challenge string) *Assertion {
+	clientDataJSON := a.ClientData("webauthn.get", challenge, a.Origin)
+	authData := a.authenticatorData(false)
+
+	return &Assertion{
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         a.Sign(authData, clientDataJSON),
+	}
+}
+
+// ClientData builds the JSON the browser signs over, tests can pass a wrong type or origin
+func (a *Authenticator) ClientData(ceremony, challenge, origin string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// Sign signs authenticator data and the client data hash like an assertion signature
+func (a *Authenticator) Sign(authData, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signature
+}
+
+// PublicKey is the COSE encoding of the credential public key
+func (a *Authenticator) PublicKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+
+	return EncodeCBOR(Map{{int64(1), int64(2)}, {int64(3), int64(-7)}, {int64(-1), int64(1)}, {int64(-2), x}, {int64(-3), y}})
+}
+
+func (a *Authenticator) authenticatorData(withCredential bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append([]byte{}, rpIDHash[:]...)
+
+	// user present and user verified
+	flags := byte(0x01 | 0x04)
+	if withCredential {
+		flags |= 0x40
+	}
+	data = append(data, flags)
+
+	if a.CountsSignatures {
+		a.SignCount++
+	}
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+
+	if withCredential {
+		data = append(data, make([]byte, 16)...) // aaguid
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.CredentialID)))
+		data = append(data, a.CredentialID...)
+		data = append(data, a.PublicKey()...)
+	}
+
+	return data
+}
+
+// Base64 encodes like the browser does for the JSON sent to the server
+func Base64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,64 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Map is a CBOR map that keeps its key order, so encoded fixtures are deterministic
+type Map []struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// EncodeCBOR encodes int64, []byte, string, bool, Map and []interface{} values
+func EncodeCBOR(value interface{}) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v >= 0 {
+			return cborHeader(0, uint64(v))
+		}
+		return cborHeader(1, uint64(-1-v))
+	case int:
+		return EncodeCBOR(int64(v))
+	case []byte:
+		return append(cborHeader(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHeader(3, uint64(len(v))), v...)
+	case []interface{}:
+		data := cborHeader(4, uint64(len(v)))
+		for _, item := range v {
+			data = append(data, EncodeCBOR(item)...)
+		}
+		return data
+	case Map:
+		data := cborHeader(5, uint64(len(v)))
+		for _, entry := range v {
+			data = append(data, EncodeCBOR(entry.Key)...)
+			data = append(data, EncodeCBOR(entry.Value)...)
+		}
+		return data
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	default:
+		panic(fmt.Sprintf("webauthntest: can't encode %T", value))
+	}
+}
+
+func cborHeader(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument <= 0xff:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(argument))
+	case argument <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(argument))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, argument)
+	}
+}
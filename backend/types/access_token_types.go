@@ -0,0 +1,46 @@
+package types
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart from JWTs
+const AccessTokenPrefix = "wt_"
+
+// Scopes a personal access token can be granted. Reading needs the read scope, the write
+// scopes don't include it.
+const (
+	ScopeRead              = "read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeAccountsWrite     = "accounts:write"
+)
+
+var AccessTokenScopes = []string{ScopeRead, ScopeTransactionsWrite, ScopeAccountsWrite}
+
+type AccessTokenStore interface {
+	CreateToken(userId int, payload *CreateAccessTokenPayload) (*AccessToken, string, error)
+	GetTokensByUserId(userId int) ([]*AccessToken, error)
+	RevokeToken(tokenId int, userId int) error
+	Authenticate(token string) (*AccessToken, error)
+}
+
+type CreateAccessTokenPayload struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=read transactions:write accounts:write"`
+	// omitted means the token never expires
+	ExpiresInDays int `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+// AccessToken is a personal access token used by scripts instead of a login session
+type AccessToken struct {
+	ID         int      `json:"id"`
+	UserID     int      `json:"-"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	ExpiresAt  *string  `json:"expires_at"`
+}
+
+// CreatedAccessToken carries the plain token, which is only returned once
+type CreatedAccessToken struct {
+	AccessToken
+	Token string `json:"token"`
+}
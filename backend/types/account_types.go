@@ -3,12 +3,16 @@ package types
 type AccountStore interface {
 	GetAccountsByUserId(userId int) ([]*Account, error)
 	GetAccountByToken(token string, userId int) (*Account, error)
-	CreateAccount(account *Account) (*Account, error)
-	UpdateAccount(account *Account, userId int) (*Account, error)
-	DeleteAccount(token string, userId int) error
+	// the changes are audited in the same database transaction, from origin
+	CreateAccount(account *Account, origin *AuditOrigin) (*Account, error)
+	UpdateAccount(account *Account, userId int, origin *AuditOrigin) (*Account, error)
+	// DeleteAccount moves the account to the trash with its transactions
+	DeleteAccount(token string, userId int, origin *AuditOrigin) error
+	RestoreAccount(token string, userId int, origin *AuditOrigin) (*Account, error)
+	GetTrashedAccountsByUserId(userId int) ([]*Account, error)
 	GetAccountFeedbackMonthly(userId int, accountToken, language string, month, year int) (*MonthlyFeedback, error)
-	ReorderAccounts(userId int, accounts []ReorderAccount) error
-	FavoriteAccount(token string, userId int, isFavorite bool) error
+	ReorderAccounts(userId int, accounts []ReorderAccount, origin *AuditOrigin) error
+	FavoriteAccount(token string, userId int, isFavorite bool, origin *AuditOrigin) error
 }
 
 type CreateAccountPayload struct {
@@ -34,6 +38,8 @@ type FavoriteAccountPayload struct {
 	IsFavorite bool `json:"is_favorite"`
 }
 
+// Account is seen through the membership of the requesting user, OrderIndex,
+// IsFavorite and Role are theirs. UserID is the user that created the account.
 type Account struct {
 	ID          int     `json:"id"`
 	Token       string  `json:"token"`
@@ -43,4 +49,6 @@ type Account struct {
 	CreatedAt   string  `json:"created_at"`
 	OrderIndex  int     `json:"order_index"`
 	IsFavorite  bool    `json:"is_favorite"`
+	Role        string  `json:"role"`
+	DeletedAt   *string `json:"deleted_at,omitempty"` // set while the account is in the trash
 }
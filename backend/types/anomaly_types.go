@@ -0,0 +1,39 @@
+package types
+
+type AnomalyStore interface {
+	DetectAnomalies(userId int, accountToken string, month, year *int) (*AnomalyReport, error)
+}
+
+// Kinds of anomalies reported by the detector
+const (
+	AnomalyLargeTransaction = "large_transaction"
+	AnomalyCategorySpike    = "category_spike"
+	AnomalyDuplicateCharge  = "duplicate_charge"
+	AnomalyMissingIncome    = "missing_income"
+)
+
+const (
+	AnomalySeverityLow    = "low"
+	AnomalySeverityMedium = "medium"
+	AnomalySeverityHigh   = "high"
+)
+
+type Anomaly struct {
+	Type           string  `json:"type"`
+	Severity       string  `json:"severity"`
+	Category       string  `json:"category"`
+	Description    string  `json:"description,omitempty"`
+	Amount         float64 `json:"amount"`
+	Expected       float64 `json:"expected"`
+	Score          float64 `json:"score"`
+	Date           string  `json:"date,omitempty"`
+	TransactionIDs []int   `json:"transaction_ids"`
+	Explanation    string  `json:"explanation"`
+}
+
+type AnomalyReport struct {
+	AccountToken string     `json:"account_token"`
+	Month        int        `json:"month"`
+	Year         int        `json:"year"`
+	Anomalies    []*Anomaly `json:"anomalies"`
+}
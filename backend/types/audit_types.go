@@ -0,0 +1,61 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Kinds of data the audit trail follows
+const (
+	AuditEntityAccount     = "account"
+	AuditEntityTransaction = "transaction"
+	AuditEntityCategory    = "category"
+	AuditEntitySettings    = "settings"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+)
+
+// AuditStore reads the trail. Events are only appended, by the stores that make the changes,
+// and never changed once recorded.
+type AuditStore interface {
+	// GetEventsByUserId pages from the newest event, beforeId is the oldest id of the previous page
+	GetEventsByUserId(userId int, limit int, beforeId int64) ([]*AuditEvent, error)
+	GetAllEventsByUserId(userId int) ([]*AuditEvent, error)
+}
+
+// AuditOrigin is where the request that made a change came from
+type AuditOrigin struct {
+	IPAddress string
+	UserAgent string
+}
+
+// AuditChange is what a store knows about a change, the origin fills in the rest of the event
+type AuditChange struct {
+	UserID       int
+	AccountToken string
+	EntityType   string
+	EntityID     string
+	Action       string
+	Before       interface{}
+	After        interface{}
+}
+
+// AuditEvent is one recorded change, before is empty for creations and after for deletions
+type AuditEvent struct {
+	ID           int64           `json:"id"`
+	UserID       int             `json:"user_id"`
+	AccountToken *string         `json:"account_token,omitempty"`
+	EntityType   string          `json:"entity_type"`
+	EntityID     string          `json:"entity_id"`
+	Action       string          `json:"action"`
+	Before       json.RawMessage `json:"before"`
+	After        json.RawMessage `json:"after"`
+	IPAddress    string          `json:"ip_address"`
+	UserAgent    string          `json:"user_agent"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
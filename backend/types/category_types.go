@@ -1,38 +1,79 @@
 package types
 
 type CategoryStore interface {
-	CreateCategory(category *Category) (*Category, error)
-	CreateCategoryAndReturn(category *Category) (*CategoryDTO, error)
-	UpdateCategory(category *Category, userId int) (*Category, error)
-	UpdateCategoryAndReturn(category *Category, userId int) (*CategoryDTO, error)
+	// the changes are audited in the same database transaction, from origin
+	CreateCategoryAndReturn(category *Category, origin *AuditOrigin) (*CategoryDTO, error)
+	UpdateCategoryAndReturn(category *Category, userId int, origin *AuditOrigin) (*CategoryDTO, error)
 	GetCategoryById(id int, userId int) (*Category, error)
 	GetCategoriesByUserId(userId int) ([]*Category, error)
 	GetCategoryDtoById(id int, userId int) (*CategoryDTO, error)
 	GetCategoriesDtoByUserId(userId int) ([]*CategoryDTO, error)
-	DeleteCategory(id int, userId int) error
-	SoftDeleteCategory(id int, userId int) error
+	DeleteCategory(id int, userId int, origin *AuditOrigin) error
+	RestoreCategory(id int, userId int, origin *AuditOrigin) (*CategoryDTO, error)
+	GetTrashedCategoriesByUserId(userId int) ([]*CategoryDTO, error)
+	// MergeCategory moves everything of the source category to the target and deletes the source
+	MergeCategory(sourceId int, targetId int, userId int, origin *AuditOrigin) (*CategoryDTO, error)
+	ReorderCategories(userId int, categories []ReorderCategory, origin *AuditOrigin) error
+	// ApplyTemplate adds the categories of the set the user doesn't have yet and returns them
+	ApplyTemplate(userId int, set *CategoryTemplateSet, origin *AuditOrigin) ([]*CategoryDTO, error)
 }
 
 type CreateCategoryPayload struct {
 	TransactionTypeId int    `json:"transaction_type_id" validate:"required,numeric,min=1,max=3"`
 	CategoryName      string `json:"category_name" validate:"required,max=255,min=3"`
 	Color             string `json:"color" validate:"required,hexcolor"`
+	ParentID          *int   `json:"parent_id" validate:"omitempty,min=1"`
+	Icon              string `json:"icon" validate:"max=50"`
 }
 
+// UpdateCategoryPayload replaces the category, without a parent it becomes a top level one
 type UpdateCategoryPayload struct {
 	CategoryName string `json:"category_name" validate:"required,max=255,min=3"`
 	Color        string `json:"color" validate:"required,hexcolor"`
+	ParentID     *int   `json:"parent_id" validate:"omitempty,min=1"`
+	Icon         string `json:"icon" validate:"max=50"`
+}
+
+type MergeCategoryPayload struct {
+	TargetCategoryID int `json:"target_category_id" validate:"required,min=1"`
+}
+
+type ReorderCategoriesPayload struct {
+	Categories []ReorderCategory `json:"categories" validate:"required,dive"`
+}
+
+type ReorderCategory struct {
+	ID         int `json:"id" validate:"required,min=1"`
+	OrderIndex int `json:"order_index" validate:"required,gte=0"`
+}
+
+// CategoryTemplateSet is a versioned list of categories in one language
+type CategoryTemplateSet struct {
+	Language   string             `json:"language"`
+	Version    int                `json:"version"`
+	Categories []CategoryTemplate `json:"categories"`
+}
+
+type CategoryTemplate struct {
+	TransactionTypeID int    `json:"transaction_type_id"`
+	CategoryName      string `json:"category_name"`
+	Color             string `json:"color"`
+	Icon              string `json:"icon"`
 }
 
 type Category struct {
-	ID                int     `json:"id"`
-	UserID            int     `json:"user_id"`
-	TransactionTypeID int     `json:"transaction_type_id"`
-	CategoryName      string  `json:"category_name"`
-	Color             string  `json:"color"`
-	CreatedAt         string  `json:"created_at"`
-	UpdatedAt         string  `json:"updated_at"`
-	DeletedAt         *string `json:"deleted_at,omitempty"` // Nullable field for soft delete
+	ID                int    `json:"id"`
+	UserID            int    `json:"user_id"`
+	TransactionTypeID int    `json:"transaction_type_id"`
+	CategoryName      string `json:"category_name"`
+	Color             string `json:"color"`
+	// ParentID groups the category under another one of the same type, which has no parent itself
+	ParentID   *int    `json:"parent_id"`
+	OrderIndex int     `json:"order_index"`
+	Icon       string  `json:"icon"`
+	CreatedAt  string  `json:"created_at"`
+	UpdatedAt  string  `json:"updated_at"`
+	DeletedAt  *string `json:"deleted_at,omitempty"` // Nullable field for soft delete
 }
 
 type CategoryDTO struct {
@@ -40,6 +81,9 @@ type CategoryDTO struct {
 	TransactionType *TransactionType `json:"transaction_type"`
 	CategoryName    string           `json:"category_name"`
 	Color           string           `json:"color"`
+	ParentID        *int             `json:"parent_id"`
+	OrderIndex      int              `json:"order_index"`
+	Icon            string           `json:"icon"`
 	CreatedAt       string           `json:"created_at"`
 	UpdatedAt       string           `json:"updated_at"`
 	DeletedAt       *string          `json:"deleted_at,omitempty"` // Nullable field for soft delete
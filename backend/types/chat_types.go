@@ -0,0 +1,58 @@
+package types
+
+type ChatStore interface {
+	CreateConversation(userId int, title string) (*ChatConversation, error)
+	GetConversationsByUserId(userId int) ([]*ChatConversation, error)
+	GetConversationById(conversationId, userId int) (*ChatConversation, error)
+	GetConversationMessages(conversationId, userId int) ([]*ChatMessage, error)
+	GetConversationToolCalls(conversationId, userId int) ([]*ChatToolCall, error)
+	DeleteConversation(conversationId, userId int) error
+	SendMessage(conversationId, userId int, content, language string) (*ChatReply, error)
+}
+
+type CreateConversationPayload struct {
+	Title string `json:"title" validate:"max=255"`
+}
+
+type SendChatMessagePayload struct {
+	Message  string `json:"message" validate:"required,min=1,max=2000"`
+	Language string `json:"language" validate:"omitempty,max=20"`
+}
+
+type ChatConversation struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	Title     string `json:"title"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type ChatMessage struct {
+	ID             int        `json:"id"`
+	ConversationID int        `json:"conversation_id"`
+	Role           string     `json:"role"`
+	Content        string     `json:"content"`
+	ToolCalls      []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID     string     `json:"tool_call_id,omitempty"`
+	PromptVersion  string     `json:"prompt_version,omitempty"`
+	CreatedAt      string     `json:"created_at"`
+}
+
+// ChatToolCall is the audit record of a tool executed for the model, it is kept when the
+// conversation is deleted
+type ChatToolCall struct {
+	ID             int     `json:"id"`
+	ConversationID *int    `json:"conversation_id"`
+	UserID         int     `json:"user_id"`
+	ToolName       string  `json:"tool_name"`
+	Arguments      string  `json:"arguments"`
+	Result         *string `json:"result,omitempty"`
+	Error          *string `json:"error,omitempty"`
+	DurationMs     int     `json:"duration_ms"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+type ChatReply struct {
+	Message   *ChatMessage    `json:"message"`
+	ToolCalls []*ChatToolCall `json:"tool_calls"`
+}
@@ -0,0 +1,79 @@
+package types
+
+// GoalStore reads goals with their progress, projected from the net contributions of the
+// last lookbackMonths months
+type GoalStore interface {
+	GetGoalsByUserId(userId int, lookbackMonths int) ([]*Goal, error)
+	GetGoalById(id int, userId int, lookbackMonths int) (*Goal, error)
+	CreateGoal(goal *Goal) (*Goal, error)
+	UpdateGoal(goal *Goal) (*Goal, error)
+	DeleteGoal(id int, userId int) error
+	GetContributions(goalId int, userId int) ([]*GoalContribution, error)
+	AddContribution(userId int, contribution *GoalContribution) (*GoalContribution, error)
+	DeleteContribution(goalId int, contributionId int, userId int) error
+}
+
+type CreateGoalPayload struct {
+	Name             string  `json:"name" validate:"required,min=1,max=100"`
+	TargetAmount     float64 `json:"target_amount" validate:"required,gt=0,lt=100000000"`
+	TargetDate       string  `json:"target_date" validate:"required,datetime=2006-01-02"`
+	AccountToken     *string `json:"account_token" validate:"omitempty,max=255"`
+	AnnualReturnRate float64 `json:"annual_return_rate" validate:"gte=0,lte=1"`
+}
+
+// UpdateGoalPayload replaces the goal, without an account it goes back to manual contributions
+type UpdateGoalPayload struct {
+	Name             string  `json:"name" validate:"required,min=1,max=100"`
+	TargetAmount     float64 `json:"target_amount" validate:"required,gt=0,lt=100000000"`
+	TargetDate       string  `json:"target_date" validate:"required,datetime=2006-01-02"`
+	AccountToken     *string `json:"account_token" validate:"omitempty,max=255"`
+	AnnualReturnRate float64 `json:"annual_return_rate" validate:"gte=0,lte=1"`
+}
+
+// AddContributionPayload records money put aside for a goal, negative amounts take it out
+type AddContributionPayload struct {
+	Amount float64 `json:"amount" validate:"required,gt=-100000000,lt=100000000"`
+	Date   string  `json:"date" validate:"required,datetime=2006-01-02"`
+	Note   string  `json:"note" validate:"max=255"`
+}
+
+type Goal struct {
+	ID           int     `json:"id"`
+	UserID       int     `json:"user_id"`
+	Name         string  `json:"name"`
+	TargetAmount float64 `json:"target_amount"`
+	TargetDate   string  `json:"target_date"` // Format: YYYY-MM-DD
+	// AccountToken links the goal to an account, its balance is the progress. Without one
+	// the progress is the sum of the contributions the user records
+	AccountToken *string `json:"account_token"`
+	// AnnualReturnRate is the interest the savings earn, 0.03 for 3%
+	AnnualReturnRate float64       `json:"annual_return_rate"`
+	CreatedAt        string        `json:"created_at"`
+	UpdatedAt        string        `json:"updated_at"`
+	Progress         *GoalProgress `json:"progress,omitempty"`
+}
+
+type GoalProgress struct {
+	CurrentAmount   float64 `json:"current_amount"`
+	RemainingAmount float64 `json:"remaining_amount"`
+	Percentage      float64 `json:"percentage"`
+	MonthsRemaining int     `json:"months_remaining"`
+	// RequiredMonthlyContribution reaches the target on the target date, interest included
+	RequiredMonthlyContribution float64 `json:"required_monthly_contribution"`
+	// AverageMonthlyContribution is the net contribution of the last LookbackMonths months
+	AverageMonthlyContribution float64 `json:"average_monthly_contribution"`
+	LookbackMonths             int     `json:"lookback_months"`
+	// ProjectedCompletionDate is when the target is reached at the average contribution,
+	// nil when it never is
+	ProjectedCompletionDate *string `json:"projected_completion_date"` // Format: YYYY-MM-DD
+	OnTrack                 bool    `json:"on_track"`
+}
+
+type GoalContribution struct {
+	ID        int     `json:"id"`
+	GoalID    int     `json:"goal_id"`
+	Amount    float64 `json:"amount"`
+	Date      string  `json:"date"` // Format: YYYY-MM-DD
+	Note      string  `json:"note"`
+	CreatedAt string  `json:"created_at"`
+}
@@ -1,21 +1,131 @@
 package types
 
+import "context"
+
 type InvestmentCalculatorStore interface {
-	CalculateInvestmentYearlyReturn(initialInvestment, monthlyContribution, annualReturnRate float64, investmentDurationYears int) (*InvestmentCalculatorResult, error)
+	// CalculateInvestmentYearlyReturn projects the investment, options is nil for a fixed monthly
+	// contribution compounded monthly
+	CalculateInvestmentYearlyReturn(initialInvestment, monthlyContribution, annualReturnRate float64, investmentDurationYears int, options *InvestmentOptions) (*InvestmentCalculatorResult, error)
+	// SolveInvestment finds the input named by solveFor that makes the investment reach the
+	// target value, the input itself is ignored. The result is the projection with it.
+	SolveInvestment(solveFor string, targetValue, initialInvestment, monthlyContribution, annualReturnRate float64, investmentDurationYears int, options *InvestmentOptions) (*InvestmentCalculatorResult, error)
+	// SimulateInvestment runs Monte Carlo simulations of the investment, it stops with an error
+	// when the context is done first
+	SimulateInvestment(ctx context.Context, simulation *InvestmentSimulationPayload) (*InvestmentSimulationResult, error)
+	// CalculateDrawdown withdraws from the portfolio every year until it runs out
+	CalculateDrawdown(drawdown *DrawdownPayload) (*DrawdownResult, error)
+	// PlanFire sizes the portfolio that covers the annual expenses at the withdrawal rate
+	PlanFire(annualExpenses float64, fire *FirePayload) (*FireResult, error)
 }
 
+// What the investment calculator can solve for instead of projecting the value
+const (
+	SolveForMonthlyContribution = "monthly_contribution"
+	SolveForYears               = "years"
+	SolveForAnnualReturnRate    = "annual_return_rate"
+)
+
+// Compounding frequencies and contribution timings of the investment calculator
+const (
+	CompoundingMonthly   = "monthly"
+	CompoundingQuarterly = "quarterly"
+	CompoundingYearly    = "yearly"
+
+	ContributionTimingStart = "start"
+	ContributionTimingEnd   = "end"
+)
+
+// PortugalCapitalGainsTaxRate is the rate applied when the tax is on and no rate is given
+const PortugalCapitalGainsTaxRate = 0.28
+
 type InvestmentCalculatorPayload struct {
 	InitialInvestment       float64 `json:"initial_investment" validate:"gte=0,lte=100000"`
-	MonthlyContribution     float64 `json:"monthly_contribution" validate:"required,gt=0,lte=10000"`
-	AnnualReturnRate        float64 `json:"annual_return_rate" validate:"required,gte=0,lte=1"`
-	InvestmentDurationYears int     `json:"investment_duration_years" validate:"required,gt=0,lte=100"`
+	MonthlyContribution     float64 `json:"monthly_contribution" validate:"required_unless=SolveFor monthly_contribution,gte=0,lte=10000"`
+	AnnualReturnRate        float64 `json:"annual_return_rate" validate:"required_unless=SolveFor annual_return_rate,gte=0,lte=1"`
+	InvestmentDurationYears int     `json:"investment_duration_years" validate:"required_unless=SolveFor years,gte=0,lte=100"`
+
+	// SolveFor turns the calculator around, it finds the input that reaches TargetValue and
+	// that input can be left out
+	SolveFor    string  `json:"solve_for" validate:"omitempty,oneof=monthly_contribution years annual_return_rate"`
+	TargetValue float64 `json:"target_value" validate:"required_with=SolveFor,gte=0,lte=1000000000"`
+
+	// The options below are all optional, without them the contribution is fixed, made at the
+	// end of each month and compounded monthly with no fees or taxes
+	AnnualInflationRate    float64 `json:"annual_inflation_rate" validate:"gte=0,lte=1"`
+	ContributionGrowthRate float64 `json:"contribution_growth_rate" validate:"gte=0,lte=1"`
+	CompoundingFrequency   string  `json:"compounding_frequency" validate:"omitempty,oneof=monthly quarterly yearly"`
+	ContributionTiming     string  `json:"contribution_timing" validate:"omitempty,oneof=start end"`
+	AnnualFeeRate          float64 `json:"annual_fee_rate" validate:"gte=0,lte=0.1"`
+	// ApplyCapitalGainsTax taxes the final gain at CapitalGainsTaxRate, Portugal's 28% when not given
+	ApplyCapitalGainsTax bool     `json:"apply_capital_gains_tax"`
+	CapitalGainsTaxRate  *float64 `json:"capital_gains_tax_rate" validate:"omitempty,gte=0,lte=1"`
+}
+
+// Options returns the optional inputs of the payload with the defaults filled in
+func (p *InvestmentCalculatorPayload) Options() *InvestmentOptions {
+	options := &InvestmentOptions{
+		AnnualInflationRate:    p.AnnualInflationRate,
+		ContributionGrowthRate: p.ContributionGrowthRate,
+		CompoundingFrequency:   p.CompoundingFrequency,
+		ContributionTiming:     p.ContributionTiming,
+		AnnualFeeRate:          p.AnnualFeeRate,
+	}
+	if options.CompoundingFrequency == "" {
+		options.CompoundingFrequency = CompoundingMonthly
+	}
+	if options.ContributionTiming == "" {
+		options.ContributionTiming = ContributionTimingEnd
+	}
+	if p.ApplyCapitalGainsTax {
+		options.CapitalGainsTaxRate = PortugalCapitalGainsTaxRate
+		if p.CapitalGainsTaxRate != nil {
+			options.CapitalGainsTaxRate = *p.CapitalGainsTaxRate
+		}
+	}
+	return options
+}
+
+type InvestmentOptions struct {
+	AnnualInflationRate float64
+	// ContributionGrowthRate raises the monthly contribution every year, 0.02 for 2%
+	ContributionGrowthRate float64
+	CompoundingFrequency   string
+	ContributionTiming     string
+	// AnnualFeeRate is taken from the value every compounding period, like a fund's TER
+	AnnualFeeRate       float64
+	CapitalGainsTaxRate float64
+}
+
+// IsDefault reports whether the options change nothing, so the closed-form formulas apply
+func (o *InvestmentOptions) IsDefault() bool {
+	return o == nil || (o.AnnualInflationRate == 0 &&
+		o.ContributionGrowthRate == 0 &&
+		(o.CompoundingFrequency == "" || o.CompoundingFrequency == CompoundingMonthly) &&
+		(o.ContributionTiming == "" || o.ContributionTiming == ContributionTimingEnd) &&
+		o.AnnualFeeRate == 0 &&
+		o.CapitalGainsTaxRate == 0)
 }
 
 type InvestmentCalculatorResult struct {
-	TotalInvestment float64           `json:"total_investment"`
-	TotalReturn     float64           `json:"total_return"`
-	TotalValue      float64           `json:"total_value"`
-	YearlyBreakdown []YearlyBreakdown `json:"yearly_breakdown"`
+	TotalInvestment float64 `json:"total_investment"`
+	TotalReturn     float64 `json:"total_return"`
+	TotalValue      float64 `json:"total_value"`
+	// Set when the options are used. NetValue is the value after the capital gains tax and
+	// RealNetValue is that in today's money
+	TotalFees       float64             `json:"total_fees,omitempty"`
+	CapitalGainsTax float64             `json:"capital_gains_tax,omitempty"`
+	NetValue        float64             `json:"net_value,omitempty"`
+	RealNetValue    float64             `json:"real_net_value,omitempty"`
+	Solution        *InvestmentSolution `json:"solution,omitempty"`
+	YearlyBreakdown []YearlyBreakdown   `json:"yearly_breakdown"`
+}
+
+// InvestmentSolution is the input a solve mode found. Years are fractional when solved with the
+// closed-form formula and whole years when the options need the simulation
+type InvestmentSolution struct {
+	SolveFor    string  `json:"solve_for"`
+	Value       float64 `json:"value"`
+	TargetValue float64 `json:"target_value"`
 }
 
 type YearlyBreakdown struct {
@@ -23,4 +133,114 @@ type YearlyBreakdown struct {
 	TotalInvestment float64 `json:"total_investment"`
 	TotalReturn     float64 `json:"total_return"`
 	TotalValue      float64 `json:"total_value"`
+	// RealTotalValue is the value in today's money, set when the options are used
+	RealTotalValue float64 `json:"real_total_value,omitempty"`
+	TotalFees      float64 `json:"total_fees,omitempty"`
+}
+
+// Return models of the Monte Carlo simulation, a normal distribution around the expected return
+// or years drawn from the embedded historical returns
+const (
+	ReturnModelNormal     = "normal"
+	ReturnModelHistorical = "historical"
+)
+
+// InvestmentSimulationPayload runs the same seed to the same result, without one a seed is
+// picked and returned
+type InvestmentSimulationPayload struct {
+	InitialInvestment       float64 `json:"initial_investment" validate:"gte=0,lte=100000"`
+	MonthlyContribution     float64 `json:"monthly_contribution" validate:"gte=0,lte=10000"`
+	InvestmentDurationYears int     `json:"investment_duration_years" validate:"required,gt=0,lte=100"`
+	ReturnModel             string  `json:"return_model" validate:"omitempty,oneof=normal historical"`
+	// ExpectedReturn and Volatility are the mean and standard deviation of the yearly return,
+	// only used by the normal model
+	ExpectedReturn float64 `json:"expected_return" validate:"gte=-1,lte=1"`
+	Volatility     float64 `json:"volatility" validate:"gte=0,lte=1"`
+	Simulations    int     `json:"simulations" validate:"omitempty,min=1,max=10000"`
+	Seed           *int64  `json:"seed"`
+	TargetValue    float64 `json:"target_value" validate:"gte=0,lte=1000000000"`
+}
+
+type InvestmentSimulationResult struct {
+	Seed            int64   `json:"seed"`
+	Simulations     int     `json:"simulations"`
+	ReturnModel     string  `json:"return_model"`
+	TotalInvestment float64 `json:"total_investment"`
+	// ProbabilityOfReachingTarget is the share of simulations that end at or above the target
+	ProbabilityOfReachingTarget *float64            `json:"probability_of_reaching_target,omitempty"`
+	YearlyPercentiles           []YearlyPercentiles `json:"yearly_percentiles"`
+}
+
+// YearlyPercentiles are the values at the end of the year that 10%, 50% and 90% of the
+// simulations stay below
+type YearlyPercentiles struct {
+	Year            int     `json:"year"`
+	TotalInvestment float64 `json:"total_investment"`
+	P10             float64 `json:"p10"`
+	P50             float64 `json:"p50"`
+	P90             float64 `json:"p90"`
+}
+
+// Withdrawal strategies of the drawdown, the same amount every year, that amount growing with
+// inflation, or a share of what is left at the start of each year
+const (
+	WithdrawalFixed             = "fixed"
+	WithdrawalInflationAdjusted = "inflation_adjusted"
+	WithdrawalPercentage        = "percentage"
+)
+
+// DefaultFireWithdrawalRate is the 4% rule, the portfolio is 25 times the annual expenses
+const DefaultFireWithdrawalRate = 0.04
+
+type DrawdownPayload struct {
+	StartingPortfolio  float64 `json:"starting_portfolio" validate:"required,gt=0,lte=1000000000"`
+	WithdrawalStrategy string  `json:"withdrawal_strategy" validate:"required,oneof=fixed inflation_adjusted percentage"`
+	// AnnualWithdrawal is the first year's withdrawal of the fixed and inflation adjusted strategies
+	AnnualWithdrawal float64 `json:"annual_withdrawal" validate:"required_unless=WithdrawalStrategy percentage,gte=0,lte=100000000"`
+	// WithdrawalRate is the share taken every year by the percentage strategy, 0.04 for 4%
+	WithdrawalRate      float64 `json:"withdrawal_rate" validate:"required_if=WithdrawalStrategy percentage,gte=0,lte=1"`
+	AnnualReturnRate    float64 `json:"annual_return_rate" validate:"gte=0,lte=1"`
+	AnnualInflationRate float64 `json:"annual_inflation_rate" validate:"gte=0,lte=1"`
+	// MaxYears is how long the drawdown is followed, 60 years when not given
+	MaxYears int `json:"max_years" validate:"omitempty,min=1,max=100"`
+}
+
+type DrawdownResult struct {
+	// YearsLasted counts the years the whole withdrawal was paid
+	YearsLasted     int            `json:"years_lasted"`
+	Depleted        bool           `json:"depleted"`
+	FinalPortfolio  float64        `json:"final_portfolio"`
+	TotalWithdrawn  float64        `json:"total_withdrawn"`
+	YearlyBreakdown []DrawdownYear `json:"yearly_breakdown"`
+}
+
+// DrawdownYear takes the withdrawal at the start of the year and the return on what is left
+type DrawdownYear struct {
+	Year         int     `json:"year"`
+	StartValue   float64 `json:"start_value"`
+	Withdrawal   float64 `json:"withdrawal"`
+	Return       float64 `json:"return"`
+	EndValue     float64 `json:"end_value"`
+	RealEndValue float64 `json:"real_end_value"`
+}
+
+// FirePayload plans financial independence from the user's own expenses. With a monthly
+// contribution it also works out how long saving up takes.
+type FirePayload struct {
+	LookbackMonths      int     `json:"lookback_months" validate:"omitempty,min=1,max=120"`
+	WithdrawalRate      float64 `json:"withdrawal_rate" validate:"omitempty,gt=0,lte=0.2"`
+	CurrentPortfolio    float64 `json:"current_portfolio" validate:"gte=0,lte=1000000000"`
+	MonthlyContribution float64 `json:"monthly_contribution" validate:"gte=0,lte=1000000"`
+	AnnualReturnRate    float64 `json:"annual_return_rate" validate:"gte=0,lte=1"`
+}
+
+type FireResult struct {
+	AnnualExpenses     float64 `json:"annual_expenses"`
+	LookbackMonths     int     `json:"lookback_months"`
+	WithdrawalRate     float64 `json:"withdrawal_rate"`
+	TargetPortfolio    float64 `json:"target_portfolio"`
+	CurrentPortfolio   float64 `json:"current_portfolio"`
+	ProgressPercentage float64 `json:"progress_percentage"`
+	// YearsToTarget is nil without a contribution or when the target is out of reach
+	YearsToTarget *float64 `json:"years_to_target"`
 }
@@ -0,0 +1,42 @@
+package types
+
+import "time"
+
+// LoginGuard tracks failed logins per identity (usually the email) and per IP
+type LoginGuard interface {
+	// Attempt counts the attempt as a failure up front and returns how long to wait when it
+	// isn't allowed
+	Attempt(identity, ipAddress string) (time.Duration, error)
+	// Release takes back the attempt once the credentials turn out right
+	Release(identity, ipAddress string) error
+	// RecordSuccess resets the identity once the login is complete
+	RecordSuccess(identity string) error
+}
+
+type LoginAttemptStore interface {
+	GetAttempt(key string) (*LoginAttempt, error)
+	// IncrementFailures adds a failure in one step, starting over when the last failure is
+	// older than staleBefore and the key isn't locked, and returns the updated attempt
+	IncrementFailures(key string, now, staleBefore time.Time) (*LoginAttempt, error)
+	// LockUntil never shortens a lock that is already longer
+	LockUntil(key string, lockedUntil time.Time) error
+	// DecrementFailures takes back one failure, it never goes below zero
+	DecrementFailures(key string) error
+	DeleteAttempts(keys ...string) error
+	RecordLockout(lockout *LoginLockout) error
+}
+
+type LoginAttempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// LoginLockout is the audit record written every time a key gets locked
+type LoginLockout struct {
+	Key         string
+	Failures    int
+	IPAddress   string
+	LockedUntil time.Time
+}
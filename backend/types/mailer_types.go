@@ -0,0 +1,11 @@
+package types
+
+type Mailer interface {
+	Send(message *MailMessage) error
+}
+
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
@@ -0,0 +1,75 @@
+package types
+
+import "time"
+
+// Roles of an account member, each one includes the permissions of the ones below it
+const (
+	AccountRoleOwner  = "owner"  // manages the account, its members and invitations
+	AccountRoleEditor = "editor" // records, edits and deletes transactions
+	AccountRoleViewer = "viewer" // only reads
+)
+
+var accountRoleRank = map[string]int{
+	AccountRoleViewer: 1,
+	AccountRoleEditor: 2,
+	AccountRoleOwner:  3,
+}
+
+// AccountRoleAtLeast reports whether role grants everything the required role does
+func AccountRoleAtLeast(role, required string) bool {
+	return accountRoleRank[role] >= accountRoleRank[required] && accountRoleRank[role] > 0
+}
+
+// Invitation statuses, only pending invitations can be answered
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusDeclined = "declined"
+	InvitationStatusRevoked  = "revoked"
+)
+
+// MembershipStore methods that act on an account take the acting user first, they fail
+// unless the policy lets that user read or manage the account
+type MembershipStore interface {
+	GetMembers(userId int, accountToken string) ([]*AccountMember, error)
+	UpdateMemberRole(userId int, accountToken string, memberId int, role string) error
+	RemoveMember(userId int, accountToken string, memberId int) error
+	CreateInvitation(userId int, invitation *AccountInvitation) error
+	GetInvitationsByAccount(userId int, accountToken string) ([]*AccountInvitation, error)
+	RevokeInvitation(userId int, accountToken string, invitationId int) error
+	GetPendingInvitationsByEmail(email string) ([]*AccountInvitation, error)
+	GetPendingInvitationById(invitationId int) (*AccountInvitation, error)
+	AcceptInvitation(invitationId int, userId int) error
+	DeclineInvitation(invitationId int) error
+}
+
+type InviteMemberPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Role  string `json:"role" validate:"required,oneof=editor viewer"`
+}
+
+type UpdateMemberRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+type AccountMember struct {
+	UserID    int       `json:"user_id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AccountInvitation struct {
+	ID           int       `json:"id"`
+	AccountToken string    `json:"account_token"`
+	AccountName  string    `json:"account_name"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	InvitedBy    int       `json:"invited_by"`
+	InviterName  string    `json:"inviter_name"`
+	Status       string    `json:"status"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
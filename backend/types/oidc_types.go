@@ -0,0 +1,12 @@
+package types
+
+// OIDCIdentityStore links accounts of external identity providers to users
+type OIDCIdentityStore interface {
+	GetUserIdByIdentity(issuer, subject string) (int, error)
+	LinkIdentity(userId int, issuer, subject, email string) error
+}
+
+type OIDCProvider struct {
+	Name     string `json:"name"`
+	LoginUrl string `json:"login_url"`
+}
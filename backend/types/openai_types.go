@@ -2,6 +2,7 @@ package types
 
 type OpenAIStore interface {
 	GenerateGPT4Response(prompt string) (string, error)
+	GenerateChatCompletion(messages []Message, tools []Tool) (*Message, error)
 }
 
 // GPTRequest represents the structure of the request to OpenAI's GPT-4 API.
@@ -10,12 +11,39 @@ type GPTRequest struct {
 	Messages    []Message `json:"messages"`
 	MaxTokens   int       `json:"max_tokens"`
 	Temperature float64   `json:"temperature"`
+	Tools       []Tool    `json:"tools,omitempty"`
 }
 
 // Message represents a single message in a conversation.
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Tool describes a function the model is allowed to call.
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// ToolCall is a function call requested by the model.
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 // GPTResponse represents the structure of the response from OpenAI's API.
@@ -29,4 +57,5 @@ type GPTResponse struct {
 type MonthlyFeedback struct {
 	FeedbackMessage string `json:"feedback_message"`
 	InDepthAnalysis string `json:"in_depth_analysis"`
+	PromptVersion   string `json:"prompt_version"`
 }
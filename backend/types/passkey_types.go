@@ -0,0 +1,94 @@
+package types
+
+// PasskeyStore keeps WebAuthn credentials and the single-use challenges of the ceremonies
+type PasskeyStore interface {
+	CreateChallenge(userId int, ceremony string) (string, error)
+	ConsumeChallenge(challenge, ceremony string) (int, error)
+	AddPasskey(passkey *Passkey) error
+	GetPasskeysByUserId(userId int) ([]*Passkey, error)
+	GetPasskeyByCredentialId(credentialId string) (*Passkey, error)
+	UpdateSignCount(passkeyId int, signCount uint32) error
+	DeletePasskey(passkeyId int, userId int) error
+}
+
+// Ceremonies a challenge is issued for, a challenge only works for its own ceremony
+const (
+	PasskeyCeremonyRegistration = "registration"
+	PasskeyCeremonyLogin        = "login"
+)
+
+// Passkey is a WebAuthn credential, a user can register one per device
+type Passkey struct {
+	ID           int     `json:"id"`
+	UserID       int     `json:"-"`
+	CredentialID string  `json:"credential_id"`
+	PublicKey    []byte  `json:"-"`
+	SignCount    uint32  `json:"-"`
+	Name         string  `json:"name"`
+	CreatedAt    string  `json:"created_at"`
+	LastUsedAt   *string `json:"last_used_at"`
+}
+
+// Binary fields are base64url encoded, as returned by the browser WebAuthn API
+type FinishPasskeyRegistrationPayload struct {
+	Challenge         string `json:"challenge" validate:"required,max=128"`
+	Name              string `json:"name" validate:"required,max=100"`
+	ClientDataJSON    string `json:"client_data_json" validate:"required"`
+	AttestationObject string `json:"attestation_object" validate:"required"`
+}
+
+type FinishPasskeyLoginPayload struct {
+	Challenge         string `json:"challenge" validate:"required,max=128"`
+	CredentialID      string `json:"credential_id" validate:"required,max=1400"`
+	ClientDataJSON    string `json:"client_data_json" validate:"required"`
+	AuthenticatorData string `json:"authenticator_data" validate:"required"`
+	Signature         string `json:"signature" validate:"required"`
+	UserHandle        string `json:"user_handle"`
+}
+
+// PasskeyRegistrationOptions are passed to navigator.credentials.create
+type PasskeyRegistrationOptions struct {
+	Challenge              string                    `json:"challenge"`
+	RP                     PasskeyRelyingParty       `json:"rp"`
+	User                   PasskeyUser               `json:"user"`
+	PubKeyCredParams       []PasskeyCredentialParam  `json:"pubKeyCredParams"`
+	ExcludeCredentials     []PasskeyCredentialRef    `json:"excludeCredentials"`
+	AuthenticatorSelection PasskeyAuthenticatorRules `json:"authenticatorSelection"`
+	Attestation            string                    `json:"attestation"`
+	Timeout                int                       `json:"timeout"`
+}
+
+// PasskeyLoginOptions are passed to navigator.credentials.get, without allowed
+// credentials so the browser offers every passkey of the site
+type PasskeyLoginOptions struct {
+	Challenge        string `json:"challenge"`
+	RPID             string `json:"rpId"`
+	UserVerification string `json:"userVerification"`
+	Timeout          int    `json:"timeout"`
+}
+
+type PasskeyRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type PasskeyUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type PasskeyCredentialParam struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type PasskeyCredentialRef struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type PasskeyAuthenticatorRules struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
@@ -0,0 +1,31 @@
+package types
+
+import "time"
+
+type QuickEntryStore interface {
+	ProposeTransaction(userId int, text, language string, useAI bool, now time.Time) (*TransactionProposal, error)
+}
+
+type ParseTransactionPayload struct {
+	Text     string `json:"text" validate:"required,min=3,max=500"`
+	UseAI    bool   `json:"use_ai"`
+	Language string `json:"language" validate:"omitempty,max=20"`
+}
+
+// Sources of a transaction proposal
+const (
+	ProposalSourceRules   = "rules"
+	ProposalSourceRulesAI = "rules+ai"
+)
+
+// TransactionProposal is never persisted: the client shows it to the user and,
+// once confirmed, sends the proposal to POST /transactions
+type TransactionProposal struct {
+	Proposal   CreateTransactionPayload `json:"proposal"`
+	Source     string                   `json:"source"`
+	Confidence float64                  `json:"confidence"`
+	Unresolved []string                 `json:"unresolved"`
+	Notes      []string                 `json:"notes"`
+	// Template version of the AI prompt, only set when the AI fallback was used
+	PromptVersion string `json:"prompt_version,omitempty"`
+}
@@ -0,0 +1,32 @@
+package types
+
+type SessionStore interface {
+	CreateSession(userId int, userAgent, ipAddress string) (*Session, string, error)
+	RotateRefreshToken(refreshToken, userAgent, ipAddress string) (*Session, string, error)
+	IsSessionActive(sessionId string, userId int) (bool, error)
+	GetActiveSessionsByUserId(userId int) ([]*Session, error)
+	RevokeSession(sessionId string, userId int) error
+	RevokeOtherSessions(userId int, keepSessionId string) error
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required,len=64,hexadecimal"`
+}
+
+// Session is one logged-in device, identified by its rotating refresh token
+type Session struct {
+	ID         string `json:"id"`
+	UserID     int    `json:"-"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	ExpiresAt  string `json:"expires_at"`
+	Current    bool   `json:"current"`
+}
+
+type AuthTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
@@ -0,0 +1,75 @@
+package types
+
+type SettingsStore interface {
+	GetSettingsByUserId(userId int) (*UserSettings, error)
+	// the change is audited in the same database transaction, from origin
+	UpdateSettings(settings *UserSettings, origin *AuditOrigin) (*UserSettings, error)
+}
+
+// AI privacy modes applied to transaction descriptions before they are sent to the LLM
+const (
+	AIPrivacyModeOff          = "off"
+	AIPrivacyModeRedact       = "redact"
+	AIPrivacyModePseudonymise = "pseudonymise"
+)
+
+// Number formats, named after the thousands and decimal separators
+const (
+	NumberFormatCommaDot   = "comma_dot"   // 1,234.56
+	NumberFormatDotComma   = "dot_comma"   // 1.234,56
+	NumberFormatSpaceComma = "space_comma" // 1 234,56
+)
+
+// UpdateSettingsPayload only changes the settings that are sent
+type UpdateSettingsPayload struct {
+	AIPrivacyMode       *string `json:"ai_privacy_mode" validate:"omitempty,oneof=off redact pseudonymise"`
+	AIAggregatesOnly    *bool   `json:"ai_aggregates_only"`
+	Timezone            *string `json:"timezone" validate:"omitempty,max=64"`
+	Locale              *string `json:"locale" validate:"omitempty,bcp47_language_tag,max=20"`
+	BaseCurrency        *string `json:"base_currency" validate:"omitempty,iso4217"`
+	WeekStart           *int    `json:"week_start" validate:"omitempty,min=0,max=6"`
+	NumberFormat        *string `json:"number_format" validate:"omitempty,oneof=comma_dot dot_comma space_comma"`
+	DefaultAccountToken *string `json:"default_account_token" validate:"omitempty,max=255"`
+	AILanguage          *string `json:"ai_language" validate:"omitempty,max=20"`
+}
+
+type UserSettings struct {
+	UserID           int    `json:"user_id"`
+	AIPrivacyMode    string `json:"ai_privacy_mode"`
+	AIAggregatesOnly bool   `json:"ai_aggregates_only"`
+	// Timezone is an IANA name, months and days are grouped in it
+	Timezone     string `json:"timezone"`
+	Locale       string `json:"locale"`
+	BaseCurrency string `json:"base_currency"`
+	// WeekStart is the first day of the week, 0 is Sunday
+	WeekStart    int    `json:"week_start"`
+	NumberFormat string `json:"number_format"`
+	// DefaultAccountToken is empty when no account is preselected
+	DefaultAccountToken string `json:"default_account_token"`
+	// AILanguage is empty to write AI feedback in the language of the locale
+	AILanguage string `json:"ai_language"`
+	CreatedAt  string `json:"created_at,omitempty"`
+	UpdatedAt  string `json:"updated_at,omitempty"`
+}
+
+// FeedbackLanguage is the language AI answers are written in when the request doesn't pick one
+func (s *UserSettings) FeedbackLanguage() string {
+	if s.AILanguage != "" {
+		return s.AILanguage
+	}
+	return s.Locale
+}
+
+// DefaultUserSettings returns the settings used for users that never saved any
+func DefaultUserSettings(userId int) *UserSettings {
+	return &UserSettings{
+		UserID:           userId,
+		AIPrivacyMode:    AIPrivacyModeOff,
+		AIAggregatesOnly: false,
+		Timezone:         "UTC",
+		Locale:           "en",
+		BaseCurrency:     "EUR",
+		WeekStart:        1,
+		NumberFormat:     NumberFormatCommaDot,
+	}
+}
@@ -3,18 +3,21 @@ package types
 import "time"
 
 type TransactionStore interface {
-	GetTransactionsByAccountToken(accountToken string, month, year *int) ([]*Transaction, error)
-	GetTransactionsDTOByAccountToken(accountToken string, month, year *int) ([]*TransactionDTO, error)
-	GetTransactionDTOById(id int) (*TransactionDTO, error)
-	CreateTransaction(transaction *Transaction, userId int) (*Transaction, error)
-	CreateTransactionAndReturn(transaction *Transaction, userId int) (*TransactionChangeResponse, error)
-	UpdateTransaction(transaction *UpdateTransactionPayload, userId int) (*Transaction, error)
-	UpdateTransactionAndReturn(payload *UpdateTransactionPayload, userId int) (*TransactionChangeResponse, error)
-	DeleteTransaction(transactionId int, userId int) (balance *float64, err error)
-	DeleteTransactionAndReturn(transactionId int, userId int) (*TransactionChangeResponse, error)
-	GetAvailableTransactionMonthsByAccountToken(accountToken string) ([]*MonthYear, error)
+	GetTransactionsByAccountToken(userId int, accountToken string, month, year *int) ([]*Transaction, error)
+	GetTransactionsDTOByAccountToken(userId int, accountToken string, month, year *int) ([]*TransactionDTO, error)
+	GetTransactionDTOById(userId int, id int) (*TransactionDTO, error)
+	// the changes are audited in the same database transaction, from origin
+	CreateTransactionAndReturn(transaction *Transaction, userId int, origin *AuditOrigin) (*TransactionChangeResponse, error)
+	UpdateTransactionAndReturn(payload *UpdateTransactionPayload, userId int, origin *AuditOrigin) (*TransactionChangeResponse, error)
+	DeleteTransactionAndReturn(transactionId int, userId int, origin *AuditOrigin) (*TransactionChangeResponse, error)
+	RestoreTransactionAndReturn(transactionId int, userId int, origin *AuditOrigin) (*TransactionChangeResponse, error)
+	GetTrashedTransactionsByUserId(userId int) ([]*TransactionDTO, error)
+	GetAvailableTransactionMonthsByAccountToken(userId int, accountToken string) ([]*MonthYear, error)
 	CalculateTransactionTotals(transactions []*TransactionDTO) (*TransactionTotals, error)
-	GetTransactionStatistics(accountToken string, month, year *int) (*TransactionStatistics, error)
+	GetTransactionStatistics(userId int, accountToken string, month, year *int) (*TransactionStatistics, error)
+	// GetAverageAnnualExpenses averages the debits of every account the user is a member of
+	// over the last months, or over the time since the first debit when that is shorter
+	GetAverageAnnualExpenses(userId int, months int) (float64, error)
 }
 
 type CreateTransactionPayload struct {
@@ -43,6 +46,8 @@ type Transaction struct {
 	Date         string  `json:"date"`
 	Balance      float64 `json:"balance"`
 	CreatedAt    string  `json:"created_at"`
+	// CreatedBy is the member that recorded the transaction, nil once that user is deleted
+	CreatedBy *int `json:"created_by"`
 }
 
 type TransactionDTO struct {
@@ -53,6 +58,8 @@ type TransactionDTO struct {
 	Date         time.Time    `json:"date"`
 	Balance      float64      `json:"balance"`
 	CreatedAt    time.Time    `json:"created_at"`
+	CreatedBy    *int         `json:"created_by"`
+	DeletedAt    *time.Time   `json:"deleted_at,omitempty"` // set while the transaction is in the trash
 	Category     *CategoryDTO `json:"category,omitempty"`
 }
 
@@ -84,6 +91,8 @@ type CategoryStatistic struct {
 	Total      float64 `json:"total"`
 	Percentage float64 `json:"percentage"`
 	Color      string  `json:"color"`
+	// Subcategories is only set in the rollups, the parent's total includes them
+	Subcategories []*CategoryStatistic `json:"subcategories,omitempty"`
 }
 
 type DailyTotal struct {
@@ -99,6 +108,8 @@ type TransactionStatistics struct {
 	LargestCredit           float64              `json:"largest_credit"`
 	CreditCategoryBreakdown []*CategoryStatistic `json:"credit_category_breakdown"`
 	DebitCategoryBreakdown  []*CategoryStatistic `json:"debit_category_breakdown"`
+	CreditCategoryRollup    []*CategoryStatistic `json:"credit_category_rollup"`
+	DebitCategoryRollup     []*CategoryStatistic `json:"debit_category_rollup"`
 	Totals                  *TransactionTotals   `json:"totals"`
 	DailyTotals             []*DailyTotal        `json:"daily_totals"`
 	StartDate               string               `json:"start_date"` // Format: YYYY-MM-DD
@@ -0,0 +1,23 @@
+package types
+
+import "time"
+
+// TrashStore permanently removes what stayed in the trash for longer than the retention
+type TrashStore interface {
+	PurgeDeletedBefore(cutoff time.Time) (*PurgeResult, error)
+}
+
+// Trash is what the user can still restore. Items are purged RetentionDays after they were
+// deleted, categories only once no transaction uses them.
+type Trash struct {
+	Accounts      []*Account        `json:"accounts"`
+	Transactions  []*TransactionDTO `json:"transactions"`
+	Categories    []*CategoryDTO    `json:"categories"`
+	RetentionDays int               `json:"retention_days"`
+}
+
+type PurgeResult struct {
+	Transactions int64
+	Accounts     int64
+	Categories   int64
+}
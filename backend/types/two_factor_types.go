@@ -0,0 +1,48 @@
+package types
+
+import "time"
+
+type TwoFactorStore interface {
+	GetStatus(userId int) (*TwoFactorStatus, error)
+	IsEnabled(userId int) (bool, error)
+	BeginEnrolment(userId int, accountName string) (*TwoFactorSetup, error)
+	ConfirmEnrolment(userId int, code string) ([]string, error)
+	Disable(userId int, code string) error
+	RegenerateRecoveryCodes(userId int, code string) ([]string, error)
+	VerifyCode(userId int, code string) error
+	// StartChallengeAttempt counts a code tried with an intermediate login token
+	StartChallengeAttempt(tokenId string, userId int, expiresAt time.Time) error
+	// CompleteChallenge uses up the intermediate login token once it earned a session
+	CompleteChallenge(tokenId string) error
+}
+
+type TwoFactorCodePayload struct {
+	Code string `json:"code" validate:"required,min=6,max=11"`
+}
+
+type TwoFactorLoginPayload struct {
+	Token string `json:"token" validate:"required"`
+	Code  string `json:"code" validate:"required,min=6,max=11"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool    `json:"enabled"`
+	EnabledAt         *string `json:"enabled_at"`
+	RecoveryCodesLeft int     `json:"recovery_codes_left"`
+}
+
+// TwoFactorSetup is shown once during enrolment, the client renders the URI as a QR code
+type TwoFactorSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TwoFactorChallenge is returned by /login instead of tokens when the second factor is required
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	TwoFactorToken    string `json:"two_factor_token"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
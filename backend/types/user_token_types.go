@@ -0,0 +1,29 @@
+package types
+
+import "time"
+
+// UserTokenStore issues single-use tokens that are sent to the user by email
+type UserTokenStore interface {
+	CreateToken(userId int, purpose string, ttl time.Duration) (string, error)
+	ConsumeToken(token, purpose string) (int, error)
+}
+
+// Purposes of a user token, a token only works for the purpose it was issued for
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailChange       = "email_change"
+)
+
+type VerifyEmailPayload struct {
+	Token string `json:"token" validate:"required,len=64,hexadecimal"`
+}
+
+type EmailPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,len=64,hexadecimal"`
+	Password string `json:"password" validate:"required,min=8,max=64"`
+}
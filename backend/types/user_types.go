@@ -7,9 +7,15 @@ import (
 type UserStore interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserById(id int) (*User, error)
-	CreateUser(user *User) error
+	// CreateUser creates the user with the categories of the template set in the language
+	CreateUser(user *User, templateLanguage string) error
 	ValidatePassword(password string) error
 	DeleteUser(userId int) error
+	MarkEmailVerified(userId int) error
+	UpdatePassword(userId int, hashedPassword string) error
+	UpdateProfile(userId int, firstName, lastName string) error
+	SetPendingEmail(userId int, email string) error
+	ConfirmPendingEmail(userId int) (string, error)
 }
 
 type RegisterUserPayload struct {
@@ -17,6 +23,8 @@ type RegisterUserPayload struct {
 	LastName  string `json:"last_name" validate:"required,max=32"`
 	Email     string `json:"email" validate:"required,email,max=255"`
 	Password  string `json:"password" validate:"required,min=8,max=64"`
+	// Language picks the categories the user starts with, the default set when empty
+	Language string `json:"language" validate:"omitempty,max=20"`
 }
 
 type LoginUserPayload struct {
@@ -25,12 +33,30 @@ type LoginUserPayload struct {
 }
 
 type User struct {
-	ID        int    `json:"id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-	Password  string `json:"-"`
-	CreatedAt string `json:"created_at"`
+	ID            int    `json:"id"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Email         string `json:"email"`
+	Password      string `json:"-"`
+	EmailVerified bool   `json:"email_verified"`
+	PendingEmail  string `json:"pending_email,omitempty"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type UpdateProfilePayload struct {
+	FirstName string `json:"first_name" validate:"required,max=32"`
+	LastName  string `json:"last_name" validate:"required,max=32"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=64"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=64"`
+}
+
+// ChangeEmailPayload asks for the password so a stolen session can't take over the account
+type ChangeEmailPayload struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,max=64"`
 }
 
 /* ==============================
@@ -42,5 +68,6 @@ type ExportData struct {
 	Accounts     []*Account        `json:"accounts"`
 	Categories   []*CategoryDTO    `json:"categories"`
 	Transactions []*TransactionDTO `json:"transactions"`
+	AuditEvents  []*AuditEvent     `json:"audit_events"`
 	ExportedAt   time.Time         `json:"exported_at"`
 }
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -78,3 +79,19 @@ func Round(val float64, places int) float64 {
 	pow := math.Pow(10, float64(places))
 	return math.Round(val*pow) / pow
 }
+
+// LoadLocation loads an IANA timezone name, an empty name means UTC
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	// "Local" is the server timezone, which is exactly what user timezones replace
+	if name == "Local" {
+		return nil, fmt.Errorf("unknown timezone %s", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %s", name)
+	}
+	return loc, nil
+}
@@ -28,11 +28,44 @@ api_axios.interceptors.request.use((config) => {
 	return config;
 });
 
+// Only one refresh request at a time, concurrent 401s wait for the same one
+let refreshPromise: Promise<string> | null = null;
+
+async function refreshAccessToken(): Promise<string> {
+	if (!refreshPromise) {
+		// The refresh token travels in an HTTP-only cookie
+		refreshPromise = axios
+			.post(`${API_URL}/auth/refresh`, null, { withCredentials: true })
+			.then((response) => {
+				token.set(response.data.token);
+				return response.data.token as string;
+			})
+			.finally(() => {
+				refreshPromise = null;
+			});
+	}
+	return refreshPromise;
+}
+
 // Response Interceptor: Handle errors and token refresh
 api_axios.interceptors.response.use(
 	(response) => response, // Pass through successful responses
 	async (error) => {
-		if (error.response?.status === 401) {
+		const request = error.config;
+		const isAuthRequest = ['login', 'auth/refresh', 'auth/logout'].includes(request?.url);
+
+		if (error.response?.status === 401 && request && !request._retried && !isAuthRequest) {
+			request._retried = true;
+			try {
+				const newToken = await refreshAccessToken();
+				request.headers.Authorization = `Bearer ${newToken}`;
+				return api_axios(request);
+			} catch {
+				// the session is gone, fall through to the login redirect
+			}
+		}
+
+		if (error.response?.status === 401 && !isAuthRequest) {
 			token.set(null);
 			window.location.href = '/login';
 		}
@@ -55,7 +55,15 @@ export function login(newToken: string, email: string) {
 }
 
 // Helper function to clear both token and email when user logs out
-export function logout() {
+export async function logout() {
+	// Revoke the session server side, the local state is cleared even if this fails
+	try {
+		const { default: api_axios } = await import('$lib/axios');
+		await api_axios.post('auth/logout');
+	} catch {
+		// already logged out or offline
+	}
+
 	token.set(null);
 	userEmail.set(null);
 